@@ -0,0 +1,132 @@
+// Copyright (c) 2017-2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/core/blockdag"
+	"strconv"
+	"strings"
+)
+
+// The strategies of the attacker.
+const (
+	// strategyNone makes the attacker mine like the honest miners.
+	strategyNone = "none"
+
+	// strategySelfish withholds the blocks of the attacker and releases
+	// them once the honest miners are about to catch up.
+	strategySelfish = "selfish"
+
+	// strategyParasite mines a private chain only referencing the blocks of
+	// the attacker, which is released once it is long enough.
+	strategyParasite = "parasite"
+)
+
+const (
+	defaultBlocks   = 1000
+	defaultMiners   = 10
+	defaultInterval = 30.0
+	defaultDelay    = 3.0
+	defaultWithhold = 6
+	defaultDAGTypes = "phantom,phantom_v2,conflux,spectre"
+)
+
+type Config struct {
+	Seed      int64
+	Blocks    uint
+	Miners    uint
+	HashRates string
+	Interval  float64
+	Delay     float64
+
+	Attacker float64
+	Strategy string
+	Withhold uint
+
+	DAGTypes string
+
+	// shares are the hashrate shares of the honest miners followed by the
+	// attacker if any, they sum up to 1.
+	shares   []float64
+	dagTypes []string
+}
+
+func (c *Config) load() error {
+	if c.Blocks == 0 {
+		return fmt.Errorf("The number of blocks must be positive")
+	}
+	if c.Interval <= 0 {
+		return fmt.Errorf("The block interval must be positive")
+	}
+	if c.Delay < 0 {
+		return fmt.Errorf("The propagation delay can't be negative")
+	}
+	if c.Attacker < 0 || c.Attacker >= 1 {
+		return fmt.Errorf("The attacker share %v is not in [0, 1)", c.Attacker)
+	}
+	switch c.Strategy {
+	case strategyNone:
+	case strategySelfish, strategyParasite:
+		if c.Attacker == 0 {
+			return fmt.Errorf("The %s strategy requires an attacker share", c.Strategy)
+		}
+		if c.Strategy == strategyParasite && c.Withhold == 0 {
+			return fmt.Errorf("The parasite chain needs to withhold blocks")
+		}
+	default:
+		return fmt.Errorf("Unknown attacker strategy %s", c.Strategy)
+	}
+
+	var rates []float64
+	if len(c.HashRates) > 0 {
+		for _, s := range strings.Split(c.HashRates, ",") {
+			rate, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				return fmt.Errorf("Invalid hashrate %s: %v", s, err)
+			}
+			if rate <= 0 {
+				return fmt.Errorf("The hashrate %v must be positive", rate)
+			}
+			rates = append(rates, rate)
+		}
+	} else {
+		if c.Miners == 0 {
+			return fmt.Errorf("The number of miners must be positive")
+		}
+		for i := uint(0); i < c.Miners; i++ {
+			rates = append(rates, 1)
+		}
+	}
+	total := 0.0
+	for _, rate := range rates {
+		total += rate
+	}
+	c.shares = nil
+	for _, rate := range rates {
+		c.shares = append(c.shares, rate/total*(1-c.Attacker))
+	}
+	if c.Attacker > 0 {
+		c.shares = append(c.shares, c.Attacker)
+	}
+
+	c.dagTypes = nil
+	for _, dagType := range strings.Split(c.DAGTypes, ",") {
+		dagType = strings.TrimSpace(dagType)
+		if blockdag.NewBlockDAG(dagType) == nil {
+			return fmt.Errorf("Unknown DAG type %s", dagType)
+		}
+		c.dagTypes = append(c.dagTypes, dagType)
+	}
+	return nil
+}
+
+// honestMiners returns the number of honest miners.
+func (c *Config) honestMiners() int {
+	if c.Attacker > 0 {
+		return len(c.shares) - 1
+	}
+	return len(c.shares)
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2017-2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/urfave/cli/v2"
+	"os"
+	"time"
+)
+
+func main() {
+	if err := dagSim(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func dagSim() error {
+	cfg := &Config{}
+
+	app := &cli.App{
+		Name:     "DAGSim",
+		Version:  "V0.0.1",
+		Compiled: time.Now(),
+		Authors: []*cli.Author{
+			&cli.Author{
+				Name: "Qitmeer",
+			},
+		},
+		Copyright: "(c) 2020 Qitmeer",
+		Usage:     "Deterministic DAG network simulator",
+		Description: "Mine blocks for miners with propagation delays and an optional attacker, " +
+			"feed them to the DAG algorithms and compare their ordering and coloring",
+		Flags: []cli.Flag{
+			&cli.Int64Flag{
+				Name:        "seed",
+				Aliases:     []string{"s"},
+				Usage:       "Seed of the simulation, the same seed gives the same result",
+				Value:       1,
+				Destination: &cfg.Seed,
+			},
+			&cli.UintFlag{
+				Name:        "blocks",
+				Aliases:     []string{"n"},
+				Usage:       "Number of blocks to mine",
+				Value:       defaultBlocks,
+				Destination: &cfg.Blocks,
+			},
+			&cli.UintFlag{
+				Name:        "miners",
+				Aliases:     []string{"m"},
+				Usage:       "Number of honest miners with the same hashrate",
+				Value:       defaultMiners,
+				Destination: &cfg.Miners,
+			},
+			&cli.StringFlag{
+				Name:        "hashrates",
+				Usage:       "Comma separated hashrates of the honest miners instead of --miners",
+				Destination: &cfg.HashRates,
+			},
+			&cli.Float64Flag{
+				Name:        "interval",
+				Aliases:     []string{"i"},
+				Usage:       "Mean seconds between blocks",
+				Value:       defaultInterval,
+				Destination: &cfg.Interval,
+			},
+			&cli.Float64Flag{
+				Name:        "delay",
+				Aliases:     []string{"d"},
+				Usage:       "Mean seconds for a block to reach another node",
+				Value:       defaultDelay,
+				Destination: &cfg.Delay,
+			},
+			&cli.Float64Flag{
+				Name:        "attacker",
+				Aliases:     []string{"a"},
+				Usage:       "Hashrate share of the attacker",
+				Destination: &cfg.Attacker,
+			},
+			&cli.StringFlag{
+				Name:        "strategy",
+				Usage:       "Attacker strategy {none,selfish,parasite}",
+				Value:       strategyNone,
+				Destination: &cfg.Strategy,
+			},
+			&cli.UintFlag{
+				Name:        "withhold",
+				Usage:       "Number of blocks of the parasite chain before it is released",
+				Value:       defaultWithhold,
+				Destination: &cfg.Withhold,
+			},
+			&cli.StringFlag{
+				Name:        "dagtypes",
+				Aliases:     []string{"G"},
+				Usage:       "Comma separated DAG types to compare {phantom,phantom_v2,conflux,spectre}",
+				Value:       defaultDAGTypes,
+				Destination: &cfg.DAGTypes,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if err := cfg.load(); err != nil {
+				return err
+			}
+			return simulate(cfg)
+		},
+	}
+
+	return app.Run(os.Args)
+}
+
+// simulate runs the network once and compares the DAG algorithms on the
+// blocks it produced.
+func simulate(cfg *Config) error {
+	blocks := newNetwork(cfg).run()
+	results := []*dagResult{}
+	for _, dagType := range cfg.dagTypes {
+		result, err := simulateDAG(dagType, blocks)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	}
+	return writeReport(os.Stdout, cfg, blocks, results)
+}
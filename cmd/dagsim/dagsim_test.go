@@ -0,0 +1,127 @@
+// Copyright (c) 2017-2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+func testConfig(t *testing.T, attacker float64, strategy string) *Config {
+	cfg := &Config{
+		Seed:     7,
+		Blocks:   200,
+		Miners:   5,
+		Interval: defaultInterval,
+		Delay:    defaultDelay,
+		Attacker: attacker,
+		Strategy: strategy,
+		Withhold: defaultWithhold,
+		DAGTypes: defaultDAGTypes,
+	}
+	if err := cfg.load(); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestConfigLoad(t *testing.T) {
+	cfg := testConfig(t, 0.25, strategySelfish)
+	if len(cfg.shares) != 6 || cfg.honestMiners() != 5 {
+		t.Fatalf("unexpected shares %v", cfg.shares)
+	}
+	total := 0.0
+	for _, share := range cfg.shares {
+		total += share
+	}
+	if total < 0.999999 || total > 1.000001 {
+		t.Fatalf("shares sum up to %v", total)
+	}
+
+	tests := []*Config{
+		{Blocks: 1, Miners: 1, Interval: 1, Strategy: strategySelfish, DAGTypes: "phantom"},
+		{Blocks: 1, Miners: 1, Interval: 1, Strategy: "unknown", DAGTypes: "phantom"},
+		{Blocks: 1, Miners: 1, Interval: 1, Strategy: strategyNone, DAGTypes: "unknown"},
+		{Blocks: 1, Interval: 1, HashRates: "1,-1", Strategy: strategyNone, DAGTypes: "phantom"},
+	}
+	for i, test := range tests {
+		if err := test.load(); err == nil {
+			t.Errorf("test %d: invalid config accepted", i)
+		}
+	}
+}
+
+func TestNetworkDeterministic(t *testing.T) {
+	for _, strategy := range []string{strategyNone, strategySelfish, strategyParasite} {
+		attacker := 0.3
+		if strategy == strategyNone {
+			attacker = 0
+		}
+		first := newNetwork(testConfig(t, attacker, strategy)).run()
+		second := newNetwork(testConfig(t, attacker, strategy)).run()
+		if len(first) != 201 || len(second) != len(first) {
+			t.Fatalf("%s: observed %d and %d blocks", strategy, len(first), len(second))
+		}
+		seen := map[uint]bool{}
+		for i, b := range first {
+			if b.id != second[i].id || b.observed != second[i].observed {
+				t.Fatalf("%s: runs differ at %d", strategy, i)
+			}
+			// The observer receives the parents first.
+			for _, p := range b.parents {
+				if !seen[p] {
+					t.Fatalf("%s: block %d observed before its parent %d", strategy, b.id, p)
+				}
+			}
+			seen[b.id] = true
+		}
+	}
+}
+
+func TestNetworkWithholding(t *testing.T) {
+	blocks := map[uint]*simBlock{}
+	withheld, chained := 0, 0
+	for _, b := range newNetwork(testConfig(t, 0.3, strategyParasite)).run() {
+		blocks[b.id] = b
+		if !b.attacker {
+			if b.released != b.created {
+				t.Fatalf("honest block %d was withheld", b.id)
+			}
+			continue
+		}
+		if b.released > b.created {
+			withheld++
+		}
+		// The parasite chain only references the blocks of the attacker.
+		if len(b.parents) == 1 && blocks[b.parents[0]].attacker {
+			chained++
+		}
+	}
+	if withheld == 0 || chained == 0 {
+		t.Fatalf("the attacker withheld %d blocks and chained %d", withheld, chained)
+	}
+}
+
+func TestSimulateDAG(t *testing.T) {
+	cfg := testConfig(t, 0, strategyNone)
+	blocks := newNetwork(cfg).run()
+	result, err := simulateDAG("phantom", blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.added != len(blocks) || result.rejected != 0 {
+		t.Fatalf("added %d and rejected %d of %d blocks", result.added,
+			result.rejected, len(blocks))
+	}
+	if !result.colored || result.ordered == 0 || result.inversions != 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if result.success(cfg) != "-" {
+		t.Fatal("success reported without attack")
+	}
+
+	if _, err := simulateDAG("unknown", blocks); err == nil {
+		t.Fatal("simulated an unknown DAG type")
+	}
+}
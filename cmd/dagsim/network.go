@@ -0,0 +1,315 @@
+// Copyright (c) 2017-2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/blockdag"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"math/rand"
+	"sort"
+)
+
+// simBlock is a block mined during the simulation.
+type simBlock struct {
+	id       uint
+	hash     hash.Hash
+	miner    int
+	attacker bool
+	parents  []uint
+	layer    uint
+
+	// The times in seconds the block was mined, broadcast by its miner and
+	// received by the observer.
+	created  float64
+	released float64
+	observed float64
+}
+
+// simNode is the view of the DAG of a node of the network.
+type simNode struct {
+	known   map[uint]bool
+	tips    map[uint]bool
+	orphans map[uint][]*simBlock
+}
+
+func newSimNode(genesis *simBlock) *simNode {
+	return &simNode{
+		known:   map[uint]bool{genesis.id: true},
+		tips:    map[uint]bool{genesis.id: true},
+		orphans: map[uint][]*simBlock{},
+	}
+}
+
+// receive adds the block to the view once all its parents are known, and
+// returns the blocks which were accepted in their order.
+func (n *simNode) receive(b *simBlock) []*simBlock {
+	if n.known[b.id] {
+		return nil
+	}
+	for _, p := range b.parents {
+		if !n.known[p] {
+			n.orphans[p] = append(n.orphans[p], b)
+			return nil
+		}
+	}
+	n.known[b.id] = true
+	for _, p := range b.parents {
+		delete(n.tips, p)
+	}
+	n.tips[b.id] = true
+
+	accepted := []*simBlock{b}
+	orphans := n.orphans[b.id]
+	delete(n.orphans, b.id)
+	for _, o := range orphans {
+		accepted = append(accepted, n.receive(o)...)
+	}
+	return accepted
+}
+
+type eventKind int
+
+const (
+	eventMine eventKind = iota
+	eventDeliver
+)
+
+type event struct {
+	time  float64
+	seq   uint64
+	kind  eventKind
+	node  int
+	block *simBlock
+}
+
+// eventQueue orders the events by time, the events of the same time in the
+// order they were scheduled so the simulation is deterministic.
+type eventQueue []*event
+
+func (q eventQueue) Len() int { return len(q) }
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].time != q[j].time {
+		return q[i].time < q[j].time
+	}
+	return q[i].seq < q[j].seq
+}
+func (q eventQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *eventQueue) Push(x interface{}) { *q = append(*q, x.(*event)) }
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+// network simulates the miners of the network, the attacker and an observer
+// node whose view is fed to the DAG algorithms.
+type network struct {
+	cfg    *Config
+	rand   *rand.Rand
+	queue  eventQueue
+	seq    uint64
+	now    float64
+	blocks []*simBlock
+
+	// nodes are the honest miners, then the attacker if any and the
+	// observer last.
+	nodes    []*simNode
+	attacker int
+	observer int
+	observed []*simBlock
+
+	// private are the blocks withheld by the attacker, publicLead the
+	// number of honest blocks it received since it began withholding.
+	private    []*simBlock
+	publicLead int
+}
+
+func newNetwork(cfg *Config) *network {
+	genesis := &simBlock{id: 0, hash: blockHash(0)}
+	n := &network{
+		cfg:      cfg,
+		rand:     rand.New(rand.NewSource(cfg.Seed)),
+		blocks:   []*simBlock{genesis},
+		attacker: -1,
+		observed: []*simBlock{genesis},
+	}
+	for i := 0; i < len(cfg.shares); i++ {
+		n.nodes = append(n.nodes, newSimNode(genesis))
+	}
+	if cfg.Attacker > 0 {
+		n.attacker = cfg.honestMiners()
+	}
+	n.observer = len(n.nodes)
+	n.nodes = append(n.nodes, newSimNode(genesis))
+	return n
+}
+
+// blockHash returns the hash of a simulated block.
+func blockHash(id uint) hash.Hash {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(id))
+	return hash.DoubleHashH(b[:])
+}
+
+func (n *network) schedule(e *event) {
+	e.seq = n.seq
+	n.seq++
+	heap.Push(&n.queue, e)
+}
+
+// run mines the blocks and delivers them until the whole network received
+// them, it returns the blocks in the order the observer received them.
+func (n *network) run() []*simBlock {
+	n.scheduleMine()
+	for n.queue.Len() > 0 {
+		e := heap.Pop(&n.queue).(*event)
+		n.now = e.time
+		switch e.kind {
+		case eventMine:
+			n.mine()
+			if uint(len(n.blocks)) <= n.cfg.Blocks {
+				n.scheduleMine()
+			} else {
+				// The attacker has nothing more to wait for.
+				n.release()
+			}
+		case eventDeliver:
+			n.deliver(e.node, e.block)
+		}
+	}
+	return n.observed
+}
+
+func (n *network) scheduleMine() {
+	n.schedule(&event{
+		time: n.now + n.rand.ExpFloat64()*n.cfg.Interval,
+		kind: eventMine,
+	})
+}
+
+// pickMiner returns the miner of the next block according to the shares.
+func (n *network) pickMiner() int {
+	r := n.rand.Float64()
+	for i, share := range n.cfg.shares {
+		if r < share {
+			return i
+		}
+		r -= share
+	}
+	return len(n.cfg.shares) - 1
+}
+
+// selectParents returns the tips of the view of the node which are not too
+// far below the highest one, like a node selects the parents of its template.
+func (n *network) selectParents(node *simNode) []uint {
+	tips := make([]*simBlock, 0, len(node.tips))
+	for id := range node.tips {
+		tips = append(tips, n.blocks[id])
+	}
+	sort.Slice(tips, func(i, j int) bool {
+		if tips[i].layer != tips[j].layer {
+			return tips[i].layer > tips[j].layer
+		}
+		return tips[i].id < tips[j].id
+	})
+	parents := []uint{}
+	for _, tip := range tips {
+		if tips[0].layer-tip.layer > blockdag.MaxTipLayerGap ||
+			len(parents) >= types.MaxParentsPerBlock {
+			break
+		}
+		parents = append(parents, tip.id)
+	}
+	return parents
+}
+
+func (n *network) mine() {
+	miner := n.pickMiner()
+	node := n.nodes[miner]
+	b := &simBlock{
+		id:       uint(len(n.blocks)),
+		miner:    miner,
+		attacker: miner == n.attacker,
+		created:  n.now,
+	}
+	b.hash = blockHash(b.id)
+	if b.attacker && n.cfg.Strategy == strategyParasite && len(n.private) > 0 {
+		b.parents = []uint{n.private[len(n.private)-1].id}
+	} else {
+		b.parents = n.selectParents(node)
+	}
+	for _, p := range b.parents {
+		if n.blocks[p].layer+1 > b.layer {
+			b.layer = n.blocks[p].layer + 1
+		}
+	}
+	n.blocks = append(n.blocks, b)
+	node.receive(b)
+
+	if !b.attacker || n.cfg.Strategy == strategyNone {
+		n.broadcast(b)
+		return
+	}
+	if len(n.private) == 0 {
+		n.publicLead = 0
+	}
+	n.private = append(n.private, b)
+	if n.cfg.Strategy == strategyParasite && uint(len(n.private)) >= n.cfg.Withhold {
+		n.release()
+	}
+}
+
+// delay returns the time a block takes to reach another node, half of the
+// delay at least plus an exponential jitter.
+func (n *network) delay() float64 {
+	return n.cfg.Delay/2 + n.rand.ExpFloat64()*n.cfg.Delay/2
+}
+
+// broadcast sends the block to all the other nodes.
+func (n *network) broadcast(b *simBlock) {
+	b.released = n.now
+	for i := range n.nodes {
+		if i == b.miner {
+			continue
+		}
+		n.schedule(&event{
+			time:  n.now + n.delay(),
+			kind:  eventDeliver,
+			node:  i,
+			block: b,
+		})
+	}
+}
+
+// release broadcasts the blocks withheld by the attacker.
+func (n *network) release() {
+	for _, b := range n.private {
+		n.broadcast(b)
+	}
+	n.private = nil
+	n.publicLead = 0
+}
+
+func (n *network) deliver(i int, b *simBlock) {
+	for _, accepted := range n.nodes[i].receive(b) {
+		if i == n.observer {
+			accepted.observed = n.now
+			n.observed = append(n.observed, accepted)
+		}
+		if i != n.attacker || accepted.attacker || len(n.private) == 0 {
+			continue
+		}
+		// The selfish attacker releases its blocks before the honest
+		// miners catch up with it.
+		n.publicLead++
+		if n.cfg.Strategy == strategySelfish && n.publicLead+1 >= len(n.private) {
+			n.release()
+		}
+	}
+}
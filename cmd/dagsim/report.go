@@ -0,0 +1,238 @@
+// Copyright (c) 2017-2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/blockdag"
+	"io"
+	"text/tabwriter"
+)
+
+// dagBlock feeds a simulated block to a DAG algorithm.
+type dagBlock struct {
+	hash      hash.Hash
+	parents   []uint
+	timestamp int64
+}
+
+func (b *dagBlock) GetHash() *hash.Hash {
+	return &b.hash
+}
+
+func (b *dagBlock) GetParents() []uint {
+	return b.parents
+}
+
+func (b *dagBlock) GetTimestamp() int64 {
+	return b.timestamp
+}
+
+func (b *dagBlock) GetWeight() uint64 {
+	return 1
+}
+
+// dagResult is the outcome of a DAG algorithm for the simulated blocks.
+type dagResult struct {
+	dagType  string
+	added    int
+	rejected int
+
+	// ordered is the number of blocks of the final order, reorders the
+	// number of times a block already ordered moved, unstable the number of
+	// blocks which moved at least once and maxShift the largest move.
+	ordered  int
+	reorders int
+	unstable int
+	maxShift int
+
+	// colored tells whether the algorithm colors the blocks.  The red
+	// blocks are counted for the honest miners and the attacker, revenue is
+	// the share of the attacker in the blue blocks.
+	colored     bool
+	honestRed   int
+	honest      int
+	attackerRed int
+	attacker    int
+	revenue     float64
+
+	// inversions is the number of honest blocks ordered after an attacker
+	// block which was mined once the observer already had them.
+	inversions int
+}
+
+// simulateDAG feeds the blocks in the order of the observer to the DAG
+// algorithm and measures how it orders and colors them.
+func simulateDAG(dagType string, blocks []*simBlock) (*dagResult, error) {
+	if blockdag.NewBlockDAG(dagType) == nil {
+		return nil, fmt.Errorf("Unknown DAG type %s", dagType)
+	}
+	ids := map[hash.Hash]uint{}
+	bd := &blockdag.BlockDAG{}
+	instance := bd.Init(dagType, func(int64, *hash.Hash, byte) int64 { return 1 }, -1,
+		func(h *hash.Hash) uint {
+			if id, ok := ids[*h]; ok {
+				return id
+			}
+			return blockdag.MaxId
+		}, nil)
+
+	result := &dagResult{dagType: dagType}
+	simIds := map[hash.Hash]*simBlock{}
+	positions := map[uint]int{}
+	moved := map[uint]bool{}
+	for _, b := range blocks {
+		db := &dagBlock{hash: b.hash, timestamp: int64(b.created)}
+		for _, p := range b.parents {
+			id, ok := ids[blockHash(p)]
+			if !ok {
+				break
+			}
+			db.parents = append(db.parents, id)
+		}
+		if len(db.parents) < len(b.parents) {
+			result.rejected++
+			continue
+		}
+		_, ib := bd.AddBlock(db)
+		if ib == nil {
+			result.rejected++
+			continue
+		}
+		ids[b.hash] = ib.GetID()
+		simIds[b.hash] = b
+		result.added++
+
+		order := dagOrder(instance, simIds)
+		for pos, sb := range order {
+			old, ok := positions[sb.id]
+			if ok && old != pos {
+				result.reorders++
+				moved[sb.id] = true
+				if shift := abs(pos - old); shift > result.maxShift {
+					result.maxShift = shift
+				}
+			}
+			positions[sb.id] = pos
+		}
+	}
+	result.unstable = len(moved)
+
+	order := dagOrder(instance, simIds)
+	result.ordered = len(order)
+	_, result.colored = instance.(*blockdag.Phantom)
+	if result.colored {
+		blues, attackerBlues := 0, 0
+		for h, b := range simIds {
+			blue := instance.IsBlue(ids[h])
+			if b.attacker {
+				result.attacker++
+				if blue {
+					attackerBlues++
+				} else {
+					result.attackerRed++
+				}
+			} else {
+				result.honest++
+				if !blue {
+					result.honestRed++
+				}
+			}
+			if blue {
+				blues++
+			}
+		}
+		if blues > 0 {
+			result.revenue = float64(attackerBlues) / float64(blues)
+		}
+	}
+	for pos, a := range order {
+		if !a.attacker {
+			continue
+		}
+		for _, h := range order[pos+1:] {
+			if !h.attacker && h.id != 0 && h.observed < a.created {
+				result.inversions++
+			}
+		}
+	}
+	return result, nil
+}
+
+// dagOrder returns the blocks in the order of the DAG algorithm, which is
+// empty if the algorithm does not order the blocks.
+func dagOrder(instance blockdag.IBlockDAG, simIds map[hash.Hash]*simBlock) []*simBlock {
+	order := []*simBlock{}
+	for o := uint(0); ; o++ {
+		h := instance.GetBlockByOrder(o)
+		if h == nil {
+			return order
+		}
+		order = append(order, simIds[*h])
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// success tells whether the attack succeeded: the selfish attacker earns more
+// than its share of blue blocks, the parasite chain reverses honest blocks.
+func (r *dagResult) success(cfg *Config) string {
+	switch cfg.Strategy {
+	case strategySelfish:
+		if !r.colored {
+			return "n/a"
+		}
+		return fmt.Sprintf("%v", r.revenue > cfg.Attacker)
+	case strategyParasite:
+		if r.ordered == 0 {
+			return "n/a"
+		}
+		return fmt.Sprintf("%v", r.inversions > 0)
+	}
+	return "-"
+}
+
+// writeReport writes the parameters of the simulation and a table of the
+// results of the DAG algorithms, the metrics not supported by an algorithm
+// are n/a.
+func writeReport(w io.Writer, cfg *Config, blocks []*simBlock, results []*dagResult) error {
+	fmt.Fprintf(w, "seed=%d blocks=%d miners=%d interval=%vs delay=%vs attacker=%v strategy=%s\n",
+		cfg.Seed, len(blocks), cfg.honestMiners(), cfg.Interval, cfg.Delay, cfg.Attacker, cfg.Strategy)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DAG\tADDED\tREJECTED\tORDERED\tREORDERS\tUNSTABLE\tMAXSHIFT\tRED(HONEST)\tRED(ATTACKER)\tREVENUE\tINVERSIONS\tSUCCESS")
+	for _, r := range results {
+		reorders, unstable, maxShift, inversions := "n/a", "n/a", "n/a", "n/a"
+		if r.ordered > 0 {
+			reorders = fmt.Sprintf("%d", r.reorders)
+			unstable = fmt.Sprintf("%d", r.unstable)
+			maxShift = fmt.Sprintf("%d", r.maxShift)
+			inversions = fmt.Sprintf("%d", r.inversions)
+		}
+		honestRed, attackerRed, revenue := "n/a", "n/a", "n/a"
+		if r.colored {
+			honestRed = rate(r.honestRed, r.honest)
+			attackerRed = rate(r.attackerRed, r.attacker)
+			revenue = fmt.Sprintf("%.4f", r.revenue)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.dagType, r.added, r.rejected, r.ordered, reorders, unstable,
+			maxShift, honestRed, attackerRed, revenue, inversions, r.success(cfg))
+	}
+	return tw.Flush()
+}
+
+// rate formats the ratio of n over total.
+func rate(n int, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.4f", float64(n)/float64(total))
+}
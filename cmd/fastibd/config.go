@@ -35,6 +35,11 @@ type Config struct {
 	DisableBar bool
 	EndPoint   string
 	ByID       bool
+
+	DAGStart  uint
+	DAGEnd    uint
+	DAGLast   uint
+	DAGFormat string
 }
 
 func (c *Config) load() error {
@@ -97,6 +97,53 @@ func fastIBD() error {
 					return node.Import()
 				},
 			},
+			&cli.Command{
+				Name:        "dag",
+				Aliases:     []string{"d"},
+				Category:    "DAG",
+				Usage:       "Export the DAG of a range of blocks",
+				Description: "Export the DAG of the blocks from the start order to the end order(exclude self), or of the last blocks, as Graphviz DOT or JSON",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "path",
+						Aliases:     []string{"p"},
+						Usage:       "Path to output data, the standard output if empty",
+						Destination: &cfg.OutputPath,
+					},
+					&cli.UintFlag{
+						Name:        "start",
+						Usage:       "Order of the first block",
+						Destination: &cfg.DAGStart,
+					},
+					&cli.UintFlag{
+						Name:        "end",
+						Usage:       "Order after the last block, after the main chain tip if zero",
+						Destination: &cfg.DAGEnd,
+					},
+					&cli.UintFlag{
+						Name:        "last",
+						Aliases:     []string{"n"},
+						Usage:       "Number of the last blocks to export instead of a range",
+						Destination: &cfg.DAGLast,
+					},
+					&cli.StringFlag{
+						Name:        "format",
+						Aliases:     []string{"f"},
+						Usage:       "Output format {dot,json}",
+						Value:       "dot",
+						Destination: &cfg.DAGFormat,
+					},
+				},
+				Before: func(c *cli.Context) error {
+					return node.init(cfg)
+				},
+				After: func(c *cli.Context) error {
+					return node.exit()
+				},
+				Action: func(c *cli.Context) error {
+					return node.ExportDAG()
+				},
+			},
 		},
 		Flags: []cli.Flag{
 			&cli.StringFlag{
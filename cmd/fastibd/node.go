@@ -10,8 +10,10 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/common/marshal"
 	"github.com/Qitmeer/qitmeer/core/blockchain"
 	"github.com/Qitmeer/qitmeer/core/blockdag"
 	"github.com/Qitmeer/qitmeer/core/dbnamespace"
@@ -255,3 +257,43 @@ func (node *Node) Import() error {
 	log.Info(fmt.Sprintf("New Info:%s  mainOrder=%d tips=%d", mainTip.GetHash().String(), mainTip.GetOrder(), node.bc.BlockDAG().GetTips().Size()))
 	return nil
 }
+
+func (node *Node) ExportDAG() error {
+	bd := node.bc.BlockDAG()
+	start, end := bd.ExportRange(node.cfg.DAGStart, node.cfg.DAGEnd, node.cfg.DAGLast)
+	if start >= end {
+		return fmt.Errorf("Start order %d is not below the end order %d", start, end)
+	}
+	blocks, err := bd.ExportDAG(start, end)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if len(node.cfg.OutputPath) > 0 {
+		outFile, err := os.OpenFile(node.cfg.OutputPath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, os.ModePerm)
+		if err != nil {
+			return err
+		}
+		defer outFile.Close()
+		out = outFile
+	}
+	switch node.cfg.DAGFormat {
+	case "dot":
+		if err := blockdag.WriteDot(out, blocks); err != nil {
+			return err
+		}
+	case "json":
+		data, err := json.MarshalIndent(marshal.MarshalJsonDAG(blocks), "", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err := out.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("Unknown format %s", node.cfg.DAGFormat)
+	}
+	log.Info(fmt.Sprintf("Finish export DAG: blocks(%d) orders[%d, %d)", len(blocks), start, end))
+	return nil
+}
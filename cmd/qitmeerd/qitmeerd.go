@@ -9,6 +9,7 @@ import (
 	"github.com/Qitmeer/qitmeer/core/message"
 	_ "github.com/Qitmeer/qitmeer/database/ffldb"
 	"github.com/Qitmeer/qitmeer/log"
+	"github.com/Qitmeer/qitmeer/metrics"
 	"github.com/Qitmeer/qitmeer/node"
 	"github.com/Qitmeer/qitmeer/params"
 	"github.com/Qitmeer/qitmeer/services/common"
@@ -17,6 +18,7 @@ import (
 	"os"
 	"runtime"
 	"runtime/debug"
+	"time"
 )
 
 func main() {
@@ -101,6 +103,22 @@ func qitmeerdMain(nodeChan chan<- *node.Node) error {
 
 		return nil
 	}
+	if cfg.DropCfIndex {
+		if err := index.DropCfIndex(db, interrupt); err != nil {
+			log.Error(fmt.Sprintf("%v", err))
+			return err
+		}
+
+		return nil
+	}
+	if cfg.DropSpendIndex {
+		if err := index.DropSpendIndex(db, interrupt); err != nil {
+			log.Error(fmt.Sprintf("%v", err))
+			return err
+		}
+
+		return nil
+	}
 
 	// Cleanup the block database
 	if cfg.Cleanup {
@@ -133,6 +151,14 @@ func qitmeerdMain(nodeChan chan<- *node.Node) error {
 		return err
 	}
 
+	// Serve the metrics when requested.
+	if cfg.MetricsListen != "" {
+		go metrics.CollectProcessMetrics(3 * time.Second)
+		metricsServer := metrics.StartPrometheusServer(cfg.MetricsListen)
+		defer metricsServer.Close()
+		log.Info("Metrics server listening", "addr", cfg.MetricsListen)
+	}
+
 	if nodeChan != nil {
 		nodeChan <- n
 	}
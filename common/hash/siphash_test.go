@@ -0,0 +1,40 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package hash
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestSipHash(t *testing.T) {
+	var key [16]byte
+	for i := range key {
+		key[i] = byte(i)
+	}
+	k0 := binary.LittleEndian.Uint64(key[0:8])
+	k1 := binary.LittleEndian.Uint64(key[8:16])
+
+	// Test vectors of the SipHash-2-4 reference implementation.
+	tests := []struct {
+		msgLen int
+		want   uint64
+	}{
+		{0, 0x726fdb47dd0e0e31},
+		{1, 0x74f839c593dc67fd},
+		{8, 0x93f5f5799a932462},
+		{15, 0xa129ca6149be45e5},
+	}
+	for _, test := range tests {
+		msg := make([]byte, test.msgLen)
+		for i := range msg {
+			msg[i] = byte(i)
+		}
+		if got := SipHash(k0, k1, msg); got != test.want {
+			t.Errorf("SipHash of %d bytes: got %x, want %x", test.msgLen,
+				got, test.want)
+		}
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/blockchain"
+	"github.com/Qitmeer/qitmeer/core/blockdag"
 	"github.com/Qitmeer/qitmeer/core/json"
 	"github.com/Qitmeer/qitmeer/core/message"
 	"github.com/Qitmeer/qitmeer/core/protocol"
@@ -223,3 +225,43 @@ func MarshalJsonBlock(b *types.SerializedBlock, inclTx bool, fullTx bool,
 
 	return fields, nil
 }
+
+// MarshalJsonConfirmationRisk converts the confirmation risk of a block to the
+// RPC output, txId is the transaction the risk was requested for, if any.
+func MarshalJsonConfirmationRisk(risk *blockchain.ConfirmationRisk, txId string) json.ConfirmationRiskResult {
+	return json.ConfirmationRiskResult{
+		TxId:          txId,
+		BlockHash:     risk.Hash.String(),
+		Order:         risk.Order,
+		AntiPast:      risk.AntiPast,
+		WaitingTime:   risk.WaitingTime,
+		Alpha:         risk.Alpha,
+		Risk:          risk.Risk,
+		SecurityLevel: risk.SecurityLevel,
+		Secure:        risk.Secure,
+	}
+}
+
+// MarshalJsonDAG converts the blocks of an exported sub-DAG to the RPC output.
+func MarshalJsonDAG(blocks []*blockdag.ExportBlock) []json.DAGBlockResult {
+	result := make([]json.DAGBlockResult, 0, len(blocks))
+	for _, b := range blocks {
+		dagBlock := json.DAGBlockResult{
+			Hash:        b.Hash.String(),
+			Order:       b.Order,
+			Layer:       b.Layer,
+			Height:      b.Height,
+			Parents:     []string{},
+			IsBlue:      b.IsBlue,
+			IsMainChain: b.IsMainChain,
+		}
+		for _, p := range b.Parents {
+			dagBlock.Parents = append(dagBlock.Parents, p.String())
+		}
+		if b.MainParent != nil {
+			dagBlock.MainParent = b.MainParent.String()
+		}
+		result = append(result, dagBlock)
+	}
+	return result
+}
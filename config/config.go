@@ -32,7 +32,14 @@ type Config struct {
 	DropTxIndex        bool     `long:"droptxindex" description:"Deletes the hash-based transaction index from the database on start up and then exits."`
 	AddrIndex          bool     `long:"addrindex" description:"Maintain a full address-based transaction index which makes the getrawtransactions RPC available"`
 	DropAddrIndex      bool     `long:"dropaddrindex" description:"Deletes the address-based transaction index from the database on start up and then exits."`
+	CfIndex            bool     `long:"cfindex" description:"Maintain the committed filter index of the blocks which serves the compact filters to light clients"`
+	DropCfIndex        bool     `long:"dropcfindex" description:"Deletes the committed filter index from the database on start up and then exits."`
+	SpendIndex         bool     `long:"spendindex" description:"Maintain an index of the spent outputs to the transactions spending them which makes the getSpendingTx RPC available"`
+	DropSpendIndex     bool     `long:"dropspendindex" description:"Deletes the spend index from the database on start up and then exits."`
+	Prune              uint64   `long:"prune" description:"Delete the oldest block files to keep the stored blocks under the target size in MiB (0 disables pruning, the minimum is 550, the transactions of the deleted blocks can no longer be fetched)"`
 	LightNode          bool     `long:"light" description:"start as a qitmeer light node"`
+	WatchAddrs         []string `long:"watchaddr" description:"Add an address whose unspent outputs are tracked by the light node"`
+	WatchBirthday      uint     `long:"watchbirthday" description:"Order of the first block which may pay to the newly added --watchaddr addresses, the synced blocks are rescanned from it"`
 	SigCacheMaxSize    uint     `long:"sigcachemaxsize" description:"The maximum number of entries in the signature verification cache"`
 	DumpBlockchain     string   `long:"dumpblockchain" description:"Write blockchain as a flat file of blocks for use with addblock, to the specified filename"`
 	TestNet            bool     `long:"testnet" description:"Use the test network"`
@@ -40,14 +47,18 @@ type Config struct {
 	PrivNet            bool     `long:"privnet" description:"Use the private network"`
 	DbType             string   `long:"dbtype" description:"Database backend to use for the Block Chain"`
 	Profile            string   `long:"profile" description:"Enable HTTP profiling on given [addr:]port -- NOTE port must be between 1024 and 65536"`
+	Metrics            bool     `long:"metrics" description:"Enable the collection of the metrics of the node"`
+	MetricsListen      string   `long:"metricslisten" description:"Serve the metrics in the Prometheus text format on the /metrics path of the given [addr:]port, which also enables their collection"`
 	DebugLevel         string   `short:"d" long:"debuglevel" description:"Logging level {trace, debug, info, warn, error, critical} "`
 	DebugPrintOrigins  bool     `long:"printorigin" description:"Print log debug location (file:line) "`
 	// MemPool Config
-	NoRelayPriority  bool    `long:"norelaypriority" description:"Do not require free or low-fee transactions to have high priority for relaying"`
-	FreeTxRelayLimit float64 `long:"limitfreerelay" description:"Limit relay of transactions with no transaction fee to the given amount in thousands of bytes per minute"`
-	AcceptNonStd     bool    `long:"acceptnonstd" description:"Accept and relay non-standard transactions to the network regardless of the default settings for the active network."`
-	MaxOrphanTxs     int     `long:"maxorphantx" description:"Max number of orphan transactions to keep in memory"`
-	MinTxFee         int64   `long:"mintxfee" description:"The minimum transaction fee in AtomMEER/kB."`
+	NoRelayPriority   bool    `long:"norelaypriority" description:"Do not require free or low-fee transactions to have high priority for relaying"`
+	FreeTxRelayLimit  float64 `long:"limitfreerelay" description:"Limit relay of transactions with no transaction fee to the given amount in thousands of bytes per minute"`
+	AcceptNonStd      bool    `long:"acceptnonstd" description:"Accept and relay non-standard transactions to the network regardless of the default settings for the active network."`
+	MaxOrphanTxs      int     `long:"maxorphantx" description:"Max number of orphan transactions to keep in memory"`
+	MinTxFee          int64   `long:"mintxfee" description:"The minimum transaction fee in AtomMEER/kB."`
+	MaxMempool        int64   `long:"maxmempool" description:"Maximum size of the mempool in megabytes, the transactions with the lowest fee rate are evicted beyond it"`
+	RejectReplacement bool    `long:"rejectreplacement" description:"Reject transactions that attempt to replace existing transactions within the mempool through the Replace-By-Fee (RBF) signaling policy."`
 	// Miner
 	Generate          bool     `long:"generate" description:"Generate (mine) coins using the CPU"`
 	MiningAddrs       []string `long:"miningaddr" description:"Add the specified payment address to the list of addresses to use for generated blocks -- At least one address is required if the generate option is set"`
@@ -55,19 +66,34 @@ type Config struct {
 	BlockMinSize      uint32   `long:"blockminsize" description:"Mininum block size in bytes to be used when creating a block"`
 	BlockMaxSize      uint32   `long:"blockmaxsize" description:"Maximum block size in bytes to be used when creating a block"`
 	BlockPrioritySize uint32   `long:"blockprioritysize" description:"Size in bytes for high-priority/low-fee transactions when creating a block"`
+	Stratum           string   `long:"stratum" description:"Listen for Stratum mining connections on the given interface/port, eg. 0.0.0.0:3333 (disabled by default)"`
+	StratumDiff       uint64   `long:"stratumdiff" description:"Initial share difficulty handed to Stratum workers before it is adjusted to their hash rate"`
 	miningAddrs       []types.Address
 	//WebSocket support
 	RPCMaxWebsockets int `long:"rpcmaxwebsockets" description:"Max number of RPC websocket connections"`
 	//P2P
-	BlocksOnly      bool     `long:"blocksonly" description:"Do not accept transactions from remote peers."`
-	MiningStateSync bool     `long:"miningstatesync" description:"Synchronizing the mining state with other nodes"`
-	AddPeers        []string `short:"a" long:"addpeer" description:"Add a peer to connect with at startup"`
-	ConnectPeers    []string `long:"connect" description:"Connect only to the specified peers at startup"`
-	ExternalIPs     []string `long:"externalip" description:"list of local addresses we claim to listen on to peers"`
-	Upnp            bool     `long:"upnp" description:"Use UPnP to map our listening port outside of NAT"`
-	Whitelists      []string `long:"whitelist" description:"Add an IP network or IP that will not be banned. (eg. 192.168.1.0/24 or ::1)"`
-	whitelists      []*net.IPNet
-	MaxInbound      int `long:"maxinbound" description:"The max total of inbound peer for host"`
+	BlocksOnly         bool     `long:"blocksonly" description:"Do not accept transactions from remote peers."`
+	NoPeerBloomFilters bool     `long:"nopeerbloomfilters" description:"Disable bloom filtering support"`
+	MiningStateSync    bool     `long:"miningstatesync" description:"Synchronizing the mining state with other nodes"`
+	AddPeers           []string `short:"a" long:"addpeer" description:"Add a peer to connect with at startup"`
+	ConnectPeers       []string `long:"connect" description:"Connect only to the specified peers at startup"`
+	ExternalIPs        []string `long:"externalip" description:"list of local addresses we claim to listen on to peers"`
+	P2PEncrypt         bool     `long:"p2pencrypt" description:"Encrypt the connections to the peers which support it"`
+	RequireEncryption  bool     `long:"requireencryption" description:"Disconnect the peers which fail to negotiate an encrypted connection, implies --p2pencrypt"`
+	PeerIdentities     []string `long:"peeridentity" description:"Identity key a peer must prove when connecting to it, as <host:port>=<hex public key>, implies --p2pencrypt"`
+	Upnp               bool     `long:"upnp" description:"Use UPnP to map our listening port outside of NAT"`
+	Whitelists         []string `long:"whitelist" description:"Add an IP network or IP that will not be banned. (eg. 192.168.1.0/24 or ::1)"`
+	whitelists         []*net.IPNet
+	MaxInbound         int `long:"maxinbound" description:"The max total of inbound peer for host"`
+	//P2P - proxy
+	Proxy          string `long:"proxy" description:"Connect via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
+	ProxyUser      string `long:"proxyuser" description:"Username for proxy server"`
+	ProxyPass      string `long:"proxypass" default-mask:"-" description:"Password for proxy server"`
+	OnionProxy     string `long:"onion" description:"Connect to tor hidden services via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
+	OnionProxyUser string `long:"onionuser" description:"Username for onion proxy server"`
+	OnionProxyPass string `long:"onionpass" default-mask:"-" description:"Password for onion proxy server"`
+	NoOnion        bool   `long:"noonion" description:"Disable connecting to tor hidden services"`
+	TorIsolation   bool   `long:"torisolation" description:"Enable Tor stream isolation by randomizing user credentials for each connection."`
 	//P2P - server ban
 	Banning         bool          `long:"banning" description:"Enable banning of misbehaving peers"`
 	BanDuration     time.Duration `long:"banduration" description:"How long to ban misbehaving peers.  Valid time units are {s, m, h}.  Minimum 1 second"`
@@ -75,9 +101,10 @@ type Config struct {
 	GetAddrPercent  int           `short:"T" long:"getaddrpercent" description:"It is the percentage of total addresses known that we will share with a call to AddressCache."`
 	TrickleInterval time.Duration `long:"trickleinterval" description:"Minimum time between attempts to send new inventory to a connected peer"`
 
-	DAGType     string `short:"G" long:"dagtype" description:"DAG type {phantom,conflux,spectre} "`
-	Cleanup     bool   `short:"L" long:"cleanup" description:"Cleanup the block database "`
-	BuildLedger bool   `long:"buildledger" description:"Generate the genesis ledger for the next qitmeer version."`
+	DAGType        string `short:"G" long:"dagtype" description:"DAG type {phantom,conflux,spectre} "`
+	DAGCacheWindow uint   `long:"dagcachewindow" description:"Keep in memory the DAG blocks within this number of layers of the highest tip and load the older ones from the database (0 keeps all the blocks, the minimum is 1000, phantom only, the block orders and the block index stay in memory)"`
+	Cleanup        bool   `short:"L" long:"cleanup" description:"Cleanup the block database "`
+	BuildLedger    bool   `long:"buildledger" description:"Generate the genesis ledger for the next qitmeer version."`
 
 	Zmqpubhashblock string `long:"zmqpubhashblock" description:"Enable publish hash block  in <address>"`
 	Zmqpubrawblock  string `long:"zmqpubrawblock" description:"Enable publish raw block in <address>"`
@@ -85,6 +112,8 @@ type Config struct {
 	Zmqpubhashtx string `long:"zmqpubhashtx" description:"Enable publish hash transaction in <address>"`
 	Zmqpubrawtx  string `long:"zmqpubrawtx" description:"Enable publish raw transaction in <address>"`
 
+	Zmqpubhashreplacedtx string `long:"zmqpubhashreplacedtx" description:"Enable publish hash of transactions replaced by fee in <address>"`
+
 	// Cache Invalid tx
 	CacheInvalidTx bool `long:"cacheinvalidtx" description:"Cache invalid transactions."`
 }
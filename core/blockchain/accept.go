@@ -100,6 +100,12 @@ func (b *BlockChain) maybeAcceptBlock(block *types.SerializedBlock, flags Behavi
 
 	blockHeader := &block.Block().Header
 	newNode := newBlockNode(blockHeader, parentsNode)
+	for _, parent := range parentsNode {
+		if parent.status.Invalidated() {
+			newNode.status |= statusInvalidated
+			break
+		}
+	}
 	mainParent := newNode.GetMainParent(b)
 	if mainParent == nil {
 		return fmt.Errorf("Can't find main parent")
@@ -102,6 +102,16 @@ type BlockChain struct {
 	// it is unlikely to be referenced in the future.
 	pruner *chainPruner
 
+	// pruneTarget is the maximum number of bytes of the stored blocks, or
+	// zero when the blocks are never deleted.
+	pruneTarget uint64
+
+	// deploymentCaches caches the threshold state of every deployment per
+	// confirmation window.  deploymentLock protects them since they are
+	// also filled by readers holding the chain lock for reads.
+	deploymentLock   sync.Mutex
+	deploymentCaches []thresholdStateCache
+
 	//block dag
 	bd *blockdag.BlockDAG
 
@@ -174,6 +184,21 @@ type Config struct {
 
 	// Cache Invalid tx
 	CacheInvalidTx bool
+
+	// PruneTarget is the maximum number of bytes of the stored blocks.  The
+	// oldest block files are deleted beyond it, except for the blocks which
+	// may still be reordered.
+	//
+	// Pruning is disabled when it is zero.
+	PruneTarget uint64
+
+	// DAGCacheWindow is the number of layers below the highest tip the
+	// DAG blocks stay in memory, the older ones are loaded from the
+	// database when needed.  It doesn't cap the memory use, the order of
+	// every DAG block and the block index nodes still stay in memory.
+	//
+	// All the DAG blocks stay in memory when it is zero.
+	DAGCacheWindow uint
 }
 
 // BestState houses information about the current best block and other info
@@ -265,12 +290,20 @@ func New(config *Config) (*BlockChain, error) {
 		orphans:            make(map[hash.Hash]*orphanBlock),
 		BlockVersion:       config.BlockVersion,
 		CacheInvalidTx:     config.CacheInvalidTx,
+		pruneTarget:        config.PruneTarget,
+	}
+	b.deploymentCaches = newThresholdCaches(len(b.deployments()))
+	if err := b.checkDeployments(); err != nil {
+		return nil, err
 	}
 	b.subsidyCache = NewSubsidyCache(0, b.params)
 
 	b.bd = &blockdag.BlockDAG{}
 	b.bd.Init(config.DAGType, b.CalcWeight,
 		1.0/float64(par.TargetTimePerBlock/time.Second), b.index.GetDAGBlockID, b.db)
+	if err := b.bd.SetCacheWindow(config.DAGCacheWindow); err != nil {
+		return nil, err
+	}
 	// Initialize the chain state from the passed database.  When the db
 	// does not yet contain any chain state, both it and the chain state
 	// will be initialized to contain only the genesis block.
@@ -441,18 +474,17 @@ func (b *BlockChain) initChainState(interrupt <-chan struct{}) error {
 		// Determine how many blocks will be loaded into the index in order to
 		// allocate the right amount as a single alloc versus a whole bunch of
 		// littles ones to reduce pressure on the GC.
-		var block *types.SerializedBlock
 		for i := uint(0); i < uint(state.total); i++ {
 			blockHash := b.bd.GetBlockHash(i)
-			block, err = dbFetchBlockByHash(dbTx, blockHash)
+			header, parentHashes, err := dbFetchHeaderAndParents(dbTx, blockHash)
 			if err != nil {
 				return err
 			}
-			if i != 0 && block.Block().Header.GetVersion() != b.BlockVersion {
+			if i != 0 && header.GetVersion() != b.BlockVersion {
 				return fmt.Errorf("The dag block is not match current genesis block. you can cleanup your block data base by '--cleanup'.")
 			}
 			parents := []*blockNode{}
-			for _, pb := range block.Block().Parents {
+			for _, pb := range parentHashes {
 				parent := b.index.LookupNode(pb)
 				if parent == nil {
 					return fmt.Errorf("Can't find parent %s", pb.String())
@@ -462,7 +494,7 @@ func (b *BlockChain) initChainState(interrupt <-chan struct{}) error {
 			refblock := b.bd.GetBlockById(i)
 			//
 			node := &blockNode{}
-			initBlockNode(node, &block.Block().Header, parents)
+			initBlockNode(node, header, parents)
 			b.index.addNode(node)
 			node.status = BlockStatus(refblock.GetStatus())
 			node.SetOrder(uint64(refblock.GetOrder()))
@@ -476,6 +508,10 @@ func (b *BlockChain) initChainState(interrupt <-chan struct{}) error {
 		// Set the best chain view to the stored best state.
 		// Load the raw block bytes for the best block.
 		mainTip := b.index.LookupNode(b.bd.GetMainChainTip().GetHash())
+		block, err := dbFetchBlockByHash(dbTx, mainTip.GetHash())
+		if err != nil {
+			return err
+		}
 		// Initialize the state related to the best block.
 		blockSize := uint64(block.Block().SerializeSize())
 		numTxns := uint64(len(block.Block().Transactions))
@@ -830,11 +866,19 @@ func (b *BlockChain) updateBestState(node *blockNode, block *types.SerializedBlo
 	// this block.
 	numTxns := uint64(len(block.Block().Transactions))
 
+	return b.putBestState(block, curTotalTxns+numTxns)
+}
+
+// putBestState stores the best state of the main chain tip, the block being
+// the last one added.
+func (b *BlockChain) putBestState(block *types.SerializedBlock, totalTxns uint64) error {
+	numTxns := uint64(len(block.Block().Transactions))
+
 	blockSize := uint64(block.Block().SerializeSize())
 
 	mainTip := b.index.LookupNode(b.bd.GetMainChainTip().GetHash())
 
-	state := newBestState(mainTip.GetHash(), mainTip.bits, blockSize, numTxns, mainTip.CalcPastMedianTime(b), curTotalTxns+numTxns,
+	state := newBestState(mainTip.GetHash(), mainTip.bits, blockSize, numTxns, mainTip.CalcPastMedianTime(b), totalTxns,
 		b.bd.GetMainChainTip().GetWeight(), b.bd.GetGraphState())
 
 	// Atomically insert info into the database.
@@ -996,9 +1040,11 @@ func (b *BlockChain) reorganizeChain(detachNodes BlockNodeList, attachNodes *lis
 	var block *types.SerializedBlock
 	var err error
 
+	rd := &ReorganizationNotifyData{NewHash: *newBlock.Hash()}
 	dl := len(detachNodes)
 	for i := dl - 1; i >= 0; i-- {
 		n = detachNodes[i]
+		rd.OldOrders = append(rd.OldOrders, BlockOrder{n.hash, n.order})
 		newn := b.index.LookupNode(n.GetHash())
 		block, err = b.fetchBlockByHash(&n.hash)
 		if err != nil || n == nil {
@@ -1070,6 +1116,7 @@ func (b *BlockChain) reorganizeChain(detachNodes BlockNodeList, attachNodes *lis
 		if !n.IsOrdered() {
 			continue
 		}
+		rd.NewOrders = append(rd.NewOrders, BlockOrder{n.hash, n.order})
 		view := NewUtxoViewpoint()
 		view.SetViewpoints([]*hash.Hash{n.GetHash()})
 		stxos := []SpentTxOut{}
@@ -1095,6 +1142,7 @@ func (b *BlockChain) reorganizeChain(detachNodes BlockNodeList, attachNodes *lis
 	// heads.
 	log.Debug(fmt.Sprintf("End DAG REORGANIZE: Old Len= %d;New Len= %d", attachNodes.Len(), detachNodes.Len()))
 
+	b.sendNotification(Reorganization, rd)
 	return nil
 }
 
@@ -33,6 +33,11 @@ const (
 
 	// statusInvalid indicates that the block has failed validation.
 	statusInvalid BlockStatus = 1 << 2
+
+	// statusInvalidated indicates that the block or one of its ancestors
+	// was invalidated by the node operator.  It is the same bit as
+	// blockdag.StatusInvalidated, so that the DAG skips the block too.
+	statusInvalidated BlockStatus = BlockStatus(blockdag.StatusInvalidated)
 )
 
 // HaveData returns whether the full block data is stored in the database.  This
@@ -54,6 +59,12 @@ func (status BlockStatus) KnownInvalid() bool {
 	return status&statusInvalid != 0
 }
 
+// Invalidated returns whether the block or one of its ancestors was
+// invalidated by the node operator.
+func (status BlockStatus) Invalidated() bool {
+	return status&statusInvalidated != 0
+}
+
 // blockNode represents a block within the block chain and is primarily used to
 // aid in selecting the best chain to be the main chain.  The main chain is
 // stored into the block database.
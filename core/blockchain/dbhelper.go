@@ -280,6 +280,13 @@ func (b *BlockChain) createChainState() error {
 			return err
 		}
 
+		// Create the bucket that houses the children of the blocks in the
+		// block index.
+		_, err = meta.CreateBucket(dbnamespace.BlockChildrenBucketName)
+		if err != nil {
+			return err
+		}
+
 		// Create the bucket that houses the chain block hash to height
 		// index.
 		_, err = meta.CreateBucket(dbnamespace.HashIndexBucketName)
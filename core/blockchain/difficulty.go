@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"github.com/Qitmeer/qitmeer/common/hash"
 	"github.com/Qitmeer/qitmeer/core/types/pow"
+	"github.com/Qitmeer/qitmeer/params"
 	"math/big"
 	"time"
 )
@@ -27,29 +28,41 @@ const maxShift = uint(256)
 // verify that claimed proof of work by a block is sane as compared to a
 // known good checkpoint.
 func (b *BlockChain) calcEasiestDifficulty(bits uint32, duration time.Duration, powInstance pow.IPow) uint32 {
+	return CalcEasiestDifficulty(b.params, bits, duration, powInstance)
+}
+
+// CalcEasiestDifficulty calculates the easiest possible difficulty that a block
+// can have given starting difficulty bits and a duration with the retarget
+// rules of the network.  It allows the nodes which don't keep the DAG, such as
+// the light nodes, to bound the difficulty claimed by a header.
+func CalcEasiestDifficulty(par *params.Params, bits uint32, duration time.Duration, powInstance pow.IPow) uint32 {
 	// Convert types used in the calculations below.
 	durationVal := int64(duration)
-	adjustmentFactor := big.NewInt(b.params.RetargetAdjustmentFactor)
-	maxRetargetTimespan := int64(b.params.TargetTimespan) *
-		b.params.RetargetAdjustmentFactor
+	adjustmentFactor := big.NewInt(par.RetargetAdjustmentFactor)
+	maxRetargetTimespan := int64(par.TargetTimespan) *
+		par.RetargetAdjustmentFactor
 	target := powInstance.GetSafeDiff(0)
 	// The test network rules allow minimum difficulty blocks once too much
 	// time has elapsed without mining a block.
-	if b.params.ReduceMinDifficulty {
-		if durationVal > int64(b.params.MinDiffReductionTime) {
+	if par.ReduceMinDifficulty {
+		if durationVal > int64(par.MinDiffReductionTime) {
 			return pow.BigToCompact(target)
 		}
 	}
 
-	// Since easier difficulty equates to higher numbers, the easiest
-	// difficulty for a given duration is the largest value possible given
-	// the number of retargets for the duration and starting difficulty
-	// multiplied by the max adjustment factor.
+	// The easiest difficulty for a given duration is the starting
+	// difficulty eased by the max adjustment factor for each retarget of
+	// the duration.  Easier difficulty equates to higher targets for the
+	// hash based pow types, and to lower ones for the cuckoo ones.
 	newTarget := pow.CompactToBig(bits)
+	higherIsEasier := powInstance.CompareDiff(bigZero, adjustmentFactor)
 
 	for durationVal > 0 && powInstance.CompareDiff(newTarget, target) {
-		newTarget.Mul(newTarget, adjustmentFactor)
-		newTarget = powInstance.GetNextDiffBig(adjustmentFactor, newTarget, big.NewInt(0))
+		if higherIsEasier {
+			newTarget.Mul(newTarget, adjustmentFactor)
+		} else {
+			newTarget.Div(newTarget, adjustmentFactor)
+		}
 		durationVal -= maxRetargetTimespan
 	}
 
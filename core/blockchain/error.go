@@ -335,6 +335,10 @@ const (
 	// ErrNoViewpoint
 	ErrNoViewpoint
 
+	// ErrInvalidatedBlock indicates that the block or one of its ancestors
+	// was invalidated by the node operator.
+	ErrInvalidatedBlock
+
 	// numErrorCodes is the maximum error code number used in tests.
 	numErrorCodes
 )
@@ -410,6 +414,8 @@ var errorCodeStrings = map[ErrorCode]string{
 
 	ErrNoBlueCoinbase: "ErrNoBlueCoinbase",
 	ErrNoViewpoint:    "ErrNoViewpoint",
+
+	ErrInvalidatedBlock: "ErrInvalidatedBlock",
 }
 
 // String returns the ErrorCode as a human-readable name.
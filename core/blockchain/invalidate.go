@@ -0,0 +1,233 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/blockdag"
+	"github.com/Qitmeer/qitmeer/core/dbnamespace"
+	"github.com/Qitmeer/qitmeer/database"
+)
+
+// InvalidateBlock marks the block and its future set as invalidated by the
+// node operator.  The DAG is ordered again without them, so the blocks after
+// the point where the main chain changes are disconnected and connected
+// again in their new order, and the transactions of the invalidated blocks
+// leave the utxo set.  The invalidated blocks are never ordered nor mining
+// tips until they are reconsidered.  The decision is stored in the database
+// so that it survives restarts.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) InvalidateBlock(blockHash *hash.Hash) error {
+	b.ChainLock()
+	defer b.ChainUnlock()
+
+	node, err := b.lookupInvalidationNode(blockHash)
+	if err != nil {
+		return err
+	}
+	nodes := b.futureNodes(node)
+	refNodes, err := b.bd.SetInvalidated(nodeHashes(nodes), true)
+	if err != nil {
+		return err
+	}
+	err = b.db.Update(func(dbTx database.Tx) error {
+		bucket, err := dbTx.Metadata().CreateBucketIfNotExists(
+			dbnamespace.InvalidatedBlocksBucketName)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(blockHash[:], []byte{})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		n.SetStatusFlags(statusInvalidated)
+	}
+	if err := b.flushNodes(nodes); err != nil {
+		return err
+	}
+	log.Info("Invalidated block", "hash", blockHash, "future", len(nodes)-1)
+	return b.reorganizeInvalidated(refNodes)
+}
+
+// ReconsiderBlock reverses the InvalidateBlock of the block.  Its future set
+// is validated again, except for the blocks which remain in the future set of
+// another invalidated block, and the DAG is ordered again with them.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ReconsiderBlock(blockHash *hash.Hash) error {
+	b.ChainLock()
+	defer b.ChainUnlock()
+
+	node, err := b.lookupInvalidationNode(blockHash)
+	if err != nil {
+		return err
+	}
+	var invalidated []*hash.Hash
+	err = b.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(
+			dbnamespace.InvalidatedBlocksBucketName)
+		if bucket == nil || bucket.Get(blockHash[:]) == nil {
+			return fmt.Errorf("block %v is not invalidated", blockHash)
+		}
+		return bucket.ForEach(func(k, _ []byte) error {
+			h, err := hash.NewHash(k)
+			if err != nil {
+				return err
+			}
+			if !h.IsEqual(blockHash) {
+				invalidated = append(invalidated, h)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	remaining := map[hash.Hash]bool{}
+	for _, h := range invalidated {
+		n := b.index.LookupNode(h)
+		if n == nil {
+			continue
+		}
+		for _, fn := range b.futureNodes(n) {
+			remaining[fn.hash] = true
+		}
+	}
+	var nodes []*blockNode
+	for _, n := range b.futureNodes(node) {
+		if !remaining[n.hash] {
+			nodes = append(nodes, n)
+		}
+	}
+	var refNodes *list.List
+	if len(nodes) > 0 {
+		refNodes, err = b.bd.SetInvalidated(nodeHashes(nodes), false)
+		if err != nil {
+			return err
+		}
+	}
+	err = b.db.Update(func(dbTx database.Tx) error {
+		return dbTx.Metadata().Bucket(
+			dbnamespace.InvalidatedBlocksBucketName).Delete(blockHash[:])
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		n.UnsetStatusFlags(statusInvalidated)
+	}
+	if err := b.flushNodes(nodes); err != nil {
+		return err
+	}
+	log.Info("Reconsidered block", "hash", blockHash, "blocks", len(nodes))
+	if refNodes == nil {
+		return nil
+	}
+	return b.reorganizeInvalidated(refNodes)
+}
+
+// lookupInvalidationNode returns the node of the block to invalidate or
+// reconsider.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) lookupInvalidationNode(blockHash *hash.Hash) (*blockNode, error) {
+	if blockHash.IsEqual(b.params.GenesisHash) {
+		return nil, fmt.Errorf("the genesis block can't be invalidated")
+	}
+	node := b.index.LookupNode(blockHash)
+	if node == nil {
+		return nil, fmt.Errorf("block %v is unknown", blockHash)
+	}
+	if b.pruneTarget > 0 && node.IsOrdered() &&
+		uint64(b.bd.GetMainChainTip().GetOrder())-node.order >= pruneOrderDepth {
+		return nil, fmt.Errorf("block %v may be pruned", blockHash)
+	}
+	return node, nil
+}
+
+// futureNodes returns the node followed by the nodes of its future set.
+//
+// This function MUST be called with the chain state lock held.
+func (b *BlockChain) futureNodes(node *blockNode) []*blockNode {
+	nodes := []*blockNode{node}
+	for _, h := range b.bd.GetFutureSet(node.GetHash()) {
+		if n := b.index.LookupNode(h); n != nil {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// flushNodes writes the status of the nodes to the database.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) flushNodes(nodes []*blockNode) error {
+	for _, n := range nodes {
+		if err := n.FlushToDB(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nodeHashes returns the hashes of the nodes.
+func nodeHashes(nodes []*blockNode) []*hash.Hash {
+	hs := make([]*hash.Hash, 0, len(nodes))
+	for _, n := range nodes {
+		hs = append(hs, n.GetHash())
+	}
+	return hs
+}
+
+// reorganizeInvalidated disconnects the blocks reordered by the DAG after
+// blocks were invalidated or reconsidered, in their old order, and connects
+// them again in their new order, so that the utxo set reflects the new
+// order.  The invalidated blocks are only disconnected.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) reorganizeInvalidated(refNodes *list.List) error {
+	var detachNodes BlockNodeList
+	for e := refNodes.Front(); e != nil; e = e.Next() {
+		ib := e.Value.(blockdag.IBlock)
+		n := b.index.LookupNode(ib.GetHash())
+		if n == nil {
+			return fmt.Errorf("block %v is unknown", ib.GetHash())
+		}
+		if n.IsOrdered() {
+			detachNodes = append(detachNodes, n.Clone())
+		}
+		n.SetOrder(uint64(ib.GetOrder()))
+	}
+	if len(detachNodes) > 1 {
+		sort.Sort(detachNodes)
+	}
+
+	tip := b.index.LookupNode(b.bd.GetMainChainTip().GetHash())
+	tipBlock, err := b.fetchBlockByHash(tip.GetHash())
+	if err != nil {
+		return err
+	}
+	tipBlock.SetOrder(tip.order)
+	err = b.reorganizeChain(detachNodes, refNodes, tipBlock)
+	if err != nil {
+		return err
+	}
+
+	// The main chain tip may change but no transaction was added.
+	b.stateLock.RLock()
+	totalTxns := b.stateSnapshot.TotalTxns
+	b.stateLock.RUnlock()
+	return b.putBestState(tipBlock, totalTxns)
+}
@@ -0,0 +1,272 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/merkle"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/core/types/pow"
+	"github.com/Qitmeer/qitmeer/database"
+	_ "github.com/Qitmeer/qitmeer/database/ffldb"
+	"github.com/Qitmeer/qitmeer/engine/txscript"
+	"github.com/Qitmeer/qitmeer/params"
+)
+
+// invalidateTestChain is a phantom chain in a temporary database.
+type invalidateTestChain struct {
+	*BlockChain
+	t      *testing.T
+	db     database.DB
+	now    time.Time
+	blocks map[string]*types.SerializedBlock
+
+	// signal holds the deployment bits set in the version of the next
+	// blocks.
+	signal uint32
+}
+
+func newInvalidateTestChain(t *testing.T) (*invalidateTestChain, func()) {
+	dir, err := ioutil.TempDir("", "invalidate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	par := &params.PrivNetParams
+	db, err := database.Create("ffldb", filepath.Join(dir, "db"), par.Net)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	tc := &invalidateTestChain{
+		t:      t,
+		db:     db,
+		now:    par.GenesisBlock.Header.Timestamp,
+		blocks: map[string]*types.SerializedBlock{},
+	}
+	teardown := func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+	if err := tc.load(); err != nil {
+		teardown()
+		t.Fatal(err)
+	}
+	return tc, teardown
+}
+
+// load loads the chain from the database.
+func (tc *invalidateTestChain) load() error {
+	b, err := New(&Config{
+		DB:          tc.db,
+		ChainParams: &params.PrivNetParams,
+		TimeSource:  NewMedianTime(),
+		DAGType:     "phantom",
+	})
+	if err != nil {
+		return err
+	}
+	tc.BlockChain = b
+	return nil
+}
+
+// addBlock adds a block holding only its coinbase, which pays to anyone.
+func (tc *invalidateTestChain) addBlock(name string, parents ...string) *types.SerializedBlock {
+	var parentHashes []*hash.Hash
+	for _, p := range parents {
+		if p == "genesis" {
+			parentHashes = append(parentHashes, tc.params.GenesisHash)
+		} else {
+			parentHashes = append(parentHashes, tc.blocks[p].Hash())
+		}
+	}
+	mainParent := tc.bd.GetMainParent(tc.bd.GetIdSet(parentHashes))
+	blues := int64(tc.bd.GetBlues(tc.bd.GetIdSet(parentHashes)))
+
+	signScript, err := txscript.NewScriptBuilder().AddInt64(int64(mainParent.GetHeight() + 1)).
+		AddData([]byte(name)).Script()
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	pkScript, err := txscript.NewScriptBuilder().AddOp(txscript.OP_TRUE).Script()
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	subsidy := CalcBlockWorkSubsidy(tc.subsidyCache, blues, tc.params)
+	tax := CalcBlockTaxSubsidy(tc.subsidyCache, blues, tc.params)
+	if !tc.params.HasTax() {
+		subsidy += tax
+	}
+	coinbase := types.NewTransaction()
+	coinbase.AddTxIn(&types.TxInput{
+		PreviousOut: *types.NewOutPoint(&hash.Hash{}, types.MaxPrevOutIndex),
+		Sequence:    types.MaxTxInSequenceNum,
+		SignScript:  signScript,
+	})
+	coinbase.AddTxOut(&types.TxOutput{Amount: subsidy, PkScript: pkScript})
+	if tc.params.HasTax() {
+		coinbase.AddTxOut(&types.TxOutput{Amount: tax, PkScript: tc.params.OrganizationPkScript})
+	}
+	txns := []*types.Tx{types.NewTx(coinbase)}
+	witness := merkle.BuildMerkleTreeStore(txns, true)
+	preimage := append(witness[len(witness)-1].Bytes(), signScript...)
+	coinbase.TxIn[0].PreviousOut.Hash = hash.DoubleHashH(preimage)
+	txns[0].RefreshHash()
+
+	tc.now = tc.now.Add(tc.params.TargetTimePerBlock)
+	difficulty, err := tc.CalcNextRequiredDifficulty(tc.now, pow.BLAKE2BD)
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	version, err := tc.CalcNextBlockVersion()
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	if tc.signal != 0 {
+		version |= vbTopBits | tc.signal
+	}
+	txRoot := merkle.BuildMerkleTreeStore(txns, false)
+	parentsRoot := merkle.BuildParentsMerkleTreeStore(parentHashes)
+	block := &types.Block{
+		Header: types.BlockHeader{
+			Version:    version,
+			ParentRoot: *parentsRoot[len(parentsRoot)-1],
+			TxRoot:     *txRoot[len(txRoot)-1],
+			Timestamp:  tc.now,
+			Difficulty: difficulty,
+			Pow:        pow.GetInstance(pow.BLAKE2BD, 0, []byte{}),
+		},
+	}
+	for _, h := range parentHashes {
+		if err := block.AddParent(h); err != nil {
+			tc.t.Fatal(err)
+		}
+	}
+	if err := block.AddTransaction(coinbase); err != nil {
+		tc.t.Fatal(err)
+	}
+	sblock := types.NewBlock(block)
+	if _, err := tc.ProcessBlock(sblock, BFNoPoWCheck); err != nil {
+		tc.t.Fatalf("block %s: %v", name, err)
+	}
+	tc.blocks[name] = sblock
+	return sblock
+}
+
+// checkOrder checks the order of the blocks, nil for the unordered ones, and
+// that the coinbase outputs of the ordered blocks are the only ones in the
+// utxo set.
+func (tc *invalidateTestChain) checkOrder(desc string, ordered []string) {
+	order := map[string]uint{}
+	for i, name := range ordered {
+		order[name] = uint(i + 1)
+	}
+	if tip := tc.bd.GetMainChainTip().GetOrder(); tip != uint(len(ordered)) {
+		tc.t.Fatalf("%s: main chain tip of order %d, expected %d", desc, tip, len(ordered))
+	}
+	for name, block := range tc.blocks {
+		node := tc.index.LookupNode(block.Hash())
+		o, ok := order[name]
+		if !ok {
+			if node.IsOrdered() || tc.bd.GetBlock(block.Hash()).IsOrdered() {
+				tc.t.Fatalf("%s: block %s has the order %d", desc, name, node.order)
+			}
+		} else if node.order != uint64(o) || !tc.bd.GetBlockByOrder(o).IsEqual(block.Hash()) {
+			tc.t.Fatalf("%s: block %s has the order %d, expected %d", desc, name, node.order, o)
+		}
+		entry, err := tc.FetchUtxoEntry(*types.NewOutPoint(block.Transactions()[0].Hash(), 0))
+		if err != nil {
+			tc.t.Fatal(err)
+		}
+		if spendable := entry != nil && !entry.IsSpent(); spendable != ok {
+			tc.t.Fatalf("%s: the coinbase of the block %s is in the utxo set: %v, expected %v",
+				desc, name, spendable, ok)
+		}
+	}
+}
+
+func TestInvalidateBlockOrder(t *testing.T) {
+	tc, teardown := newInvalidateTestChain(t)
+	defer teardown()
+
+	// genesis - a - b - c - d
+	//            \- x ---/
+	tc.addBlock("a", "genesis")
+	tc.addBlock("b", "a")
+	tc.addBlock("x", "a")
+	tc.addBlock("c", "b", "x")
+	tc.addBlock("d", "c")
+	all := []string{"a", "b", "x", "c", "d"}
+	if tc.bd.GetBlock(tc.blocks["b"].Hash()).GetOrder() != 2 {
+		all = []string{"a", "x", "b", "c", "d"}
+	}
+	tc.checkOrder("initial", all)
+
+	// The future set of b leaves the order and the utxo set.
+	if err := tc.InvalidateBlock(tc.blocks["b"].Hash()); err != nil {
+		t.Fatal(err)
+	}
+	tc.checkOrder("invalidated b", []string{"a", "x"})
+	if !tc.bd.GetTips().Has(tc.blocks["x"].Hash()) || tc.bd.GetTips().Size() != 1 {
+		t.Fatalf("tips %v, expected x", tc.bd.GetTips().List())
+	}
+
+	// The new blocks are built on the valid blocks, and the children of
+	// the invalidated blocks are invalidated too.
+	tc.addBlock("y", "x")
+	tc.addBlock("e", "d")
+	tc.checkOrder("added y and e", []string{"a", "x", "y"})
+	if !tc.index.LookupNode(tc.blocks["e"].Hash()).status.Invalidated() {
+		t.Fatal("the child of an invalidated block is valid")
+	}
+
+	// The invalidated blocks stay out of the order after a restart.
+	if err := tc.load(); err != nil {
+		t.Fatal(err)
+	}
+	tc.checkOrder("loaded", []string{"a", "x", "y"})
+
+	// Invalidating x as well leaves a.
+	if err := tc.InvalidateBlock(tc.blocks["x"].Hash()); err != nil {
+		t.Fatal(err)
+	}
+	tc.checkOrder("invalidated x", []string{"a"})
+
+	// Reconsidering b keeps its future which is in the future of x.
+	if err := tc.ReconsiderBlock(tc.blocks["b"].Hash()); err != nil {
+		t.Fatal(err)
+	}
+	tc.checkOrder("reconsidered b", []string{"a", "b"})
+
+	// Reconsidering x orders the blocks as they were, followed by e.  y
+	// is then outside the main chain of e and waits for the next block.
+	if err := tc.ReconsiderBlock(tc.blocks["x"].Hash()); err != nil {
+		t.Fatal(err)
+	}
+	var orders []string
+	for o := uint(1); o <= tc.bd.GetMainChainTip().GetOrder(); o++ {
+		h := tc.bd.GetBlockByOrder(o)
+		for name, block := range tc.blocks {
+			if block.Hash().IsEqual(h) {
+				orders = append(orders, name)
+			}
+		}
+	}
+	expected := append(all, "e")
+	if len(orders) != len(expected) {
+		t.Fatalf("orders %v after reconsidering all the blocks, expected %v", orders, expected)
+	}
+	for i, name := range expected {
+		if orders[i] != name {
+			t.Fatalf("orders %v after reconsidering all the blocks, expected %v", orders, expected)
+		}
+	}
+	tc.checkOrder("reconsidered x", orders)
+}
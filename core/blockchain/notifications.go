@@ -77,12 +77,23 @@ type BlockAcceptedNotifyData struct {
 }
 
 // ReorganizationNotifyData is the structure for data indicating information
-// about a reorganization.
+// about a reorganization, which happens when a new block changes the order of
+// blocks that were already ordered in the DAG.
 type ReorganizationNotifyData struct {
-	OldHash   hash.Hash
-	OldHeight uint64
-	NewHash   hash.Hash
-	NewHeight uint64
+	// NewHash is the hash of the block that caused the reorganization.
+	NewHash hash.Hash
+
+	// OldOrders are the blocks which were detached, with their old order.
+	OldOrders []BlockOrder
+
+	// NewOrders are the blocks which were attached, with their new order.
+	NewOrders []BlockOrder
+}
+
+// BlockOrder is a block hash with its order in the DAG.
+type BlockOrder struct {
+	Hash  hash.Hash
+	Order uint64
 }
 
 // Notification defines notification that is sent to the caller via the callback
@@ -2,13 +2,24 @@
 package blockchain
 
 import (
+	"fmt"
 	"time"
+
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/dbnamespace"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/database"
 )
 
 // pruningIntervalInMinutes is the interval in which to prune the blockchain's
 // nodes and restore memory to the garbage collector.
 const pruningIntervalInMinutes = 5
 
+// pruneOrderDepth is the number of the latest blocks in the DAG order the data
+// of which is never pruned, so that the blocks and their spend journals are
+// still available when they are reordered.
+const pruneOrderDepth = 2880
+
 // chainPruner is used to occasionally prune the blockchain of old nodes that
 // can be freed to the garbage collector.
 type chainPruner struct {
@@ -35,4 +46,112 @@ func (c *chainPruner) pruneChainIfNeeded() {
 		return
 	}
 	c.lastNodeInsertTime = now
+
+	if c.chain.pruneTarget > 0 {
+		if err := c.pruneBlocks(); err != nil {
+			log.Error("Failed to prune the block files", "error", err)
+		}
+	}
+}
+
+// pruneBlocks deletes the oldest block files beyond the prune target.  The
+// files holding the blocks within pruneOrderDepth of the main chain tip are
+// kept.  The parents of the deleted blocks are saved to rebuild the block
+// index, and their spend journals are removed.
+//
+// pruneBlocks must be called with the chainLock held for writes.
+func (c *chainPruner) pruneBlocks() error {
+	b := c.chain
+	mainOrder := b.bd.GetMainChainTip().GetOrder()
+	if mainOrder <= pruneOrderDepth {
+		return nil
+	}
+	keep := b.bd.GetBlockByOrder(mainOrder - pruneOrderDepth)
+	if keep == nil {
+		return fmt.Errorf("no block of order %d", mainOrder-pruneOrderDepth)
+	}
+
+	var pruned int
+	deleted, err := b.db.PruneBlocks(b.pruneTarget, keep,
+		func(dbTx database.Tx, hashes []hash.Hash) error {
+			pruned = len(hashes)
+			return dbPutPrunedBlocks(dbTx, hashes)
+		})
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		log.Info("Pruned the block files", "blocks", pruned,
+			"bytes", deleted)
+	}
+	return nil
+}
+
+// dbPutPrunedBlocks uses an existing database transaction to save the parents
+// of the blocks about to be pruned, in their order, and to remove their spend
+// journals.
+func dbPutPrunedBlocks(dbTx database.Tx, hashes []hash.Hash) error {
+	meta := dbTx.Metadata()
+	bucket, err := meta.CreateBucketIfNotExists(
+		dbnamespace.PrunedBlocksBucketName)
+	if err != nil {
+		return err
+	}
+	for i := range hashes {
+		blockHash := &hashes[i]
+		if bucket.Get(blockHash[:]) != nil {
+			continue
+		}
+		block, err := dbFetchBlockByHash(dbTx, blockHash)
+		if err != nil {
+			return err
+		}
+		parents := block.Block().Parents
+		serialized := make([]byte, 0, len(parents)*hash.HashSize)
+		for _, parent := range parents {
+			serialized = append(serialized, parent[:]...)
+		}
+		if err := bucket.Put(blockHash[:], serialized); err != nil {
+			return err
+		}
+		if err := dbRemoveSpendJournalEntry(dbTx, blockHash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbFetchHeaderAndParents uses an existing database transaction to retrieve
+// the header and the ordered parents of the block, which may have been
+// pruned.
+func dbFetchHeaderAndParents(dbTx database.Tx, blockHash *hash.Hash) (*types.BlockHeader, []*hash.Hash, error) {
+	bucket := dbTx.Metadata().Bucket(dbnamespace.PrunedBlocksBucketName)
+	if bucket != nil {
+		serialized := bucket.Get(blockHash[:])
+		if serialized != nil {
+			if len(serialized)%hash.HashSize != 0 {
+				return nil, nil, fmt.Errorf("corrupt parents of the "+
+					"pruned block %s", blockHash)
+			}
+			header, err := dbFetchHeaderByHash(dbTx, blockHash)
+			if err != nil {
+				return nil, nil, err
+			}
+			parents := make([]*hash.Hash, 0,
+				len(serialized)/hash.HashSize)
+			for len(serialized) > 0 {
+				var parent hash.Hash
+				copy(parent[:], serialized[:hash.HashSize])
+				parents = append(parents, &parent)
+				serialized = serialized[hash.HashSize:]
+			}
+			return header, parents, nil
+		}
+	}
+
+	block, err := dbFetchBlockByHash(dbTx, blockHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &block.Block().Header, block.Block().Parents, nil
 }
@@ -0,0 +1,109 @@
+// Copyright (c) 2017-2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/blockdag"
+	"github.com/Qitmeer/qitmeer/core/blockdag/anticone"
+	"math"
+	"time"
+)
+
+const (
+	// DefaultRiskAlpha is the relative computational power of the attacker
+	// assumed when no other value is requested.
+	DefaultRiskAlpha = 0.1
+
+	// riskModelStates is the number of states of the SPECTRE risk model,
+	// which only needs to be much greater than 1.
+	riskModelStates = 50
+
+	// maxRiskAntiPast caps the anti past size handed to the risk model.
+	// The reversal probability is negligible far before it.
+	maxRiskAntiPast = 200
+)
+
+// ConfirmationRisk is the probability that a block is reversed according to
+// the SPECTRE risk model.
+type ConfirmationRisk struct {
+	Hash  hash.Hash
+	Order uint64
+
+	// AntiPast is the smallest future set size of the block and its
+	// anticone, WaitingTime the seconds since the block was created.
+	AntiPast    uint
+	WaitingTime uint
+
+	// Alpha is the relative computational power of the attacker and Risk
+	// the probability of reversal.  The block is considered secure when
+	// the risk is not above the security level of the network.
+	Alpha         float64
+	Risk          float64
+	SecurityLevel float64
+	Secure        bool
+}
+
+// riskParams returns the block rate, delay and security level of the network,
+// falling back to the anticone defaults when they are not configured.
+func (b *BlockChain) riskParams() (float64, float64, float64) {
+	lambda := b.params.BlockRate
+	if lambda <= 0 {
+		lambda = 1.0 / float64(b.params.TargetTimePerBlock/time.Second)
+	}
+	delay := b.params.BlockDelay
+	if delay <= 0 {
+		delay = anticone.BlockDelay
+	}
+	securityLevel := b.params.SecurityLevel
+	if securityLevel <= 0 {
+		securityLevel = anticone.SecurityLevel
+	}
+	return lambda, delay, securityLevel
+}
+
+// BlockConfirmationRisk returns the probability that the block with the given
+// hash is reversed by an attacker with the relative computational power alpha,
+// given the blocks that were built on it and the time it has been in the DAG.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) BlockConfirmationRisk(h *hash.Hash, alpha float64) (*ConfirmationRisk, error) {
+	if alpha <= 0 || alpha >= 0.5 {
+		return nil, fmt.Errorf("attacker power %v is not in (0, 0.5)", alpha)
+	}
+	node := b.index.LookupNode(h)
+	if node == nil {
+		return nil, fmt.Errorf("block %s is unknown", h)
+	}
+	lambda, delay, securityLevel := b.riskParams()
+
+	result := &ConfirmationRisk{
+		Hash:          *h,
+		Order:         node.GetOrder(),
+		Alpha:         alpha,
+		Risk:          1,
+		SecurityLevel: securityLevel,
+	}
+	elapsed := b.timeSource.AdjustedTime().Unix() - node.GetTimestamp()
+	if elapsed > 0 {
+		result.WaitingTime = uint(elapsed)
+	}
+
+	// A block which is invalid or not ordered yet is not confirmed at all.
+	status := b.index.NodeStatus(node)
+	if status.KnownInvalid() || status.Invalidated() ||
+		node.GetOrder() == uint64(blockdag.MaxBlockOrder) {
+		return result, nil
+	}
+	result.AntiPast = b.bd.GetAntiPastSize(h, maxRiskAntiPast)
+	if result.AntiPast > 0 {
+		risk := blockdag.GetRisk(riskModelStates, alpha, lambda, delay,
+			result.WaitingTime, int(result.AntiPast))
+		result.Risk = math.Min(math.Max(risk, 0), 1)
+	}
+	result.Secure = result.Risk <= securityLevel
+	return result, nil
+}
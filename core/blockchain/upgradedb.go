@@ -3,6 +3,7 @@ package blockchain
 import (
 	"fmt"
 	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/blockdag"
 	"github.com/Qitmeer/qitmeer/core/dbnamespace"
 	"github.com/Qitmeer/qitmeer/core/types"
 	"github.com/Qitmeer/qitmeer/database"
@@ -18,13 +19,22 @@ func (b *BlockChain) upgradeDB() error {
 	err := b.db.Update(func(dbTx database.Tx) error {
 		meta := dbTx.Metadata()
 		bidxStart := time.Now()
-		spendBucket := meta.Bucket(dbnamespace.SpendJournalBucketName)
-		if spendBucket == nil {
-			return nil
+		// The children of the DAG blocks are indexed since the version 4.
+		if b.dbInfo.version < 4 {
+			err := blockdag.DBBuildDAGBlockChildren(dbTx)
+			if err != nil {
+				return err
+			}
 		}
-		err := checkSpendJournal(dbTx, spendBucket)
-		if err != nil {
-			return err
+		// The spend journal is checked against the blocks when it
+		// comes from before the version 3.  The blocks of the newer
+		// databases may have been pruned, so they can't be read back.
+		spendBucket := meta.Bucket(dbnamespace.SpendJournalBucketName)
+		if b.dbInfo.version < 3 && spendBucket != nil {
+			err := checkSpendJournal(dbTx, spendBucket)
+			if err != nil {
+				return err
+			}
 		}
 		// save
 		b.dbInfo = &databaseInfo{
@@ -33,7 +43,7 @@ func (b *BlockChain) upgradeDB() error {
 			bidxVer: currentBlockIndexVersion,
 			created: time.Now(),
 		}
-		err = dbPutDatabaseInfo(dbTx, b.dbInfo)
+		err := dbPutDatabaseInfo(dbTx, b.dbInfo)
 		if err != nil {
 			return err
 		}
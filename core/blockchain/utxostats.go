@@ -0,0 +1,108 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"errors"
+
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/dbnamespace"
+	"github.com/Qitmeer/qitmeer/database"
+)
+
+// utxoStatsInterruptInterval is the number of utxo entries walked between the
+// checks of the interrupt channel.
+const utxoStatsInterruptInterval = 1000
+
+// errInterruptRequested indicates that an operation was cancelled due to a
+// user-requested interrupt.
+var errInterruptRequested = errors.New("interrupt requested")
+
+// interruptRequested returns true when the provided channel has been closed.
+func interruptRequested(interrupted <-chan struct{}) bool {
+	select {
+	case <-interrupted:
+		return true
+	default:
+	}
+
+	return false
+}
+
+// UtxoSetStats houses the statistics of the utxo set at a DAG order.
+type UtxoSetStats struct {
+	// Hash and Order identify the main chain tip of the utxo set.
+	Hash  hash.Hash
+	Order uint64
+
+	Count          uint64
+	TotalAmount    uint64
+	SerializedSize uint64
+
+	// UtxoSetHash is the BLAKE2b-256 of all the serialized keys and
+	// entries of the utxo set in the order of their keys, so that the utxo
+	// sets of nodes at the same order can be compared.
+	UtxoSetHash hash.Hash
+}
+
+// FetchUtxoSetStats walks the utxo set to count its entries, sum their
+// amounts and hash them.  The walk is done in a database snapshot without
+// holding the chain lock, so that blocks are still processed meanwhile.  It
+// stops with errInterruptRequested when the interrupt channel is closed.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FetchUtxoSetStats(interrupt <-chan struct{}) (*UtxoSetStats, error) {
+	// The chain lock is held until the database snapshot is taken, so that
+	// the main chain tip matches the utxo set.
+	b.ChainRLock()
+	locked := true
+	defer func() {
+		if locked {
+			b.ChainRUnlock()
+		}
+	}()
+
+	var stats *UtxoSetStats
+	err := b.db.View(func(dbTx database.Tx) error {
+		tip := b.bd.GetMainChainTip()
+		stats = &UtxoSetStats{
+			Hash:  *tip.GetHash(),
+			Order: uint64(tip.GetOrder()),
+		}
+		b.ChainRUnlock()
+		locked = false
+
+		hasher := hash.GetHasher(hash.Blake2b_256)
+		utxoBucket := dbTx.Metadata().Bucket(dbnamespace.UtxoSetBucketName)
+		cursor := utxoBucket.Cursor()
+		for ok := cursor.First(); ok; ok = cursor.Next() {
+			if stats.Count%utxoStatsInterruptInterval == 0 &&
+				interruptRequested(interrupt) {
+				return errInterruptRequested
+			}
+
+			key, serialized := cursor.Key(), cursor.Value()
+			entry, err := DeserializeUtxoEntry(serialized)
+			if err != nil {
+				return database.Error{
+					ErrorCode: database.ErrCorruption,
+					Description: "corrupt utxo entry: " +
+						err.Error(),
+				}
+			}
+			stats.Count++
+			stats.TotalAmount += entry.Amount()
+			stats.SerializedSize += uint64(len(key) + len(serialized))
+			hasher.Write(key)
+			hasher.Write(serialized)
+		}
+		copy(stats.UtxoSetHash[:], hasher.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
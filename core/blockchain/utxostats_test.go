@@ -0,0 +1,114 @@
+// Copyright (c) 2017-2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/database"
+)
+
+func TestFetchUtxoSetStats(t *testing.T) {
+	tc, teardown := newInvalidateTestChain(t)
+	defer teardown()
+
+	before, err := tc.FetchUtxoSetStats(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc.addBlock("a", "genesis")
+	tc.addBlock("b", "a")
+
+	// The coinbase outputs of the blocks are added to the utxo set.
+	var count, amount, size uint64
+	err = tc.db.View(func(dbTx database.Tx) error {
+		for _, name := range []string{"a", "b"} {
+			coinbase := tc.blocks[name].Transactions()[0]
+			for i := range coinbase.Tx.TxOut {
+				outpoint := *types.NewOutPoint(coinbase.Hash(), uint32(i))
+				entry, err := dbFetchUtxoEntry(dbTx, outpoint)
+				if err != nil {
+					return err
+				}
+				serialized, err := serializeUtxoEntry(entry)
+				if err != nil {
+					return err
+				}
+				count++
+				amount += entry.Amount()
+				size += uint64(len(*outpointKey(outpoint)) + len(serialized))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := tc.FetchUtxoSetStats(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tip := tc.bd.GetMainChainTip()
+	if stats.Hash != *tc.blocks["b"].Hash() || stats.Order != uint64(tip.GetOrder()) {
+		t.Fatalf("stats of %s at order %d, want %s at order %d", stats.Hash,
+			stats.Order, tc.blocks["b"].Hash(), tip.GetOrder())
+	}
+	if stats.Count != before.Count+count || stats.TotalAmount != before.TotalAmount+amount ||
+		stats.SerializedSize != before.SerializedSize+size {
+		t.Fatalf("got %d entries of %d for %d bytes, want %d entries of %d for %d bytes",
+			stats.Count, stats.TotalAmount, stats.SerializedSize, before.Count+count,
+			before.TotalAmount+amount, before.SerializedSize+size)
+	}
+	if stats.UtxoSetHash == before.UtxoSetHash {
+		t.Fatal("the utxo set hash did not change with the new blocks")
+	}
+
+	// The hash of the same utxo set is stable.
+	again, err := tc.FetchUtxoSetStats(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *again != *stats {
+		t.Fatalf("got stats %v, then %v", stats, again)
+	}
+
+	// Spending an output changes the hash.
+	var spent *UtxoEntry
+	err = tc.db.Update(func(dbTx database.Tx) error {
+		outpoint := *types.NewOutPoint(tc.blocks["a"].Transactions()[0].Hash(), 0)
+		var err error
+		spent, err = dbFetchUtxoEntry(dbTx, outpoint)
+		if err != nil {
+			return err
+		}
+		spent.Spend()
+		view := NewUtxoViewpoint()
+		view.entries[outpoint] = spent
+		return dbPutUtxoView(dbTx, view)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := tc.FetchUtxoSetStats(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Count != stats.Count-1 || after.TotalAmount != stats.TotalAmount-spent.Amount() {
+		t.Fatalf("got %d entries of %d after the spend, want %d entries of %d",
+			after.Count, after.TotalAmount, stats.Count-1, stats.TotalAmount-spent.Amount())
+	}
+	if after.UtxoSetHash == stats.UtxoSetHash {
+		t.Fatal("the utxo set hash did not change with the spend")
+	}
+
+	// The walk stops on an interrupt.
+	interrupt := make(chan struct{})
+	close(interrupt)
+	if _, err := tc.FetchUtxoSetStats(interrupt); err != errInterruptRequested {
+		t.Fatalf("got error %v, want %v", err, errInterruptRequested)
+	}
+}
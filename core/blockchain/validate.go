@@ -747,6 +747,14 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *types.SerializedB
 		return ruleError(ErrMissingTxOut, str)
 	}
 
+	// The transactions of the blocks invalidated by the node operator are
+	// never applied.
+	if node.status.Invalidated() {
+		str := fmt.Sprintf("block %v or one of its ancestors was "+
+			"invalidated", node.hash)
+		return ruleError(ErrInvalidatedBlock, str)
+	}
+
 	// Don't run scripts if this node is before the latest known good
 	// checkpoint since the validity is verified via the checkpoints (all
 	// transactions are included in the merkle root hash and any changes
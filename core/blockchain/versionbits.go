@@ -0,0 +1,278 @@
+// Copyright (c) 2017-2020 The qitmeer developers
+// Copyright (c) 2016-2017 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/params"
+)
+
+const (
+	// vbTopBits defines the bits to set in the version to signal that the
+	// version bits scheme is being used.
+	vbTopBits = 0x20000000
+
+	// vbTopMask is the bitmask to use to determine whether or not the
+	// version bits scheme is in use.
+	vbTopMask = 0xe0000000
+
+	// vbFirstBit is the first bit available to deployments.  The lower bits
+	// hold the block version which is compared by the consensus rules, and
+	// the upper ones are reserved to the version bits scheme, see
+	// types.BlockHeader.GetVersion.
+	vbFirstBit = 16
+
+	// vbNumBits is the total number of bits available for use with the
+	// version bits scheme.
+	vbNumBits = 29
+)
+
+// deploymentChecker provides a thresholdConditionChecker which can be used to
+// test a specific deployment rule.  This is required for properly detecting
+// and activating consensus rule changes.
+type deploymentChecker struct {
+	deployment *params.ConsensusDeployment
+	chain      *BlockChain
+}
+
+// Ensure the deploymentChecker type implements the thresholdConditionChecker
+// interface.
+var _ thresholdConditionChecker = deploymentChecker{}
+
+// BeginTime returns the unix timestamp for the median block time after which
+// voting on a rule change starts (at the next window).
+//
+// This implementation returns the value defined by the specific deployment the
+// checker is associated with.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c deploymentChecker) BeginTime() uint64 {
+	return c.deployment.StartTime
+}
+
+// EndTime returns the unix timestamp for the median block time after which an
+// attempted rule change fails if it has not already been locked in or
+// activated.
+//
+// This implementation returns the value defined by the specific deployment the
+// checker is associated with.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c deploymentChecker) EndTime() uint64 {
+	return c.deployment.ExpireTime
+}
+
+// RuleChangeActivationThreshold is the number of blocks for which the condition
+// must be true in order to lock in a rule change.
+//
+// This implementation returns the value defined by the chain params the checker
+// is associated with.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c deploymentChecker) RuleChangeActivationThreshold() uint32 {
+	return c.chain.params.RuleChangeActivationThreshold
+}
+
+// MinerConfirmationWindow is the number of main chain blocks in each threshold
+// state retarget window.
+//
+// This implementation returns the value defined by the chain params the checker
+// is associated with.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c deploymentChecker) MinerConfirmationWindow() uint32 {
+	return c.chain.params.MinerConfirmationWindow
+}
+
+// Condition returns true when the specific bit defined by the deployment
+// associated with the checker is set.
+//
+// This is part of the thresholdConditionChecker interface implementation.
+func (c deploymentChecker) Condition(node *blockNode) (bool, error) {
+	conditionMask := uint32(1) << c.deployment.BitNumber
+	version := node.blockVersion
+	return (version&vbTopMask == vbTopBits) && (version&conditionMask != 0),
+		nil
+}
+
+// deployments returns the deployments voted on with the block version of the
+// chain.
+func (b *BlockChain) deployments() []params.ConsensusDeployment {
+	return b.params.Deployments[b.BlockVersion]
+}
+
+// checkDeployments ensures the deployments of the chain use valid and unique
+// version bits.
+func (b *BlockChain) checkDeployments() error {
+	used := make(map[uint8]int)
+	for id, deployment := range b.deployments() {
+		if deployment.BitNumber < vbFirstBit || deployment.BitNumber >= vbNumBits {
+			return AssertError(fmt.Sprintf("deployment %d uses bit %d "+
+				"outside of [%d, %d)", id, deployment.BitNumber,
+				vbFirstBit, vbNumBits))
+		}
+		if other, ok := used[deployment.BitNumber]; ok {
+			return AssertError(fmt.Sprintf("deployments %d and %d use "+
+				"the same bit %d", other, id, deployment.BitNumber))
+		}
+		used[deployment.BitNumber] = id
+	}
+	return nil
+}
+
+// deploymentState returns the current rule change threshold for a given
+// deployment ID for the block AFTER the provided node.
+func (b *BlockChain) deploymentState(prevNode *blockNode, deploymentID uint32) (ThresholdState, error) {
+	deployments := b.deployments()
+	if deploymentID >= uint32(len(deployments)) {
+		return ThresholdFailed, DeploymentError(fmt.Sprintf("%d", deploymentID))
+	}
+
+	b.deploymentLock.Lock()
+	defer b.deploymentLock.Unlock()
+
+	checker := deploymentChecker{deployment: &deployments[deploymentID], chain: b}
+	cache := &b.deploymentCaches[deploymentID]
+	return b.thresholdState(prevNode, checker, cache)
+}
+
+// isDeploymentActive returns whether the deployment is active for the block
+// AFTER the provided node.  Validation uses it to gate the rules introduced by
+// a deployment.
+func (b *BlockChain) isDeploymentActive(prevNode *blockNode, deploymentID uint32) (bool, error) {
+	state, err := b.deploymentState(prevNode, deploymentID)
+	if err != nil {
+		return false, err
+	}
+	return state == ThresholdActive, nil
+}
+
+// calcNextBlockVersion calculates the expected version of the block after the
+// passed previous block node based on the state of started and locked in
+// rule change deployments.  When no deployment is being voted on, the plain
+// block version of the chain is returned.
+func (b *BlockChain) calcNextBlockVersion(prevNode *blockNode) (uint32, error) {
+	expectedVersion := uint32(vbTopBits)
+	for id, deployment := range b.deployments() {
+		state, err := b.deploymentState(prevNode, uint32(id))
+		if err != nil {
+			return 0, err
+		}
+		if state == ThresholdStarted || state == ThresholdLockedIn {
+			expectedVersion |= uint32(1) << deployment.BitNumber
+		}
+	}
+	if expectedVersion == vbTopBits {
+		return b.BlockVersion, nil
+	}
+	return expectedVersion | b.BlockVersion, nil
+}
+
+// mainTipNode returns the block node of the main chain tip.
+func (b *BlockChain) mainTipNode() *blockNode {
+	return b.index.LookupNode(b.bd.GetMainChainTip().GetHash())
+}
+
+// CalcNextBlockVersion calculates the expected version of the block after the
+// end of the current main chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CalcNextBlockVersion() (uint32, error) {
+	b.ChainRLock()
+	defer b.ChainRUnlock()
+	return b.calcNextBlockVersion(b.mainTipNode())
+}
+
+// ThresholdState returns the current rule change threshold state of the given
+// deployment ID for the block AFTER the end of the current main chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ThresholdState(deploymentID uint32) (ThresholdState, error) {
+	b.ChainRLock()
+	defer b.ChainRUnlock()
+	return b.deploymentState(b.mainTipNode(), deploymentID)
+}
+
+// IsDeploymentActive returns true if the target deploymentID is active, and
+// false otherwise.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) IsDeploymentActive(deploymentID uint32) (bool, error) {
+	b.ChainRLock()
+	defer b.ChainRUnlock()
+	return b.isDeploymentActive(b.mainTipNode(), deploymentID)
+}
+
+// DeploymentStatus describes a deployment and its state for the block after
+// the main chain tip.
+type DeploymentStatus struct {
+	ID         uint32
+	Deployment params.ConsensusDeployment
+	State      ThresholdState
+
+	// Count is the number of blocks of the current window which signal
+	// the deployment.  It is only set while the deployment is started.
+	Count uint32
+}
+
+// DeploymentInfo describes the state of all deployments for the block after
+// the main chain tip.
+type DeploymentInfo struct {
+	Hash        hash.Hash
+	Height      uint
+	Window      uint32
+	Threshold   uint32
+	Elapsed     uint32
+	Deployments []DeploymentStatus
+}
+
+// FetchDeploymentInfo returns the state of all deployments for the block after
+// the main chain tip along with the progress of the current window.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FetchDeploymentInfo() (*DeploymentInfo, error) {
+	b.ChainRLock()
+	defer b.ChainRUnlock()
+
+	tip := b.mainTipNode()
+	info := &DeploymentInfo{
+		Hash:      tip.hash,
+		Height:    tip.GetHeight(),
+		Window:    b.params.MinerConfirmationWindow,
+		Threshold: b.params.RuleChangeActivationThreshold,
+	}
+	if info.Window > 0 {
+		info.Elapsed = uint32((tip.GetHeight() + 1) % uint(info.Window))
+	}
+	for id, deployment := range b.deployments() {
+		state, err := b.deploymentState(tip, uint32(id))
+		if err != nil {
+			return nil, err
+		}
+		status := DeploymentStatus{
+			ID:         uint32(id),
+			Deployment: deployment,
+			State:      state,
+		}
+		if state == ThresholdStarted {
+			checker := deploymentChecker{deployment: &deployment, chain: b}
+			node := tip
+			for i := uint32(0); i < info.Elapsed && node != nil; i++ {
+				condition, err := checker.Condition(node)
+				if err != nil {
+					return nil, err
+				}
+				if condition {
+					status.Count++
+				}
+				node = node.GetMainParent(b)
+			}
+		}
+		info.Deployments = append(info.Deployments, status)
+	}
+	return info, nil
+}
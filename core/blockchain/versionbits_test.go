@@ -0,0 +1,226 @@
+// Copyright (c) 2017-2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/Qitmeer/qitmeer/params"
+)
+
+func TestThresholdStateStringer(t *testing.T) {
+	for state := ThresholdDefined; state < numThresholdsStates; state++ {
+		if thresholdStateStrings[state] == "" {
+			t.Fatalf("threshold state %d has no name", state)
+		}
+	}
+	if ThresholdLockedIn.String() != "ThresholdLockedIn" {
+		t.Fatalf("unexpected name %s", ThresholdLockedIn)
+	}
+	if numThresholdsStates.String() != "Unknown ThresholdState (5)" {
+		t.Fatalf("unexpected name %s", numThresholdsStates)
+	}
+}
+
+func TestDeploymentCondition(t *testing.T) {
+	checker := deploymentChecker{deployment: &params.ConsensusDeployment{BitNumber: 17}}
+	tests := []struct {
+		version uint32
+		want    bool
+	}{
+		{version: 12, want: false},
+		{version: vbTopBits | 12, want: false},
+		{version: vbTopBits | 1<<17 | 12, want: true},
+		{version: vbTopBits | 1<<18 | 12, want: false},
+		// The bit only counts with the version bits top bits.
+		{version: 1<<17 | 12, want: false},
+		{version: 0xe0000000 | 1<<17 | 12, want: false},
+	}
+	for i, test := range tests {
+		got, err := checker.Condition(&blockNode{blockVersion: test.version})
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if got != test.want {
+			t.Errorf("test %d: got condition %v for version %08x, want %v",
+				i, got, test.version, test.want)
+		}
+	}
+}
+
+func TestCheckDeployments(t *testing.T) {
+	tests := []struct {
+		bits  []uint8
+		valid bool
+	}{
+		{bits: nil, valid: true},
+		{bits: []uint8{16, 28}, valid: true},
+		{bits: []uint8{15}, valid: false},
+		{bits: []uint8{29}, valid: false},
+		{bits: []uint8{20, 20}, valid: false},
+	}
+	for i, test := range tests {
+		par := params.Params{Deployments: map[uint32][]params.ConsensusDeployment{}}
+		for _, bit := range test.bits {
+			par.Deployments[12] = append(par.Deployments[12],
+				params.ConsensusDeployment{BitNumber: bit})
+		}
+		b := BlockChain{params: &par, BlockVersion: 12}
+		err := b.checkDeployments()
+		if (err == nil) != test.valid {
+			t.Errorf("test %d: unexpected result %v", i, err)
+		}
+	}
+}
+
+// testThresholdChecker is a deployment voted with the bit 17 of the block
+// version in windows of 4 blocks.
+type testThresholdChecker struct {
+	begin     uint64
+	end       uint64
+	threshold uint32
+}
+
+func (c testThresholdChecker) BeginTime() uint64                     { return c.begin }
+func (c testThresholdChecker) EndTime() uint64                       { return c.end }
+func (c testThresholdChecker) RuleChangeActivationThreshold() uint32 { return c.threshold }
+func (c testThresholdChecker) MinerConfirmationWindow() uint32       { return 4 }
+
+func (c testThresholdChecker) Condition(node *blockNode) (bool, error) {
+	return deploymentChecker{deployment: &params.ConsensusDeployment{BitNumber: 17}}.Condition(node)
+}
+
+func TestThresholdState(t *testing.T) {
+	const window = 4
+	tests := []struct {
+		name string
+		// votes is the number of blocks signaling in each window, the
+		// genesis block never does.
+		votes []int
+		// begin and end are the heights of the blocks whose median time
+		// starts and expires the deployment, -1 for none.
+		begin int
+		end   int
+		// states are the states of the windows after the first one.
+		states []ThresholdState
+	}{
+		{
+			name:   "activation",
+			votes:  []int{0, 3, 0, 0},
+			begin:  -1,
+			end:    -1,
+			states: []ThresholdState{ThresholdStarted, ThresholdLockedIn, ThresholdActive, ThresholdActive},
+		},
+		{
+			name:   "threshold boundary",
+			votes:  []int{0, 2, 3, 0},
+			begin:  -1,
+			end:    -1,
+			states: []ThresholdState{ThresholdStarted, ThresholdStarted, ThresholdLockedIn, ThresholdActive},
+		},
+		{
+			name:   "votes before the start",
+			votes:  []int{3, 3, 3, 0},
+			begin:  7,
+			end:    -1,
+			states: []ThresholdState{ThresholdDefined, ThresholdStarted, ThresholdLockedIn, ThresholdActive},
+		},
+		{
+			name:   "expiry",
+			votes:  []int{0, 2, 3, 3},
+			begin:  -1,
+			end:    7,
+			states: []ThresholdState{ThresholdStarted, ThresholdFailed, ThresholdFailed, ThresholdFailed},
+		},
+		{
+			name:   "locked in before the expiry",
+			votes:  []int{0, 3, 0, 0},
+			begin:  -1,
+			end:    11,
+			states: []ThresholdState{ThresholdStarted, ThresholdLockedIn, ThresholdActive, ThresholdActive},
+		},
+	}
+	for _, test := range tests {
+		func() {
+			tc, teardown := newInvalidateTestChain(t)
+			defer teardown()
+
+			nodes := []*blockNode{tc.index.LookupNode(tc.params.GenesisHash)}
+			parent := "genesis"
+			for i, votes := range test.votes {
+				for j := 0; j < window; j++ {
+					height := i*window + j
+					if height == 0 {
+						continue
+					}
+					tc.signal = 0
+					if votes > 0 {
+						tc.signal = 1 << 17
+						votes--
+					}
+					name := strconv.Itoa(height)
+					block := tc.addBlock(name, parent)
+					parent = name
+					nodes = append(nodes, tc.index.LookupNode(block.Hash()))
+				}
+			}
+			medianTime := func(height int) uint64 {
+				if height < 0 {
+					return 0
+				}
+				return uint64(nodes[height].CalcPastMedianTime(tc.BlockChain).Unix())
+			}
+			checker := testThresholdChecker{
+				begin:     medianTime(test.begin),
+				end:       math.MaxUint64,
+				threshold: 3,
+			}
+			if test.end >= 0 {
+				checker.end = medianTime(test.end)
+			}
+
+			cache := &newThresholdCaches(1)[0]
+			for height, node := range nodes {
+				want := ThresholdDefined
+				if w := (height + 1) / window; w > 0 {
+					want = test.states[w-1]
+				}
+				got, err := tc.thresholdState(node, checker, cache)
+				if err != nil {
+					t.Fatalf("%s: %v", test.name, err)
+				}
+				if got != want {
+					t.Fatalf("%s: state %v after the block %d, want %v",
+						test.name, got, height, want)
+				}
+			}
+
+			// Only the last block of each window is cached, and the
+			// cached states are not calculated again.
+			if len(cache.entries) != len(test.votes) {
+				t.Fatalf("%s: %d cached states, want %d", test.name,
+					len(cache.entries), len(test.votes))
+			}
+			for i := range test.votes {
+				last := nodes[i*window+window-1]
+				if _, ok := cache.Lookup(last.GetHash()); !ok {
+					t.Fatalf("%s: no cached state for the window %d", test.name, i)
+				}
+			}
+			cache.Update(nodes[2*window-1].GetHash(), ThresholdFailed)
+			cache.Update(nodes[3*window-1].GetHash(), ThresholdFailed)
+			delete(cache.entries, *nodes[4*window-1].GetHash())
+			got, err := tc.thresholdState(nodes[4*window-1], checker, cache)
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			if got != ThresholdFailed {
+				t.Fatalf("%s: state %v not derived from the cache", test.name, got)
+			}
+		}()
+	}
+}
@@ -414,8 +414,19 @@ const (
 
 	// StatusBadSide
 	StatusBadSide BlockStatus = 1 << 0
+
+	// StatusInvalidated indicates that the block or one of its ancestors
+	// was invalidated by the node operator.  The lower bits are used by
+	// the validation status of the block chain.
+	StatusInvalidated BlockStatus = 1 << 3
 )
 
 func (status BlockStatus) IsBadSide() bool {
 	return status&StatusBadSide != 0
 }
+
+// IsInvalidated returns whether the block or one of its ancestors was
+// invalidated by the node operator.
+func (status BlockStatus) IsInvalidated() bool {
+	return status&StatusInvalidated != 0
+}
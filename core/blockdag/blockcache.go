@@ -0,0 +1,178 @@
+// Copyright (c) 2017-2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockdag
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/database"
+)
+
+// loadedCacheSize is the number of the blocks loaded from the database which
+// stay in memory after they were evicted.
+const loadedCacheSize = 1000
+
+// blockCache holds the blocks loaded from the database, the oldest one is
+// dropped once it is full.
+type blockCache struct {
+	blocks map[uint]IBlock
+	ids    []uint
+	next   int
+}
+
+func newBlockCache(size int) *blockCache {
+	return &blockCache{
+		blocks: map[uint]IBlock{},
+		ids:    make([]uint, 0, size),
+	}
+}
+
+func (c *blockCache) get(id uint) IBlock {
+	return c.blocks[id]
+}
+
+func (c *blockCache) add(ib IBlock) {
+	if len(c.ids) < cap(c.ids) {
+		c.ids = append(c.ids, ib.GetID())
+	} else {
+		delete(c.blocks, c.ids[c.next])
+		c.ids[c.next] = ib.GetID()
+		c.next = (c.next + 1) % len(c.ids)
+	}
+	c.blocks[ib.GetID()] = ib
+}
+
+// SetCacheWindow keeps in memory only the blocks within window layers of the
+// highest tip, the older blocks are evicted and loaded again from the
+// database when needed.  The blocks out of the window must no longer change,
+// so it has to be deeper than any reorganization.  It is only supported by
+// the phantom DAG with a database, and has to be set before any block is
+// added or loaded.  Phantom_v2 is rejected like the other DAGs since it keeps
+// its own copy of every block and doesn't load them from the database.  A
+// window of zero keeps all the blocks in memory.
+//
+// The window doesn't cap the memory use: the order of every block stays in
+// memory so the blocks can still be found by their order, as well as the
+// nodes of the block index of the chain.  Only the blocks, with their sets of
+// parents and children, are evicted so the memory grows much slower.
+func (bd *BlockDAG) SetCacheWindow(window uint) error {
+	bd.stateLock.Lock()
+	defer bd.stateLock.Unlock()
+
+	if window == 0 {
+		bd.cacheWindow = 0
+		return nil
+	}
+	if _, ok := bd.instance.(*Phantom); !ok {
+		return fmt.Errorf("The %s DAG does not support a cache window", bd.instance.GetName())
+	}
+	if bd.db == nil {
+		return fmt.Errorf("The DAG cache window requires a database")
+	}
+	if bd.blockTotal > 0 {
+		return fmt.Errorf("The DAG cache window must be set before adding blocks")
+	}
+	bd.cacheWindow = window
+	bd.loaded = newBlockCache(loadedCacheSize)
+	return nil
+}
+
+// loadBlock returns a block which was evicted from memory, from the loaded
+// blocks or the database.  Its parents and children only hold their ids.  It
+// returns nil without an error when the block is unknown.
+func (bd *BlockDAG) loadBlock(id uint) (IBlock, error) {
+	if bd.loaded == nil || id >= bd.blockTotal {
+		return nil, nil
+	}
+	if ib := bd.loaded.get(id); ib != nil {
+		return ib, nil
+	}
+	block := &Block{id: id}
+	ib := bd.instance.CreateBlock(block)
+	err := bd.db.View(func(dbTx database.Tx) error {
+		err := DBGetDAGBlock(dbTx, ib)
+		if err != nil {
+			return err
+		}
+		children, err := DBGetDAGBlockChildren(dbTx, id)
+		if err != nil {
+			return err
+		}
+		if len(children) > 0 {
+			block.children = NewIdSet()
+			block.children.AddList(children)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the DAG block %d: %v", id, err)
+	}
+	bd.loaded.add(ib)
+	return ib, nil
+}
+
+// addRef adds a block to a set of parents or children, by reference when it
+// is in memory and by id otherwise so its loaded copy can be dropped.
+func (bd *BlockDAG) addRef(s *IdSet, ib IBlock) {
+	if _, ok := bd.blocks[ib.GetID()]; ok {
+		s.AddPair(ib.GetID(), ib)
+	} else {
+		s.Add(ib.GetID())
+	}
+}
+
+// resolveSet returns a copy of a set of parents or children holding the
+// blocks, the evicted ones being loaded from the database.  The blocks which
+// fail to be loaded are left out.
+func (bd *BlockDAG) resolveSet(s *IdSet) *IdSet {
+	result := NewIdSet()
+	for k := range s.GetMap() {
+		if ib := bd.getBlockById(k); ib != nil {
+			result.AddPair(k, ib)
+		}
+	}
+	return result
+}
+
+// evictBlocks removes from memory the blocks which fell out of the cache
+// window, except the genesis, the tips and the blocks which are not ordered
+// yet.  The resident blocks then refer to them by id.  The order of the
+// evicted blocks is kept.  It runs before a block is added, once the changes
+// of the previous one were stored.
+func (bd *BlockDAG) evictBlocks() {
+	if bd.cacheWindow == 0 || bd.tips == nil {
+		return
+	}
+	var maxLayer uint
+	for _, v := range bd.tips.GetMap() {
+		if layer := v.(IBlock).GetLayer(); layer > maxLayer {
+			maxLayer = layer
+		}
+	}
+	if maxLayer <= bd.cacheWindow || maxLayer-bd.cacheWindow <= bd.evictedLayer {
+		return
+	}
+	bd.evictedLayer = maxLayer - bd.cacheWindow
+
+	for id, ib := range bd.blocks {
+		if id == 0 || ib.GetLayer() >= bd.evictedLayer || bd.tips.Has(id) || !ib.IsOrdered() {
+			continue
+		}
+		delete(bd.blocks, id)
+		if ib.HasParents() {
+			for k := range ib.GetParents().GetMap() {
+				if parent, ok := bd.blocks[k]; ok {
+					parent.GetChildren().Add(id)
+				}
+			}
+		}
+		if ib.HasChildren() {
+			for k := range ib.GetChildren().GetMap() {
+				if child, ok := bd.blocks[k]; ok {
+					child.GetParents().Add(id)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,317 @@
+// Copyright (c) 2017-2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockdag
+
+import (
+	"container/list"
+	"encoding/binary"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/dbnamespace"
+	"github.com/Qitmeer/qitmeer/core/protocol"
+	"github.com/Qitmeer/qitmeer/database"
+	_ "github.com/Qitmeer/qitmeer/database/ffldb"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func testCacheDB(t *testing.T) (database.DB, func()) {
+	dir, err := ioutil.TempDir("", "blockcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := database.Create("ffldb", filepath.Join(dir, "db"), protocol.PrivNet)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	err = db.Update(func(dbTx database.Tx) error {
+		_, err := dbTx.Metadata().CreateBucket(dbnamespace.BlockIndexBucketName)
+		if err != nil {
+			return err
+		}
+		_, err = dbTx.Metadata().CreateBucket(dbnamespace.BlockChildrenBucketName)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// testCacheDAG is a phantom DAG with its own block ids.
+type testCacheDAG struct {
+	bd  *BlockDAG
+	ids map[hash.Hash]uint
+}
+
+func newTestCacheDAG(db database.DB) *testCacheDAG {
+	d := &testCacheDAG{bd: &BlockDAG{}, ids: map[hash.Hash]uint{}}
+	d.bd.Init(phantom, CalcBlockWeight, -1, d.getBlockId, db)
+	return d
+}
+
+func (d *testCacheDAG) getBlockId(h *hash.Hash) uint {
+	if id, ok := d.ids[*h]; ok {
+		return id
+	}
+	return MaxId
+}
+
+// addBlock adds the block and stores the reordered blocks like the chain.
+func (d *testCacheDAG) addBlock(t *testing.T, block *TestBlock) (*list.List, IBlock) {
+	l, ib := d.bd.AddBlock(block)
+	if ib == nil {
+		return l, ib
+	}
+	d.ids[*ib.GetHash()] = ib.GetID()
+	if d.bd.db == nil {
+		return l, ib
+	}
+	err := d.bd.db.Update(func(dbTx database.Tx) error {
+		for e := l.Front(); e != nil; e = e.Next() {
+			err := DBPutDAGBlock(dbTx, e.Value.(IBlock))
+			if err != nil {
+				return err
+			}
+		}
+		return DBPutDAGBlock(dbTx, ib)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l, ib
+}
+
+// buildRandomDAG adds the blocks of a random DAG to the DAGs.  Each block
+// sees the DAG of the first one up to a few blocks ago, as if they were
+// delayed, and picks its parents among the tips of that view.
+func buildRandomDAG(t *testing.T, seed int64, total int, dags ...*testCacheDAG) {
+	r := rand.New(rand.NewSource(seed))
+	ref := dags[0].bd
+	for i := 0; i < total; i++ {
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], uint64(i))
+		block := &TestBlock{hash: hash.DoubleHashH(b[:]), parents: NewIdSet(), timeStamp: int64(i)}
+		if i > 0 {
+			view := ref.GetBlockTotal()
+			if delay := uint(r.Intn(4)); view > delay {
+				view -= delay
+			}
+			tips := []IBlock{}
+			for id := uint(0); id < view; id++ {
+				if view-id > 30 {
+					id = view - 30
+				}
+				ib := ref.GetBlockById(id)
+				isTip := true
+				if ib.HasChildren() {
+					for k := range ib.GetChildren().GetMap() {
+						if k < view {
+							isTip = false
+							break
+						}
+					}
+				}
+				if isTip {
+					tips = append(tips, ib)
+				}
+			}
+			sort.Slice(tips, func(i, j int) bool {
+				return tips[i].GetLayer() > tips[j].GetLayer() ||
+					tips[i].GetLayer() == tips[j].GetLayer() && tips[i].GetID() < tips[j].GetID()
+			})
+			for _, j := range r.Perm(len(tips)) {
+				if tips[0].GetLayer()-tips[j].GetLayer() <= 2 && block.parents.Size() < 3 {
+					block.parents.Add(tips[j].GetID())
+				}
+			}
+		}
+
+		// The blocks which are not ordered yet come in no particular order.
+		var added []IBlock
+		var orders []map[uint]uint
+		for _, d := range dags {
+			l, ib := d.addBlock(t, block)
+			added = append(added, ib)
+			order := map[uint]uint{}
+			if l != nil {
+				for e := l.Front(); e != nil; e = e.Next() {
+					order[e.Value.(IBlock).GetID()] = e.Value.(IBlock).GetOrder()
+				}
+			}
+			orders = append(orders, order)
+		}
+		for j := 1; j < len(dags); j++ {
+			if (added[0] == nil) != (added[j] == nil) {
+				t.Fatalf("block %d added to one DAG only", i)
+			}
+			if !reflect.DeepEqual(orders[0], orders[j]) {
+				t.Fatalf("block %d reordered %v and %v", i, orders[0], orders[j])
+			}
+		}
+	}
+}
+
+// compareDAG checks that both DAGs hold the same blocks in the same order.
+func compareDAG(t *testing.T, expected *BlockDAG, got *BlockDAG) {
+	if expected.GetBlockTotal() != got.GetBlockTotal() {
+		t.Fatalf("%d blocks, expected %d", got.GetBlockTotal(), expected.GetBlockTotal())
+	}
+	if !expected.GetMainChainTip().GetHash().IsEqual(got.GetMainChainTip().GetHash()) {
+		t.Fatalf("main chain tip %s, expected %s", got.GetMainChainTip().GetHash(),
+			expected.GetMainChainTip().GetHash())
+	}
+	for id := uint(0); id < expected.GetBlockTotal(); id++ {
+		e := expected.GetBlockById(id)
+		g := got.GetBlockById(id)
+		if g == nil {
+			t.Fatalf("block %d is missing", id)
+		}
+		if !e.GetHash().IsEqual(g.GetHash()) || e.GetOrder() != g.GetOrder() ||
+			e.GetLayer() != g.GetLayer() || e.GetHeight() != g.GetHeight() ||
+			e.GetMainParent() != g.GetMainParent() {
+			t.Fatalf("block %d is (%s, order %d, layer %d, height %d, main parent %d), "+
+				"expected (%s, order %d, layer %d, height %d, main parent %d)", id,
+				g.GetHash(), g.GetOrder(), g.GetLayer(), g.GetHeight(), g.GetMainParent(),
+				e.GetHash(), e.GetOrder(), e.GetLayer(), e.GetHeight(), e.GetMainParent())
+		}
+		if e.HasParents() != g.HasParents() || e.HasParents() && !e.GetParents().IsEqual(g.GetParents()) {
+			t.Fatalf("block %d has different parents", id)
+		}
+		if e.HasChildren() != g.HasChildren() || e.HasChildren() && !e.GetChildren().IsEqual(g.GetChildren()) {
+			t.Fatalf("block %d has different children", id)
+		}
+		if expected.instance.IsBlue(id) != got.instance.IsBlue(id) {
+			t.Fatalf("block %d has a different color", id)
+		}
+		if e.IsOrdered() && !got.GetBlockByOrder(e.GetOrder()).IsEqual(e.GetHash()) {
+			t.Fatalf("block %d is not found by its order %d", id, e.GetOrder())
+		}
+	}
+}
+
+func TestCacheWindow(t *testing.T) {
+	db, teardown := testCacheDB(t)
+	defer teardown()
+
+	ref := newTestCacheDAG(nil)
+	if err := ref.bd.SetCacheWindow(10); err == nil {
+		t.Fatal("cache window set without a database")
+	}
+	cached := newTestCacheDAG(db)
+	if err := cached.bd.SetCacheWindow(20); err != nil {
+		t.Fatal(err)
+	}
+	// Drop the loaded blocks often so they are read from the database.
+	cached.bd.loaded = newBlockCache(16)
+
+	const total = 600
+	buildRandomDAG(t, 1, total, ref, cached)
+	compareDAG(t, ref.bd, cached.bd)
+	if resident := len(cached.bd.blocks); resident >= total/2 {
+		t.Fatalf("%d of %d blocks stay in memory", resident, total)
+	}
+	if err := cached.bd.SetCacheWindow(10); err == nil {
+		t.Fatal("cache window changed after adding blocks")
+	}
+
+	// The DAG loaded from the database evicts the old blocks as well.
+	err := db.Update(func(dbTx database.Tx) error {
+		return DBPutDAGInfo(dbTx, cached.bd)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := newTestCacheDAG(db)
+	loaded.ids = cached.ids
+	if err := loaded.bd.SetCacheWindow(20); err != nil {
+		t.Fatal(err)
+	}
+	genesis := ref.bd.GetGenesisHash()
+	err = db.View(func(dbTx database.Tx) error {
+		return loaded.bd.Load(dbTx, total, genesis)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareDAG(t, ref.bd, loaded.bd)
+	if resident := len(loaded.bd.blocks); resident >= total/2 {
+		t.Fatalf("%d of %d blocks stay in memory after loading", resident, total)
+	}
+}
+
+func TestCacheWindowUnsupported(t *testing.T) {
+	db, teardown := testCacheDB(t)
+	defer teardown()
+
+	for _, dagType := range []string{conflux, spectre, phantom_v2} {
+		bd := &BlockDAG{}
+		bd.Init(dagType, CalcBlockWeight, -1, onGetBlockId, db)
+		if err := bd.SetCacheWindow(20); err == nil {
+			t.Errorf("cache window set for %s", dagType)
+		}
+	}
+}
+
+func TestCacheWindowLoadError(t *testing.T) {
+	db, teardown := testCacheDB(t)
+	defer teardown()
+
+	cached := newTestCacheDAG(db)
+	if err := cached.bd.SetCacheWindow(20); err != nil {
+		t.Fatal(err)
+	}
+	buildRandomDAG(t, 2, 200, cached)
+
+	// Lose an evicted block, reading it is then an error, and fatal for the
+	// ordering and coloring of the DAG.
+	var lost uint
+	for id := uint(1); id < cached.bd.GetBlockTotal(); id++ {
+		if _, ok := cached.bd.blocks[id]; !ok {
+			lost = id
+			break
+		}
+	}
+	if lost == 0 {
+		t.Fatal("no block was evicted")
+	}
+	err := db.Update(func(dbTx database.Tx) error {
+		var key [4]byte
+		dbnamespace.ByteOrder.PutUint32(key[:], uint32(lost))
+		return dbTx.Metadata().Bucket(dbnamespace.BlockIndexBucketName).Delete(key[:])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached.bd.loaded = newBlockCache(loadedCacheSize)
+
+	if _, err := cached.bd.loadBlock(lost); err == nil {
+		t.Fatalf("block %d loaded without its record", lost)
+	}
+	if _, err := cached.bd.fetchBlockById(lost); err == nil {
+		t.Fatalf("block %d fetched without its record", lost)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("block %d returned without its record", lost)
+			}
+		}()
+		cached.bd.GetBlockById(lost)
+	}()
+	if _, err := cached.bd.ExportDAG(0, cached.bd.GetBlockTotal()); err == nil {
+		t.Fatal("DAG exported with a lost block")
+	}
+}
@@ -187,6 +187,17 @@ type BlockDAG struct {
 	getBlockId GetBlockId
 
 	db database.DB
+
+	// The number of layers below the highest tip the blocks stay in memory,
+	// the older blocks are loaded from the database. All the blocks stay in
+	// memory when it is zero.
+	cacheWindow uint
+
+	// The layer below which the blocks were evicted.
+	evictedLayer uint
+
+	// The blocks loaded from the database after their eviction.
+	loaded *blockCache
 }
 
 // Acquire the name of DAG instance
@@ -228,6 +239,8 @@ func (bd *BlockDAG) AddBlock(b IBlockData) (*list.List, IBlock) {
 	/*	if bd.hasBlock(b.GetHash()) {
 		return nil
 	}*/
+	bd.evictBlocks()
+
 	parents := []IBlock{}
 	if bd.blockTotal > 0 {
 		parentsIds := b.GetParents()
@@ -248,6 +261,12 @@ func (bd *BlockDAG) AddBlock(b IBlockData) (*list.List, IBlock) {
 	}
 	//
 	block := Block{id: bd.blockTotal, hash: *b.GetHash(), layer: 0, status: StatusNone, mainParent: MaxId}
+	for _, parent := range parents {
+		if parent.GetStatus().IsInvalidated() {
+			block.status |= StatusInvalidated
+			break
+		}
+	}
 
 	if bd.blocks == nil {
 		bd.blocks = map[uint]IBlock{}
@@ -265,7 +284,7 @@ func (bd *BlockDAG) AddBlock(b IBlockData) (*list.List, IBlock) {
 		var maxLayer uint = 0
 		for _, v := range parents {
 			parent := v.(IBlock)
-			block.parents.AddPair(parent.GetID(), parent)
+			bd.addRef(block.parents, parent)
 			parent.AddChild(ib)
 			if block.mainParent > parent.GetID() {
 				block.mainParent = parent.GetID()
@@ -286,7 +305,9 @@ func (bd *BlockDAG) AddBlock(b IBlockData) (*list.List, IBlock) {
 		bd.lastTime = t
 	}
 	//
-	return bd.instance.AddBlock(ib), ib
+	changed := bd.instance.AddBlock(ib)
+	bd.updateMetrics(changed)
+	return changed, ib
 }
 
 // Acquire the genesis block of chain
@@ -364,16 +385,44 @@ func (bd *BlockDAG) GetBlockById(id uint) IBlock {
 	return bd.getBlockById(id)
 }
 
-// Acquire one block by id
+// Acquire one block by id.  The evicted blocks are loaded from the database
+// and the result is nil when the block is unknown.  The ordering and coloring
+// of the DAG can't go on without a block which failed to be loaded, because
+// the node would then keep another state than its peers, so that is fatal.
 func (bd *BlockDAG) getBlockById(id uint) IBlock {
 	if id == MaxId {
 		return nil
 	}
-	block, ok := bd.blocks[id]
-	if !ok {
+	if block, ok := bd.blocks[id]; ok {
+		return block
+	}
+	ib, err := bd.loadBlock(id)
+	if err != nil {
+		panic(err.Error())
+	}
+	if ib == nil {
 		return nil
 	}
-	return block
+	return ib
+}
+
+// fetchBlockById returns the block, or an error when it is unknown or failed
+// to be loaded from the database.
+func (bd *BlockDAG) fetchBlockById(id uint) (IBlock, error) {
+	if id == MaxId {
+		return nil, fmt.Errorf("no DAG block %d", id)
+	}
+	if block, ok := bd.blocks[id]; ok {
+		return block, nil
+	}
+	ib, err := bd.loadBlock(id)
+	if err != nil {
+		return nil, err
+	}
+	if ib == nil {
+		return nil, fmt.Errorf("no DAG block %d", id)
+	}
+	return ib, nil
 }
 
 // Total number of blocks
@@ -419,6 +468,8 @@ func (bd *BlockDAG) BuildMerkleTreeStoreFromTips() []*hash.Hash {
 }
 
 // Refresh the dag tip whith new block,it will cause changes in tips set.
+// The invalidated blocks are never tips, and a block whose children are all
+// invalidated stays a tip.
 func (bd *BlockDAG) updateTips(b IBlock) {
 	if bd.tips == nil {
 		bd.tips = NewIdSet()
@@ -427,11 +478,13 @@ func (bd *BlockDAG) updateTips(b IBlock) {
 	}
 	for k, v := range bd.tips.GetMap() {
 		block := v.(IBlock)
-		if block.HasChildren() {
+		if bd.hasValidChild(block) {
 			bd.tips.Remove(k)
 		}
 	}
-	bd.tips.AddPair(b.GetID(), b)
+	if !b.GetStatus().IsInvalidated() {
+		bd.tips.AddPair(b.GetID(), b)
+	}
 }
 
 // The last time is when add one block to DAG.
@@ -491,15 +544,45 @@ func (bd *BlockDAG) getFutureSet(fs *IdSet, b IBlock) {
 	if children == nil || children.IsEmpty() {
 		return
 	}
-	for k, v := range children.GetMap() {
-		ib := v.(IBlock)
-		if !fs.Has(k) {
-			fs.AddPair(k, ib)
-			bd.getFutureSet(fs, ib)
+	for k := range children.GetMap() {
+		if fs.Has(k) {
+			continue
 		}
+		ib := bd.getBlockById(k)
+		if ib == nil {
+			continue
+		}
+		fs.AddPair(k, ib)
+		bd.getFutureSet(fs, ib)
 	}
 }
 
+// GetFutureSet returns the hashes of the blocks which have the block in their
+// past set, in their DAG order.  The unordered blocks are last.
+func (bd *BlockDAG) GetFutureSet(h *hash.Hash) []*hash.Hash {
+	bd.stateLock.Lock()
+	defer bd.stateLock.Unlock()
+
+	ib := bd.getBlock(h)
+	if ib == nil {
+		return nil
+	}
+	fs := NewIdSet()
+	bd.getFutureSet(fs, ib)
+	blocks := make([]IBlock, 0, fs.Size())
+	for _, v := range fs.GetMap() {
+		blocks = append(blocks, v.(IBlock))
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].GetOrder() < blocks[j].GetOrder()
+	})
+	result := make([]*hash.Hash, 0, len(blocks))
+	for _, b := range blocks {
+		result = append(result, b.GetHash())
+	}
+	return result
+}
+
 // Query whether a given block is on the main chain.
 // Note that some DAG protocols may not support this feature.
 func (bd *BlockDAG) IsOnMainChain(id uint) bool {
@@ -512,7 +595,11 @@ func (bd *BlockDAG) IsOnMainChain(id uint) bool {
 // Query whether a given block is on the main chain.
 // Note that some DAG protocols may not support this feature.
 func (bd *BlockDAG) isOnMainChain(id uint) bool {
-	return bd.instance.IsOnMainChain(bd.getBlockById(id))
+	ib := bd.getBlockById(id)
+	if ib == nil {
+		return false
+	}
+	return bd.instance.IsOnMainChain(ib)
 }
 
 // return the tip of main chain
@@ -539,7 +626,11 @@ func (bd *BlockDAG) GetMainParent(parents *IdSet) IBlock {
 // Return the layer of block,it is stable.
 // You can imagine that this is the main chain.
 func (bd *BlockDAG) GetLayer(id uint) uint {
-	return bd.GetBlockById(id).GetLayer()
+	ib := bd.GetBlockById(id)
+	if ib == nil {
+		return 0
+	}
+	return ib.GetLayer()
 }
 
 // Return current general description of the whole state of DAG
@@ -593,8 +684,11 @@ func (bd *BlockDAG) locateBlocks(gs *GraphState, maxHashes uint) []*hash.Hash {
 		}
 		needRec := true
 		if cur.HasChildren() {
-			for _, v := range cur.GetChildren().GetMap() {
-				ib := v.(IBlock)
+			for k := range cur.GetChildren().GetMap() {
+				ib := bd.getBlockById(k)
+				if ib == nil {
+					continue
+				}
 				if gs.GetTips().Has(ib.GetHash()) || !fs.Has(ib.GetHash()) && ib.IsOrdered() {
 					needRec = false
 					break
@@ -604,10 +698,9 @@ func (bd *BlockDAG) locateBlocks(gs *GraphState, maxHashes uint) []*hash.Hash {
 		if needRec {
 			fs.AddPair(cur.GetHash(), cur)
 			if cur.HasParents() {
-				for _, v := range cur.GetParents().GetMap() {
-					value := v.(IBlock)
-					ib := value
-					if fs.Has(ib.GetHash()) {
+				for k := range cur.GetParents().GetMap() {
+					ib := bd.getBlockById(k)
+					if ib == nil || fs.Has(ib.GetHash()) {
 						continue
 					}
 					queue = append(queue, ib)
@@ -626,9 +719,9 @@ func (bd *BlockDAG) locateBlocks(gs *GraphState, maxHashes uint) []*hash.Hash {
 		}
 		if ib.HasChildren() {
 			need := true
-			for _, v := range ib.GetChildren().GetMap() {
-				ib := v.(IBlock)
-				if gs.GetTips().Has(ib.GetHash()) {
+			for k := range ib.GetChildren().GetMap() {
+				ib := bd.getBlockById(k)
+				if ib != nil && gs.GetTips().Has(ib.GetHash()) {
 					need = false
 					break
 				}
@@ -653,19 +746,70 @@ func (bd *BlockDAG) locateBlocks(gs *GraphState, maxHashes uint) []*hash.Hash {
 	return result
 }
 
-// Judging whether block is the virtual tip that it have not future set.
-func isVirtualTip(bs *IdSet, futureSet *IdSet, anticone *IdSet, children *IdSet) bool {
-	for k := range children.GetMap() {
+// Judging whether block is the virtual tip that it have not future set.  The
+// invalidated children are left out of the DAG.
+func (bd *BlockDAG) isVirtualTip(bs *IdSet, futureSet *IdSet, anticone *IdSet, children *IdSet) bool {
+	for k, v := range children.GetMap() {
 		if bs.Has(k) {
 			return false
 		}
-		if !futureSet.Has(k) && !anticone.Has(k) {
+		if !futureSet.Has(k) && !anticone.Has(k) && !bd.isInvalidatedChild(k, v) {
 			return false
 		}
 	}
 	return true
 }
 
+// getFutureSize returns the size of the future set of the block, counting no
+// further than max.
+func (bd *BlockDAG) getFutureSize(b IBlock, max uint) uint {
+	visited := NewIdSet()
+	queue := []IBlock{b}
+	for len(queue) > 0 && uint(visited.Size()) < max {
+		cur := queue[0]
+		queue = queue[1:]
+		children := cur.GetChildren()
+		if children == nil {
+			continue
+		}
+		for k := range children.GetMap() {
+			if visited.Has(k) {
+				continue
+			}
+			visited.Add(k)
+			queue = append(queue, bd.getBlockById(k))
+		}
+	}
+	if uint(visited.Size()) > max {
+		return max
+	}
+	return uint(visited.Size())
+}
+
+// GetAntiPastSize returns the smallest future set size of the block and the
+// blocks in its anticone, which is the number of blocks an attacker has to
+// outpace in order to reverse the block.  The result is capped at max, the
+// anticone is not examined when the future of the block reaches it.
+func (bd *BlockDAG) GetAntiPastSize(h *hash.Hash, max uint) uint {
+	bd.stateLock.Lock()
+	defer bd.stateLock.Unlock()
+
+	ib := bd.getBlock(h)
+	if ib == nil {
+		return 0
+	}
+	size := bd.getFutureSize(ib, max)
+	if size >= max {
+		return max
+	}
+	for _, v := range bd.getAnticone(ib, nil).GetMap() {
+		if fs := bd.getFutureSize(v.(IBlock), size); fs < size {
+			size = fs
+		}
+	}
+	return size
+}
+
 // This function is used to GetAnticone recursion
 func (bd *BlockDAG) recAnticone(bs *IdSet, futureSet *IdSet, anticone *IdSet, ib IBlock) {
 	if bs.Has(ib.GetID()) || anticone.Has(ib.GetID()) {
@@ -676,7 +820,7 @@ func (bd *BlockDAG) recAnticone(bs *IdSet, futureSet *IdSet, anticone *IdSet, ib
 	if children == nil || children.Size() == 0 {
 		needRecursion = true
 	} else {
-		needRecursion = isVirtualTip(bs, futureSet, anticone, children)
+		needRecursion = bd.isVirtualTip(bs, futureSet, anticone, children)
 	}
 	if needRecursion {
 		if !futureSet.Has(ib.GetID()) {
@@ -685,9 +829,8 @@ func (bd *BlockDAG) recAnticone(bs *IdSet, futureSet *IdSet, anticone *IdSet, ib
 		parents := ib.GetParents()
 
 		//Because parents can not be empty, so there is no need to judge.
-		for _, v := range parents.GetMap() {
-			pib := v.(IBlock)
-			bd.recAnticone(bs, futureSet, anticone, pib)
+		for k := range parents.GetMap() {
+			bd.recAnticone(bs, futureSet, anticone, bd.getBlockById(k))
 		}
 	}
 }
@@ -789,8 +932,8 @@ func (bd *BlockDAG) getDiffAnticone(b IBlock, verbose bool) *IdSet {
 	mainsubdag.Add(0)
 	mainsubdagTips := NewIdSet()
 
-	for _, v := range parents.GetMap() {
-		ib := v.(IBlock)
+	for k := range parents.GetMap() {
+		ib := bd.getBlockById(k)
 		cur := &Block{id: ib.GetID(), hash: *ib.GetHash(), parents: NewIdSet(), mainParent: MaxId}
 		if ib.GetID() == b.GetMainParent() {
 			mainsubdag.Add(ib.GetID())
@@ -809,11 +952,11 @@ func (bd *BlockDAG) getDiffAnticone(b IBlock, verbose bool) *IdSet {
 		for _, v := range mainsubdagTips.GetMap() {
 			ib := v.(IBlock)
 			if ib.HasParents() {
-				for _, pv := range ib.GetParents().GetMap() {
-					pib := pv.(IBlock)
-					if mainsubdag.Has(pib.GetID()) {
+				for pk := range ib.GetParents().GetMap() {
+					if mainsubdag.Has(pk) {
 						continue
 					}
+					pib := bd.getBlockById(pk)
 					mainsubdag.Add(pib.GetID())
 					newmainsubdagTips.AddPair(pib.GetID(), pib)
 				}
@@ -832,11 +975,11 @@ func (bd *BlockDAG) getDiffAnticone(b IBlock, verbose bool) *IdSet {
 		for _, v := range mainsubdagTips.GetMap() {
 			ib := v.(IBlock)
 			if ib.HasParents() {
-				for _, pv := range ib.GetParents().GetMap() {
-					pib := pv.(IBlock)
-					if mainsubdag.Has(pib.GetID()) {
+				for pk := range ib.GetParents().GetMap() {
+					if mainsubdag.Has(pk) {
 						continue
 					}
+					pib := bd.getBlockById(pk)
 					mainsubdag.Add(pib.GetID())
 					newmainsubdagTips.AddPair(pib.GetID(), pib)
 				}
@@ -851,8 +994,8 @@ func (bd *BlockDAG) getDiffAnticone(b IBlock, verbose bool) *IdSet {
 			tb := v.(*Block)
 			realib := bd.getBlockById(tb.GetID())
 			if realib.HasParents() {
-				for _, pv := range realib.GetParents().GetMap() {
-					pib := pv.(IBlock)
+				for pk := range realib.GetParents().GetMap() {
+					pib := bd.getBlockById(pk)
 					var cur *Block
 					if anticone.Has(pib.GetID()) {
 						cur = anticone.Get(pib.GetID()).(*Block)
@@ -944,9 +1087,9 @@ func (bd *BlockDAG) GetConfirmations(id uint) uint {
 		if !cur.HasChildren() {
 			continue
 		} else {
-			childList := cur.GetChildren().SortHashList(false)
-			for _, v := range childList {
-				ib := cur.GetChildren().Get(v).(IBlock)
+			children := bd.resolveSet(cur.GetChildren())
+			for _, v := range children.SortHashList(false) {
+				ib := children.Get(v).(IBlock)
 				queue = append(queue, ib)
 			}
 		}
@@ -994,6 +1137,9 @@ func (bd *BlockDAG) getValidTips(limit bool) []IBlock {
 			continue
 		}
 		block := bd.getBlockById(parents[i])
+		if block.GetStatus().IsInvalidated() {
+			continue
+		}
 		if math.Abs(float64(block.GetLayer())-float64(mainParent.GetLayer())) > MaxTipLayerGap {
 			continue
 		}
@@ -1121,6 +1267,10 @@ func (bd *BlockDAG) Load(dbTx database.Tx, blockTotal uint, genesis *hash.Hash)
 	bd.blockTotal = blockTotal
 	bd.blocks = map[uint]IBlock{}
 	bd.tips = NewIdSet()
+	bd.evictedLayer = 0
+	if bd.cacheWindow > 0 {
+		bd.loaded = newBlockCache(loadedCacheSize)
+	}
 	return bd.instance.Load(dbTx)
 }
 
@@ -1206,9 +1356,9 @@ func (bd *BlockDAG) IsHourglass(id uint) bool {
 		if !cur.HasParents() {
 			continue
 		}
-		for _, v := range cur.GetParents().GetMap() {
-			ib := v.(IBlock)
-			if queueSet.Has(ib.GetID()) || !ib.IsOrdered() {
+		for k := range cur.GetParents().GetMap() {
+			ib := bd.getBlockById(k)
+			if ib == nil || queueSet.Has(ib.GetID()) || !ib.IsOrdered() {
 				continue
 			}
 			queue = append(queue, ib)
@@ -1279,9 +1429,9 @@ func (bd *BlockDAG) GetMaturity(target uint, views []uint) uint {
 			continue
 		}
 
-		for _, v := range cur.GetParents().GetMap() {
-			ib := v.(IBlock)
-			if queueSet.Has(ib.GetID()) {
+		for k := range cur.GetParents().GetMap() {
+			ib := bd.getBlockById(k)
+			if ib == nil || queueSet.Has(ib.GetID()) {
 				continue
 			}
 			queue = append(queue, ib)
@@ -1317,9 +1467,9 @@ func (bd *BlockDAG) getMainFork(ib IBlock, backward bool) IBlock {
 			if !cur.HasChildren() {
 				continue
 			} else {
-				childList := cur.GetChildren().SortHashList(false)
-				for _, v := range childList {
-					ib := cur.GetChildren().Get(v).(IBlock)
+				children := bd.resolveSet(cur.GetChildren())
+				for _, v := range children.SortHashList(false) {
+					ib := children.Get(v).(IBlock)
 					queue = append(queue, ib)
 				}
 			}
@@ -1327,9 +1477,9 @@ func (bd *BlockDAG) getMainFork(ib IBlock, backward bool) IBlock {
 			if !cur.HasParents() {
 				continue
 			} else {
-				parentsList := cur.GetParents().SortHashList(false)
-				for _, v := range parentsList {
-					ib := cur.GetParents().Get(v).(IBlock)
+				parents := bd.resolveSet(cur.GetParents())
+				for _, v := range parents.SortHashList(false) {
+					ib := parents.Get(v).(IBlock)
 					queue = append(queue, ib)
 				}
 			}
@@ -204,9 +204,9 @@ func (bd *BlockDAG) processMaturity(target IBlock, views []IBlock, mainViewIB IB
 			continue
 		}
 
-		for _, v := range cur.GetParents().GetMap() {
-			ib := v.(IBlock)
-			if queueSet.Has(ib.GetID()) {
+		for k := range cur.GetParents().GetMap() {
+			ib := bd.getBlockById(k)
+			if ib == nil || queueSet.Has(ib.GetID()) {
 				continue
 			}
 			queue = append(queue, ib)
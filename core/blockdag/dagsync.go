@@ -140,13 +140,10 @@ func (ds *DAGSync) GetMainLocator(point *hash.Hash) []*hash.Hash {
 			}
 
 			next := ds.bd.getBlockById(cur.GetMainParent())
-			if next.GetID() == endBlock.GetID() {
+			if next == nil || next.GetID() == endBlock.GetID() {
 				break
 			}
 			cur = next
-			if cur == nil {
-				break
-			}
 		}
 	}
 	locator = append(locator, endBlock.GetHash())
@@ -8,7 +8,8 @@ import (
 )
 
 // DBPutDAGBlock stores the information needed to reconstruct the provided
-// block in the block index according to the format described above.
+// block in the block index according to the format described above.  The
+// block is also recorded as a child of its parents.
 func DBPutDAGBlock(dbTx database.Tx, block IBlock) error {
 	bucket := dbTx.Metadata().Bucket(dbnamespace.BlockIndexBucketName)
 	var serializedID [4]byte
@@ -21,7 +22,73 @@ func DBPutDAGBlock(dbTx database.Tx, block IBlock) error {
 	if err != nil {
 		return err
 	}
-	return bucket.Put(key, buff.Bytes())
+	err = bucket.Put(key, buff.Bytes())
+	if err != nil {
+		return err
+	}
+	return dbPutDAGBlockChildren(dbTx, block)
+}
+
+// dbPutDAGBlockChildren adds the block to the children index of its parents,
+// the key is the id of the parent followed by the id of the block.
+func dbPutDAGBlockChildren(dbTx database.Tx, block IBlock) error {
+	if !block.HasParents() {
+		return nil
+	}
+	bucket := dbTx.Metadata().Bucket(dbnamespace.BlockChildrenBucketName)
+	if bucket == nil {
+		return fmt.Errorf("no dag block children index")
+	}
+	var key [8]byte
+	dbnamespace.ByteOrder.PutUint32(key[4:], uint32(block.GetID()))
+	for k := range block.GetParents().GetMap() {
+		dbnamespace.ByteOrder.PutUint32(key[:4], uint32(k))
+		err := bucket.Put(key[:], []byte{})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DBGetDAGBlockChildren returns the ids of the children of a block from the
+// children index.
+func DBGetDAGBlockChildren(dbTx database.Tx, id uint) ([]uint, error) {
+	bucket := dbTx.Metadata().Bucket(dbnamespace.BlockChildrenBucketName)
+	if bucket == nil {
+		return nil, fmt.Errorf("no dag block children index")
+	}
+	var prefix [4]byte
+	dbnamespace.ByteOrder.PutUint32(prefix[:], uint32(id))
+
+	children := []uint{}
+	cursor := bucket.Cursor()
+	for ok := cursor.Seek(prefix[:]); ok; ok = cursor.Next() {
+		key := cursor.Key()
+		if !bytes.HasPrefix(key, prefix[:]) {
+			break
+		}
+		children = append(children, uint(dbnamespace.ByteOrder.Uint32(key[4:])))
+	}
+	return children, nil
+}
+
+// DBBuildDAGBlockChildren creates the children index from the parents of the
+// blocks in the block index, for the databases which predate it.
+func DBBuildDAGBlockChildren(dbTx database.Tx) error {
+	meta := dbTx.Metadata()
+	_, err := meta.CreateBucketIfNotExists(dbnamespace.BlockChildrenBucketName)
+	if err != nil {
+		return err
+	}
+	return meta.Bucket(dbnamespace.BlockIndexBucketName).ForEach(func(k, v []byte) error {
+		block := &Block{}
+		err := block.Decode(bytes.NewReader(v))
+		if err != nil {
+			return err
+		}
+		return dbPutDAGBlockChildren(dbTx, block)
+	})
 }
 
 // DBGetDAGBlock get dag block data by resouce ID
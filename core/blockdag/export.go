@@ -0,0 +1,147 @@
+// Copyright (c) 2017-2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockdag
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"io"
+)
+
+// ExportBlock describes a block of an exported sub-DAG.
+type ExportBlock struct {
+	Hash   *hash.Hash
+	Order  uint
+	Layer  uint
+	Height uint
+
+	// Parents may contain blocks outside of the exported range, MainParent
+	// is nil for the genesis block.
+	Parents     []*hash.Hash
+	MainParent  *hash.Hash
+	IsBlue      bool
+	IsMainChain bool
+}
+
+// ExportRange resolves the orders [start, end) of the blocks to export.  An
+// end of zero stands for the order after the main chain tip, and a positive
+// number of last blocks replaces the start with the order of the last blocks
+// before the end.
+func (bd *BlockDAG) ExportRange(start uint, end uint, last uint) (uint, uint) {
+	if end == 0 {
+		end = bd.GetMainChainTip().GetOrder() + 1
+	}
+	if last > 0 {
+		start = 0
+		if end > last {
+			start = end - last
+		}
+	}
+	return start, end
+}
+
+// ExportDAG returns the blocks whose order is in [start, end), sorted by their
+// order.  The end is capped after the main chain tip, which is the last ordered
+// block.
+func (bd *BlockDAG) ExportDAG(start uint, end uint) ([]*ExportBlock, error) {
+	bd.stateLock.Lock()
+	defer bd.stateLock.Unlock()
+
+	if total := bd.getMainChainTip().GetOrder() + 1; end > total {
+		end = total
+	}
+	result := []*ExportBlock{}
+	for order := start; order < end; order++ {
+		id, ok := bd.order[order]
+		if !ok {
+			continue
+		}
+		ib, err := bd.fetchBlockById(id)
+		if err != nil {
+			return nil, err
+		}
+		eb := &ExportBlock{
+			Hash:        ib.GetHash(),
+			Order:       ib.GetOrder(),
+			Layer:       ib.GetLayer(),
+			Height:      ib.GetHeight(),
+			IsBlue:      bd.instance.IsBlue(id),
+			IsMainChain: bd.isOnMainChain(id),
+		}
+		if ib.HasParents() {
+			for _, pid := range ib.GetParents().SortList(false) {
+				parent, err := bd.fetchBlockById(pid)
+				if err != nil {
+					return nil, err
+				}
+				eb.Parents = append(eb.Parents, parent.GetHash())
+			}
+			mp, err := bd.fetchBlockById(ib.GetMainParent())
+			if err != nil {
+				return nil, err
+			}
+			eb.MainParent = mp.GetHash()
+		}
+		result = append(result, eb)
+	}
+	return result, nil
+}
+
+// WriteDot writes the exported blocks as a Graphviz DOT digraph, with edges
+// from the blocks to their parents.  Blue and red blocks are filled with their
+// color, main chain blocks are boxes and the main parent edges are bold.  The
+// parents outside of the exported blocks are drawn dashed.
+func WriteDot(w io.Writer, blocks []*ExportBlock) error {
+	exported := make(map[hash.Hash]struct{}, len(blocks))
+	for _, b := range blocks {
+		exported[*b.Hash] = struct{}{}
+	}
+	lines := []string{"digraph dag {", "\trankdir=RL;", "\tnode [style=filled];"}
+	external := make(map[hash.Hash]struct{})
+	for _, b := range blocks {
+		color := "tomato"
+		if b.IsBlue {
+			color = "lightblue"
+		}
+		shape := "ellipse"
+		if b.IsMainChain {
+			shape = "box"
+		}
+		lines = append(lines, fmt.Sprintf("\t\"%s\" [label=\"%s\\norder %d layer %d\", "+
+			"shape=%s, fillcolor=%s];", b.Hash, shortHash(b.Hash), b.Order,
+			b.Layer, shape, color))
+		for _, p := range b.Parents {
+			style := ""
+			if b.MainParent != nil && p.IsEqual(b.MainParent) {
+				style = " [style=bold]"
+			}
+			lines = append(lines, fmt.Sprintf("\t\"%s\" -> \"%s\"%s;", b.Hash, p, style))
+			if _, ok := exported[*p]; !ok {
+				external[*p] = struct{}{}
+			}
+		}
+	}
+	for _, b := range blocks {
+		for _, p := range b.Parents {
+			if _, ok := external[*p]; ok {
+				lines = append(lines, fmt.Sprintf("\t\"%s\" [label=\"%s\", "+
+					"style=dashed];", p, shortHash(p)))
+				delete(external, *p)
+			}
+		}
+	}
+	lines = append(lines, "}")
+	for _, line := range lines {
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shortHash returns the beginning of the hash to label the blocks with.
+func shortHash(h *hash.Hash) string {
+	return h.String()[:8]
+}
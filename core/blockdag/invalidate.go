@@ -0,0 +1,168 @@
+// Copyright (c) 2017-2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockdag
+
+import (
+	"container/list"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"sort"
+)
+
+// SetInvalidated marks the blocks as invalidated, or valid again, and orders
+// the DAG again as if the invalidated blocks had never been added.  The
+// invalidated blocks keep their place in the graph but they are neither tips
+// nor ordered.  The caller must pass all the future set of an invalidated
+// block.  It returns the blocks whose order may have changed, in their new
+// order followed by the unordered ones.  It is only supported by the phantom
+// DAG.
+func (bd *BlockDAG) SetInvalidated(hs []*hash.Hash, invalidated bool) (*list.List, error) {
+	bd.stateLock.Lock()
+	defer bd.stateLock.Unlock()
+
+	ph, ok := bd.instance.(*Phantom)
+	if !ok {
+		return nil, fmt.Errorf("The %s DAG does not support invalidating blocks", bd.instance.GetName())
+	}
+	changed := NewIdSet()
+	for _, h := range hs {
+		ib := bd.getBlock(h)
+		if ib == nil {
+			return nil, fmt.Errorf("no DAG block %v", h)
+		}
+		if ib.GetID() == 0 {
+			return nil, fmt.Errorf("the genesis can't be invalidated")
+		}
+		// The blocks out of the cache window must no longer change.
+		if bd.cacheWindow > 0 && ib.GetLayer() <= bd.evictedLayer {
+			return nil, fmt.Errorf("the DAG block %v is out of the cache window", h)
+		}
+		changed.AddPair(ib.GetID(), ib)
+	}
+	setInvalidated(changed, invalidated)
+	refNodes, err := ph.reorder(changed)
+	if err != nil {
+		setInvalidated(changed, !invalidated)
+		return nil, err
+	}
+	return refNodes, nil
+}
+
+func setInvalidated(bs *IdSet, invalidated bool) {
+	for _, v := range bs.GetMap() {
+		ib := v.(IBlock)
+		if invalidated {
+			ib.SetStatus(ib.GetStatus() | StatusInvalidated)
+		} else {
+			ib.SetStatus(ib.GetStatus() &^ StatusInvalidated)
+		}
+	}
+}
+
+// hasValidChild returns whether a child of the block is not invalidated.
+func (bd *BlockDAG) hasValidChild(ib IBlock) bool {
+	if !ib.HasChildren() {
+		return false
+	}
+	for k, v := range ib.GetChildren().GetMap() {
+		if !bd.isInvalidatedChild(k, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// isInvalidatedChild returns whether the child of a set of children is
+// invalidated.  The children which fail to be found are taken as valid.
+func (bd *BlockDAG) isInvalidatedChild(id uint, v interface{}) bool {
+	child, ok := v.(IBlock)
+	if !ok {
+		ib, err := bd.fetchBlockById(id)
+		if err != nil {
+			return false
+		}
+		child = ib
+	}
+	return child.GetStatus().IsInvalidated()
+}
+
+// reorder orders the DAG again after the status of the changed blocks was
+// set.  The main chain is rolled back to its intersection with the main chain
+// of the bluest tip, the blocks after the intersection lose their order and
+// the new main chain is ordered from there.  The coloring of a block only
+// depends on its past set, so it stays.
+func (ph *Phantom) reorder(changed *IdSet) (*list.List, error) {
+	tips := ph.bd.tips.Clone()
+	for k, v := range changed.GetMap() {
+		tips.AddPair(k, v)
+		ib := v.(IBlock)
+		if !ib.HasParents() {
+			continue
+		}
+		for pk := range ib.GetParents().GetMap() {
+			parent := ph.bd.getBlockById(pk)
+			if parent == nil {
+				return nil, fmt.Errorf("missing parent %d of the DAG block %d", pk, k)
+			}
+			tips.AddPair(pk, parent)
+		}
+	}
+	for k, v := range tips.GetMap() {
+		ib := v.(IBlock)
+		if ib.GetStatus().IsInvalidated() || ph.bd.hasValidChild(ib) {
+			tips.Remove(k)
+		}
+	}
+	mainTip := ph.getBluest(tips)
+	if mainTip == nil {
+		return nil, fmt.Errorf("no valid DAG tip")
+	}
+	intersection, path := ph.getIntersectionPathWithMainChain(mainTip)
+	ib := ph.getBlock(intersection)
+	if ib == nil {
+		return nil, fmt.Errorf("DAG can't find intersection")
+	}
+	if ph.bd.cacheWindow > 0 && ib.GetLayer() < ph.bd.evictedLayer {
+		return nil, fmt.Errorf("the DAG would be reordered out of the cache window")
+	}
+
+	result := changed.Clone()
+	ph.bd.tips = tips
+	ph.virtualBlock.SetOrder(MaxBlockOrder)
+	for k, v := range ph.diffAnticone.GetMap() {
+		v.(IBlock).SetOrder(MaxBlockOrder)
+		result.AddPair(k, v)
+	}
+	mainOrder := ph.GetMainChainTip().GetOrder()
+	for o := ib.GetOrder() + 1; o <= mainOrder; o++ {
+		id, ok := ph.bd.order[o]
+		if !ok {
+			continue
+		}
+		delete(ph.bd.order, o)
+		ob := ph.getBlock(id)
+		ob.SetOrder(MaxBlockOrder)
+		result.AddPair(id, ob)
+	}
+	ph.rollBackMainChain(intersection)
+	ph.updateMainOrder(path, intersection)
+	ph.mainChain.tip = mainTip.GetID()
+	ph.diffAnticone = ph.bd.getAnticone(mainTip, nil)
+	result.AddSet(ph.diffAnticone)
+
+	blocks := make([]IBlock, 0, result.Size())
+	for _, v := range result.GetMap() {
+		blocks = append(blocks, v.(IBlock))
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].GetOrder() < blocks[j].GetOrder() ||
+			blocks[i].GetOrder() == blocks[j].GetOrder() && blocks[i].GetID() < blocks[j].GetID()
+	})
+	refNodes := list.New()
+	for _, b := range blocks {
+		refNodes.PushBack(b)
+	}
+	return refNodes, nil
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2017-2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockdag
+
+import (
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"testing"
+)
+
+// buildWithout adds the blocks of the DAG to a new DAG in the same order,
+// except the excluded ones.
+func buildWithout(t *testing.T, ref *testCacheDAG, exclude *IdSet) *testCacheDAG {
+	d := newTestCacheDAG(nil)
+	for id := uint(0); id < ref.bd.GetBlockTotal(); id++ {
+		if exclude.Has(id) {
+			continue
+		}
+		ib := ref.bd.GetBlockById(id)
+		block := &TestBlock{hash: *ib.GetHash(), parents: NewIdSet(), timeStamp: int64(id)}
+		if ib.HasParents() {
+			for k := range ib.GetParents().GetMap() {
+				block.parents.Add(d.ids[*ref.bd.GetBlockById(k).GetHash()])
+			}
+		}
+		if _, added := d.addBlock(t, block); added == nil {
+			t.Fatalf("block %d was not added", id)
+		}
+	}
+	return d
+}
+
+// futureIds returns the block followed by its future set.
+func futureIds(d *testCacheDAG, id uint) *IdSet {
+	result := NewIdSet()
+	result.Add(id)
+	for _, h := range d.bd.GetFutureSet(d.bd.GetBlockById(id).GetHash()) {
+		result.Add(d.ids[*h])
+	}
+	return result
+}
+
+func hashesOf(d *testCacheDAG, ids *IdSet) []*hash.Hash {
+	result := []*hash.Hash{}
+	for _, id := range ids.List() {
+		result = append(result, d.bd.GetBlockById(id).GetHash())
+	}
+	return result
+}
+
+func orderSnapshot(d *testCacheDAG) map[uint]uint {
+	result := map[uint]uint{}
+	for id := uint(0); id < d.bd.GetBlockTotal(); id++ {
+		result[id] = d.bd.GetBlockById(id).GetOrder()
+	}
+	return result
+}
+
+// compareInvalidated checks that the DAG with invalidated blocks is ordered
+// like the DAG built without them, and that the reordered blocks are listed.
+func compareInvalidated(t *testing.T, expected *testCacheDAG, got *testCacheDAG, invalidated *IdSet,
+	before map[uint]uint, changed map[uint]bool) {
+	if !expected.bd.GetMainChainTip().GetHash().IsEqual(got.bd.GetMainChainTip().GetHash()) {
+		t.Fatalf("main chain tip %s, expected %s", got.bd.GetMainChainTip().GetHash(),
+			expected.bd.GetMainChainTip().GetHash())
+	}
+	if !expected.bd.GetTips().IsEqual(got.bd.GetTips()) {
+		t.Fatalf("tips %v, expected %v", got.bd.GetTips().List(), expected.bd.GetTips().List())
+	}
+	for id := uint(0); id < got.bd.GetBlockTotal(); id++ {
+		g := got.bd.GetBlockById(id)
+		if invalidated.Has(id) {
+			if !g.GetStatus().IsInvalidated() || g.IsOrdered() {
+				t.Fatalf("invalidated block %d has the order %d", id, g.GetOrder())
+			}
+		} else {
+			e := expected.bd.GetBlock(g.GetHash())
+			if g.GetStatus().IsInvalidated() || e.GetOrder() != g.GetOrder() {
+				t.Fatalf("block %d has the order %d, expected %d", id, g.GetOrder(), e.GetOrder())
+			}
+			if g.IsOrdered() && !got.bd.GetBlockByOrder(g.GetOrder()).IsEqual(g.GetHash()) {
+				t.Fatalf("block %d is not found by its order %d", id, g.GetOrder())
+			}
+		}
+		if before[id] != g.GetOrder() && !changed[id] {
+			t.Fatalf("block %d was reordered from %d to %d but not listed", id, before[id], g.GetOrder())
+		}
+	}
+}
+
+func setInvalidatedBlocks(t *testing.T, d *testCacheDAG, ids *IdSet, invalidated bool) map[uint]bool {
+	l, err := d.bd.SetInvalidated(hashesOf(d, ids), invalidated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := map[uint]bool{}
+	last := uint(0)
+	for e := l.Front(); e != nil; e = e.Next() {
+		ib := e.Value.(IBlock)
+		if ib.GetOrder() < last {
+			t.Fatalf("block %d of order %d is listed after the order %d", ib.GetID(), ib.GetOrder(), last)
+		}
+		last = ib.GetOrder()
+		changed[ib.GetID()] = true
+	}
+	return changed
+}
+
+func TestSetInvalidated(t *testing.T) {
+	const total = 300
+	for _, root := range []uint{40, 150, total - 20, total - 3} {
+		d := newTestCacheDAG(nil)
+		buildRandomDAG(t, 3, total, d)
+		original := orderSnapshot(d)
+
+		invalidated := futureIds(d, root)
+		changed := setInvalidatedBlocks(t, d, invalidated, true)
+		compareInvalidated(t, buildWithout(t, d, invalidated), d, invalidated, original, changed)
+
+		// A child of an invalidated block is invalidated as well.
+		block := &TestBlock{hash: hash.DoubleHashH([]byte("child")), parents: NewIdSet(), timeStamp: total}
+		block.parents.Add(root)
+		l, ib := d.addBlock(t, block)
+		if ib == nil || l.Len() != 1 || !ib.GetStatus().IsInvalidated() || ib.IsOrdered() {
+			t.Fatalf("the child of the invalidated block %d was ordered", root)
+		}
+		invalidated.Add(ib.GetID())
+		original[ib.GetID()] = ib.GetOrder()
+		before := orderSnapshot(d)
+		compareInvalidated(t, buildWithout(t, d, invalidated), d, invalidated, before, map[uint]bool{})
+
+		// The reconsidered blocks are ordered as if they were never
+		// invalidated.
+		changed = setInvalidatedBlocks(t, d, invalidated, false)
+		compareInvalidated(t, buildWithout(t, d, NewIdSet()), d, NewIdSet(), before, changed)
+		for id, order := range original {
+			if id < total && d.bd.GetBlockById(id).GetOrder() != order {
+				t.Fatalf("block %d has the order %d after being reconsidered, expected %d",
+					id, d.bd.GetBlockById(id).GetOrder(), order)
+			}
+		}
+	}
+}
+
+func TestSetInvalidatedNested(t *testing.T) {
+	d := newTestCacheDAG(nil)
+	buildRandomDAG(t, 4, 200, d)
+
+	inner := futureIds(d, 150)
+	setInvalidatedBlocks(t, d, inner, true)
+	outer := futureIds(d, 100)
+	outer.AddSet(inner)
+	setInvalidatedBlocks(t, d, outer, true)
+	before := orderSnapshot(d)
+
+	// Reconsidering the outer block keeps the inner one invalidated.
+	reconsidered := outer.Clone()
+	reconsidered.RemoveSet(inner)
+	changed := setInvalidatedBlocks(t, d, reconsidered, false)
+	compareInvalidated(t, buildWithout(t, d, inner), d, inner, before, changed)
+
+	if _, err := d.bd.SetInvalidated([]*hash.Hash{d.bd.GetGenesisHash()}, true); err == nil {
+		t.Fatal("the genesis was invalidated")
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockdag
+
+import (
+	"container/list"
+
+	"github.com/Qitmeer/qitmeer/metrics"
+)
+
+var (
+	// tipsGauge is the number of tips of the DAG.
+	tipsGauge = metrics.NewGauge("blockdag/tips")
+
+	// blueRatioGauge is the ratio of the blue blocks to all of the blocks
+	// in the past set of the main chain tip, the tip included.
+	blueRatioGauge = metrics.NewGaugeFloat64("blockdag/blueratio")
+
+	// orderChangeHistogram samples the number of the blocks already
+	// ordered whose order changed when a block was added.
+	orderChangeHistogram = metrics.NewHistogram("blockdag/orderchange")
+)
+
+// updateMetrics updates the metrics of the DAG once a block has been added,
+// changed is the list of blocks whose order changed including the new one.
+//
+// This function MUST be called with the state lock held.
+func (bd *BlockDAG) updateMetrics(changed *list.List) {
+	if !metrics.Enabled {
+		return
+	}
+	tipsGauge.Update(int64(bd.tips.Size()))
+	// The blue number of the main chain tip is already known, whereas the
+	// blues of the virtual block take a coloring of its anticone.
+	if pb, ok := bd.instance.GetMainChainTip().(*PhantomBlock); ok && pb.IsOrdered() {
+		blueRatioGauge.Update(float64(pb.GetBlueNum()+1) / float64(pb.GetOrder()+1))
+	}
+	if changed != nil && changed.Len() > 0 {
+		orderChangeHistogram.Update(int64(changed.Len() - 1))
+	}
+}
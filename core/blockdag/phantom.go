@@ -62,6 +62,14 @@ func (ph *Phantom) AddBlock(ib IBlock) *list.List {
 	ph.updateBlockColor(pb)
 	ph.updateBlockOrder(pb)
 
+	// The invalidated blocks are out of the order until they are
+	// reconsidered.
+	if pb.GetStatus().IsInvalidated() {
+		refNodes := list.New()
+		refNodes.PushBack(pb)
+		return refNodes
+	}
+
 	changeBlock := ph.updateMainChain(ph.getBluest(ph.bd.tips), pb)
 	ph.preUpdateVirtualBlock()
 	return ph.getOrderChangeList(changeBlock)
@@ -293,9 +301,9 @@ func (ph *Phantom) updateMainChain(buestTip *PhantomBlock, pb *PhantomBlock) *Ph
 	ph.updateMainOrder(path, intersection)
 	ph.mainChain.tip = buestTip.GetID()
 
-	ph.diffAnticone = ph.bd.getAnticone(ph.bd.getBlockById(ph.mainChain.tip), nil)
+	ph.diffAnticone = ph.bd.getAnticone(buestTip, nil)
 
-	changeOrder := ph.bd.getBlockById(intersection).GetOrder() + 1
+	changeOrder := ph.getBlock(intersection).GetOrder() + 1
 	return ph.getBlock(ph.bd.order[changeOrder])
 }
 
@@ -396,7 +404,7 @@ func (ph *Phantom) UpdateVirtualBlockOrder() *PhantomBlock {
 	ph.calculateBlueSet(ph.virtualBlock, ph.diffAnticone)
 	ph.updateBlockOrder(ph.virtualBlock)
 
-	startOrder := ph.getBlock(ph.mainChain.tip).GetOrder()
+	startOrder := tp.GetOrder()
 	for k, v := range ph.virtualBlock.blueDiffAnticone.GetMap() {
 		dab := ph.getBlock(k)
 		dab.SetOrder(startOrder + v.(uint))
@@ -410,7 +418,7 @@ func (ph *Phantom) UpdateVirtualBlockOrder() *PhantomBlock {
 
 	ph.virtualBlock.SetOrder(ph.bd.blockTotal + 1)
 
-	return ph.getBlock(ph.mainChain.tip)
+	return tp
 }
 
 func (ph *Phantom) preUpdateVirtualBlock() *PhantomBlock {
@@ -431,13 +439,11 @@ func (ph *Phantom) GetDiffBlueSet() *IdSet {
 	}
 	ph.UpdateVirtualBlockOrder()
 	result := NewIdSet()
-	curPb := ph.getBlock(ph.mainChain.tip)
-	for {
+	for curPb := ph.getBlock(ph.mainChain.tip); curPb != nil; curPb = ph.getBlock(curPb.mainParent) {
 		result.AddSet(curPb.blueDiffAnticone)
 		if curPb.mainParent == MaxId {
 			break
 		}
-		curPb = ph.getBlock(curPb.mainParent)
 	}
 
 	if ph.virtualBlock.GetOrder() != MaxBlockOrder {
@@ -524,14 +530,26 @@ func (ph *Phantom) GetMainParent(parents *IdSet) IBlock {
 	if parents == nil || parents.IsEmpty() {
 		return nil
 	}
+	var mainParent *PhantomBlock
 	if parents.Size() == 1 {
-		return ph.getBlock(parents.List()[0])
+		mainParent = ph.getBlock(parents.List()[0])
+	} else {
+		mainParent = ph.getBluest(parents)
+	}
+	if mainParent == nil {
+		return nil
 	}
-	return ph.getBluest(parents)
+	return mainParent
 }
 
+// getBlock returns the block, or nil when it is unknown.  A block which failed
+// to be loaded from the database is fatal, see getBlockById.
 func (ph *Phantom) getBlock(id uint) *PhantomBlock {
-	return ph.bd.getBlockById(id).(*PhantomBlock)
+	ib := ph.bd.getBlockById(id)
+	if ib == nil {
+		return nil
+	}
+	return ib.(*PhantomBlock)
 }
 
 func (ph *Phantom) GetDiffAnticone() *IdSet {
@@ -580,7 +598,10 @@ func (ph *Phantom) Load(dbTx database.Tx) error {
 			parentsSet := NewIdSet()
 			for k := range ib.GetParents().GetMap() {
 				parent := ph.bd.getBlockById(k)
-				parentsSet.AddPair(k, parent)
+				if parent == nil {
+					return fmt.Errorf("missing parent %d of the dag block %d", k, i)
+				}
+				ph.bd.addRef(parentsSet, parent)
 				parent.AddChild(ib)
 			}
 			ib.GetParents().Clean()
@@ -592,18 +613,21 @@ func (ph *Phantom) Load(dbTx database.Tx) error {
 		//
 		ph.bd.order[ib.GetOrder()] = ib.GetID()
 
-		if !ib.IsOrdered() {
+		if !ib.IsOrdered() && !ib.GetStatus().IsInvalidated() {
 			ph.diffAnticone.AddPair(ib.GetID(), ib)
 		}
+		ph.bd.evictBlocks()
 	}
 
 	ph.mainChain.tip = ph.GetMainParent(ph.bd.tips).GetID()
 
-	for cur := ph.getBlock(ph.mainChain.tip); cur != nil; cur = ph.getBlock(cur.mainParent) {
-		ph.mainChain.blocks.Add(cur.GetID())
-		if cur.mainParent == MaxId {
-			break
+	for id := ph.mainChain.tip; id != MaxId; {
+		cur, err := ph.bd.fetchBlockById(id)
+		if err != nil {
+			return err
 		}
+		ph.mainChain.blocks.Add(id)
+		id = cur.GetMainParent()
 	}
 	return nil
 }
@@ -622,7 +646,10 @@ func (ph *Phantom) GetBlues(parents *IdSet) uint {
 	vb := &Block{hash: hash.ZeroHash, layer: 0, mainParent: MaxId}
 	pb := &PhantomBlock{vb, 0, NewIdSet(), NewIdSet()}
 
-	tp := ph.GetMainParent(parents).(*PhantomBlock)
+	tp, ok := ph.GetMainParent(parents).(*PhantomBlock)
+	if !ok {
+		return 0
+	}
 	pb.mainParent = tp.GetID()
 	pb.blueNum = tp.blueNum + 1
 	pb.height = tp.height + 1
@@ -654,8 +681,9 @@ func (ph *Phantom) doIsBlue(ib IBlock, fork IBlock) bool {
 	}
 	var cur *PhantomBlock
 	if fork == nil {
-		cur = ph.bd.getMainFork(b, true).(*PhantomBlock)
-		if cur == nil {
+		if mf := ph.bd.getMainFork(b, true); mf != nil {
+			cur = mf.(*PhantomBlock)
+		} else {
 			cur = ph.getBlock(ph.mainChain.tip)
 		}
 	} else {
@@ -696,7 +724,10 @@ func (ph *Phantom) IsDAG(parents []IBlock) bool {
 
 		// In the past set
 		//vb
-		tp := ph.GetMainParent(parentsSet).(*PhantomBlock)
+		tp, ok := ph.GetMainParent(parentsSet).(*PhantomBlock)
+		if !ok {
+			return false
+		}
 		pb.mainParent = tp.GetID()
 		pb.blueNum = tp.blueNum + 1
 		pb.height = tp.height + 1
@@ -1,8 +1,10 @@
 package blockdag
 
 import (
+	"bytes"
 	"fmt"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -24,6 +26,118 @@ func Test_GetFutureSet(t *testing.T) {
 	}
 }
 
+func Test_GetFutureSetByOrder(t *testing.T) {
+	ibd := InitBlockDAG(phantom, "PH_fig2-blocks")
+	if ibd == nil {
+		t.FailNow()
+	}
+
+	anBlock := tbMap[testData.PH_GetFutureSet.Input]
+	hashes := bd.GetFutureSet(anBlock.GetHash())
+	bset := NewIdSet()
+	lastOrder := uint(0)
+	for _, h := range hashes {
+		ib := bd.GetBlock(h)
+		if ib.GetOrder() < lastOrder {
+			t.Fatalf("block %s of order %d follows the order %d",
+				getBlockTag(ib.GetID()), ib.GetOrder(), lastOrder)
+		}
+		lastOrder = ib.GetOrder()
+		bset.Add(ib.GetID())
+	}
+	if !processResult(bset, changeToIDList(testData.PH_GetFutureSet.Output)) {
+		t.FailNow()
+	}
+}
+
+func Test_GetAntiPastSize(t *testing.T) {
+	ibd := InitBlockDAG(phantom, "PH_fig2-blocks")
+	if ibd == nil {
+		t.FailNow()
+	}
+
+	anBlock := tbMap[testData.PH_GetFutureSet.Input]
+	futureSize := uint(len(testData.PH_GetFutureSet.Output))
+	size := bd.GetAntiPastSize(anBlock.GetHash(), futureSize+1)
+	if size > futureSize {
+		t.Fatalf("anti past size %d is above the future size %d", size, futureSize)
+	}
+	if size := bd.GetAntiPastSize(anBlock.GetHash(), 1); size > 1 {
+		t.Fatalf("anti past size %d is above the max", size)
+	}
+
+	// Nothing was built on the tips yet.
+	for _, h := range bd.GetTipsList() {
+		if size := bd.GetAntiPastSize(h.GetHash(), futureSize); size != 0 {
+			t.Fatalf("tip %s has anti past size %d", getBlockTag(h.GetID()), size)
+		}
+	}
+}
+
+func Test_ExportDAG(t *testing.T) {
+	ibd := InitBlockDAG(phantom, "PH_fig2-blocks")
+	if ibd == nil {
+		t.FailNow()
+	}
+
+	// Only the blocks up to the main chain tip are ordered.
+	total := bd.GetMainChainTip().GetOrder() + 1
+	blocks, err := bd.ExportDAG(0, bd.GetBlockTotal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uint(len(blocks)) != total {
+		t.Fatalf("exported %d blocks of %d", len(blocks), total)
+	}
+	for i, b := range blocks {
+		if b.Order != uint(i) {
+			t.Fatalf("block %s has order %d at %d", b.Hash, b.Order, i)
+		}
+		if i == 0 {
+			if b.MainParent != nil || len(b.Parents) != 0 {
+				t.Fatal("genesis has parents")
+			}
+			continue
+		}
+		found := false
+		for _, p := range b.Parents {
+			found = found || p.IsEqual(b.MainParent)
+		}
+		if !found {
+			t.Fatalf("main parent of %s is not a parent", b.Hash)
+		}
+	}
+	if blocks, err := bd.ExportDAG(2, 4); err != nil || len(blocks) != 2 {
+		t.Fatalf("unexpected export range: %v", err)
+	}
+
+	// A zero end stands for the main chain tip, with or without a number
+	// of last blocks.
+	if start, end := bd.ExportRange(1, 0, 0); start != 1 || end != total {
+		t.Fatalf("export range [%d, %d), expected [1, %d)", start, end, total)
+	}
+	if start, end := bd.ExportRange(0, 0, 2); start != total-2 || end != total {
+		t.Fatalf("export range [%d, %d), expected [%d, %d)", start, end, total-2, total)
+	}
+	if start, end := bd.ExportRange(0, 3, 5); start != 0 || end != 3 {
+		t.Fatalf("export range [%d, %d), expected [0, 3)", start, end)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteDot(&buf, blocks[1:]); err != nil {
+		t.Fatal(err)
+	}
+	dot := buf.String()
+	if !strings.HasPrefix(dot, "digraph dag {") {
+		t.Fatalf("unexpected dot output %s", dot)
+	}
+	// The genesis is drawn as a parent outside of the export.
+	if !strings.Contains(dot, fmt.Sprintf("\"%s\" [label=\"%s\", style=dashed]",
+		blocks[0].Hash, shortHash(blocks[0].Hash))) {
+		t.Fatalf("genesis not drawn as external parent in %s", dot)
+	}
+}
+
 func Test_GetAnticone(t *testing.T) {
 	ibd := InitBlockDAG(phantom, "PH_fig2-blocks")
 	if ibd == nil {
@@ -60,6 +60,10 @@ var (
 	// block which consists of metadata for all known blocks in DAG.
 	BlockIndexBucketName = []byte("blockidx")
 
+	// BlockChildrenBucketName is the name of the db bucket used to house
+	// the ids of the children of the blocks in DAG.
+	BlockChildrenBucketName = []byte("blockchildren")
+
 	// IndexTipsBucketName is the name of the db bucket used to house the
 	// current tip of each index.
 	IndexTipsBucketName = []byte("idxtips")
@@ -70,4 +74,16 @@ var (
 
 	// CacheInvalidTx is the name of the db bucket used to cache invalid tx
 	CacheInvalidTxName = []byte("cacheinvalidtx")
+
+	// BanListBucketName is the name of the db bucket used to house the
+	// banned hosts and subnets of the peer server.
+	BanListBucketName = []byte("banlist")
+
+	// PrunedBlocksBucketName is the name of the db bucket used to house the
+	// parents of the blocks the data of which was pruned.
+	PrunedBlocksBucketName = []byte("prunedblocks")
+
+	// InvalidatedBlocksBucketName is the name of the db bucket used to
+	// house the blocks invalidated by the node operator.
+	InvalidatedBlocksBucketName = []byte("invalidatedblocks")
 )
@@ -50,3 +50,59 @@ type GetBlockHeaderVerboseResult struct {
 	Time          int64     `json:"time"`
 	PowResult     PowResult `json:"pow"`
 }
+
+// GetUtxoSetInfoResult models the data from the getUtxoSetInfo command.
+type GetUtxoSetInfoResult struct {
+	BestBlock      string `json:"bestblock"`
+	Order          uint64 `json:"order"`
+	Count          uint64 `json:"count"`
+	TotalAmount    uint64 `json:"totalamount"`
+	SerializedSize uint64 `json:"serializedsize"`
+	UtxoSetHash    string `json:"utxosethash"`
+}
+
+// DeploymentInfoResult models a deployment of the getDeploymentInfo command.
+type DeploymentInfoResult struct {
+	ID         uint32 `json:"id"`
+	Bit        uint8  `json:"bit"`
+	StartTime  uint64 `json:"starttime"`
+	ExpireTime uint64 `json:"expiretime"`
+	Status     string `json:"status"`
+	Count      uint32 `json:"count,omitempty"`
+}
+
+// GetDeploymentInfoResult models the data from the getDeploymentInfo command.
+type GetDeploymentInfoResult struct {
+	BestBlock   string                 `json:"bestblock"`
+	Height      uint                   `json:"height"`
+	Window      uint32                 `json:"window"`
+	Threshold   uint32                 `json:"threshold"`
+	Elapsed     uint32                 `json:"elapsed"`
+	Deployments []DeploymentInfoResult `json:"deployments"`
+}
+
+// ConfirmationRiskResult models the data from the getBlockRisk and
+// getTxConfirmationRisk commands.
+type ConfirmationRiskResult struct {
+	TxId          string  `json:"txid,omitempty"`
+	BlockHash     string  `json:"blockhash,omitempty"`
+	Order         uint64  `json:"order"`
+	AntiPast      uint    `json:"antipast"`
+	WaitingTime   uint    `json:"waitingtime"`
+	Alpha         float64 `json:"alpha"`
+	Risk          float64 `json:"risk"`
+	SecurityLevel float64 `json:"securitylevel"`
+	Secure        bool    `json:"secure"`
+}
+
+// DAGBlockResult models a block of the data from the exportDAG command.
+type DAGBlockResult struct {
+	Hash        string   `json:"hash"`
+	Order       uint     `json:"order"`
+	Layer       uint     `json:"layer"`
+	Height      uint     `json:"height"`
+	Parents     []string `json:"parents"`
+	MainParent  string   `json:"mainparent,omitempty"`
+	IsBlue      bool     `json:"isblue"`
+	IsMainChain bool     `json:"ismainchain"`
+}
@@ -0,0 +1,30 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+
+package json
+
+// LightBlockHeaderResult models the data of a block header returned by the
+// light node when the verbose flag is set.  The order is the order of the
+// block reported by the peer the header was synced from.
+type LightBlockHeaderResult struct {
+	Hash       string    `json:"hash"`
+	Order      uint64    `json:"order"`
+	Version    int32     `json:"version"`
+	ParentRoot string    `json:"parentroot"`
+	TxRoot     string    `json:"txRoot"`
+	StateRoot  string    `json:"stateRoot"`
+	Difficulty uint32    `json:"difficulty"`
+	Time       int64     `json:"time"`
+	PowResult  PowResult `json:"pow"`
+}
+
+// WatchedUtxoResult models an unspent output of a watched address returned
+// by the getWatchedUtxos command of the light node.
+type WatchedUtxoResult struct {
+	Txid         string  `json:"txid"`
+	Vout         uint32  `json:"vout"`
+	Address      string  `json:"address"`
+	Amount       float64 `json:"amount"`
+	ScriptPubKey string  `json:"scriptPubKey"`
+	BlockHash    string  `json:"blockhash"`
+	BlockOrder   uint64  `json:"blockorder"`
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+
+package json
+
+// EstimateSmartFeeResult models the data returned from the estimateSmartFee
+// command.  The fee rate is in MEER/kB, and blocks is the number of blocks
+// the estimate was found for.
+type EstimateSmartFeeResult struct {
+	FeeRate *float64 `json:"feerate,omitempty"`
+	Errors  []string `json:"errors,omitempty"`
+	Blocks  int64    `json:"blocks"`
+}
+
+// GetMempoolInfoResult models the data returned from the getMempoolInfo
+// command.  The fee rates are in MEER/kB, the mempool minimum fee is raised
+// above the minimum relay fee when transactions are evicted from the full
+// mempool.
+type GetMempoolInfoResult struct {
+	Size          int     `json:"size"`
+	Bytes         int64   `json:"bytes"`
+	MaxMempool    int64   `json:"maxmempool"`
+	MempoolMinFee float64 `json:"mempoolminfee"`
+	MinRelayTxFee float64 `json:"minrelaytxfee"`
+}
+
+// SaveMempoolResult models the data returned from the saveMempool command.
+type SaveMempoolResult struct {
+	FileName string `json:"filename"`
+	Size     int    `json:"size"`
+}
+
+// LoadMempoolResult models the data returned from the loadMempool command.
+type LoadMempoolResult struct {
+	FileName string `json:"filename"`
+	Accepted int    `json:"accepted"`
+	Failed   int    `json:"failed"`
+}
@@ -45,6 +45,8 @@ type GetPeerInfoResult struct {
 	Version    uint32              `json:"version"`
 	SubVer     string              `json:"subver"`
 	Inbound    bool                `json:"inbound"`
+	Encrypted  bool                `json:"encrypted"`
+	Identity   string              `json:"identity,omitempty"`
 	BanScore   int32               `json:"banscore"`
 	SyncNode   bool                `json:"syncnode"`
 	GraphState GetGraphStateResult `json:"graphstate"`
@@ -61,4 +63,14 @@ type GetGraphStateResult struct {
 type GetBanlistResult struct {
 	Host   string `json:"host"`
 	Expire string `json:"expire"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// GetAddedNodeInfoResult models the data from the getaddednodeinfo command.
+type GetAddedNodeInfoResult struct {
+	AddedNode string `json:"addednode"`
+	State     string `json:"state"`
+	Connected bool   `json:"connected"`
+	ID        int32  `json:"id,omitempty"`
+	Address   string `json:"address,omitempty"`
 }
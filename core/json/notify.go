@@ -0,0 +1,50 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+
+package json
+
+// NewBlockNtfn models the data of the newBlocks websocket notification.
+type NewBlockNtfn struct {
+	Hash     string   `json:"hash"`
+	Order    uint64   `json:"order"`
+	Height   uint64   `json:"height"`
+	Layer    uint32   `json:"layer"`
+	IsBlue   bool     `json:"isblue"`
+	Txsvalid bool     `json:"txsvalid"`
+	Parents  []string `json:"parents"`
+	Time     int64    `json:"time"`
+	TxCount  int      `json:"txcount"`
+}
+
+// NewTxNtfn models the data of the newTransactions websocket notification.
+type NewTxNtfn struct {
+	Txid     string `json:"txid"`
+	Size     int    `json:"size"`
+	Fee      int64  `json:"fee"`
+	FeePerKB int64  `json:"feeperkb"`
+	Time     int64  `json:"time"`
+}
+
+// TxReplacedNtfn models the data of the replacedTransactions websocket
+// notification.  The replaced transactions include the descendants of the
+// transactions which were double spent by the replacement.
+type TxReplacedNtfn struct {
+	Txid     string   `json:"txid"`
+	Fee      int64    `json:"fee"`
+	FeePerKB int64    `json:"feeperkb"`
+	Replaced []string `json:"replaced"`
+}
+
+// OrderChangeNtfn models the data of the orderChanges websocket notification.
+type OrderChangeNtfn struct {
+	Hash   string            `json:"hash"`
+	Blocks []*BlockOrderNtfn `json:"blocks"`
+}
+
+// BlockOrderNtfn is the order change of one block in OrderChangeNtfn.  An old
+// or new order is omitted when the block was not ordered before or after the
+// change.
+type BlockOrderNtfn struct {
+	Hash     string  `json:"hash"`
+	OldOrder *uint64 `json:"oldorder,omitempty"`
+	NewOrder *uint64 `json:"neworder,omitempty"`
+}
@@ -104,6 +104,15 @@ type GetUtxoResult struct {
 	Coinbase      bool               `json:"coinbase"`
 }
 
+// GetSpendingTxResult models the data from the getSpendingTx command.  The
+// block hash is empty when the spending transaction is in the mempool.
+type GetSpendingTxResult struct {
+	TxId          string `json:"txid"`
+	Vin           uint32 `json:"vin"`
+	BlockHash     string `json:"blockhash,omitempty"`
+	Confirmations int64  `json:"confirmations"`
+}
+
 // GetRawTransactionsResult models the data from the getrawtransactions
 // command.
 type GetRawTransactionsResult struct {
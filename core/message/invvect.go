@@ -31,6 +31,7 @@ const (
 	InvTypeBlock         InvType = 2
 	InvTypeFilteredBlock InvType = 3
 	InvTypeAiringBlock   InvType = 4
+	InvTypeCmpctBlock    InvType = 5
 )
 
 // Map of service flags back to their constant names for pretty printing.
@@ -40,6 +41,7 @@ var ivStrings = map[InvType]string{
 	InvTypeBlock:         "MSG_BLOCK",
 	InvTypeFilteredBlock: "MSG_FILTERED_BLOCK",
 	InvTypeAiringBlock:   "MSG_AIRING_BLOCK",
+	InvTypeCmpctBlock:    "MSG_CMPCT_BLOCK",
 }
 
 // String returns the InvType in human-readable form.
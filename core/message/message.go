@@ -70,6 +70,15 @@ const (
 	CmdCFilter      = "cfilter"
 	CmdCFHeaders    = "cfheaders"
 	CmdCFTypes      = "cftypes"
+	CmdFilterLoad   = "filterload"
+	CmdFilterAdd    = "filteradd"
+	CmdFilterClear  = "filterclear"
+	CmdMerkleBlock  = "merkleblock"
+	CmdEncInit      = "encinit"
+	CmdSendCmpct    = "sendcmpct"
+	CmdCmpctBlock   = "cmpctblock"
+	CmdGetBlockTxn  = "getblocktxn"
+	CmdBlockTxn     = "blocktxn"
 )
 
 // Message is an interface that describes a qitmeer message.  A type that
@@ -134,27 +143,39 @@ func makeEmptyMessage(command string) (Message, error) {
 		msg = &MsgSyncPoint{}
 	case CmdFeeFilter:
 		msg = &MsgFeeFilter{}
+	case CmdGetCFilter:
+		msg = &MsgGetCFilter{}
+	case CmdGetCFHeaders:
+		msg = &MsgGetCFHeaders{}
+	case CmdCFilter:
+		msg = &MsgCFilter{}
+	case CmdCFHeaders:
+		msg = &MsgCFHeaders{}
+	case CmdFilterLoad:
+		msg = &MsgFilterLoad{}
+	case CmdFilterAdd:
+		msg = &MsgFilterAdd{}
+	case CmdFilterClear:
+		msg = &MsgFilterClear{}
+	case CmdMerkleBlock:
+		msg = &MsgMerkleBlock{}
+	case CmdEncInit:
+		msg = &MsgEncInit{}
+	case CmdSendCmpct:
+		msg = &MsgSendCmpct{}
+	case CmdCmpctBlock:
+		msg = &MsgCmpctBlock{}
+	case CmdGetBlockTxn:
+		msg = &MsgGetBlockTxn{}
+	case CmdBlockTxn:
+		msg = &MsgBlockTxn{}
 	/*
 		case CmdSendHeaders:
 			msg = &MsgSendHeaders{}
 
-
-
-		case CmdGetCFilter:
-			msg = &MsgGetCFilter{}
-
-		case CmdGetCFHeaders:
-			msg = &MsgGetCFHeaders{}
-
 		case CmdGetCFTypes:
 			msg = &MsgGetCFTypes{}
 
-		case CmdCFilter:
-			msg = &MsgCFilter{}
-
-		case CmdCFHeaders:
-			msg = &MsgCFHeaders{}
-
 		case CmdCFTypes:
 			msg = &MsgCFTypes{}
 	*/
@@ -0,0 +1,95 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package message
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	s "github.com/Qitmeer/qitmeer/core/serialization"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"io"
+)
+
+// MsgBlockTxn implements the Message interface and represents a blocktxn
+// message.  It is sent in response to a getblocktxn message, and holds the
+// requested transactions of the block in the order of the request.
+type MsgBlockTxn struct {
+	BlockHash hash.Hash
+	Txs       []*types.Transaction
+}
+
+// Decode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgBlockTxn) Decode(r io.Reader, pver uint32) error {
+	err := s.ReadElements(r, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	count, err := s.ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many transactions for message "+
+			"[count %v, max %v]", count, maxTxPerBlock)
+		return messageError("MsgBlockTxn.Decode", str)
+	}
+	msg.Txs = make([]*types.Transaction, count)
+	for i := range msg.Txs {
+		tx := &types.Transaction{}
+		err := tx.Deserialize(r)
+		if err != nil {
+			return err
+		}
+		msg.Txs[i] = tx
+	}
+	return nil
+}
+
+// Encode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgBlockTxn) Encode(w io.Writer, pver uint32) error {
+	if len(msg.Txs) > maxTxPerBlock {
+		str := fmt.Sprintf("too many transactions for message "+
+			"[count %v, max %v]", len(msg.Txs), maxTxPerBlock)
+		return messageError("MsgBlockTxn.Encode", str)
+	}
+
+	err := s.WriteElements(w, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	err = s.WriteVarInt(w, pver, uint64(len(msg.Txs)))
+	if err != nil {
+		return err
+	}
+	for _, tx := range msg.Txs {
+		err = tx.Encode(w, pver, types.TxSerializeFull)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgBlockTxn) Command() string {
+	return CmdBlockTxn
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgBlockTxn) MaxPayloadLength(pver uint32) uint32 {
+	return types.MaxBlockPayload
+}
+
+// NewMsgBlockTxn returns a new blocktxn message that conforms to the Message
+// interface holding the transactions of the block.
+func NewMsgBlockTxn(blockHash *hash.Hash, txs []*types.Transaction) *MsgBlockTxn {
+	return &MsgBlockTxn{BlockHash: *blockHash, Txs: txs}
+}
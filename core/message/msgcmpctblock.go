@@ -0,0 +1,251 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package message
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	s "github.com/Qitmeer/qitmeer/core/serialization"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"io"
+)
+
+const (
+	// ShortTxIDSize is the size of the short transaction ids of a compact
+	// block.
+	ShortTxIDSize = 6
+
+	// shortTxIDMask keeps the bits of a SipHash which form a short
+	// transaction id.
+	shortTxIDMask = 1<<(ShortTxIDSize*8) - 1
+)
+
+// PrefilledTx is a transaction sent in full in a compact block, together with
+// its index in the block.
+type PrefilledTx struct {
+	Index uint32
+	Tx    *types.Transaction
+}
+
+// MsgCmpctBlock implements the Message interface and represents a cmpctblock
+// message.  It is sent in response to a getdata message with the
+// InvTypeCmpctBlock type, and holds the header and the parents of the block
+// together with the short ids of its transactions, so that the peer can
+// rebuild the block from its memory pool.  The transactions the peer can't
+// be expected to have, such as the coinbase, are prefilled.
+//
+// The short id of a transaction is the lower 6 bytes of the SipHash-2-4 of its
+// hash, keyed with the first 16 bytes of the SHA256 of the header followed by
+// the nonce, so that the collisions can't be chosen in advance.
+type MsgCmpctBlock struct {
+	Header       types.BlockHeader
+	Parents      []*hash.Hash
+	Nonce        uint64
+	ShortIDs     []uint64
+	PrefilledTxs []*PrefilledTx
+}
+
+// BlockHash returns the hash of the block.
+func (msg *MsgCmpctBlock) BlockHash() hash.Hash {
+	return msg.Header.BlockHash()
+}
+
+// TxCount returns the number of transactions in the block.
+func (msg *MsgCmpctBlock) TxCount() int {
+	return len(msg.ShortIDs) + len(msg.PrefilledTxs)
+}
+
+// ShortIDKeys returns the SipHash key of the short transaction ids.
+func (msg *MsgCmpctBlock) ShortIDKeys() (uint64, uint64) {
+	var buf bytes.Buffer
+	_ = msg.Header.Serialize(&buf)
+	_ = s.WriteElements(&buf, msg.Nonce)
+	sum := sha256.Sum256(buf.Bytes())
+	return binary.LittleEndian.Uint64(sum[0:8]),
+		binary.LittleEndian.Uint64(sum[8:16])
+}
+
+// ShortTxID returns the short id of the transaction hash with the key k0, k1.
+func ShortTxID(k0, k1 uint64, txHash *hash.Hash) uint64 {
+	return hash.SipHash(k0, k1, txHash[:]) & shortTxIDMask
+}
+
+// Decode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) Decode(r io.Reader, pver uint32) error {
+	err := msg.Header.Deserialize(r)
+	if err != nil {
+		return err
+	}
+
+	count, err := s.ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > types.MaxParentsPerBlock {
+		str := fmt.Sprintf("too many parents for message "+
+			"[count %v, max %v]", count, types.MaxParentsPerBlock)
+		return messageError("MsgCmpctBlock.Decode", str)
+	}
+	msg.Parents = make([]*hash.Hash, count)
+	for i := range msg.Parents {
+		msg.Parents[i] = &hash.Hash{}
+		err := s.ReadElements(r, msg.Parents[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.ReadElements(r, &msg.Nonce)
+	if err != nil {
+		return err
+	}
+
+	count, err = s.ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many short ids for message "+
+			"[count %v, max %v]", count, maxTxPerBlock)
+		return messageError("MsgCmpctBlock.Decode", str)
+	}
+	msg.ShortIDs = make([]uint64, count)
+	var shortID [8]byte
+	for i := range msg.ShortIDs {
+		_, err := io.ReadFull(r, shortID[:ShortTxIDSize])
+		if err != nil {
+			return err
+		}
+		msg.ShortIDs[i] = binary.LittleEndian.Uint64(shortID[:])
+	}
+
+	count, err = s.ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > maxTxPerBlock-uint64(len(msg.ShortIDs)) {
+		str := fmt.Sprintf("too many prefilled transactions for message "+
+			"[count %v, max %v]", count,
+			maxTxPerBlock-uint64(len(msg.ShortIDs)))
+		return messageError("MsgCmpctBlock.Decode", str)
+	}
+	msg.PrefilledTxs = make([]*PrefilledTx, count)
+	for i := range msg.PrefilledTxs {
+		index, err := s.ReadVarInt(r, pver)
+		if err != nil {
+			return err
+		}
+		tx := &types.Transaction{}
+		err = tx.Deserialize(r)
+		if err != nil {
+			return err
+		}
+		msg.PrefilledTxs[i] = &PrefilledTx{Index: uint32(index), Tx: tx}
+	}
+	return nil
+}
+
+// Encode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) Encode(w io.Writer, pver uint32) error {
+	if msg.TxCount() > maxTxPerBlock {
+		str := fmt.Sprintf("too many transactions for message "+
+			"[count %v, max %v]", msg.TxCount(), maxTxPerBlock)
+		return messageError("MsgCmpctBlock.Encode", str)
+	}
+
+	err := msg.Header.Serialize(w)
+	if err != nil {
+		return err
+	}
+
+	err = s.WriteVarInt(w, pver, uint64(len(msg.Parents)))
+	if err != nil {
+		return err
+	}
+	for _, parent := range msg.Parents {
+		err = s.WriteElements(w, parent)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.WriteElements(w, msg.Nonce)
+	if err != nil {
+		return err
+	}
+
+	err = s.WriteVarInt(w, pver, uint64(len(msg.ShortIDs)))
+	if err != nil {
+		return err
+	}
+	var shortID [8]byte
+	for _, id := range msg.ShortIDs {
+		binary.LittleEndian.PutUint64(shortID[:], id)
+		_, err = w.Write(shortID[:ShortTxIDSize])
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.WriteVarInt(w, pver, uint64(len(msg.PrefilledTxs)))
+	if err != nil {
+		return err
+	}
+	for _, ptx := range msg.PrefilledTxs {
+		err = s.WriteVarInt(w, pver, uint64(ptx.Index))
+		if err != nil {
+			return err
+		}
+		err = ptx.Tx.Encode(w, pver, types.TxSerializeFull)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgCmpctBlock) Command() string {
+	return CmdCmpctBlock
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) MaxPayloadLength(pver uint32) uint32 {
+	return types.MaxBlockPayload
+}
+
+func (msg *MsgCmpctBlock) String() string {
+	return fmt.Sprintf("Block:%s ShortIDs:%d PrefilledTxs:%d",
+		msg.BlockHash().String(), len(msg.ShortIDs), len(msg.PrefilledTxs))
+}
+
+// NewMsgCmpctBlock returns a new cmpctblock message that conforms to the
+// Message interface for the block.  The coinbase is prefilled and the other
+// transactions are sent as short ids keyed with the nonce.
+func NewMsgCmpctBlock(block *types.Block, nonce uint64) *MsgCmpctBlock {
+	msg := &MsgCmpctBlock{
+		Header:  block.Header,
+		Parents: block.Parents,
+		Nonce:   nonce,
+	}
+	if len(block.Transactions) == 0 {
+		return msg
+	}
+	msg.PrefilledTxs = []*PrefilledTx{{Index: 0, Tx: block.Transactions[0]}}
+	msg.ShortIDs = make([]uint64, 0, len(block.Transactions)-1)
+	k0, k1 := msg.ShortIDKeys()
+	for _, tx := range block.Transactions[1:] {
+		txHash := tx.TxHash()
+		msg.ShortIDs = append(msg.ShortIDs, ShortTxID(k0, k1, &txHash))
+	}
+	return msg
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package message
+
+import (
+	"io"
+)
+
+const (
+	// EncInitPubKeySize is the size of the compressed secp256k1 public keys
+	// sent in an encinit message.
+	EncInitPubKeySize = 33
+
+	// EncInitSignatureSize is the size of the compact signature sent in an
+	// encinit message.
+	EncInitSignatureSize = 65
+
+	// encInitPayloadSize is the size of the payload of an encinit message.
+	encInitPayloadSize = 2*EncInitPubKeySize + EncInitSignatureSize
+)
+
+// MsgEncInit implements the Message interface and represents an encinit
+// message.  It is exchanged right after the version messages when both of the
+// peers advertise the Encrypt service.  It carries the long-term identity key
+// of the node, the ephemeral public key used to derive the keys encrypting the
+// rest of the connection, and the signature of the ephemeral key and of the
+// version messages by the identity key.
+type MsgEncInit struct {
+	Identity  [EncInitPubKeySize]byte
+	PubKey    [EncInitPubKeySize]byte
+	Signature [EncInitSignatureSize]byte
+}
+
+// Decode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgEncInit) Decode(r io.Reader, pver uint32) error {
+	if _, err := io.ReadFull(r, msg.Identity[:]); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(r, msg.PubKey[:]); err != nil {
+		return err
+	}
+	_, err := io.ReadFull(r, msg.Signature[:])
+	return err
+}
+
+// Encode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgEncInit) Encode(w io.Writer, pver uint32) error {
+	if _, err := w.Write(msg.Identity[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.PubKey[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(msg.Signature[:])
+	return err
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgEncInit) Command() string {
+	return CmdEncInit
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgEncInit) MaxPayloadLength(pver uint32) uint32 {
+	return encInitPayloadSize
+}
+
+// NewMsgEncInit returns a new encinit message that conforms to the Message
+// interface using the passed serialized identity and ephemeral public keys and
+// compact signature.
+func NewMsgEncInit(identity []byte, pubKey []byte, signature []byte) *MsgEncInit {
+	msg := &MsgEncInit{}
+	copy(msg.Identity[:], identity)
+	copy(msg.PubKey[:], pubKey)
+	copy(msg.Signature[:], signature)
+	return msg
+}
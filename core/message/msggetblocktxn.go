@@ -0,0 +1,95 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package message
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	s "github.com/Qitmeer/qitmeer/core/serialization"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"io"
+)
+
+// MsgGetBlockTxn implements the Message interface and represents a getblocktxn
+// message.  It is used to request the transactions of a compact block which
+// couldn't be found in the memory pool, by their indexes in the block.  The
+// peer responds with a blocktxn message.
+type MsgGetBlockTxn struct {
+	BlockHash hash.Hash
+	Indexes   []uint32
+}
+
+// Decode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) Decode(r io.Reader, pver uint32) error {
+	err := s.ReadElements(r, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	count, err := s.ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many transaction indexes for message "+
+			"[count %v, max %v]", count, maxTxPerBlock)
+		return messageError("MsgGetBlockTxn.Decode", str)
+	}
+	msg.Indexes = make([]uint32, count)
+	for i := range msg.Indexes {
+		index, err := s.ReadVarInt(r, pver)
+		if err != nil {
+			return err
+		}
+		msg.Indexes[i] = uint32(index)
+	}
+	return nil
+}
+
+// Encode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) Encode(w io.Writer, pver uint32) error {
+	if len(msg.Indexes) > maxTxPerBlock {
+		str := fmt.Sprintf("too many transaction indexes for message "+
+			"[count %v, max %v]", len(msg.Indexes), maxTxPerBlock)
+		return messageError("MsgGetBlockTxn.Encode", str)
+	}
+
+	err := s.WriteElements(w, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	err = s.WriteVarInt(w, pver, uint64(len(msg.Indexes)))
+	if err != nil {
+		return err
+	}
+	for _, index := range msg.Indexes {
+		err = s.WriteVarInt(w, pver, uint64(index))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgGetBlockTxn) Command() string {
+	return CmdGetBlockTxn
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) MaxPayloadLength(pver uint32) uint32 {
+	return types.MaxBlockPayload
+}
+
+// NewMsgGetBlockTxn returns a new getblocktxn message that conforms to the
+// Message interface requesting the transactions at the indexes of the block.
+func NewMsgGetBlockTxn(blockHash *hash.Hash, indexes []uint32) *MsgGetBlockTxn {
+	return &MsgGetBlockTxn{BlockHash: *blockHash, Indexes: indexes}
+}
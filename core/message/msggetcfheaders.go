@@ -0,0 +1,73 @@
+// Copyright (c) 2017 The btcsuite developers
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package message
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	s "github.com/Qitmeer/qitmeer/core/serialization"
+	"io"
+)
+
+// MsgGetCFHeaders implements the Message interface and represents a
+// getcfheaders message.  It is used to request the committed filter hashes of
+// the blocks starting at StartOrder in the DAG order up to and including the
+// block with StopHash.  The hashes are returned via a cfheaders message
+// (MsgCFHeaders) and are limited to MaxCFHeadersPerMsg.
+type MsgGetCFHeaders struct {
+	FilterType FilterType
+	StartOrder uint32
+	StopHash   hash.Hash
+}
+
+// Decode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgGetCFHeaders) Decode(r io.Reader, pver uint32) error {
+	var filterType uint8
+	err := s.ReadElements(r, &filterType, &msg.StartOrder, &msg.StopHash)
+	if err != nil {
+		return err
+	}
+	msg.FilterType = FilterType(filterType)
+	return nil
+}
+
+// Encode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgGetCFHeaders) Encode(w io.Writer, pver uint32) error {
+	return s.WriteElements(w, uint8(msg.FilterType), msg.StartOrder,
+		&msg.StopHash)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgGetCFHeaders) Command() string {
+	return CmdGetCFHeaders
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgGetCFHeaders) MaxPayloadLength(pver uint32) uint32 {
+	// Filter type + start order + stop hash.
+	return 1 + 4 + hash.HashSize
+}
+
+func (msg *MsgGetCFHeaders) String() string {
+	return fmt.Sprintf("FilterType:%d StartOrder:%d StopHash:%s",
+		msg.FilterType, msg.StartOrder, msg.StopHash.String())
+}
+
+// NewMsgGetCFHeaders returns a new getcfheaders message that conforms to the
+// Message interface using the passed parameters and defaults for the remaining
+// fields.
+func NewMsgGetCFHeaders(filterType FilterType, startOrder uint32,
+	stopHash *hash.Hash) *MsgGetCFHeaders {
+	return &MsgGetCFHeaders{
+		FilterType: filterType,
+		StartOrder: startOrder,
+		StopHash:   *stopHash,
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2014-2016 The btcsuite developers
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package message
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	s "github.com/Qitmeer/qitmeer/core/serialization"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"io"
+)
+
+const (
+	// maxTxPerBlock is the maximum number of transactions that could
+	// possibly fit into a block, a transaction is at least 10 bytes.
+	maxTxPerBlock = (types.MaxBlockPayload / 10) + 1
+
+	// maxFlagsPerMerkleBlock is the maximum number of flag bytes that
+	// could possibly fit into a merkle block.  Since each transaction is
+	// represented by a single bit, this is the max number of transactions
+	// per block divided by 8 bits per byte.  Then an extra one to cover
+	// partials.
+	maxFlagsPerMerkleBlock = maxTxPerBlock / 8
+)
+
+// MsgMerkleBlock implements the Message interface and represents a merkleblock
+// message.  It holds the header of the block together with a partial merkle tree of its
+// transactions, which proves that the transactions matched by the filter of
+// the peer are committed to by the TxRoot of the header.
+type MsgMerkleBlock struct {
+	Header       types.BlockHeader
+	Transactions uint32
+	Hashes       []*hash.Hash
+	Flags        []byte
+}
+
+// AddTxHash adds a new transaction hash to the message.
+func (msg *MsgMerkleBlock) AddTxHash(h *hash.Hash) error {
+	if len(msg.Hashes)+1 > maxTxPerBlock {
+		str := fmt.Sprintf("too many tx hashes for message [max %v]",
+			maxTxPerBlock)
+		return messageError("MsgMerkleBlock.AddTxHash", str)
+	}
+
+	msg.Hashes = append(msg.Hashes, h)
+	return nil
+}
+
+// Decode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgMerkleBlock) Decode(r io.Reader, pver uint32) error {
+	err := msg.Header.Deserialize(r)
+	if err != nil {
+		return err
+	}
+
+	err = s.ReadElements(r, &msg.Transactions)
+	if err != nil {
+		return err
+	}
+
+	// Read num transaction hashes and limit to max.
+	count, err := s.ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > maxTxPerBlock {
+		str := fmt.Sprintf("too many transaction hashes for message "+
+			"[count %v, max %v]", count, maxTxPerBlock)
+		return messageError("MsgMerkleBlock.Decode", str)
+	}
+
+	// Create a contiguous slice of hashes to deserialize into in order to
+	// reduce the number of allocations.
+	hashes := make([]hash.Hash, count)
+	msg.Hashes = make([]*hash.Hash, 0, count)
+	for i := uint64(0); i < count; i++ {
+		h := &hashes[i]
+		err := s.ReadElements(r, h)
+		if err != nil {
+			return err
+		}
+		msg.AddTxHash(h)
+	}
+
+	msg.Flags, err = s.ReadVarBytes(r, pver, maxFlagsPerMerkleBlock,
+		"merkle block flags size")
+	return err
+}
+
+// Encode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgMerkleBlock) Encode(w io.Writer, pver uint32) error {
+	// Limit to max transaction hashes.
+	numHashes := len(msg.Hashes)
+	if numHashes > maxTxPerBlock {
+		str := fmt.Sprintf("too many transaction hashes for message "+
+			"[count %v, max %v]", numHashes, maxTxPerBlock)
+		return messageError("MsgMerkleBlock.Encode", str)
+	}
+	numFlagBytes := len(msg.Flags)
+	if numFlagBytes > maxFlagsPerMerkleBlock {
+		str := fmt.Sprintf("too many flag bytes for message [count %v, "+
+			"max %v]", numFlagBytes, maxFlagsPerMerkleBlock)
+		return messageError("MsgMerkleBlock.Encode", str)
+	}
+
+	err := msg.Header.Serialize(w)
+	if err != nil {
+		return err
+	}
+
+	err = s.WriteElements(w, msg.Transactions)
+	if err != nil {
+		return err
+	}
+
+	err = s.WriteVarInt(w, pver, uint64(numHashes))
+	if err != nil {
+		return err
+	}
+	for _, h := range msg.Hashes {
+		err = s.WriteElements(w, h)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.WriteVarBytes(w, pver, msg.Flags)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgMerkleBlock) Command() string {
+	return CmdMerkleBlock
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgMerkleBlock) MaxPayloadLength(pver uint32) uint32 {
+	return types.MaxBlockPayload
+}
+
+func (msg *MsgMerkleBlock) String() string {
+	return fmt.Sprintf("Block:%s Transactions:%d Hashes:%d",
+		msg.Header.BlockHash().String(), msg.Transactions, len(msg.Hashes))
+}
+
+// NewMsgMerkleBlock returns a new merkleblock message that conforms to
+// the Message interface.  See MsgMerkleBlock for details.
+func NewMsgMerkleBlock(bh *types.BlockHeader) *MsgMerkleBlock {
+	return &MsgMerkleBlock{
+		Header:       *bh,
+		Transactions: 0,
+		Hashes:       make([]*hash.Hash, 0),
+		Flags:        make([]byte, 0),
+	}
+}
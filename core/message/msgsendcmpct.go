@@ -0,0 +1,52 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package message
+
+import (
+	s "github.com/Qitmeer/qitmeer/core/serialization"
+	"io"
+)
+
+// CmpctBlockEncodingVersion is the version of the compact block encoding
+// announced in the sendcmpct messages.
+const CmpctBlockEncodingVersion = 1
+
+// MsgSendCmpct implements the Message interface and represents a sendcmpct
+// message.  It is sent once after the version handshake to tell the peer that
+// the compact blocks of the announced encoding version may be requested with
+// the getdata messages, and reconstructed with getblocktxn and blocktxn.
+type MsgSendCmpct struct {
+	Version uint64
+}
+
+// Decode decodes r using the protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgSendCmpct) Decode(r io.Reader, pver uint32) error {
+	return s.ReadElements(r, &msg.Version)
+}
+
+// Encode encodes the receiver to w using the protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgSendCmpct) Encode(w io.Writer, pver uint32) error {
+	return s.WriteElements(w, msg.Version)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgSendCmpct) Command() string {
+	return CmdSendCmpct
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgSendCmpct) MaxPayloadLength(pver uint32) uint32 {
+	return 8
+}
+
+// NewMsgSendCmpct returns a new sendcmpct message that conforms to the Message
+// interface using the passed encoding version.
+func NewMsgSendCmpct(version uint64) *MsgSendCmpct {
+	return &MsgSendCmpct{Version: version}
+}
@@ -16,7 +16,11 @@ const (
 	InitialProcotolVersion uint32 = 20
 
 	// ProtocolVersion is the latest protocol version this package supports.
-	ProtocolVersion uint32 = 22
+	ProtocolVersion uint32 = 23
+
+	// CmpctBlockVersion is the protocol version which adds the sendcmpct,
+	// cmpctblock, getblocktxn and blocktxn messages.
+	CmpctBlockVersion uint32 = 23
 )
 
 // Network represents which qitmeer network a message belongs to.
@@ -72,4 +76,12 @@ const (
 
 	// a peer supports committed filters (CFs).
 	CF
+
+	// a peer supports encrypting the connection after the version
+	// handshake.
+	Encrypt
+
+	// a peer only stores the recent blocks, the older block files being
+	// pruned.  It doesn't advertise the Full service.
+	Pruned
 )
@@ -47,6 +47,7 @@ type BlockHeader struct {
 
 	// block version
 	// first 2 bytes, so this value can't more than 65535
+	// last 2 bytes are the version bits of the consensus deployments
 	Version uint32
 
 	// The merkle root of the previous parent blocks (the dag layer)
@@ -121,7 +122,7 @@ func (bh *BlockHeader) BlockData() []byte {
 
 //To maintain version
 //use the first 2 bytes for version
-//last 2 bytes use for rand nonce
+//last 2 bytes signal the consensus deployments, they must not be randomized
 func (bh *BlockHeader) GetVersion() uint32 {
 	b := make([]byte, 4)
 	newVersionData := make([]byte, 4)
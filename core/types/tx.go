@@ -1053,6 +1053,14 @@ type TxDesc struct {
 
 	// FeePerKB is the fee the transaction pays in meer per 1000 bytes.
 	FeePerKB int64
+
+	// AncestorFee, AncestorSize and AncestorCount are the total fee, size
+	// and number of the transactions in the package made of the entry and
+	// its unconfirmed ancestors in the source pool, which have to be mined
+	// along with it.
+	AncestorFee   int64
+	AncestorSize  int64
+	AncestorCount int
 }
 
 // TxLoc holds locator data for the offset and length of where a transaction is
@@ -18,9 +18,11 @@ import (
 	"github.com/Qitmeer/qitmeer/database"
 	"hash/crc32"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 )
 
 const (
@@ -172,6 +174,10 @@ type blockStore struct {
 	// new blocks are written to.
 	writeCursor *writeCursor
 
+	// firstFileNum is the number of the oldest block file, the files
+	// before it have been pruned.  It is accessed atomically.
+	firstFileNum uint32
+
 	// These functions are set to openFile, openWriteFile, and deleteFile by
 	// default, but are exposed here to allow the whitebox tests to replace
 	// them when working with mock files.
@@ -311,6 +317,39 @@ func (s *blockStore) deleteFile(fileNum uint32) error {
 	return nil
 }
 
+// pruneFiles deletes the block files before the passed file number, which are
+// closed first when they are open.  The blocks stored in them are reported as
+// pruned from then on.
+func (s *blockStore) pruneFiles(endFileNum uint32) error {
+	s.obfMutex.Lock()
+	defer s.obfMutex.Unlock()
+
+	firstFileNum := atomic.LoadUint32(&s.firstFileNum)
+	atomic.StoreUint32(&s.firstFileNum, endFileNum)
+	for fileNum := firstFileNum; fileNum < endFileNum; fileNum++ {
+		s.lruMutex.Lock()
+		if elem, ok := s.fileNumToLRUElem[fileNum]; ok {
+			s.openBlocksLRU.Remove(elem)
+			delete(s.fileNumToLRUElem, fileNum)
+		}
+		s.lruMutex.Unlock()
+
+		// Close the file under its write lock in case any readers are
+		// still reading from it.
+		if blockFile, ok := s.openBlockFiles[fileNum]; ok {
+			blockFile.Lock()
+			_ = blockFile.file.Close()
+			blockFile.Unlock()
+			delete(s.openBlockFiles, fileNum)
+		}
+
+		if err := s.deleteFileFunc(fileNum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // blockFile attempts to return an existing file handle for the passed flat file
 // number if it is already open as well as marking it as most recently used.  It
 // will also open the file when it's not already open subject to the rules
@@ -322,6 +361,12 @@ func (s *blockStore) deleteFile(fileNum uint32) error {
 // separate goroutine to close the file after it is returned from here, but
 // before the caller has acquired a read lock.
 func (s *blockStore) blockFile(fileNum uint32) (*lockableFile, error) {
+	// The blocks of the pruned files are gone.
+	if fileNum < atomic.LoadUint32(&s.firstFileNum) {
+		str := fmt.Sprintf("block file %d has been pruned", fileNum)
+		return nil, makeDbErr(database.ErrBlockPruned, str, nil)
+	}
+
 	// When the requested block file is open for writes, return it.
 	wc := s.writeCursor
 	wc.RLock()
@@ -716,27 +761,50 @@ func (s *blockStore) handleRollback(oldBlockFileNum, oldBlockOffset uint32) {
 }
 
 // scanBlockFiles searches the database directory for all flat block files to
-// find the end of the most recent file.  This position is considered the
-// current write cursor which is also stored in the metadata.  Thus, it is used
-// to detect unexpected shutdowns in the middle of writes so the block files
-// can be reconciled.
-func scanBlockFiles(dbPath string) (int, uint32) {
-	lastFile := -1
-	fileLen := uint32(0)
-	for i := 0; ; i++ {
-		filePath := blockFilePath(dbPath, uint32(i))
-		st, err := os.Stat(filePath)
-		if err != nil {
-			break
+// find the oldest file, which follows the pruned ones, and the end of the most
+// recent file.  This position is considered the current write cursor which is
+// also stored in the metadata.  Thus, it is used to detect unexpected shutdowns
+// in the middle of writes so the block files can be reconciled.
+func scanBlockFiles(dbPath string) (int, int, uint32) {
+	firstFile, lastFile := -1, -1
+	entries, err := ioutil.ReadDir(dbPath)
+	if err != nil {
+		return firstFile, lastFile, 0
+	}
+	for _, entry := range entries {
+		var fileNum uint32
+		_, err := fmt.Sscanf(entry.Name(), blockFilenameTemplate, &fileNum)
+		if err != nil || entry.Name() != filepath.Base(
+			blockFilePath(dbPath, fileNum)) {
+			continue
+		}
+		if firstFile == -1 || int(fileNum) < firstFile {
+			firstFile = int(fileNum)
+		}
+		if int(fileNum) > lastFile {
+			lastFile = int(fileNum)
 		}
-		lastFile = i
+	}
 
-		fileLen = uint32(st.Size())
+	// The files after the oldest one are contiguous, the last one is found
+	// the same way as when nothing has been pruned.
+	fileLen := uint32(0)
+	if lastFile != -1 {
+		lastFile = firstFile - 1
+		for i := firstFile; ; i++ {
+			st, err := os.Stat(blockFilePath(dbPath, uint32(i)))
+			if err != nil {
+				break
+			}
+			lastFile = i
+
+			fileLen = uint32(st.Size())
+		}
 	}
 
-	dblog.Trace("Scan found latest block file ", "lastFile", lastFile,
-		"length", fileLen)
-	return lastFile, fileLen
+	dblog.Trace("Scan found latest block file ", "firstFile", firstFile,
+		"lastFile", lastFile, "length", fileLen)
+	return firstFile, lastFile, fileLen
 }
 
 // newBlockStore returns a new block store with the current block file number
@@ -745,8 +813,9 @@ func newBlockStore(basePath string, network protocol.Network) *blockStore {
 	// Look for the end of the latest block to file to determine what the
 	// write cursor position is from the viewpoing of the block files on
 	// disk.
-	fileNum, fileOff := scanBlockFiles(basePath)
+	firstFileNum, fileNum, fileOff := scanBlockFiles(basePath)
 	if fileNum == -1 {
+		firstFileNum = 0
 		fileNum = 0
 		fileOff = 0
 	}
@@ -758,6 +827,7 @@ func newBlockStore(basePath string, network protocol.Network) *blockStore {
 		openBlockFiles:   make(map[uint32]*lockableFile),
 		openBlocksLRU:    list.New(),
 		fileNumToLRUElem: make(map[uint32]*list.Element),
+		firstFileNum:     uint32(firstFileNum),
 
 		writeCursor: &writeCursor{
 			curFile:    &lockableFile{},
@@ -15,6 +15,7 @@ import (
 	"runtime"
 	"sort"
 	"sync"
+	"sync/atomic"
 
 	"github.com/Qitmeer/qitmeer/common/hash"
 	"github.com/Qitmeer/qitmeer/core/protocol"
@@ -1958,6 +1959,78 @@ func (db *db) Update(fn func(database.Tx) error) error {
 	return tx.Commit()
 }
 
+// PruneBlocks deletes the oldest block files until the block files use at most
+// targetSize bytes.  The file holding the keep block, the following ones and
+// the current write file are never deleted.  The prune function is invoked
+// with the hashes of the blocks stored in the files about to be deleted in
+// the context of a managed read-write transaction, which is committed before
+// the files are deleted.  The number of deleted bytes is returned.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) PruneBlocks(targetSize uint64, keep *hash.Hash, prune func(database.Tx, []hash.Hash) error) (uint64, error) {
+	store := db.store
+	var endFileNum uint32
+	var deleted uint64
+	err := db.Update(func(dbTx database.Tx) error {
+		tx := dbTx.(*transaction)
+		blockRow, err := tx.fetchBlockRow(keep)
+		if err != nil {
+			return err
+		}
+		keepFileNum := deserializeBlockLoc(blockRow).blockFileNum
+
+		wc := store.writeCursor
+		wc.RLock()
+		curFileNum := wc.curFileNum
+		wc.RUnlock()
+		if curFileNum < keepFileNum {
+			keepFileNum = curFileNum
+		}
+
+		// Delete the oldest files until the remaining ones fit.
+		firstFileNum := atomic.LoadUint32(&store.firstFileNum)
+		sizes := make(map[uint32]uint64)
+		var totalSize uint64
+		for fileNum := firstFileNum; fileNum <= curFileNum; fileNum++ {
+			st, err := os.Stat(blockFilePath(store.basePath, fileNum))
+			if err != nil {
+				continue
+			}
+			sizes[fileNum] = uint64(st.Size())
+			totalSize += uint64(st.Size())
+		}
+		endFileNum = firstFileNum
+		for endFileNum < keepFileNum && totalSize > targetSize {
+			totalSize -= sizes[endFileNum]
+			deleted += sizes[endFileNum]
+			endFileNum++
+		}
+		if endFileNum == firstFileNum {
+			return nil
+		}
+
+		var hashes []hash.Hash
+		cursor := tx.blockIdxBucket.Cursor()
+		for ok := cursor.First(); ok; ok = cursor.Next() {
+			loc := deserializeBlockLoc(cursor.Value())
+			if loc.blockFileNum < endFileNum {
+				var h hash.Hash
+				copy(h[:], cursor.Key())
+				hashes = append(hashes, h)
+			}
+		}
+		return prune(tx, hashes)
+	})
+	if err != nil || deleted == 0 {
+		return 0, err
+	}
+
+	if err := store.pruneFiles(endFileNum); err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
 // Close cleanly shuts down the database and syncs all data.  It will block
 // until all database transactions have been finalized (rolled back or
 // committed).
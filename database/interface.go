@@ -308,6 +308,7 @@ type Tx interface {
 	// The interface contract guarantees at least the following errors will
 	// be returned (other implementation-specific errors are possible):
 	//   - ErrBlockNotFound if the requested block hash does not exist
+	//   - ErrBlockPruned if the requested block has been pruned
 	//   - ErrTxClosed if the transaction has already been closed
 	//   - ErrCorruption if the database has somehow become corrupted
 	//
@@ -449,6 +450,18 @@ type DB interface {
 	// user-supplied function will result in a panic.
 	Update(fn func(tx Tx) error) error
 
+	// PruneBlocks deletes the oldest stored blocks until the blocks use at
+	// most targetSize bytes.  The blocks stored along with or after the
+	// keep block, and the blocks being written to, are never deleted.  The
+	// prune function is invoked with the hashes of the blocks about to be
+	// deleted in the context of a managed read-write transaction, which
+	// is committed before the blocks are deleted.  The number of deleted
+	// bytes is returned.
+	//
+	// The headers of the pruned blocks are kept, while fetching them
+	// returns ErrBlockPruned.
+	PruneBlocks(targetSize uint64, keep *hash.Hash, prune func(tx Tx, hashes []hash.Hash) error) (uint64, error)
+
 	// Close cleanly shuts down the database and syncs all data.  It will
 	// block until all database transactions have been finalized (rolled
 	// back or committed).
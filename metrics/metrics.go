@@ -23,6 +23,10 @@ import (
 // MetricsEnabledFlag is the CLI flag name to use to enable metrics collections.
 const MetricsEnabledFlag = "metrics"
 
+// MetricsListenFlag is the CLI flag name of the address to serve the metrics
+// on, which also enables metrics collections.
+const MetricsListenFlag = "metricslisten"
+
 // Enabled is the flag specifying if metrics are enable or not.
 var Enabled = false
 
@@ -31,7 +35,8 @@ var Enabled = false
 // and peek into the command line args for the metrics flag.
 func init() {
 	for _, arg := range os.Args {
-		if strings.TrimLeft(arg, "-") == MetricsEnabledFlag {
+		flag := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+		if flag == MetricsEnabledFlag || flag == MetricsListenFlag {
 			log.Info("Enabling metrics collection")
 			Enabled = true
 		}
@@ -48,6 +53,34 @@ func NewCounter(name string) metrics.Counter {
 	return metrics.GetOrRegisterCounter(name, metrics.DefaultRegistry)
 }
 
+// NewGauge create a new metrics Gauge, either a real one of a NOP stub depending
+// on the metrics flag.
+func NewGauge(name string) metrics.Gauge {
+	if !Enabled {
+		return new(metrics.NilGauge)
+	}
+	return metrics.GetOrRegisterGauge(name, metrics.DefaultRegistry)
+}
+
+// NewGaugeFloat64 create a new metrics GaugeFloat64, either a real one of a NOP
+// stub depending on the metrics flag.
+func NewGaugeFloat64(name string) metrics.GaugeFloat64 {
+	if !Enabled {
+		return new(metrics.NilGaugeFloat64)
+	}
+	return metrics.GetOrRegisterGaugeFloat64(name, metrics.DefaultRegistry)
+}
+
+// NewHistogram create a new metrics Histogram sampling the recent values,
+// either a real one of a NOP stub depending on the metrics flag.
+func NewHistogram(name string) metrics.Histogram {
+	if !Enabled {
+		return new(metrics.NilHistogram)
+	}
+	return metrics.GetOrRegisterHistogram(name, metrics.DefaultRegistry,
+		metrics.NewExpDecaySample(1028, 0.015))
+}
+
 // NewMeter create a new metrics Meter, either a real one of a NOP stub depending
 // on the metrics flag.
 func NewMeter(name string) metrics.Meter {
@@ -0,0 +1,118 @@
+// Copyright (c) 2017-2019 The Qitmeer developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Qitmeer/qitmeer/log"
+	"github.com/rcrowley/go-metrics"
+)
+
+// prometheusNamespace prefixes the names of all of the exported metrics.
+const prometheusNamespace = "qitmeer"
+
+// prometheusQuantiles are the quantiles exported for the timers and the
+// histograms.
+var prometheusQuantiles = []float64{0.5, 0.75, 0.95, 0.99}
+
+// prometheusName converts the name of a metric to a valid Prometheus metric
+// name, for example "blkmgr/block/process" to "qitmeer_blkmgr_block_process".
+func prometheusName(name string) string {
+	mapped := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+	return prometheusNamespace + "_" + mapped
+}
+
+// writeSummary writes the quantiles, the sum and the count of a timer or a
+// histogram.  The values of the timers are converted from nanoseconds to
+// seconds.
+func writeSummary(buf *bytes.Buffer, name string, quantiles []float64,
+	sum, count int64, scale float64) {
+
+	fmt.Fprintf(buf, "# TYPE %s summary\n", name)
+	for i, q := range prometheusQuantiles {
+		fmt.Fprintf(buf, "%s{quantile=\"%g\"} %g\n", name, q, quantiles[i]*scale)
+	}
+	fmt.Fprintf(buf, "%s_sum %g\n", name, float64(sum)*scale)
+	fmt.Fprintf(buf, "%s_count %d\n", name, count)
+}
+
+// WritePrometheus writes the metrics of the registry in the Prometheus text
+// exposition format.  The meters are exported as counters of their number of
+// events, the timers in seconds.
+func WritePrometheus(buf *bytes.Buffer, r metrics.Registry) {
+	names := make([]string, 0)
+	all := make(map[string]interface{})
+	r.Each(func(name string, i interface{}) {
+		names = append(names, name)
+		all[name] = i
+	})
+	sort.Strings(names)
+
+	for _, rawName := range names {
+		name := prometheusName(rawName)
+		switch m := all[rawName].(type) {
+		case metrics.Counter:
+			fmt.Fprintf(buf, "# TYPE %s counter\n", name)
+			fmt.Fprintf(buf, "%s %d\n", name, m.Count())
+		case metrics.Gauge:
+			fmt.Fprintf(buf, "# TYPE %s gauge\n", name)
+			fmt.Fprintf(buf, "%s %d\n", name, m.Value())
+		case metrics.GaugeFloat64:
+			fmt.Fprintf(buf, "# TYPE %s gauge\n", name)
+			fmt.Fprintf(buf, "%s %g\n", name, m.Value())
+		case metrics.Meter:
+			fmt.Fprintf(buf, "# TYPE %s counter\n", name)
+			fmt.Fprintf(buf, "%s %d\n", name, m.Snapshot().Count())
+		case metrics.Timer:
+			t := m.Snapshot()
+			writeSummary(buf, name+"_seconds", t.Percentiles(prometheusQuantiles),
+				t.Sum(), t.Count(), 1e-9)
+		case metrics.Histogram:
+			h := m.Snapshot()
+			writeSummary(buf, name, h.Percentiles(prometheusQuantiles),
+				h.Sum(), h.Count(), 1)
+		}
+	}
+}
+
+// PrometheusHandler returns a HTTP handler serving the metrics of the
+// registry in the Prometheus text exposition format.
+func PrometheusHandler(r metrics.Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var buf bytes.Buffer
+		WritePrometheus(&buf, r)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(buf.Bytes())
+	})
+}
+
+// StartPrometheusServer serves the metrics of the default registry in the
+// Prometheus text exposition format on the /metrics path of the listen
+// address.  The returned server has to be closed on shutdown.
+func StartPrometheusServer(listen string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", PrometheusHandler(metrics.DefaultRegistry))
+	server := &http.Server{Addr: listen, Handler: mux}
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Error("Metrics server failed", "addr", listen, "error", err)
+		}
+	}()
+	return server
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2017-2019 The Qitmeer developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("mempool/accepted", r).Inc(3)
+	metrics.GetOrRegisterGauge("p2p/peers", r).Update(8)
+	metrics.GetOrRegisterGaugeFloat64("blockdag/blueratio", r).Update(0.5)
+	metrics.GetOrRegisterTimer("blkmgr/block/process", r).Update(2 * time.Second)
+
+	var buf bytes.Buffer
+	WritePrometheus(&buf, r)
+	out := buf.String()
+
+	expected := []string{
+		"# TYPE qitmeer_mempool_accepted counter\nqitmeer_mempool_accepted 3\n",
+		"# TYPE qitmeer_p2p_peers gauge\nqitmeer_p2p_peers 8\n",
+		"qitmeer_blockdag_blueratio 0.5\n",
+		"# TYPE qitmeer_blkmgr_block_process_seconds summary\n",
+		"qitmeer_blkmgr_block_process_seconds{quantile=\"0.5\"} 2\n",
+		"qitmeer_blkmgr_block_process_seconds_sum 2\n",
+		"qitmeer_blkmgr_block_process_seconds_count 1\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(out, e) {
+			t.Errorf("missing %q in:\n%s", e, out)
+		}
+	}
+
+	// The metrics are sorted by name.
+	if strings.Index(out, "blkmgr") > strings.Index(out, "mempool") {
+		t.Errorf("metrics not sorted:\n%s", out)
+	}
+}
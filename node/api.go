@@ -6,12 +6,15 @@
 package node
 
 import (
+	"encoding/hex"
 	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
 	"github.com/Qitmeer/qitmeer/core/blockdag"
 	"github.com/Qitmeer/qitmeer/core/json"
 	"github.com/Qitmeer/qitmeer/core/message"
 	"github.com/Qitmeer/qitmeer/core/protocol"
 	"github.com/Qitmeer/qitmeer/core/types/pow"
+	"github.com/Qitmeer/qitmeer/p2p/connmgr"
 	"github.com/Qitmeer/qitmeer/params"
 	"github.com/Qitmeer/qitmeer/rpc"
 	"github.com/Qitmeer/qitmeer/services/common"
@@ -28,6 +31,11 @@ func (nf *QitmeerFull) apis() []rpc.API {
 			Service:   NewPublicBlockChainAPI(nf),
 			Public:    true,
 		},
+		{
+			NameSpace: rpc.DefaultServiceNameSpace,
+			Service:   rpc.NewPublicSubscribeAPI(nf.node.rpcServer),
+			Public:    true,
+		},
 		{
 			NameSpace: rpc.TestNameSpace,
 			Service:   NewPrivateBlockChainAPI(nf),
@@ -38,6 +46,11 @@ func (nf *QitmeerFull) apis() []rpc.API {
 			Service:   NewPrivateLogAPI(nf),
 			Public:    false,
 		},
+		{
+			NameSpace: rpc.PeerNameSpace,
+			Service:   NewPrivatePeerAPI(nf),
+			Public:    false,
+		},
 	}
 }
 
@@ -72,7 +85,7 @@ func (api *PublicBlockChainAPI) GetNodeInfo() (interface{}, error) {
 		TestNet:          api.node.node.Config.TestNet,
 		Confirmations:    blockdag.StableConfirmations,
 		CoinbaseMaturity: int32(api.node.node.Params.CoinbaseMaturity),
-		Modules:          []string{rpc.DefaultServiceNameSpace, rpc.MinerNameSpace, rpc.TestNameSpace, rpc.LogNameSpace},
+		Modules:          []string{rpc.DefaultServiceNameSpace, rpc.MinerNameSpace, rpc.TestNameSpace, rpc.LogNameSpace, rpc.PeerNameSpace},
 	}
 	ret.GraphState = *getGraphStateResult(best.GraphState)
 	return ret, nil
@@ -128,6 +141,8 @@ func (api *PublicBlockChainAPI) GetPeerInfo() (interface{}, error) {
 			Version:    statsSnap.Version,
 			SubVer:     statsSnap.UserAgent,
 			Inbound:    statsSnap.Inbound,
+			Encrypted:  p.Encrypted(),
+			Identity:   hex.EncodeToString(p.Identity()),
 			BanScore:   int32(p.BanScore()),
 			SyncNode:   statsSnap.ID == syncPeerID,
 		}
@@ -144,6 +159,50 @@ func (api *PublicBlockChainAPI) GetPeerInfo() (interface{}, error) {
 	return infos, nil
 }
 
+// GetCFilter returns the serialized committed filter of a block as a hex
+// string, it requires --cfindex.
+func (api *PublicBlockChainAPI) GetCFilter(blockHash string) (interface{}, error) {
+	if api.node.cfIndex == nil {
+		return nil, fmt.Errorf("The committed filter index must be enabled (--cfindex)")
+	}
+	h, err := hash.NewHashFromStr(blockHash)
+	if err != nil {
+		return nil, rpc.RpcDecodeHexError(blockHash)
+	}
+	filterBytes, err := api.node.cfIndex.FilterByBlockHash(h)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Failed to load filter")
+	}
+	if filterBytes == nil {
+		return nil, fmt.Errorf("No filter for block %s", h)
+	}
+	return hex.EncodeToString(filterBytes), nil
+}
+
+// GetCFilterHeader returns the committed filter header of a block, it
+// requires --cfindex.
+func (api *PublicBlockChainAPI) GetCFilterHeader(blockHash string) (interface{}, error) {
+	if api.node.cfIndex == nil {
+		return nil, fmt.Errorf("The committed filter index must be enabled (--cfindex)")
+	}
+	h, err := hash.NewHashFromStr(blockHash)
+	if err != nil {
+		return nil, rpc.RpcDecodeHexError(blockHash)
+	}
+	headerBytes, err := api.node.cfIndex.FilterHeaderByBlockHash(h)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Failed to load filter header")
+	}
+	if headerBytes == nil {
+		return nil, fmt.Errorf("No filter header for block %s", h)
+	}
+	header, err := hash.NewHash(headerBytes)
+	if err != nil {
+		return nil, err
+	}
+	return header.String(), nil
+}
+
 // Return the RPC info
 func (api *PublicBlockChainAPI) GetRpcInfo() (interface{}, error) {
 	rs := api.node.node.rpcServer.ReqStatus
@@ -195,19 +254,66 @@ func (api *PrivateBlockChainAPI) Stop() (interface{}, error) {
 func (api *PrivateBlockChainAPI) Banlist() (interface{}, error) {
 	bl := api.node.node.peerServer.GetBanlist()
 	bls := []*json.GetBanlistResult{}
-	for k, v := range bl {
-		bls = append(bls, &json.GetBanlistResult{Host: k, Expire: v.String()})
+	for _, v := range bl {
+		bls = append(bls, &json.GetBanlistResult{Host: v.Key(), Expire: v.Expire.String(), Reason: v.Reason})
 	}
 	return bls, nil
 }
 
+// SetBan bans a host or a subnet in the CIDR notation for the duration in
+// seconds, the default ban duration is used when it is omitted.
+func (api *PrivateBlockChainAPI) SetBan(subnet string, duration *int64, reason *string) (interface{}, error) {
+	dur := connmgr.BanDuration
+	if duration != nil {
+		dur = time.Duration(*duration) * time.Second
+	}
+	re := "manually added"
+	if reason != nil {
+		re = *reason
+	}
+	err := api.node.node.peerServer.SetBan(subnet, dur, re)
+	if err != nil {
+		return nil, rpc.RpcInvalidError("%s", err.Error())
+	}
+	return true, nil
+}
+
 // RemoveBan
 func (api *PrivateBlockChainAPI) RemoveBan(host *string) (interface{}, error) {
 	ho := ""
 	if host != nil {
 		ho = *host
 	}
-	api.node.node.peerServer.RemoveBan(ho)
+	err := api.node.node.peerServer.RemoveBan(ho)
+	if err != nil {
+		return nil, rpc.RpcInvalidError("%s", err.Error())
+	}
+	return true, nil
+}
+
+// ClearBanned removes all of the bans
+func (api *PrivateBlockChainAPI) ClearBanned() (interface{}, error) {
+	api.node.node.peerServer.ClearBanned()
+	return true, nil
+}
+
+// InvalidateBlock marks the block and its future set as invalid, the DAG is
+// ordered without them and their transactions are removed from the utxo set
+// until the block is reconsidered.
+func (api *PrivateBlockChainAPI) InvalidateBlock(h hash.Hash) (interface{}, error) {
+	err := api.node.blockManager.GetChain().InvalidateBlock(&h)
+	if err != nil {
+		return nil, rpc.RpcInvalidError("%s", err.Error())
+	}
+	return true, nil
+}
+
+// ReconsiderBlock reverses the invalidateBlock of the block.
+func (api *PrivateBlockChainAPI) ReconsiderBlock(h hash.Hash) (interface{}, error) {
+	err := api.node.blockManager.GetChain().ReconsiderBlock(&h)
+	if err != nil {
+		return nil, rpc.RpcInvalidError("%s", err.Error())
+	}
 	return true, nil
 }
 
@@ -221,6 +327,75 @@ func (api *PrivateBlockChainAPI) SetRpcMaxClients(max int) (interface{}, error)
 	return api.node.node.Config.RPCMaxClients, nil
 }
 
+type PrivatePeerAPI struct {
+	node *QitmeerFull
+}
+
+func NewPrivatePeerAPI(node *QitmeerFull) *PrivatePeerAPI {
+	return &PrivatePeerAPI{node}
+}
+
+// AddNode adds or removes a node to connect to permanently, or connects to it
+// once. The command is one of add, remove or onetry.
+func (api *PrivatePeerAPI) AddNode(addr string, command string) (interface{}, error) {
+	var err error
+	switch command {
+	case "add":
+		err = api.node.node.peerServer.AddNode(addr, true)
+	case "remove":
+		err = api.node.node.peerServer.RemoveNode(addr)
+	case "onetry":
+		err = api.node.node.peerServer.AddNode(addr, false)
+	default:
+		return nil, rpc.RpcInvalidError("invalid command '%s' for addnode, must be add, remove or onetry", command)
+	}
+	if err != nil {
+		return nil, rpc.RpcInvalidError("%s: %s", addr, err.Error())
+	}
+	return true, nil
+}
+
+// DisconnectNode disconnects the peer with the id, or the peers connected to
+// the address.
+func (api *PrivatePeerAPI) DisconnectNode(target string) (interface{}, error) {
+	var err error
+	if id, perr := strconv.ParseInt(target, 10, 32); perr == nil {
+		err = api.node.node.peerServer.DisconnectNodeByID(int32(id))
+	} else {
+		err = api.node.node.peerServer.DisconnectNodeByAddr(target)
+	}
+	if err != nil {
+		return nil, rpc.RpcInvalidError("%s: %s", target, err.Error())
+	}
+	return true, nil
+}
+
+// GetAddedNodeInfo returns the state of the added nodes, or of the node only
+// when it is given.
+func (api *PrivatePeerAPI) GetAddedNodeInfo(node *string) (interface{}, error) {
+	nodes := api.node.node.peerServer.AddedNodes()
+	infos := make([]*json.GetAddedNodeInfoResult, 0, len(nodes))
+	for _, n := range nodes {
+		if node != nil && *node != n.Addr {
+			continue
+		}
+		info := &json.GetAddedNodeInfoResult{
+			AddedNode: n.Addr,
+			State:     n.State.String(),
+		}
+		if n.Peer != nil {
+			info.Connected = true
+			info.ID = n.Peer.ID()
+			info.Address = n.Peer.Addr()
+		}
+		infos = append(infos, info)
+	}
+	if node != nil && len(infos) == 0 {
+		return nil, rpc.RpcInvalidError("node %s has not been added", *node)
+	}
+	return infos, nil
+}
+
 type PrivateLogAPI struct {
 	node *QitmeerFull
 }
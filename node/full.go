@@ -35,9 +35,13 @@ type QitmeerFull struct {
 	blockManager *blkmgr.BlockManager
 	// tx manager
 	txManager *tx.TxManager
+	// committed filter index, nil when it is disabled
+	cfIndex *index.CfIndex
 
 	// miner service
 	cpuMiner *miner.CPUMiner
+	// stratum mining server, nil when it is disabled
+	stratum *miner.StratumServer
 
 	// address service
 	addressApi *address.AddressApi
@@ -58,12 +62,22 @@ func (qm *QitmeerFull) Start(server *peerserver.PeerServer) error {
 
 	qm.blockManager.Start()
 	qm.txManager.Start()
+
+	if qm.stratum != nil {
+		if err := qm.stratum.Start(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 func (qm *QitmeerFull) Stop() error {
 	log.Debug("Stopping Qitmeer full node service")
 
+	if qm.stratum != nil {
+		qm.stratum.Stop()
+	}
+
 	log.Info("try stop bm")
 
 	qm.blockManager.Stop()
@@ -109,6 +123,7 @@ func newQitmeerFullNode(node *Node) (*QitmeerFull, error) {
 
 	var txIndex *index.TxIndex
 	var addrIndex *index.AddrIndex
+	var spendIndex *index.SpendIndex
 	log.Info("Transaction index is enabled")
 	txIndex = index.NewTxIndex(qm.db)
 	indexes = append(indexes, txIndex)
@@ -117,6 +132,16 @@ func newQitmeerFullNode(node *Node) (*QitmeerFull, error) {
 		addrIndex = index.NewAddrIndex(qm.db, node.Params)
 		indexes = append(indexes, addrIndex)
 	}
+	if cfg.CfIndex {
+		log.Info("Committed filter index is enabled")
+		qm.cfIndex = index.NewCfIndex(qm.db)
+		indexes = append(indexes, qm.cfIndex)
+	}
+	if cfg.SpendIndex {
+		log.Info("Spend index is enabled")
+		spendIndex = index.NewSpendIndex(qm.db)
+		indexes = append(indexes, spendIndex)
+	}
 	// index-manager
 	var indexManager blockchain.IndexManager
 	if len(indexes) > 0 {
@@ -134,7 +159,7 @@ func newQitmeerFullNode(node *Node) (*QitmeerFull, error) {
 	qm.blockManager = bm
 
 	// txmanager
-	tm, err := tx.NewTxManager(bm, txIndex, addrIndex, cfg, qm.nfManager, qm.sigCache, node.DB)
+	tm, err := tx.NewTxManager(bm, txIndex, addrIndex, spendIndex, cfg, qm.nfManager, qm.sigCache, node.DB)
 	if err != nil {
 		return nil, err
 	}
@@ -144,6 +169,7 @@ func newQitmeerFullNode(node *Node) (*QitmeerFull, error) {
 	node.peerServer.BlockManager = bm
 	node.peerServer.TimeSource = qm.timeSource
 	node.peerServer.TxMemPool = qm.txManager.MemPool().(*mempool.TxPool)
+	node.peerServer.CfIndex = qm.cfIndex
 
 	// Cpu Miner
 	// Create the mining policy based on the configuration options.
@@ -165,6 +191,9 @@ func newQitmeerFullNode(node *Node) (*QitmeerFull, error) {
 
 	qm.cpuMiner = miner.NewCPUMiner(cfg, node.Params, &policy, qm.sigCache,
 		qm.txManager.MemPool().(*mempool.TxPool), qm.timeSource, qm.blockManager, defaultNumWorkers)
+	if cfg.Stratum != "" {
+		qm.stratum = miner.NewStratumServer(qm.cpuMiner, cfg.Stratum, cfg.StratumDiff)
+	}
 	// init address api
 	qm.addressApi = address.NewAddressApi(cfg, node.Params)
 	return &qm, nil
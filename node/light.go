@@ -3,9 +3,11 @@ package node
 
 import (
 	"github.com/Qitmeer/qitmeer/config"
+	"github.com/Qitmeer/qitmeer/core/blockchain"
 	"github.com/Qitmeer/qitmeer/database"
 	"github.com/Qitmeer/qitmeer/p2p/peerserver"
 	"github.com/Qitmeer/qitmeer/rpc"
+	"github.com/Qitmeer/qitmeer/services/light"
 )
 
 // QitmeerLight implements the qitmeer light node service.
@@ -13,26 +15,44 @@ type QitmeerLight struct {
 	// database
 	db     database.DB
 	config *config.Config
+
+	// header and watched address sync service
+	syncManager *light.SyncManager
+
+	// clock time service
+	timeSource blockchain.MedianTimeSource
 }
 
 func (light *QitmeerLight) Start(server *peerserver.PeerServer) error {
 	log.Debug("Starting Qitmeer light node service")
+	light.syncManager.Start()
 	return nil
 }
 
 func (light *QitmeerLight) Stop() error {
 	log.Debug("Stopping Qitmeer light node service")
-	return nil
+	return light.syncManager.Stop()
 }
 
 func (light *QitmeerLight) APIs() []rpc.API {
-	return []rpc.API{}
+	return []rpc.API{light.syncManager.API()}
 }
 
 func newQitmeerLight(n *Node) (*QitmeerLight, error) {
-	light := QitmeerLight{
-		config: n.Config,
-		db:     n.DB,
+	ql := QitmeerLight{
+		config:     n.Config,
+		db:         n.DB,
+		timeSource: blockchain.NewMedianTime(),
 	}
-	return &light, nil
+	sm, err := light.NewSyncManager(n.DB, n.Params, ql.timeSource,
+		n.Config.WatchAddrs, n.Config.WatchBirthday, n.Config.MaxPeers)
+	if err != nil {
+		return nil, err
+	}
+	ql.syncManager = sm
+
+	// prepare peerServer
+	n.peerServer.LightSync = sm
+	n.peerServer.TimeSource = ql.timeSource
+	return &ql, nil
 }
@@ -55,7 +55,7 @@ func NewNode(cfg *config.Config, database database.DB, chainParams *params.Param
 		quit:   make(chan struct{}),
 	}
 
-	server, err := peerserver.NewPeerServer(cfg, chainParams)
+	server, err := peerserver.NewPeerServer(cfg, database, chainParams)
 	if err != nil {
 		return nil, err
 	}
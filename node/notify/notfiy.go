@@ -1,6 +1,7 @@
 package notify
 
 import (
+	"github.com/Qitmeer/qitmeer/core/json"
 	"github.com/Qitmeer/qitmeer/core/message"
 	"github.com/Qitmeer/qitmeer/core/types"
 )
@@ -11,4 +12,7 @@ type Notify interface {
 	AnnounceNewTransactions(newTxs []*types.TxDesc)
 	RelayInventory(invVect *message.InvVect, data interface{})
 	BroadcastMessage(msg message.Message)
+	NotifyBlockConnected(ntfn *json.NewBlockNtfn)
+	NotifyReorganization(ntfn *json.OrderChangeNtfn)
+	NotifyTxReplaced(ntfn *json.TxReplacedNtfn)
 }
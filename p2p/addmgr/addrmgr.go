@@ -684,7 +684,7 @@ func (a *AddrManager) HostToNetAddress(host string, port uint16, services protoc
 // ip is in the range used for Tor addresses then it will be transformed into
 // the relevant .onion address.
 func ipString(na *types.NetAddress) string {
-	if isOnionCatTor(na) {
+	if IsOnionCatTor(na) {
 		// We know now that na.IP is long enogh.
 		base32 := base32.StdEncoding.EncodeToString(na.IP[6:])
 		return strings.ToLower(base32) + ".onion"
@@ -970,8 +970,8 @@ func getReachabilityFrom(localAddr, remoteAddr *types.NetAddress) int {
 		return Unreachable
 	}
 
-	if isOnionCatTor(remoteAddr) {
-		if isOnionCatTor(localAddr) {
+	if IsOnionCatTor(remoteAddr) {
+		if IsOnionCatTor(localAddr) {
 			return Private
 		}
 
@@ -1059,7 +1059,7 @@ func (a *AddrManager) GetBestLocalAddress(remoteAddr *types.NetAddress) *types.N
 
 		// Send something unroutable if nothing suitable.
 		var ip net.IP
-		if !isIPv4(remoteAddr) && !isOnionCatTor(remoteAddr) {
+		if !isIPv4(remoteAddr) && !IsOnionCatTor(remoteAddr) {
 			ip = net.IPv6zero
 		} else {
 			ip = net.IPv4zero
@@ -113,11 +113,11 @@ func isLocal(na *types.NetAddress) bool {
 	return na.IP.IsLoopback() || zero4Net.Contains(na.IP)
 }
 
-// isOnionCatTor returns whether or not the passed address is in the IPv6 range
+// IsOnionCatTor returns whether or not the passed address is in the IPv6 range
 // used by bitcoin to support Tor (fd87:d87e:eb43::/48).  Note that this range
 // is the same range used by OnionCat, which is part of the RFC4193 unique local
 // IPv6 range.
-func isOnionCatTor(na *types.NetAddress) bool {
+func IsOnionCatTor(na *types.NetAddress) bool {
 	return onionCatNet.Contains(na.IP)
 }
 
@@ -230,7 +230,7 @@ func IsRoutable(na *types.NetAddress) bool {
 	return isValid(na) && !(isRFC1918(na) || isRFC2544(na) ||
 		isRFC3927(na) || isRFC4862(na) || isRFC3849(na) ||
 		isRFC4843(na) || isRFC5737(na) || isRFC6598(na) ||
-		isLocal(na) || (isRFC4193(na) && !isOnionCatTor(na)))
+		isLocal(na) || (isRFC4193(na) && !IsOnionCatTor(na)))
 }
 
 // GroupKey returns a string representing the network group an address is part
@@ -268,7 +268,7 @@ func GroupKey(na *types.NetAddress) string {
 		}
 		return ip.Mask(net.CIDRMask(16, 32)).String()
 	}
-	if isOnionCatTor(na) {
+	if IsOnionCatTor(na) {
 		// group is keyed off the first 4 bits of the actual onion key.
 		return fmt.Sprintf("tor:%d", na.IP[6]&((1<<4)-1))
 	}
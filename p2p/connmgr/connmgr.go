@@ -133,6 +133,24 @@ const (
 	ConnDisconnected
 )
 
+// connStateStrings is a map of the connection states back to their constant
+// names for pretty printing.
+var connStateStrings = map[ConnState]string{
+	ConnPending:      "pending",
+	ConnFailing:      "failing",
+	ConnCanceled:     "canceled",
+	ConnEstablished:  "established",
+	ConnDisconnected: "disconnected",
+}
+
+// String returns the ConnState in human-readable form.
+func (s ConnState) String() string {
+	if str, ok := connStateStrings[s]; ok {
+		return str
+	}
+	return fmt.Sprintf("Unknown ConnState (%d)", uint32(s))
+}
+
 // ConnReq is the connection request to a network address. If permanent, the
 // connection will be retried on disconnection.
 type ConnReq struct {
@@ -491,27 +509,8 @@ func (cm *ConnManager) Connect(c *ConnReq) {
 		return
 	}
 
-	if atomic.LoadUint64(&c.id) == 0 {
-		atomic.StoreUint64(&c.id, atomic.AddUint64(&cm.connReqCount, 1))
-
-		// Submit a request of a pending connection attempt to the
-		// connection manager. By registering the id before the
-		// connection is even established, we'll be able to later
-		// cancel the connection via the Remove method.
-		done := make(chan struct{})
-		select {
-		case cm.requests <- registerPending{c, done}:
-		case <-cm.quit:
-			return
-		}
-
-		// Wait for the registration to successfully add the pending
-		// conn req to the conn manager's internal state.
-		select {
-		case <-done:
-		case <-cm.quit:
-			return
-		}
+	if atomic.LoadUint64(&c.id) == 0 && !cm.register(c) {
+		return
 	}
 	log.Debug(fmt.Sprintf("Attempting to connect to %v", c))
 	conn, err := cm.cfg.Dial(c.Addr.Network(), c.Addr.String())
@@ -529,6 +528,43 @@ func (cm *ConnManager) Connect(c *ConnReq) {
 	}
 }
 
+// Register assigns an id to the connection request and registers it as a
+// pending connection, so that it can be removed with the Remove method before
+// Connect is run.  It does nothing when the request already has an id.
+func (cm *ConnManager) Register(c *ConnReq) {
+	if atomic.LoadInt32(&cm.stop) != 0 || atomic.LoadUint64(&c.id) != 0 {
+		return
+	}
+	cm.register(c)
+}
+
+// register assigns an id to the connection request and waits for the
+// connection handler to register it as pending.  It returns false when the
+// connection manager is stopped meanwhile.
+func (cm *ConnManager) register(c *ConnReq) bool {
+	atomic.StoreUint64(&c.id, atomic.AddUint64(&cm.connReqCount, 1))
+
+	// Submit a request of a pending connection attempt to the
+	// connection manager. By registering the id before the
+	// connection is even established, we'll be able to later
+	// cancel the connection via the Remove method.
+	done := make(chan struct{})
+	select {
+	case cm.requests <- registerPending{c, done}:
+	case <-cm.quit:
+		return false
+	}
+
+	// Wait for the registration to successfully add the pending
+	// conn req to the conn manager's internal state.
+	select {
+	case <-done:
+	case <-cm.quit:
+		return false
+	}
+	return true
+}
+
 // Disconnect disconnects the connection corresponding to the given connection
 // id. If permanent, the connection will be retried with an increasing backoff
 // duration.
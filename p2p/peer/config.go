@@ -9,6 +9,7 @@ import (
 	"github.com/Qitmeer/qitmeer/core/blockdag"
 	"github.com/Qitmeer/qitmeer/core/protocol"
 	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/crypto/ecc/secp256k1"
 	"github.com/Qitmeer/qitmeer/params"
 	"time"
 )
@@ -118,4 +119,17 @@ type Config struct {
 	// TrickleInterval is the duration of the ticker which trickles down the
 	// inventory to a peer.
 	TrickleInterval time.Duration
+
+	// IdentityKey is the long-term key of the node, which signs the
+	// ephemeral keys of the encrypted connections.  It is required to
+	// advertise the Encrypt service.
+	IdentityKey *secp256k1.PrivateKey
+
+	// RequireEncryption specifies whether the peers which fail to
+	// negotiate an encrypted connection are disconnected.
+	RequireEncryption bool
+
+	// PeerIdentity is the serialized compressed identity key the remote
+	// peer must prove, if any.  The connection then has to be encrypted.
+	PeerIdentity []byte
 }
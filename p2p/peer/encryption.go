@@ -0,0 +1,332 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/core/protocol"
+	"github.com/Qitmeer/qitmeer/crypto/ecc/secp256k1"
+	"github.com/Qitmeer/qitmeer/log"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// maxFramePayload is the maximum number of plaintext bytes sealed in a
+	// frame of an encrypted connection.  Larger writes are split.
+	maxFramePayload = 1 << 20
+
+	// frameHeaderSize is the size of the length prefix of a frame.
+	frameHeaderSize = 4
+
+	// tagSize is the size of the Poly1305 tag sealed with each frame.
+	tagSize = 16
+)
+
+// encryptionInfo binds the derived keys to their purpose.
+var encryptionInfo = []byte("qitmeer p2p encryption v1")
+
+// errFrameTooLarge is returned when a frame announces more bytes than any
+// frame written by a peer can hold.
+var errFrameTooLarge = errors.New("encrypted frame too large")
+
+// -----------------------------------------------------------------------------
+// After the version messages, the peers which both advertise the Encrypt
+// service exchange encinit messages.  Each carries the long-term identity key
+// of the node, an ephemeral secp256k1 public key and a compact signature by the
+// identity key of:
+//
+//   sha256(transcript || role || identity || ephemeral key)
+//
+// where the transcript is the hash of the version messages sent by the
+// outbound then the inbound side, and the role is 0 for the outbound side and
+// 1 for the inbound one.  A peer whose version message was altered, or whose
+// ephemeral key was replaced, fails the signature check, and the identity must
+// match the one expected for the peer if any.  The ECDH shared secret is
+// expanded with HKDF-SHA256, salted with the hash of the transcript and both
+// encinit messages, into a ChaCha20-Poly1305 key for each direction, so the
+// verack messages which follow in encrypted frames confirm that both sides saw
+// the same handshake.  All of the following traffic is sent in frames:
+//
+//   <length><ciphertext>
+//
+//   Field        Type      Size
+//   length       uint32    4 bytes
+//   ciphertext   []byte    length bytes, including the 16 bytes tag
+//
+// The nonce of a frame is its sequence number in the direction, and the
+// length is authenticated as additional data, so that frames can't be
+// dropped, reordered, replayed or truncated without the connection failing.
+//
+// The Encrypt service flag itself travels in plaintext, so the nodes which
+// must not fall back to plaintext connections disconnect the peers which
+// don't negotiate the encryption.
+// -----------------------------------------------------------------------------
+
+// aeadStream seals or opens the frames of one direction of a connection.
+type aeadStream struct {
+	aead    cipher.AEAD
+	counter uint64
+	nonce   [chacha20poly1305.NonceSize]byte
+}
+
+// nextNonce returns the nonce of the next frame.
+func (s *aeadStream) nextNonce() []byte {
+	binary.LittleEndian.PutUint64(s.nonce[4:], s.counter)
+	s.counter++
+	return s.nonce[:]
+}
+
+// encryptedConn wraps a connection to encrypt and authenticate everything
+// written to it, and to decrypt and verify everything read from it.
+type encryptedConn struct {
+	net.Conn
+
+	readMtx sync.Mutex
+	reader  aeadStream
+	pending []byte
+
+	writeMtx sync.Mutex
+	writer   aeadStream
+}
+
+// Read decrypts the next frames of the connection into b.
+//
+// This is part of the net.Conn interface.
+func (c *encryptedConn) Read(b []byte) (int, error) {
+	c.readMtx.Lock()
+	defer c.readMtx.Unlock()
+
+	for len(c.pending) == 0 {
+		var header [frameHeaderSize]byte
+		if _, err := io.ReadFull(c.Conn, header[:]); err != nil {
+			return 0, err
+		}
+		length := binary.LittleEndian.Uint32(header[:])
+		if length > maxFramePayload+tagSize {
+			return 0, errFrameTooLarge
+		}
+		frame := make([]byte, length)
+		if _, err := io.ReadFull(c.Conn, frame); err != nil {
+			return 0, err
+		}
+		plaintext, err := c.reader.aead.Open(frame[:0],
+			c.reader.nextNonce(), frame, header[:])
+		if err != nil {
+			return 0, fmt.Errorf("failed to decrypt frame: %v", err)
+		}
+		c.pending = plaintext
+	}
+
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write encrypts b and writes it to the connection.
+//
+// This is part of the net.Conn interface.
+func (c *encryptedConn) Write(b []byte) (int, error) {
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+
+	written := 0
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > maxFramePayload {
+			chunk = chunk[:maxFramePayload]
+		}
+		frame := make([]byte, frameHeaderSize,
+			frameHeaderSize+len(chunk)+tagSize)
+		binary.LittleEndian.PutUint32(frame,
+			uint32(len(chunk)+tagSize))
+		frame = c.writer.aead.Seal(frame, c.writer.nextNonce(), chunk,
+			frame[:frameHeaderSize])
+		if _, err := c.Conn.Write(frame); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		b = b[len(chunk):]
+	}
+	return written, nil
+}
+
+// newEncryptedConn returns the connection encrypted with the keys derived from
+// the shared secret and the hash of the handshake.
+func newEncryptedConn(conn net.Conn, secret, handshakeHash []byte, inbound bool) (*encryptedConn, error) {
+	kdf := hkdf.New(sha256.New, secret, handshakeHash, encryptionInfo)
+
+	var outboundKey, inboundKey [chacha20poly1305.KeySize]byte
+	if _, err := io.ReadFull(kdf, outboundKey[:]); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(kdf, inboundKey[:]); err != nil {
+		return nil, err
+	}
+	outboundAEAD, err := chacha20poly1305.New(outboundKey[:])
+	if err != nil {
+		return nil, err
+	}
+	inboundAEAD, err := chacha20poly1305.New(inboundKey[:])
+	if err != nil {
+		return nil, err
+	}
+
+	// The outbound key encrypts what the outbound side writes.
+	c := &encryptedConn{Conn: conn}
+	if inbound {
+		c.reader.aead = outboundAEAD
+		c.writer.aead = inboundAEAD
+	} else {
+		c.reader.aead = inboundAEAD
+		c.writer.aead = outboundAEAD
+	}
+	return c, nil
+}
+
+// hashParts returns the SHA-256 hash of the length prefixed parts.
+func hashParts(parts ...[]byte) []byte {
+	h := sha256.New()
+	var length [4]byte
+	for _, part := range parts {
+		binary.LittleEndian.PutUint32(length[:], uint32(len(part)))
+		h.Write(length[:])
+		h.Write(part)
+	}
+	return h.Sum(nil)
+}
+
+// handshakeTranscript returns the hash of the version messages sent by the
+// outbound then the inbound side of the connection.
+func (p *Peer) handshakeTranscript() []byte {
+	outboundVersion, inboundVersion := p.localVersion, p.remoteVersion
+	if p.inbound {
+		outboundVersion, inboundVersion = inboundVersion, outboundVersion
+	}
+	return hashParts(encryptionInfo, outboundVersion, inboundVersion)
+}
+
+// encInitSigHash returns the hash signed by the identity key of the sender of
+// an encinit message.
+func encInitSigHash(transcript []byte, inbound bool, identity, pubKey []byte) []byte {
+	role := []byte{0}
+	if inbound {
+		role[0] = 1
+	}
+	return hashParts(transcript, role, identity, pubKey)
+}
+
+// negotiateEncryption exchanges the encinit messages with the remote peer and
+// switches the connection to the encrypted transport when both of the peers
+// advertise the Encrypt service.  Otherwise the connection is left in
+// plaintext, so that the peers which don't support it can still connect,
+// unless the encryption is required or the identity of the peer is expected.
+func (p *Peer) negotiateEncryption() error {
+	if !protocol.HasServices(p.cfg.Services, protocol.Encrypt) ||
+		!protocol.HasServices(p.Services(), protocol.Encrypt) {
+		if p.cfg.RequireEncryption || p.cfg.PeerIdentity != nil {
+			return fmt.Errorf("the connection to %s is not encrypted", p.addr)
+		}
+		return nil
+	}
+	if p.cfg.IdentityKey == nil {
+		return errors.New("no identity key to encrypt the connection")
+	}
+
+	privKey, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		return err
+	}
+	transcript := p.handshakeTranscript()
+	localIdentity := p.cfg.IdentityKey.PubKey().SerializeCompressed()
+	localPub := privKey.PubKey().SerializeCompressed()
+	sig, err := secp256k1.SignCompact(p.cfg.IdentityKey,
+		encInitSigHash(transcript, p.inbound, localIdentity, localPub), true)
+	if err != nil {
+		return err
+	}
+	if err := p.writeMessage(message.NewMsgEncInit(localIdentity, localPub, sig)); err != nil {
+		return err
+	}
+
+	remoteMsg, _, err := p.readMessage()
+	if err != nil {
+		return err
+	}
+	msg, ok := remoteMsg.(*message.MsgEncInit)
+	if !ok {
+		return fmt.Errorf("an encinit message must follow the version "+
+			"message, got %s", remoteMsg.Command())
+	}
+	if p.cfg.PeerIdentity != nil && !bytes.Equal(msg.Identity[:], p.cfg.PeerIdentity) {
+		return fmt.Errorf("the peer has the identity %x instead of %x",
+			msg.Identity[:], p.cfg.PeerIdentity)
+	}
+	remoteIdentity, err := secp256k1.ParsePubKey(msg.Identity[:])
+	if err != nil {
+		return fmt.Errorf("invalid encinit identity key: %v", err)
+	}
+	signer, _, err := secp256k1.RecoverCompact(msg.Signature[:],
+		encInitSigHash(transcript, !p.inbound, msg.Identity[:], msg.PubKey[:]))
+	if err != nil || !signer.IsEqual(remoteIdentity) {
+		return errors.New("the encinit message isn't signed by the identity key")
+	}
+	remotePub, err := secp256k1.ParsePubKey(msg.PubKey[:])
+	if err != nil {
+		return fmt.Errorf("invalid encinit public key: %v", err)
+	}
+	secret := secp256k1.GenerateSharedSecret(privKey, remotePub)
+
+	outboundIdentity, outboundPub := localIdentity, localPub
+	inboundIdentity, inboundPub := msg.Identity[:], msg.PubKey[:]
+	if p.inbound {
+		outboundIdentity, inboundIdentity = inboundIdentity, outboundIdentity
+		outboundPub, inboundPub = inboundPub, outboundPub
+	}
+	handshakeHash := hashParts(transcript, outboundIdentity, outboundPub,
+		inboundIdentity, inboundPub)
+	conn, err := newEncryptedConn(p.conn, secret, handshakeHash, p.inbound)
+	if err != nil {
+		return err
+	}
+
+	p.flagsMtx.Lock()
+	p.conn = conn
+	p.encrypted = true
+	p.identity = append([]byte(nil), msg.Identity[:]...)
+	p.flagsMtx.Unlock()
+	log.Debug("Encrypted the connection", "peer", p.addr,
+		"identity", fmt.Sprintf("%x", msg.Identity[:]))
+	return nil
+}
+
+// Encrypted returns whether the connection to the peer is encrypted.
+//
+// This function is safe for concurrent access.
+func (p *Peer) Encrypted() bool {
+	p.flagsMtx.Lock()
+	defer p.flagsMtx.Unlock()
+	return p.encrypted
+}
+
+// Identity returns the serialized identity key proved by the peer when the
+// connection was encrypted, or nil if it isn't.
+//
+// This function is safe for concurrent access.
+func (p *Peer) Identity() []byte {
+	p.flagsMtx.Lock()
+	defer p.flagsMtx.Unlock()
+	return p.identity
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/Qitmeer/qitmeer/core/blockdag"
+	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/core/protocol"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/crypto/ecc/secp256k1"
+	"github.com/Qitmeer/qitmeer/params"
+)
+
+// encryptedPipe returns both ends of a pipe encrypted with the same keys.
+func encryptedPipe(t *testing.T) (*encryptedConn, *encryptedConn) {
+	outbound, inbound := net.Pipe()
+	secret := bytes.Repeat([]byte{0x42}, 32)
+	handshakeHash := bytes.Repeat([]byte{0x02}, 32)
+	outConn, err := newEncryptedConn(outbound, secret, handshakeHash, false)
+	if err != nil {
+		t.Fatalf("newEncryptedConn: %v", err)
+	}
+	inConn, err := newEncryptedConn(inbound, secret, handshakeHash, true)
+	if err != nil {
+		t.Fatalf("newEncryptedConn: %v", err)
+	}
+	return outConn, inConn
+}
+
+// TestEncryptedConn ensures the data written to an encrypted connection is
+// read back by the other side, including the writes split into several
+// frames.
+func TestEncryptedConn(t *testing.T) {
+	outConn, inConn := encryptedPipe(t)
+	defer outConn.Close()
+	defer inConn.Close()
+
+	tests := [][]byte{
+		[]byte("version"),
+		bytes.Repeat([]byte{0xab}, maxFramePayload+100),
+	}
+	for i, data := range tests {
+		errChan := make(chan error, 1)
+		go func() {
+			_, err := outConn.Write(data)
+			errChan <- err
+		}()
+		got := make([]byte, len(data))
+		if _, err := io.ReadFull(inConn, got); err != nil {
+			t.Fatalf("#%d: read: %v", i, err)
+		}
+		if err := <-errChan; err != nil {
+			t.Fatalf("#%d: write: %v", i, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("#%d: mismatched data", i)
+		}
+	}
+
+	// The inbound side writes with its own key.
+	go inConn.Write([]byte("verack"))
+	got := make([]byte, 6)
+	if _, err := io.ReadFull(outConn, got); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(got) != "verack" {
+		t.Fatalf("unexpected data %q", got)
+	}
+}
+
+// TestEncryptedConnTampered ensures a modified frame is rejected.
+func TestEncryptedConnTampered(t *testing.T) {
+	outbound, inbound := net.Pipe()
+	defer outbound.Close()
+	defer inbound.Close()
+	secret := bytes.Repeat([]byte{0x42}, 32)
+	handshakeHash := bytes.Repeat([]byte{0x02}, 32)
+	outConn, err := newEncryptedConn(outbound, secret, handshakeHash, false)
+	if err != nil {
+		t.Fatalf("newEncryptedConn: %v", err)
+	}
+
+	// Capture the frame written by the outbound side.
+	var frame bytes.Buffer
+	go func() {
+		outConn.Write([]byte("block"))
+		outbound.Close()
+	}()
+	io.Copy(&frame, inbound)
+
+	tampered := frame.Bytes()
+	tampered[len(tampered)-1] ^= 0x01
+	r, w := net.Pipe()
+	defer r.Close()
+	inConn, err := newEncryptedConn(r, secret, handshakeHash, true)
+	if err != nil {
+		t.Fatalf("newEncryptedConn: %v", err)
+	}
+	go w.Write(tampered)
+	if _, err := inConn.Read(make([]byte, 5)); err == nil {
+		t.Fatal("tampered frame was accepted")
+	}
+}
+
+// newTestPeer returns a peer of the configuration connected through conn.
+func newTestPeer(t *testing.T, cfg Config, conn net.Conn, inbound bool) *Peer {
+	cfg.ChainParams = &params.PrivNetParams
+	cfg.NewestGS = func() (*blockdag.GraphState, error) {
+		gs := blockdag.NewGraphState()
+		gs.GetTips().Add(cfg.ChainParams.GenesisHash)
+		gs.SetTotal(1)
+		return gs, nil
+	}
+	p := newPeerBase(&cfg, inbound)
+	p.conn = conn
+	p.addr = conn.RemoteAddr().String()
+	p.na = types.NewNetAddressIPPort(net.ParseIP("127.0.0.1"), 0, 0)
+	return p
+}
+
+// negotiateTestPeers negotiates the protocol between a pair of peers of the
+// configurations over a TCP connection, which the caller closes.  The version
+// messages read by the outbound peer are altered by tamper when it isn't nil.
+func negotiateTestPeers(t *testing.T, outCfg, inCfg Config, tamper func([]byte)) (*Peer, *Peer, error, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	outConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	inConn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outPeer := newTestPeer(t, outCfg, outConn, false)
+	inPeer := newTestPeer(t, inCfg, inConn, true)
+	outErr := make(chan error, 1)
+	go func() {
+		err := outPeer.writeLocalVersionMsg()
+		if err == nil {
+			err = outPeer.readRemoteVersionMsg()
+		}
+		if err == nil && tamper != nil {
+			tamper(outPeer.remoteVersion)
+		}
+		if err == nil {
+			err = outPeer.negotiateEncryption()
+		}
+		if err != nil {
+			outConn.Close()
+		}
+		outErr <- err
+	}()
+	inErr := inPeer.negotiateInboundProtocol()
+	if inErr != nil {
+		inConn.Close()
+	}
+	return outPeer, inPeer, <-outErr, inErr
+}
+
+// TestNegotiateEncryption ensures the peers encrypt the connection when both
+// advertise the Encrypt service and prove their identity, and that the
+// connections which can't be authenticated fail.
+func TestNegotiateEncryption(t *testing.T) {
+	allowSelfConns = true
+	defer func() {
+		allowSelfConns = false
+	}()
+	outKey, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inKey, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	outCfg := Config{Services: protocol.Full | protocol.Encrypt, IdentityKey: outKey}
+	inCfg := Config{Services: protocol.Full | protocol.Encrypt, IdentityKey: inKey}
+	inIdentity := inKey.PubKey().SerializeCompressed()
+
+	// The identities are exchanged and the messages are encrypted.
+	outCfg.PeerIdentity = inIdentity
+	outPeer, inPeer, outErr, inErr := negotiateTestPeers(t, outCfg, inCfg, nil)
+	if outErr != nil || inErr != nil {
+		t.Fatalf("negotiation failed: %v, %v", outErr, inErr)
+	}
+	if !outPeer.Encrypted() || !inPeer.Encrypted() {
+		t.Fatal("the connection isn't encrypted")
+	}
+	if !bytes.Equal(outPeer.Identity(), inIdentity) ||
+		!bytes.Equal(inPeer.Identity(), outKey.PubKey().SerializeCompressed()) {
+		t.Fatal("unexpected peer identities")
+	}
+	go outPeer.writeMessage(message.NewMsgVerAck())
+	if msg, _, err := inPeer.readMessage(); err != nil || msg.Command() != message.CmdVerAck {
+		t.Fatalf("failed to read the encrypted verack: %v", err)
+	}
+	outPeer.conn.Close()
+	inPeer.conn.Close()
+
+	// The peer which announces another identity than the expected one is
+	// rejected.
+	outCfg.PeerIdentity = outKey.PubKey().SerializeCompressed()
+	outPeer, inPeer, outErr, _ = negotiateTestPeers(t, outCfg, inCfg, nil)
+	outPeer.conn.Close()
+	inPeer.conn.Close()
+	if outErr == nil {
+		t.Fatal("unexpected identity accepted")
+	}
+	outCfg.PeerIdentity = nil
+
+	// A version message altered on the way fails the signature checks of
+	// both sides.
+	tamper := func(version []byte) {
+		version[len(version)-1] ^= 0x01
+	}
+	outPeer, inPeer, outErr, inErr = negotiateTestPeers(t, outCfg, inCfg, tamper)
+	outPeer.conn.Close()
+	inPeer.conn.Close()
+	if outErr == nil || inErr == nil {
+		t.Fatalf("altered version message accepted: %v, %v", outErr, inErr)
+	}
+
+	// The connection stays in plaintext when a peer doesn't advertise the
+	// Encrypt service, unless the other one requires the encryption.
+	plainCfg := Config{Services: protocol.Full}
+	outPeer, inPeer, outErr, inErr = negotiateTestPeers(t, outCfg, plainCfg, nil)
+	outPeer.conn.Close()
+	inPeer.conn.Close()
+	if outErr != nil || inErr != nil || outPeer.Encrypted() {
+		t.Fatalf("plaintext negotiation failed: %v, %v", outErr, inErr)
+	}
+	outCfg.RequireEncryption = true
+	outPeer, inPeer, outErr, _ = negotiateTestPeers(t, outCfg, plainCfg, nil)
+	outPeer.conn.Close()
+	inPeer.conn.Close()
+	if outErr == nil {
+		t.Fatal("plaintext connection accepted while encryption is required")
+	}
+}
@@ -104,30 +104,59 @@ type MessageListeners struct {
 
 	// OnFeeFilter
 	OnFeeFilter func(p *Peer, msg *message.MsgFeeFilter)
-	/*
-		// OnSendHeaders is invoked when a peer receives a sendheaders message.
-		OnSendHeaders func(p *Peer, msg *message.MsgSendHeaders)
 
-		// OnCFilter is invoked when a peer receives a cfilter wire message.
-		OnCFilter func(p *Peer, msg *message.MsgCFilter)
+	// OnCFilter is invoked when a peer receives a cfilter wire message.
+	OnCFilter func(p *Peer, msg *message.MsgCFilter)
 
-		// OnCFHeaders is invoked when a peer receives a cfheaders wire
-		// message.
-		OnCFHeaders func(p *Peer, msg *message.MsgCFHeaders)
+	// OnCFHeaders is invoked when a peer receives a cfheaders wire
+	// message.
+	OnCFHeaders func(p *Peer, msg *message.MsgCFHeaders)
 
-		// OnCFTypes is invoked when a peer receives a cftypes wire message.
-		OnCFTypes func(p *Peer, msg *message.MsgCFTypes)
+	// OnGetCFilter is invoked when a peer receives a getcfilter wire
+	// message.
+	OnGetCFilter func(p *Peer, msg *message.MsgGetCFilter)
 
-		// OnHeaders is invoked when a peer receives a headers wire message.
-		OnHeaders func(p *Peer, msg *message.MsgHeaders)
+	// OnGetCFHeaders is invoked when a peer receives a getcfheaders
+	// wire message.
+	OnGetCFHeaders func(p *Peer, msg *message.MsgGetCFHeaders)
 
-		// OnGetCFilter is invoked when a peer receives a getcfilter wire
-		// message.
-		OnGetCFilter func(p *Peer, msg *message.MsgGetCFilter)
+	// OnFilterAdd is invoked when a peer receives a filteradd wire message.
+	OnFilterAdd func(p *Peer, msg *message.MsgFilterAdd)
+
+	// OnFilterClear is invoked when a peer receives a filterclear wire
+	// message.
+	OnFilterClear func(p *Peer, msg *message.MsgFilterClear)
 
-		// OnGetCFHeaders is invoked when a peer receives a getcfheaders
-		// wire message.
-		OnGetCFHeaders func(p *Peer, msg *message.MsgGetCFHeaders)
+	// OnFilterLoad is invoked when a peer receives a filterload wire
+	// message.
+	OnFilterLoad func(p *Peer, msg *message.MsgFilterLoad)
+
+	// OnMerkleBlock is invoked when a peer receives a merkleblock wire
+	// message.
+	OnMerkleBlock func(p *Peer, msg *message.MsgMerkleBlock)
+
+	// OnHeaders is invoked when a peer receives a headers wire message.
+	OnHeaders func(p *Peer, msg *message.MsgHeaders)
+
+	// OnSendCmpct is invoked when a peer receives a sendcmpct wire message.
+	OnSendCmpct func(p *Peer, msg *message.MsgSendCmpct)
+
+	// OnCmpctBlock is invoked when a peer receives a cmpctblock wire
+	// message.
+	OnCmpctBlock func(p *Peer, msg *message.MsgCmpctBlock)
+
+	// OnGetBlockTxn is invoked when a peer receives a getblocktxn wire
+	// message.
+	OnGetBlockTxn func(p *Peer, msg *message.MsgGetBlockTxn)
+
+	// OnBlockTxn is invoked when a peer receives a blocktxn wire message.
+	OnBlockTxn func(p *Peer, msg *message.MsgBlockTxn)
+	/*
+		// OnSendHeaders is invoked when a peer receives a sendheaders message.
+		OnSendHeaders func(p *Peer, msg *message.MsgSendHeaders)
+
+		// OnCFTypes is invoked when a peer receives a cftypes wire message.
+		OnCFTypes func(p *Peer, msg *message.MsgCFTypes)
 
 		// OnGetCFTypes is invoked when a peer receives a getcftypes wire
 		// message.
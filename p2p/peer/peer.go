@@ -447,6 +447,18 @@ func (p *Peer) WantsHeaders() bool {
 	return sendHeadersPreferred
 }
 
+// SupportsCmpctBlocks returns if the peer announced with a sendcmpct message
+// that compact blocks of the supported encoding can be requested from it.
+//
+// This function is safe for concurrent access.
+func (p *Peer) SupportsCmpctBlocks() bool {
+	p.flagsMtx.Lock()
+	cmpctBlocks := p.cmpctBlocks
+	p.flagsMtx.Unlock()
+
+	return cmpctBlocks
+}
+
 // QueueInventory adds the passed inventory to the inventory send queue which
 // might not be sent right away, rather it is trickled to the peer in batches.
 // Inventory that the peer is already known to have is ignored.
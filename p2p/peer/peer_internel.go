@@ -78,6 +78,16 @@ type Peer struct {
 	versionSent          bool // peer sent the version msg
 	verAckReceived       bool // peer received the version ack msg
 	sendHeadersPreferred bool // peer wants header instead of block
+	encrypted            bool // connection switched to the encrypted transport
+	cmpctBlocks          bool // peer serves and reconstructs compact blocks
+
+	// localVersion and remoteVersion are the payloads of the version
+	// messages, which the encryption of the connection authenticates.
+	// identity is the serialized identity key proved by the peer when the
+	// connection was encrypted.
+	localVersion  []byte
+	remoteVersion []byte
+	identity      []byte
 
 	// Inv
 	knownInventory *invcache.InventoryCache
@@ -213,10 +223,11 @@ func (p *Peer) writeMessage(msg message.Message) error {
 // acceptable then return an error.
 func (p *Peer) readRemoteVersionMsg() error {
 	// Read their version message.
-	remoteMsg, _, err := p.readMessage()
+	remoteMsg, buf, err := p.readMessage()
 	if err != nil {
 		return err
 	}
+	p.remoteVersion = buf
 
 	// Notify and disconnect clients if the first message is not a version
 	// message.
@@ -375,6 +386,14 @@ func (p *Peer) writeLocalVersionMsg() error {
 		return err
 	}
 
+	// The payload is kept to authenticate the encryption of the
+	// connection.
+	var buf bytes.Buffer
+	if err := localVerMsg.Encode(&buf, p.ProtocolVersion()); err != nil {
+		return err
+	}
+	p.localVersion = buf.Bytes()
+
 	if err := p.writeMessage(localVerMsg); err != nil {
 		return err
 	}
@@ -387,24 +406,34 @@ func (p *Peer) writeLocalVersionMsg() error {
 
 // negotiateInboundProtocol waits to receive a version message from the peer
 // then sends our version message. If the events do not occur in that order then
-// it returns an error.
+// it returns an error.  The connection is encrypted afterwards when both of the
+// peers support it.
 func (p *Peer) negotiateInboundProtocol() error {
 	if err := p.readRemoteVersionMsg(); err != nil {
 		return err
 	}
 
-	return p.writeLocalVersionMsg()
+	if err := p.writeLocalVersionMsg(); err != nil {
+		return err
+	}
+
+	return p.negotiateEncryption()
 }
 
 // negotiateOutboundProtocol sends our version message then waits to receive a
 // version message from the peer.  If the events do not occur in that order then
-// it returns an error.
+// it returns an error.  The connection is encrypted afterwards when both of the
+// peers support it.
 func (p *Peer) negotiateOutboundProtocol() error {
 	if err := p.writeLocalVersionMsg(); err != nil {
 		return err
 	}
 
-	return p.readRemoteVersionMsg()
+	if err := p.readRemoteVersionMsg(); err != nil {
+		return err
+	}
+
+	return p.negotiateEncryption()
 }
 
 // start begins processing input and output messages.
@@ -0,0 +1,254 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peerserver
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/Qitmeer/qitmeer/core/dbnamespace"
+	"github.com/Qitmeer/qitmeer/database"
+	"github.com/Qitmeer/qitmeer/log"
+)
+
+// BanEntry describes a banned host or subnet.
+type BanEntry struct {
+	Subnet *net.IPNet
+	Expire time.Time
+	Reason string
+}
+
+// Key returns the key of the entry in the ban list, which is the address for
+// a single host and the CIDR notation for a subnet.
+func (e *BanEntry) Key() string {
+	ones, bits := e.Subnet.Mask.Size()
+	if ones == bits {
+		return e.Subnet.IP.String()
+	}
+	return e.Subnet.String()
+}
+
+// ParseBanSubnet parses a host address or a subnet in the CIDR notation to
+// ban.
+func ParseBanSubnet(subnet string) (*net.IPNet, error) {
+	_, ipnet, err := net.ParseCIDR(subnet)
+	if err == nil {
+		return ipnet, nil
+	}
+	ip := net.ParseIP(subnet)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid host or subnet '%s'", subnet)
+	}
+	bits := 32
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	} else {
+		bits = 128
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// -----------------------------------------------------------------------------
+// The ban list is stored in a bucket of the database metadata, keyed by the
+// key of the entry:
+//
+//   <key> = <expire><reason>
+//
+//   Field      Type      Size
+//   expire     int64     8 bytes
+//   reason     string    variable
+// -----------------------------------------------------------------------------
+
+// dbPutBanEntry stores the entry in the ban list of the database.
+func dbPutBanEntry(dbTx database.Tx, entry *BanEntry) error {
+	serialized := make([]byte, 8+len(entry.Reason))
+	binary.LittleEndian.PutUint64(serialized, uint64(entry.Expire.Unix()))
+	copy(serialized[8:], entry.Reason)
+	bucket := dbTx.Metadata().Bucket(dbnamespace.BanListBucketName)
+	return bucket.Put([]byte(entry.Key()), serialized)
+}
+
+// dbFetchBanList loads the entries of the ban list of the database.
+func dbFetchBanList(dbTx database.Tx) ([]*BanEntry, error) {
+	var entries []*BanEntry
+	bucket := dbTx.Metadata().Bucket(dbnamespace.BanListBucketName)
+	err := bucket.ForEach(func(k, v []byte) error {
+		if len(v) < 8 {
+			return fmt.Errorf("corrupt ban entry %s", k)
+		}
+		subnet, err := ParseBanSubnet(string(k))
+		if err != nil {
+			return err
+		}
+		entries = append(entries, &BanEntry{
+			Subnet: subnet,
+			Expire: time.Unix(int64(binary.LittleEndian.Uint64(v)), 0),
+			Reason: string(v[8:]),
+		})
+		return nil
+	})
+	return entries, err
+}
+
+// updateBanList applies the update to the ban list of the database.  It does
+// nothing when the server has no database.
+func (s *PeerServer) updateBanList(update func(dbTx database.Tx) error) {
+	if s.db == nil {
+		return
+	}
+	err := s.db.Update(func(dbTx database.Tx) error {
+		_, err := dbTx.Metadata().CreateBucketIfNotExists(
+			dbnamespace.BanListBucketName)
+		if err != nil {
+			return err
+		}
+		return update(dbTx)
+	})
+	if err != nil {
+		log.Error("Failed to update the ban list", "error", err)
+	}
+}
+
+// loadBanList restores the bans saved in the database, the expired ones are
+// removed.
+func (s *PeerServer) loadBanList(state *peerState) {
+	var entries []*BanEntry
+	s.updateBanList(func(dbTx database.Tx) error {
+		var err error
+		entries, err = dbFetchBanList(dbTx)
+		if err != nil {
+			return err
+		}
+		bucket := dbTx.Metadata().Bucket(dbnamespace.BanListBucketName)
+		for _, entry := range entries {
+			if time.Now().After(entry.Expire) {
+				if err := bucket.Delete([]byte(entry.Key())); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+
+	state.banMtx.Lock()
+	for _, entry := range entries {
+		if time.Now().Before(entry.Expire) {
+			state.banned[entry.Key()] = entry
+		}
+	}
+	log.Debug("Loaded the ban list", "entries", len(state.banned))
+	state.banMtx.Unlock()
+}
+
+// addBan bans the subnet until the expiry and saves the ban in the database.
+func (s *PeerServer) addBan(state *peerState, subnet *net.IPNet, expire time.Time, reason string) {
+	entry := &BanEntry{Subnet: subnet, Expire: expire, Reason: reason}
+	state.banMtx.Lock()
+	state.banned[entry.Key()] = entry
+	state.banMtx.Unlock()
+
+	s.updateBanList(func(dbTx database.Tx) error {
+		return dbPutBanEntry(dbTx, entry)
+	})
+}
+
+// IsBanPeer returns whether the host is in a banned subnet.  The expired bans
+// of the host are removed from the ban list and from the database.
+func (s *PeerServer) IsBanPeer(host string) bool {
+	banned, expired := s.state.checkBan(host)
+	if len(expired) > 0 {
+		s.updateBanList(func(dbTx database.Tx) error {
+			bucket := dbTx.Metadata().Bucket(dbnamespace.BanListBucketName)
+			for _, key := range expired {
+				if err := bucket.Delete([]byte(key)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	return banned
+}
+
+// GetBanlist returns the entries of the ban list which haven't expired.
+func (s *PeerServer) GetBanlist() []*BanEntry {
+	s.state.banMtx.RLock()
+	defer s.state.banMtx.RUnlock()
+
+	entries := make([]*BanEntry, 0, len(s.state.banned))
+	for _, entry := range s.state.banned {
+		if time.Now().Before(entry.Expire) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// SetBan bans the host or subnet for the duration and disconnects the
+// connected peers in it.
+func (s *PeerServer) SetBan(subnet string, dur time.Duration, reason string) error {
+	ipnet, err := ParseBanSubnet(subnet)
+	if err != nil {
+		return err
+	}
+	if dur <= 0 {
+		return fmt.Errorf("invalid ban duration %v", dur)
+	}
+	s.addBan(s.state, ipnet, time.Now().Add(dur), reason)
+	log.Info(fmt.Sprintf("Banned %s for %v", subnet, dur), "reason", reason)
+
+	replyChan := make(chan int)
+	s.query <- disconnectBannedMsg{reply: replyChan}
+	<-replyChan
+	return nil
+}
+
+// RemoveBan removes the ban of the host or subnet, or all of the bans when it
+// is empty.
+func (s *PeerServer) RemoveBan(subnet string) error {
+	if len(subnet) == 0 {
+		s.ClearBanned()
+		return nil
+	}
+	ipnet, err := ParseBanSubnet(subnet)
+	if err != nil {
+		return err
+	}
+	key := (&BanEntry{Subnet: ipnet}).Key()
+
+	s.state.banMtx.Lock()
+	_, ok := s.state.banned[key]
+	delete(s.state.banned, key)
+	s.state.banMtx.Unlock()
+	if !ok {
+		return fmt.Errorf("%s is not banned", subnet)
+	}
+
+	s.updateBanList(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(dbnamespace.BanListBucketName)
+		return bucket.Delete([]byte(key))
+	})
+	log.Trace(fmt.Sprintf("RemoveBan:%s", key))
+	return nil
+}
+
+// ClearBanned removes all of the bans.
+func (s *PeerServer) ClearBanned() {
+	s.state.banMtx.Lock()
+	s.state.banned = make(map[string]*BanEntry)
+	s.state.banMtx.Unlock()
+
+	s.updateBanList(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		if err := meta.DeleteBucket(dbnamespace.BanListBucketName); err != nil {
+			return err
+		}
+		_, err := meta.CreateBucket(dbnamespace.BanListBucketName)
+		return err
+	})
+	log.Trace("Remove all ban")
+}
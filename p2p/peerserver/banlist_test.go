@@ -0,0 +1,194 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peerserver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Qitmeer/qitmeer/core/dbnamespace"
+	"github.com/Qitmeer/qitmeer/core/protocol"
+	"github.com/Qitmeer/qitmeer/database"
+	_ "github.com/Qitmeer/qitmeer/database/ffldb"
+)
+
+func TestParseBanSubnet(t *testing.T) {
+	tests := []struct {
+		subnet string
+		key    string
+		valid  bool
+	}{
+		{subnet: "1.2.3.4", key: "1.2.3.4", valid: true},
+		{subnet: "1.2.3.0/24", key: "1.2.3.0/24", valid: true},
+		{subnet: "1.2.3.4/24", key: "1.2.3.0/24", valid: true},
+		{subnet: "1.2.3.4/32", key: "1.2.3.4", valid: true},
+		{subnet: "::ffff:1.2.3.4", key: "1.2.3.4", valid: true},
+		{subnet: "2001:db8::1", key: "2001:db8::1", valid: true},
+		{subnet: "2001:db8::/32", key: "2001:db8::/32", valid: true},
+		{subnet: "2001:db8::1/128", key: "2001:db8::1", valid: true},
+		{subnet: "1.2.3.4/33", valid: false},
+		{subnet: "1.2.3", valid: false},
+		{subnet: "host.example", valid: false},
+	}
+	for _, test := range tests {
+		ipnet, err := ParseBanSubnet(test.subnet)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: unexpected result %v", test.subnet, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if key := (&BanEntry{Subnet: ipnet}).Key(); key != test.key {
+			t.Errorf("%s: got key %s, want %s", test.subnet, key, test.key)
+		}
+	}
+}
+
+// newBanTestServer returns a server with an empty ban list in a temporary
+// database.
+func newBanTestServer(t *testing.T) (*PeerServer, func()) {
+	dir, err := ioutil.TempDir("", "banlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := database.Create("ffldb", filepath.Join(dir, "db"), protocol.PrivNet)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	s := &PeerServer{db: db, state: &peerState{banned: make(map[string]*BanEntry)}}
+	return s, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// dbBanKeys returns the keys of the ban list of the database.
+func dbBanKeys(t *testing.T, s *PeerServer) map[string]bool {
+	keys := map[string]bool{}
+	err := s.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(dbnamespace.BanListBucketName)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			keys[string(k)] = true
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestBanListDB(t *testing.T) {
+	s, teardown := newBanTestServer(t)
+	defer teardown()
+
+	expire := time.Unix(time.Now().Add(time.Hour).Unix(), 0)
+	entries := map[string]*BanEntry{}
+	for _, subnet := range []string{"1.2.3.4", "10.0.0.0/8", "2001:db8::/32"} {
+		ipnet, err := ParseBanSubnet(subnet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.addBan(s.state, ipnet, expire, "misbehaving "+subnet)
+		entries[subnet] = &BanEntry{Subnet: ipnet, Expire: expire, Reason: "misbehaving " + subnet}
+	}
+	expired, _ := ParseBanSubnet("5.6.7.8")
+	s.updateBanList(func(dbTx database.Tx) error {
+		return dbPutBanEntry(dbTx, &BanEntry{Subnet: expired, Expire: time.Now().Add(-time.Hour)})
+	})
+
+	// The entries survive the serialization.
+	var fetched []*BanEntry
+	err := s.db.View(func(dbTx database.Tx) error {
+		var err error
+		fetched, err = dbFetchBanList(dbTx)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fetched) != len(entries)+1 {
+		t.Fatalf("got %d entries, want %d", len(fetched), len(entries)+1)
+	}
+	for _, entry := range fetched {
+		if entry.Key() == "5.6.7.8" {
+			continue
+		}
+		want, ok := entries[entry.Key()]
+		if !ok {
+			t.Fatalf("unexpected entry %s", entry.Key())
+		}
+		if entry.Subnet.String() != want.Subnet.String() || !entry.Expire.Equal(want.Expire) ||
+			entry.Reason != want.Reason {
+			t.Fatalf("got entry %v, want %v", entry, want)
+		}
+	}
+
+	// Loading the ban list prunes the expired entries.
+	state := &peerState{banned: make(map[string]*BanEntry)}
+	s.loadBanList(state)
+	if len(state.banned) != len(entries) {
+		t.Fatalf("loaded %d entries, want %d", len(state.banned), len(entries))
+	}
+	for subnet := range entries {
+		if _, ok := state.banned[subnet]; !ok {
+			t.Fatalf("entry %s not loaded", subnet)
+		}
+	}
+	if keys := dbBanKeys(t, s); len(keys) != len(entries) || keys["5.6.7.8"] {
+		t.Fatalf("got the entries %v in the database after loading", keys)
+	}
+}
+
+func TestIsBanPeer(t *testing.T) {
+	s, teardown := newBanTestServer(t)
+	defer teardown()
+
+	for _, subnet := range []string{"1.2.3.4", "10.0.0.0/8", "2001:db8::/32", "5.6.7.0/24"} {
+		ipnet, err := ParseBanSubnet(subnet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.addBan(s.state, ipnet, time.Now().Add(time.Hour), "")
+	}
+	tests := []struct {
+		host   string
+		banned bool
+	}{
+		{host: "1.2.3.4", banned: true},
+		{host: "1.2.3.5", banned: false},
+		{host: "10.20.30.40", banned: true},
+		{host: "11.0.0.1", banned: false},
+		{host: "2001:db8::1", banned: true},
+		{host: "2001:db9::1", banned: false},
+		{host: "::ffff:10.0.0.1", banned: true},
+		{host: "5.6.7.8", banned: true},
+	}
+	for _, test := range tests {
+		if banned := s.IsBanPeer(test.host); banned != test.banned {
+			t.Errorf("%s: got banned %v, want %v", test.host, banned, test.banned)
+		}
+	}
+
+	// An expired ban is removed from the ban list and the database.
+	s.state.banned["5.6.7.0/24"].Expire = time.Now().Add(-time.Second)
+	if s.IsBanPeer("5.6.7.8") {
+		t.Fatal("5.6.7.8 is still banned after the expiry")
+	}
+	if _, ok := s.state.banned["5.6.7.0/24"]; ok {
+		t.Fatal("the expired ban is still in the ban list")
+	}
+	if keys := dbBanKeys(t, s); len(keys) != 3 || keys["5.6.7.0/24"] {
+		t.Fatalf("got the entries %v in the database after the expiry", keys)
+	}
+}
@@ -9,8 +9,9 @@ import (
 )
 
 type BanPeerMsg struct {
-	sp  *serverPeer
-	dur time.Duration
+	sp     *serverPeer
+	dur    time.Duration
+	reason string
 }
 
 // BanPeer bans a peer that has already been connected to the server by ip.
@@ -26,10 +27,15 @@ func (s *PeerServer) handleBanPeerMsg(state *peerState, msg *BanPeerMsg) {
 		log.Debug(fmt.Sprintf("can't split ban peer %s %v", msg.sp.Addr(), err))
 		return
 	}
+	subnet, err := ParseBanSubnet(host)
+	if err != nil {
+		log.Debug(fmt.Sprintf("can't ban peer %s %v", host, err))
+		return
+	}
 	direction := directionString(msg.sp.Inbound())
 	log.Info(fmt.Sprintf("Banned peer %s (%s) for %v", host, direction,
-		connmgr.BanDuration))
-	state.banned[host] = time.Now().Add(msg.dur)
+		msg.dur), "reason", msg.reason)
+	s.addBan(state, subnet, time.Now().Add(msg.dur), msg.reason)
 }
 
 // addBanScore increases the persistent and decaying ban score fields by the
@@ -66,7 +72,7 @@ func (sp *serverPeer) addBanScore(persistent, transient uint32, reason string) {
 			log.Warn("Misbehaving peer -- banning and disconnecting", "peer", sp)
 			dur := float64(transient) / float64(connmgr.BanThreshold)
 			dur *= float64(connmgr.BanDuration)
-			msg := BanPeerMsg{sp: sp, dur: time.Duration(dur)}
+			msg := BanPeerMsg{sp: sp, dur: time.Duration(dur), reason: reason}
 			if msg.dur > connmgr.BanDuration {
 				msg.dur = connmgr.BanDuration
 			}
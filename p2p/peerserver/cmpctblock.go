@@ -0,0 +1,259 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peerserver
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/merkle"
+	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/core/protocol"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/log"
+	"github.com/Qitmeer/qitmeer/p2p/connmgr"
+	"github.com/Qitmeer/qitmeer/p2p/peer"
+)
+
+// maxPendingCmpctBlocks is the maximum number of compact blocks of a peer
+// waiting for their missing transactions.  The full blocks are requested
+// instead beyond it.
+const maxPendingCmpctBlocks = 16
+
+var (
+	// errShortIDCollision is returned when several transactions of a
+	// compact block have the same short id.
+	errShortIDCollision = errors.New("short id collision")
+
+	// errBadMerkleRoot is returned when the transactions found for the
+	// short ids of a compact block don't match its merkle root.
+	errBadMerkleRoot = errors.New("reconstructed transactions don't " +
+		"match the merkle root")
+)
+
+// partialBlock is a compact block being reconstructed from the memory pool
+// and the transactions requested from the peer.
+type partialBlock struct {
+	msg     *message.MsgCmpctBlock
+	txs     []*types.Transaction
+	missing []uint32
+}
+
+// newPartialBlock places the prefilled transactions of the compact block and
+// the transactions of the pool matching its short ids.  The indexes of the
+// transactions which are left to request from the peer are returned in
+// missing.
+func newPartialBlock(msg *message.MsgCmpctBlock, pool []*types.Tx) (*partialBlock, error) {
+	txCount := msg.TxCount()
+	if txCount == 0 {
+		return nil, errors.New("compact block without transactions")
+	}
+	pb := &partialBlock{
+		msg: msg,
+		txs: make([]*types.Transaction, txCount),
+	}
+
+	// The prefilled transactions are in the order of the block.
+	next := 0
+	for _, ptx := range msg.PrefilledTxs {
+		if int(ptx.Index) < next || int(ptx.Index) >= txCount {
+			return nil, fmt.Errorf("invalid prefilled transaction "+
+				"index %d", ptx.Index)
+		}
+		pb.txs[ptx.Index] = ptx.Tx
+		next = int(ptx.Index) + 1
+	}
+
+	// The short ids fill the remaining indexes in order.
+	indexes := make(map[uint64]uint32, len(msg.ShortIDs))
+	i := uint32(0)
+	for _, id := range msg.ShortIDs {
+		for pb.txs[i] != nil {
+			i++
+		}
+		if _, ok := indexes[id]; ok {
+			return nil, errShortIDCollision
+		}
+		indexes[id] = i
+		i++
+	}
+
+	// Two transactions of the pool with the same short id can't tell
+	// which one is in the block, so it is requested.
+	k0, k1 := msg.ShortIDKeys()
+	found := make(map[uint32]bool, len(indexes))
+	for _, tx := range pool {
+		index, ok := indexes[message.ShortTxID(k0, k1, tx.Hash())]
+		if !ok {
+			continue
+		}
+		if _, ok := found[index]; ok {
+			pb.txs[index] = nil
+			found[index] = false
+			continue
+		}
+		pb.txs[index] = tx.Tx
+		found[index] = true
+	}
+
+	for i, tx := range pb.txs {
+		if tx == nil {
+			pb.missing = append(pb.missing, uint32(i))
+		}
+	}
+	return pb, nil
+}
+
+// fill places the transactions requested from the peer.
+func (pb *partialBlock) fill(txs []*types.Transaction) error {
+	if len(txs) != len(pb.missing) {
+		return fmt.Errorf("got %d transactions, requested %d",
+			len(txs), len(pb.missing))
+	}
+	for i, index := range pb.missing {
+		pb.txs[index] = txs[i]
+	}
+	pb.missing = nil
+	return nil
+}
+
+// block returns the reconstructed block.  It fails when the transactions
+// don't match the merkle root, which happens when a transaction of the pool
+// has the short id of another one of the block.
+func (pb *partialBlock) block() (*types.Block, error) {
+	block := &types.Block{
+		Header:       pb.msg.Header,
+		Parents:      pb.msg.Parents,
+		Transactions: pb.txs,
+	}
+	txs := make([]*types.Tx, len(pb.txs))
+	for i, tx := range pb.txs {
+		txs[i] = types.NewTx(tx)
+	}
+	merkles := merkle.BuildMerkleTreeStore(txs, false)
+	if !block.Header.TxRoot.IsEqual(merkles[len(merkles)-1]) {
+		return nil, errBadMerkleRoot
+	}
+	return block, nil
+}
+
+// pushSendCmpctMsg tells the peer that compact blocks can be requested from
+// this server.  It is only sent to the peers which know the message, and not
+// by light nodes which cannot reconstruct compact blocks.
+func (sp *serverPeer) pushSendCmpctMsg() {
+	if sp.server.cfg.LightNode ||
+		sp.ProtocolVersion() < protocol.CmpctBlockVersion {
+		return
+	}
+	sp.QueueMessage(message.NewMsgSendCmpct(
+		message.CmpctBlockEncodingVersion), nil)
+}
+
+// requestFullBlock requests the block the compact block of which couldn't be
+// reconstructed.
+func (sp *serverPeer) requestFullBlock(blockHash *hash.Hash) {
+	gdmsg := message.NewMsgGetData()
+	gdmsg.AddInvVect(message.NewInvVect(message.InvTypeBlock, blockHash))
+	sp.QueueMessage(gdmsg, nil)
+}
+
+// finishCmpctBlock processes the reconstructed compact block like a full
+// block received from the peer.
+func (sp *serverPeer) finishCmpctBlock(p *peer.Peer, pb *partialBlock) {
+	blockHash := pb.msg.BlockHash()
+	block, err := pb.block()
+	if err != nil {
+		log.Debug("Failed to reconstruct the compact block", "hash",
+			blockHash, "peer", p, "error", err)
+		sp.requestFullBlock(&blockHash)
+		return
+	}
+	log.Trace("Reconstructed the compact block", "hash", blockHash,
+		"prefilled", len(pb.msg.PrefilledTxs), "peer", p)
+	sp.processBlock(p, types.NewBlock(block))
+}
+
+// OnCmpctBlock is invoked when a peer receives a cmpctblock wire message.  The
+// block is rebuilt from the memory pool, and the transactions which aren't in
+// it are requested from the peer with a getblocktxn message.  The full block
+// is requested when the compact block can't be reconstructed.
+func (sp *serverPeer) OnCmpctBlock(p *peer.Peer, msg *message.MsgCmpctBlock) {
+	blockHash := msg.BlockHash()
+	p.AddKnownInventory(message.NewInvVect(message.InvTypeBlock, &blockHash))
+
+	var pool []*types.Tx
+	if sp.server.TxMemPool != nil {
+		txDescs := sp.server.TxMemPool.TxDescs()
+		pool = make([]*types.Tx, 0, len(txDescs))
+		for _, txDesc := range txDescs {
+			pool = append(pool, txDesc.Tx)
+		}
+	}
+	pb, err := newPartialBlock(msg, pool)
+	if err != nil {
+		log.Debug("Failed to reconstruct the compact block", "hash",
+			blockHash, "peer", p, "error", err)
+		sp.requestFullBlock(&blockHash)
+		return
+	}
+	if len(pb.missing) == 0 {
+		sp.finishCmpctBlock(p, pb)
+		return
+	}
+
+	if _, ok := sp.cmpctBlocks[blockHash]; !ok &&
+		len(sp.cmpctBlocks) >= maxPendingCmpctBlocks {
+		sp.requestFullBlock(&blockHash)
+		return
+	}
+	sp.cmpctBlocks[blockHash] = pb
+	log.Trace("Requesting the missing transactions of the compact block",
+		"hash", blockHash, "missing", len(pb.missing), "peer", p)
+	p.QueueMessage(message.NewMsgGetBlockTxn(&blockHash, pb.missing), nil)
+}
+
+// OnGetBlockTxn is invoked when a peer receives a getblocktxn wire message.
+// The requested transactions of the block are sent in a blocktxn message.
+func (sp *serverPeer) OnGetBlockTxn(p *peer.Peer, msg *message.MsgGetBlockTxn) {
+	block, err := sp.server.BlockManager.GetChain().FetchBlockByHash(
+		&msg.BlockHash)
+	if err != nil {
+		log.Trace("Unable to fetch requested block hash", "hash",
+			msg.BlockHash, "error", err)
+		return
+	}
+
+	blockTxs := block.Block().Transactions
+	txs := make([]*types.Transaction, 0, len(msg.Indexes))
+	for _, index := range msg.Indexes {
+		if int(index) >= len(blockTxs) {
+			sp.addBanScore(0, connmgr.SeriousScore, "getblocktxn")
+			return
+		}
+		txs = append(txs, blockTxs[index])
+	}
+	p.QueueMessage(message.NewMsgBlockTxn(&msg.BlockHash, txs), nil)
+}
+
+// OnBlockTxn is invoked when a peer receives a blocktxn wire message.  The
+// transactions complete the pending compact block.
+func (sp *serverPeer) OnBlockTxn(p *peer.Peer, msg *message.MsgBlockTxn) {
+	pb, ok := sp.cmpctBlocks[msg.BlockHash]
+	if !ok {
+		sp.addBanScore(0, connmgr.ManyScore, "blocktxn")
+		return
+	}
+	delete(sp.cmpctBlocks, msg.BlockHash)
+
+	if err := pb.fill(msg.Txs); err != nil {
+		log.Debug("Invalid blocktxn", "hash", msg.BlockHash, "peer", p,
+			"error", err)
+		sp.addBanScore(0, connmgr.ExcessiveScore, "blocktxn")
+		sp.requestFullBlock(&msg.BlockHash)
+		return
+	}
+	sp.finishCmpctBlock(p, pb)
+}
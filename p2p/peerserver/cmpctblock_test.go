@@ -0,0 +1,109 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peerserver
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/merkle"
+	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/core/protocol"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/core/types/pow"
+)
+
+// testCmpctBlock returns a block holding a coinbase and n other transactions.
+func testCmpctBlock(n int) *types.Block {
+	block := &types.Block{Parents: []*hash.Hash{{0x01}, {0x02}}}
+	block.Header.Timestamp = time.Unix(1560000000, 0)
+	block.Header.Pow = pow.GetInstance(pow.BLAKE2BD, 0, []byte{})
+	txs := make([]*types.Tx, 0, n+1)
+	for i := 0; i <= n; i++ {
+		tx := types.NewTransaction()
+		tx.Timestamp = time.Unix(1560000000, 0)
+		prevOut := types.NewOutPoint(&hash.Hash{}, types.MaxPrevOutIndex)
+		if i > 0 {
+			prevOut = types.NewOutPoint(&hash.Hash{byte(i)}, 0)
+		}
+		tx.AddTxIn(types.NewTxInput(prevOut, []byte{byte(i)}))
+		tx.AddTxOut(types.NewTxOutput(uint64(i+1)*1e8, []byte{0x51}))
+		block.Transactions = append(block.Transactions, tx)
+		txs = append(txs, types.NewTx(tx))
+	}
+	merkles := merkle.BuildMerkleTreeStore(txs, false)
+	block.Header.TxRoot = *merkles[len(merkles)-1]
+	return block
+}
+
+// TestCmpctBlockReconstruction ensures compact blocks survive the encoding
+// and are rebuilt from the pool and the requested transactions.
+func TestCmpctBlockReconstruction(t *testing.T) {
+	block := testCmpctBlock(4)
+	msg := message.NewMsgCmpctBlock(block, 0x1234)
+	if len(msg.PrefilledTxs) != 1 || len(msg.ShortIDs) != 4 {
+		t.Fatalf("got %d prefilled transactions and %d short ids",
+			len(msg.PrefilledTxs), len(msg.ShortIDs))
+	}
+
+	var buf bytes.Buffer
+	if err := msg.Encode(&buf, protocol.ProtocolVersion); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	var decoded message.MsgCmpctBlock
+	if err := decoded.Decode(&buf, protocol.ProtocolVersion); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	// The pool misses the transactions 2 and 4, and holds another one.
+	pool := []*types.Tx{
+		types.NewTx(block.Transactions[3]),
+		types.NewTx(testCmpctBlock(5).Transactions[5]),
+		types.NewTx(block.Transactions[1]),
+	}
+	pb, err := newPartialBlock(&decoded, pool)
+	if err != nil {
+		t.Fatalf("newPartialBlock: %v", err)
+	}
+	if len(pb.missing) != 2 || pb.missing[0] != 2 || pb.missing[1] != 4 {
+		t.Fatalf("missing transactions %v, want [2 4]", pb.missing)
+	}
+	if err := pb.fill(block.Transactions[2:3]); err == nil {
+		t.Fatal("fill accepted too few transactions")
+	}
+	err = pb.fill([]*types.Transaction{block.Transactions[2],
+		block.Transactions[4]})
+	if err != nil {
+		t.Fatalf("fill: %v", err)
+	}
+	rebuilt, err := pb.block()
+	if err != nil {
+		t.Fatalf("block: %v", err)
+	}
+	if rebuilt.BlockHash() != block.BlockHash() {
+		t.Fatalf("rebuilt block %v, want %v", rebuilt.BlockHash(),
+			block.BlockHash())
+	}
+	if len(rebuilt.Parents) != len(block.Parents) {
+		t.Fatalf("rebuilt block has %d parents, want %d",
+			len(rebuilt.Parents), len(block.Parents))
+	}
+
+	// A wrong transaction for a short id is caught by the merkle root.
+	pb, err = newPartialBlock(&decoded, nil)
+	if err != nil {
+		t.Fatalf("newPartialBlock: %v", err)
+	}
+	txs := append([]*types.Transaction{}, block.Transactions[1:]...)
+	txs[0], txs[1] = txs[1], txs[0]
+	if err := pb.fill(txs); err != nil {
+		t.Fatalf("fill: %v", err)
+	}
+	if _, err := pb.block(); err != errBadMerkleRoot {
+		t.Fatalf("block: got %v, want %v", err, errBadMerkleRoot)
+	}
+}
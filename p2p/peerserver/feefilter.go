@@ -0,0 +1,57 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peerserver
+
+import (
+	"time"
+
+	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/log"
+)
+
+// feeFilterInterval is the interval at which the minimum fee rate of the
+// mempool is checked and announced to the peers when it has changed.
+const feeFilterInterval = time.Minute
+
+// pushFeeFilterMsg sends a feefilter message with the minimum fee rate of the
+// mempool to the peer, so that it doesn't announce transactions which would be
+// rejected.
+func (sp *serverPeer) pushFeeFilterMsg() {
+	if sp.server.TxMemPool == nil || sp.server.LightSync != nil ||
+		sp.server.cfg.BlocksOnly {
+		return
+	}
+	minFee := int64(sp.server.TxMemPool.MinRelayFee())
+	sp.QueueMessage(message.NewMsgFeeFilter(minFee), nil)
+}
+
+// feeFilterHandler announces the minimum fee rate of the mempool to all the
+// peers whenever it changes, as it rises when transactions are evicted from
+// the full mempool and decays afterwards.
+//
+// It must be run as a goroutine.
+func (s *PeerServer) feeFilterHandler() {
+	ticker := time.NewTicker(feeFilterInterval)
+	lastMinFee := s.TxMemPool.MinRelayFee()
+
+out:
+	for {
+		select {
+		case <-ticker.C:
+			minFee := s.TxMemPool.MinRelayFee()
+			if minFee == lastMinFee {
+				continue
+			}
+			lastMinFee = minFee
+			log.Debug("Announcing the mempool minimum fee", "feePerKB", minFee)
+			s.BroadcastMessage(message.NewMsgFeeFilter(int64(minFee)))
+		case <-s.quit:
+			break out
+		}
+	}
+
+	ticker.Stop()
+	s.wg.Done()
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peerserver
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Qitmeer/qitmeer/crypto/ecc/secp256k1"
+	"github.com/Qitmeer/qitmeer/log"
+)
+
+// identityKeyFile is the name of the file holding the identity key of the node
+// in the data directory.
+const identityKeyFile = "identitykey"
+
+// loadIdentityKey loads the long-term identity key which signs the encrypted
+// connections of the node, or generates and saves it on the first run.
+func loadIdentityKey(dataDir string) (*secp256k1.PrivateKey, error) {
+	path := filepath.Join(dataDir, identityKeyFile)
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		b, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(b) != secp256k1.PrivKeyBytesLen {
+			return nil, fmt.Errorf("invalid identity key in %s", path)
+		}
+		key, _ := secp256k1.PrivKeyFromBytes(b)
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(path, []byte(hex.EncodeToString(key.Serialize())), 0600)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Generated the identity key of the node", "path", path)
+	return key, nil
+}
+
+// parsePeerIdentities parses the identity keys of the peers given as
+// <host:port>=<hex public key>, keyed by the address the peers are dialed at.
+func (s *PeerServer) parsePeerIdentities(identities []string) (map[string][]byte, error) {
+	result := make(map[string][]byte, len(identities))
+	for _, identity := range identities {
+		i := strings.LastIndex(identity, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid peer identity %s, expected "+
+				"<host:port>=<hex public key>", identity)
+		}
+		addr, err := s.addrStringToNetAddr(identity[:i])
+		if err != nil {
+			return nil, err
+		}
+		b, err := hex.DecodeString(identity[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity key of %s: %v", addr, err)
+		}
+		pubKey, err := secp256k1.ParsePubKey(b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity key of %s: %v", addr, err)
+		}
+		result[addr.String()] = pubKey.SerializeCompressed()
+	}
+	return result, nil
+}
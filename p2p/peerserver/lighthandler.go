@@ -0,0 +1,129 @@
+package peerserver
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/blockdag"
+	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/log"
+	"github.com/Qitmeer/qitmeer/p2p/peer"
+	"github.com/Qitmeer/qitmeer/services/light"
+)
+
+// pushLightHeadersMsg sends the headers of the blocks which follow the last
+// block of the locator whose order agrees with the light node, along with
+// that block first so the light node knows where they start.  The locator
+// holds the blocks of light.LocatorOrders for the number of headers of the
+// light node, so the blocks which were reordered since it synced them are
+// sent again.  The genesis block is the starting point when none of them
+// agrees.  The reply is sent even when there are no headers, since the light
+// node waits for it.
+func (sp *serverPeer) pushLightHeadersMsg(locator []*hash.Hash, total uint) {
+	chain := sp.server.BlockManager.GetChain()
+	bd := chain.BlockDAG()
+
+	start := uint(0)
+	for i, order := range light.LocatorOrders(total) {
+		if i >= len(locator) {
+			break
+		}
+		h := bd.GetBlockByOrder(order)
+		if h != nil && h.IsEqual(locator[i]) {
+			start = order
+			break
+		}
+	}
+
+	headersMsg := message.NewMsgHeaders(chain.BestSnapshot().GraphState)
+	for order := start; len(headersMsg.Headers) < message.MaxBlockHeadersPerMsg; order++ {
+		h := bd.GetBlockByOrder(order)
+		if h == nil {
+			break
+		}
+		blockHead, err := chain.HeaderByHash(h)
+		if err != nil {
+			log.Trace(fmt.Sprintf("Sorry, there are not these blocks %s for %s", h.String(), sp.String()))
+			break
+		}
+		headersMsg.AddBlockHeader(&blockHead)
+	}
+	sp.QueueMessage(headersMsg, nil)
+}
+
+// lightListeners returns the message listeners of the peers of a light node,
+// which only syncs the block headers and the merkle blocks of the watched
+// addresses.
+func (sp *serverPeer) lightListeners() peer.MessageListeners {
+	return peer.MessageListeners{
+		OnVersion:     sp.OnVersion,
+		OnGetAddr:     sp.OnGetAddr,
+		OnAddr:        sp.OnAddr,
+		OnRead:        sp.OnRead,
+		OnWrite:       sp.OnWrite,
+		OnInv:         sp.OnLightInv,
+		OnHeaders:     sp.OnLightHeaders,
+		OnMerkleBlock: sp.OnLightMerkleBlock,
+		OnTx:          sp.OnLightTx,
+		OnGraphState:  sp.OnLightGraphState,
+		OnSyncResult:  sp.OnLightSyncResult,
+		OnSyncPoint:   sp.OnLightSyncPoint,
+	}
+}
+
+// updateLightGS updates the graph state of the peer and informs the light sync
+// manager.
+func (sp *serverPeer) updateLightGS(p *peer.Peer, gs *blockdag.GraphState) {
+	if gs == nil {
+		return
+	}
+	p.UpdateLastGS(gs)
+	sp.server.LightSync.QueueGraphState(sp.syncPeer)
+}
+
+// OnLightInv is invoked when a peer of a light node receives an inv message.
+func (sp *serverPeer) OnLightInv(p *peer.Peer, msg *message.MsgInv) {
+	if msg.GS != nil {
+		p.UpdateLastGS(msg.GS)
+	}
+	if len(msg.InvList) > 0 {
+		sp.server.LightSync.QueueInv(msg, sp.syncPeer)
+	}
+}
+
+// OnLightHeaders is invoked when a peer of a light node receives a headers
+// message.
+func (sp *serverPeer) OnLightHeaders(p *peer.Peer, msg *message.MsgHeaders) {
+	if msg.GS != nil {
+		p.UpdateLastGS(msg.GS)
+	}
+	sp.server.LightSync.QueueHeaders(msg, sp.syncPeer)
+}
+
+// OnLightMerkleBlock is invoked when a peer of a light node receives a
+// merkleblock message.
+func (sp *serverPeer) OnLightMerkleBlock(p *peer.Peer, msg *message.MsgMerkleBlock) {
+	sp.server.LightSync.QueueMerkleBlock(msg, sp.syncPeer)
+}
+
+// OnLightTx is invoked when a peer of a light node receives a tx message.
+func (sp *serverPeer) OnLightTx(p *peer.Peer, msg *message.MsgTx) {
+	tx := types.NewTx(msg.Tx)
+	p.AddKnownInventory(message.NewInvVect(message.InvTypeTx, tx.Hash()))
+	sp.server.LightSync.QueueTx(tx, sp.syncPeer)
+}
+
+// OnLightGraphState
+func (sp *serverPeer) OnLightGraphState(p *peer.Peer, msg *message.MsgGraphState) {
+	sp.updateLightGS(p, msg.GS)
+}
+
+// OnLightSyncResult
+func (sp *serverPeer) OnLightSyncResult(p *peer.Peer, msg *message.MsgSyncResult) {
+	sp.updateLightGS(p, msg.GS)
+}
+
+// OnLightSyncPoint
+func (sp *serverPeer) OnLightSyncPoint(p *peer.Peer, msg *message.MsgSyncPoint) {
+	sp.updateLightGS(p, msg.GS)
+}
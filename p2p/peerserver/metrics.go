@@ -0,0 +1,34 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peerserver
+
+import (
+	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/metrics"
+)
+
+var (
+	// peersGauge is the number of connected peers.
+	peersGauge = metrics.NewGauge("p2p/peers")
+
+	// inboundPeersGauge is the number of connected inbound peers.
+	inboundPeersGauge = metrics.NewGauge("p2p/peers/inbound")
+)
+
+// updatePeerMetrics updates the metrics of the connected peers.  It is
+// invoked from the peerHandler goroutine.
+func updatePeerMetrics(state *peerState) {
+	peersGauge.Update(int64(state.Count()))
+	inboundPeersGauge.Update(int64(len(state.inboundPeers)))
+}
+
+// markTraffic counts the bytes of a message read from or written to a peer
+// per message type.
+func markTraffic(direction string, bytes int, msg message.Message) {
+	if !metrics.Enabled || msg == nil {
+		return
+	}
+	metrics.NewCounter("p2p/" + direction + "/" + msg.Command()).Inc(int64(bytes))
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/Qitmeer/qitmeer/config"
 	"github.com/Qitmeer/qitmeer/core/protocol"
 	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/database"
 	"github.com/Qitmeer/qitmeer/log"
 	"github.com/Qitmeer/qitmeer/p2p/addmgr"
 	"github.com/Qitmeer/qitmeer/p2p/connmgr"
@@ -16,13 +17,33 @@ import (
 	"time"
 )
 
-func NewPeerServer(cfg *config.Config, chainParams *params.Params) (*PeerServer, error) {
+func NewPeerServer(cfg *config.Config, db database.DB, chainParams *params.Params) (*PeerServer, error) {
 
 	services := defaultServices
+	if cfg.CfIndex {
+		services |= protocol.CF
+	}
+	if !cfg.NoPeerBloomFilters {
+		services |= protocol.Bloom
+	}
+	// A light node only has the block headers, so it serves nothing.
+	if cfg.LightNode {
+		services = protocol.Light
+	}
+	// A pruned node can't serve the old blocks.
+	if cfg.Prune > 0 {
+		services &^= protocol.Full
+		services |= protocol.Pruned
+	}
+	encrypt := cfg.P2PEncrypt || cfg.RequireEncryption || len(cfg.PeerIdentities) > 0
+	if encrypt {
+		services |= protocol.Encrypt
+	}
 
 	s := PeerServer{
 		services:    services,
 		cfg:         cfg,
+		db:          db,
 		chainParams: chainParams,
 		newPeers:    make(chan *serverPeer, cfg.MaxPeers),
 		donePeers:   make(chan *serverPeer, cfg.MaxPeers),
@@ -39,7 +60,22 @@ func NewPeerServer(cfg *config.Config, chainParams *params.Params) (*PeerServer,
 	if cfg.BanThreshold > 0 {
 		connmgr.BanThreshold = cfg.BanThreshold
 	}
-	amgr := addmgr.New(cfg.DataDir, cfg.GetAddrPercent, net.LookupIP)
+	s.setupProxy(cfg)
+	if encrypt {
+		identityKey, err := loadIdentityKey(cfg.DataDir)
+		if err != nil {
+			return nil, err
+		}
+		s.identityKey = identityKey
+		log.Info("P2P identity", "key",
+			fmt.Sprintf("%x", identityKey.PubKey().SerializeCompressed()))
+
+		s.peerIdentities, err = s.parsePeerIdentities(cfg.PeerIdentities)
+		if err != nil {
+			return nil, err
+		}
+	}
+	amgr := addmgr.New(cfg.DataDir, cfg.GetAddrPercent, s.lookup)
 	var listeners []net.Listener
 	var nat NAT
 	if !cfg.DisableListen {
@@ -142,11 +178,17 @@ func NewPeerServer(cfg *config.Config, chainParams *params.Params) (*PeerServer,
 			if addr.GetAttempts() > 1 && time.Since(addr.LastAttempt()) < 10*time.Minute {
 				return nil, errors.New("no valid connect address")
 			}
-			if s.state.IsBanPeer(addr.NetAddress().IP.String()) {
+			if s.IsBanPeer(addr.NetAddress().IP.String()) {
+				return nil, errors.New("no valid connect address")
+			}
+
+			// Skip the tor hidden services when they can't be
+			// dialed.
+			if !s.onion && addmgr.IsOnionCatTor(addr.NetAddress()) {
 				return nil, errors.New("no valid connect address")
 			}
 			addrString := addmgr.NetAddressKey(addr.NetAddress())
-			return addrStringToNetAddr(addrString)
+			return s.addrStringToNetAddr(addrString)
 		}
 	}
 	// Create a connection manager.
@@ -171,21 +213,22 @@ func NewPeerServer(cfg *config.Config, chainParams *params.Params) (*PeerServer,
 	s.connManager = cmgr
 	s.nat = nat
 
-	// Start up persistent peers.
+	// Persistent peers are connected to once the peer handler is started.
 	permanentPeers := cfg.ConnectPeers
 	if len(permanentPeers) == 0 {
 		permanentPeers = cfg.AddPeers
 	}
+	s.persistentReqs = make(map[string]*connmgr.ConnReq, len(permanentPeers))
 	for _, addr := range permanentPeers {
-		tcpAddr, err := addrStringToNetAddr(addr)
+		tcpAddr, err := s.addrStringToNetAddr(addr)
 		if err != nil {
 			return nil, err
 		}
 
-		go s.connManager.Connect(&connmgr.ConnReq{
+		s.persistentReqs[addr] = &connmgr.ConnReq{
 			Addr:      tcpAddr,
 			Permanent: true,
-		})
+		}
 	}
 
 	return &s, nil
@@ -29,7 +29,7 @@ func (s *PeerServer) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 		sp.Disconnect()
 		return false
 	}
-	if state.IsBanPeer(host) {
+	if s.IsBanPeer(host) {
 		sp.Disconnect()
 		return false
 	}
@@ -58,6 +58,7 @@ func (s *PeerServer) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 			state.outboundPeers[sp.ID()] = sp
 		}
 	}
+	updatePeerMetrics(state)
 
 	return true
 }
@@ -81,6 +82,7 @@ func (s *PeerServer) handleDonePeerMsg(state *peerState, sp *serverPeer) {
 			s.connManager.Disconnect(sp.connReq.ID())
 		}
 		delete(list, sp.ID())
+		updatePeerMetrics(state)
 		log.Debug("Removed peer", "peer", sp)
 		return
 	}
@@ -3,6 +3,9 @@ package peerserver
 import (
 	"fmt"
 	"github.com/Qitmeer/qitmeer/log"
+	"github.com/Qitmeer/qitmeer/p2p/connmgr"
+	"net"
+	"sync"
 	"time"
 )
 
@@ -12,8 +15,16 @@ type peerState struct {
 	inboundPeers    map[int32]*serverPeer
 	outboundPeers   map[int32]*serverPeer
 	persistentPeers map[int32]*serverPeer
-	banned          map[string]time.Time
 	outboundGroups  map[string]int
+
+	// addedNodes are the permanent connection requests of the nodes added
+	// at startup or with the addnode RPC, keyed by their address.
+	addedNodes map[string]*connmgr.ConnReq
+
+	// banned is the ban list keyed by host or subnet, it is read by other
+	// goroutines so it is protected by banMtx.
+	banMtx sync.RWMutex
+	banned map[string]*BanEntry
 }
 
 // Count returns the count of all known peers.
@@ -42,17 +53,29 @@ func (ps *peerState) forAllOutboundPeers(closure func(sp *serverPeer)) {
 	}
 }
 
-func (ps *peerState) IsBanPeer(host string) bool {
-	if banEnd, ok := ps.banned[host]; ok {
-		if time.Now().Before(banEnd) {
+// checkBan returns whether the host is in a banned subnet.  The expired bans
+// of the host are removed and their keys returned, so that they are removed
+// from the database as well.
+func (ps *peerState) checkBan(host string) (bool, []string) {
+	ip := net.ParseIP(host)
+
+	ps.banMtx.Lock()
+	defer ps.banMtx.Unlock()
+	var expired []string
+	for key, entry := range ps.banned {
+		if ip == nil && key != host || ip != nil && !entry.Subnet.Contains(ip) {
+			continue
+		}
+		if time.Now().Before(entry.Expire) {
 			log.Debug(fmt.Sprintf("Peer %s is banned for another %v - disconnecting",
-				host, time.Until(banEnd)))
-			return true
+				host, time.Until(entry.Expire)))
+			return true, expired
 		}
-		log.Info("Peer is no longer banned", "peer", host)
-		delete(ps.banned, host)
+		log.Info("Peer is no longer banned", "peer", host, "subnet", key)
+		delete(ps.banned, key)
+		expired = append(expired, key)
 	}
-	return false
+	return false, expired
 }
 
 func (ps *peerState) IsMaxInboundPeer(sp *serverPeer) bool {
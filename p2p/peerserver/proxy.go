@@ -0,0 +1,137 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peerserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Qitmeer/qitmeer/config"
+	"github.com/Qitmeer/qitmeer/p2p/connmgr"
+	"golang.org/x/net/proxy"
+)
+
+// dialFunc is the signature of the functions used to connect to the peers.
+type dialFunc func(network, addr string, timeout time.Duration) (net.Conn, error)
+
+// onionAddr implements the net.Addr interface and represents a tor address.
+type onionAddr struct {
+	addr string
+}
+
+// String returns the onion address.
+//
+// This is part of the net.Addr interface.
+func (oa *onionAddr) String() string {
+	return oa.addr
+}
+
+// Network returns "onion".
+//
+// This is part of the net.Addr interface.
+func (oa *onionAddr) Network() string {
+	return "onion"
+}
+
+// Ensure onionAddr implements the net.Addr interface.
+var _ net.Addr = (*onionAddr)(nil)
+
+// isOnionHost returns whether the host is a tor hidden service.
+func isOnionHost(host string) bool {
+	return strings.HasSuffix(host, ".onion")
+}
+
+// noOnionDial is used to dial the tor hidden services when there is no proxy
+// to reach them.
+func noOnionDial(network, addr string, timeout time.Duration) (net.Conn, error) {
+	return nil, errors.New("tor has been disabled")
+}
+
+// socksDial returns a dial function connecting through the SOCKS5 proxy.  When
+// the isolation is enabled, random credentials are used for each connection so
+// that Tor uses a different circuit for it.
+func socksDial(proxyAddr, user, pass string, isolation bool) dialFunc {
+	return func(network, addr string, timeout time.Duration) (net.Conn, error) {
+		var auth *proxy.Auth
+		if isolation {
+			var b [16]byte
+			if _, err := rand.Read(b[:]); err != nil {
+				return nil, err
+			}
+			auth = &proxy.Auth{
+				User:     hex.EncodeToString(b[:8]),
+				Password: hex.EncodeToString(b[8:]),
+			}
+		} else if user != "" || pass != "" {
+			auth = &proxy.Auth{User: user, Password: pass}
+		}
+		dialer, err := proxy.SOCKS5("tcp", proxyAddr, auth,
+			&net.Dialer{Timeout: timeout})
+		if err != nil {
+			return nil, err
+		}
+		return dialer.Dial(network, addr)
+	}
+}
+
+// setupProxy sets up the functions used to connect to the peers and to resolve
+// the host names depending on the proxy options.  By default the peers are
+// dialed directly and the system resolver is used.  When a proxy is specified,
+// the peers are dialed through it and, unless --noonion is set or an onion
+// proxy is specified, it is assumed to be tor and used to resolve the host
+// names as well.  The tor hidden services are dialed through the onion proxy
+// when one is specified and through the proxy otherwise.  Without any of them,
+// or with --noonion, they can't be dialed and are never resolved.
+func (s *PeerServer) setupProxy(cfg *config.Config) {
+	s.dial = net.DialTimeout
+	s.lookup = net.LookupIP
+	if cfg.Proxy != "" {
+		// The proxy credentials are overridden by the isolation unless
+		// it applies to the onion proxy.
+		isolation := cfg.TorIsolation && cfg.OnionProxy == ""
+		s.dial = socksDial(cfg.Proxy, cfg.ProxyUser, cfg.ProxyPass,
+			isolation)
+		if !cfg.NoOnion && cfg.OnionProxy == "" {
+			s.lookup = func(host string) ([]net.IP, error) {
+				return connmgr.TorLookupIP(host, cfg.Proxy)
+			}
+		}
+	}
+
+	s.onionDial = noOnionDial
+	if cfg.Proxy != "" {
+		s.onionDial = s.dial
+	}
+	if cfg.OnionProxy != "" {
+		s.onionDial = socksDial(cfg.OnionProxy, cfg.OnionProxyUser,
+			cfg.OnionProxyPass, cfg.TorIsolation)
+
+		// The proxy isn't tor when both of them are specified, so the
+		// host names are resolved through the onion proxy.
+		if cfg.Proxy != "" {
+			s.lookup = func(host string) ([]net.IP, error) {
+				return connmgr.TorLookupIP(host, cfg.OnionProxy)
+			}
+		}
+	}
+	if cfg.NoOnion {
+		s.onionDial = noOnionDial
+	}
+	s.onion = !cfg.NoOnion && (cfg.Proxy != "" || cfg.OnionProxy != "")
+}
+
+// Dial connects to the address on the named network, the tor hidden services
+// are dialed through the onion proxy.
+func (s *PeerServer) Dial(network, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err == nil && isOnionHost(host) {
+		return s.onionDial("tcp", addr, defaultConnectTimeout)
+	}
+	return s.dial(network, addr, defaultConnectTimeout)
+}
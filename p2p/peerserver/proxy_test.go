@@ -0,0 +1,44 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peerserver
+
+import (
+	"testing"
+
+	"github.com/Qitmeer/qitmeer/config"
+)
+
+func TestSetupProxyOnion(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   config.Config
+		onion bool
+	}{
+		{"no proxy", config.Config{}, false},
+		{"proxy", config.Config{Proxy: "127.0.0.1:9050"}, true},
+		{"onion proxy", config.Config{OnionProxy: "127.0.0.1:9050"}, true},
+		{"noonion", config.Config{Proxy: "127.0.0.1:9050", NoOnion: true}, false},
+	}
+	for _, test := range tests {
+		s := &PeerServer{cfg: &test.cfg}
+		s.setupProxy(&test.cfg)
+		if s.onion != test.onion {
+			t.Errorf("%s: onion %v, expected %v", test.name, s.onion, test.onion)
+			continue
+		}
+		if test.onion {
+			continue
+		}
+
+		// The hidden services are neither resolved nor dialed.
+		_, err := s.Dial("tcp", "3g2upl4pq6kufc4m.onion:8130")
+		if err == nil || err.Error() != "tor has been disabled" {
+			t.Errorf("%s: dialed a hidden service: %v", test.name, err)
+		}
+		if _, err := s.addrStringToNetAddr("3g2upl4pq6kufc4m.onion:8130"); err == nil {
+			t.Errorf("%s: resolved a hidden service", test.name)
+		}
+	}
+}
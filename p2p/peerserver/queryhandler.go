@@ -7,6 +7,7 @@ package peerserver
 
 import (
 	"errors"
+	"github.com/Qitmeer/qitmeer/p2p/connmgr"
 	"github.com/satori/go.uuid"
 )
 
@@ -24,7 +25,7 @@ type getOutboundGroup struct {
 }
 
 type getAddedNodesMsg struct {
-	reply chan []*serverPeer
+	reply chan []*AddedNode
 }
 
 type disconnectNodeMsg struct {
@@ -39,10 +40,14 @@ type connectNodeMsg struct {
 }
 
 type removeNodeMsg struct {
-	cmp   func(*serverPeer) bool
+	addr  string
 	reply chan error
 }
 
+type disconnectBannedMsg struct {
+	reply chan int
+}
+
 type getPeerMsg struct {
 	uuid  uuid.UUID
 	reply chan bool
@@ -72,9 +77,59 @@ func (s *PeerServer) handleQuery(state *peerState, querymsg interface{}) {
 		msg.reply <- peers
 
 	case connectNodeMsg:
-		msg.reply <- errors.New("not support")
+		if _, ok := state.addedNodes[msg.addr]; ok {
+			msg.reply <- errors.New("node already added")
+			return
+		}
+		connected := false
+		state.forAllPeers(func(sp *serverPeer) {
+			if sp.Addr() == msg.addr {
+				connected = true
+			}
+		})
+		if connected {
+			msg.reply <- errors.New("peer already connected")
+			return
+		}
+		netAddr, err := s.addrStringToNetAddr(msg.addr)
+		if err != nil {
+			msg.reply <- err
+			return
+		}
+
+		// Keep the permanent requests so that they can be removed and
+		// their state reported later.
+		c := &connmgr.ConnReq{
+			Addr:      netAddr,
+			Permanent: msg.permanent,
+		}
+		if msg.permanent {
+			state.addedNodes[msg.addr] = c
+		}
+
+		// The request is registered before replying, so that it can be
+		// removed right away.
+		s.connManager.Register(c)
+		go s.connManager.Connect(c)
+		msg.reply <- nil
+
 	case removeNodeMsg:
-		msg.reply <- errors.New("not support")
+		c, ok := state.addedNodes[msg.addr]
+		if !ok {
+			msg.reply <- errors.New("node has not been added")
+			return
+		}
+		delete(state.addedNodes, msg.addr)
+
+		// Removing the request cancels its retries and closes its
+		// connection if it is established.  The request is registered
+		// when it is added, so it only has no id when the connection
+		// manager is stopped.
+		if c.ID() != 0 {
+			go s.connManager.Remove(c.ID())
+		}
+		msg.reply <- nil
+
 	case getOutboundGroup:
 		count, ok := state.outboundGroups[msg.key]
 		if ok {
@@ -83,10 +138,34 @@ func (s *PeerServer) handleQuery(state *peerState, querymsg interface{}) {
 			msg.reply <- 0
 		}
 	case getAddedNodesMsg:
-		peers := make([]*serverPeer, 0)
-		msg.reply <- peers
+		nodes := make([]*AddedNode, 0, len(state.addedNodes))
+		for addr, c := range state.addedNodes {
+			node := &AddedNode{Addr: addr, State: c.State()}
+			for _, sp := range state.persistentPeers {
+				if sp.connReq == c {
+					node.Peer = sp
+					break
+				}
+			}
+			nodes = append(nodes, node)
+		}
+		msg.reply <- nodes
+
 	case disconnectNodeMsg:
-		msg.reply <- errors.New("not support")
+		// The peers are removed from the state once they are done, and
+		// the permanent ones are reconnected.
+		found := false
+		state.forAllPeers(func(sp *serverPeer) {
+			if msg.cmp(sp) {
+				sp.Disconnect()
+				found = true
+			}
+		})
+		if !found {
+			msg.reply <- errors.New("peer not found")
+			return
+		}
+		msg.reply <- nil
 
 	case getPeerMsg:
 		has := false
@@ -100,5 +179,15 @@ func (s *PeerServer) handleQuery(state *peerState, querymsg interface{}) {
 			}
 		})
 		msg.reply <- has
+
+	case disconnectBannedMsg:
+		disconnected := 0
+		state.forAllPeers(func(sp *serverPeer) {
+			if s.IsBanPeer(sp.NA().IP.String()) {
+				sp.Disconnect()
+				disconnected++
+			}
+		})
+		msg.reply <- disconnected
 	}
 }
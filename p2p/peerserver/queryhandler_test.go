@@ -0,0 +1,160 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peerserver
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Qitmeer/qitmeer/p2p/connmgr"
+	"github.com/Qitmeer/qitmeer/p2p/peer"
+)
+
+// newQueryTestState returns an empty peer state.
+func newQueryTestState() *peerState {
+	return &peerState{
+		inboundPeers:    make(map[int32]*serverPeer),
+		outboundPeers:   make(map[int32]*serverPeer),
+		persistentPeers: make(map[int32]*serverPeer),
+		outboundGroups:  make(map[string]int),
+		addedNodes:      make(map[string]*connmgr.ConnReq),
+		banned:          make(map[string]*BanEntry),
+	}
+}
+
+func TestAddRemoveNode(t *testing.T) {
+	// The dials block until released and then fail, so a request which is
+	// not removed is retried.
+	release := make(chan struct{})
+	var dials int32
+	cm, err := connmgr.New(&connmgr.Config{
+		RetryDuration: time.Millisecond,
+		Dial: func(network, addr string) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			<-release
+			return nil, errors.New("unreachable")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm.Start()
+	defer func() {
+		cm.Stop()
+		cm.Wait()
+	}()
+
+	s := &PeerServer{connManager: cm}
+	state := newQueryTestState()
+	query := func(msg interface{}, reply chan error) error {
+		s.handleQuery(state, msg)
+		return <-reply
+	}
+	addNode := func(addr string) error {
+		reply := make(chan error, 1)
+		return query(connectNodeMsg{addr: addr, permanent: true, reply: reply}, reply)
+	}
+	removeNode := func(addr string) error {
+		reply := make(chan error, 1)
+		return query(removeNodeMsg{addr: addr, reply: reply}, reply)
+	}
+
+	const addr = "127.0.0.1:18130"
+	if err := addNode(addr); err != nil {
+		t.Fatal(err)
+	}
+	c := state.addedNodes[addr]
+	if c == nil {
+		t.Fatal("the node is not in the added nodes")
+	}
+	if c.ID() == 0 || c.State() != connmgr.ConnPending {
+		t.Fatalf("got the request id %d in the state %v, want it registered", c.ID(), c.State())
+	}
+	if err := addNode(addr); err == nil {
+		t.Fatal("adding the node twice did not fail")
+	}
+	if err := addNode("127.0.0.1"); err == nil {
+		t.Fatal("adding an address without a port did not fail")
+	}
+
+	reply := make(chan []*AddedNode, 1)
+	s.handleQuery(state, getAddedNodesMsg{reply: reply})
+	if nodes := <-reply; len(nodes) != 1 || nodes[0].Addr != addr || nodes[0].Peer != nil {
+		t.Fatalf("got the added nodes %v", nodes)
+	}
+
+	// Removing the node right away cancels the request before its dial
+	// fails, so it is never retried.
+	if err := removeNode(addr); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.addedNodes) != 0 {
+		t.Fatal("the node is still in the added nodes")
+	}
+	for i := 0; c.State() != connmgr.ConnCanceled; i++ {
+		if i == 100 {
+			t.Fatalf("got the request state %v, want canceled", c.State())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(release)
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&dials); n > 1 {
+		t.Fatalf("the removed node was dialed %d times", n)
+	}
+	if err := removeNode(addr); err == nil {
+		t.Fatal("removing the node twice did not fail")
+	}
+}
+
+func TestDisconnectNode(t *testing.T) {
+	s := &PeerServer{}
+	state := newQueryTestState()
+	for id, addr := range map[int32]string{1: "127.0.0.1:18130", 2: "127.0.0.2:18130"} {
+		p, err := peer.NewOutboundPeer(&peer.Config{}, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		state.outboundPeers[id] = &serverPeer{Peer: p}
+	}
+	disconnect := func(addr string) error {
+		reply := make(chan error, 1)
+		s.handleQuery(state, disconnectNodeMsg{
+			cmp:   func(sp *serverPeer) bool { return sp.Addr() == addr },
+			reply: reply,
+		})
+		return <-reply
+	}
+
+	if err := disconnect("127.0.0.3:18130"); err == nil {
+		t.Fatal("disconnecting an unknown peer did not fail")
+	}
+	if err := disconnect("127.0.0.1:18130"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-peerQuit(state.outboundPeers[1]):
+	case <-time.After(time.Second):
+		t.Fatal("the peer was not disconnected")
+	}
+	select {
+	case <-peerQuit(state.outboundPeers[2]):
+		t.Fatal("the other peer was disconnected")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// peerQuit returns a channel closed once the peer is disconnected.
+func peerQuit(sp *serverPeer) <-chan struct{} {
+	quit := make(chan struct{})
+	go func() {
+		sp.WaitForDisconnect()
+		close(quit)
+	}()
+	return quit
+}
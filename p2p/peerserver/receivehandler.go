@@ -39,7 +39,7 @@ func (sp *serverPeer) OnVersion(p *peer.Peer, msg *message.MsgVersion) *message.
 	}
 	isInbound := sp.Inbound()
 	remoteAddr := sp.NA()
-	if sp.server.state.IsBanPeer(remoteAddr.IP.String()) {
+	if sp.server.IsBanPeer(remoteAddr.IP.String()) {
 		return message.NewMsgReject(msg.Command(), message.RejectBan, "ban peer version message")
 	}
 	if sp.server.state.IsMaxInboundPeer(sp) {
@@ -77,7 +77,7 @@ func (sp *serverPeer) OnVersion(p *peer.Peer, msg *message.MsgVersion) *message.
 		// Advertise the local address when the server accepts incoming
 		// connections and it believes itself to be close to the best
 		// known tip.
-		if !sp.server.cfg.DisableListen && sp.server.BlockManager.IsCurrent() {
+		if !sp.server.cfg.DisableListen && sp.server.isCurrent() {
 			// Get address that best matches.
 			lna := addrManager.GetBestLocalAddress(remoteAddr)
 			if addmgr.IsRoutable(lna) {
@@ -105,11 +105,21 @@ func (sp *serverPeer) OnVersion(p *peer.Peer, msg *message.MsgVersion) *message.
 	sp.server.TimeSource.AddTimeSample(p.Addr(), msg.Timestamp)
 
 	// Signal the block manager this peer is a new sync candidate.
-	log.Trace("OnVersion -> NewPeer send to blkMgr msgChan", "peer", sp.syncPeer)
-	sp.server.BlockManager.NewPeer(sp.syncPeer)
+	if sp.server.LightSync != nil {
+		sp.server.LightSync.NewPeer(sp.syncPeer)
+	} else {
+		log.Trace("OnVersion -> NewPeer send to blkMgr msgChan", "peer", sp.syncPeer)
+		sp.server.BlockManager.NewPeer(sp.syncPeer)
+	}
 
 	// Add valid peer to the server.
 	sp.server.AddPeer(sp)
+
+	// Tell the peer the minimum fee rate of the transactions to announce.
+	sp.pushFeeFilterMsg()
+
+	// Tell the peer compact blocks can be requested.
+	sp.pushSendCmpctMsg()
 	return nil
 }
 
@@ -193,12 +203,14 @@ func (sp *serverPeer) OnAddr(p *peer.Peer, msg *message.MsgAddr) {
 // the bytes received by the server.
 func (sp *serverPeer) OnRead(p *peer.Peer, bytesRead int, msg message.Message, err error) {
 	sp.server.AddBytesReceived(uint64(bytesRead))
+	markTraffic("in", bytesRead, msg)
 }
 
 // OnWrite is invoked when a peer sends a message and it is used to update
 // the bytes sent by the server.
 func (sp *serverPeer) OnWrite(p *peer.Peer, bytesWritten int, msg message.Message, err error) {
 	sp.server.AddBytesSent(uint64(bytesWritten))
+	markTraffic("out", bytesWritten, msg)
 }
 
 // OnBlock is invoked when a peer receives a block wire message.  It blocks
@@ -214,6 +226,14 @@ func (sp *serverPeer) OnBlock(p *peer.Peer, msg *message.MsgBlock, buf []byte) {
 	iv := message.NewInvVect(message.InvTypeBlock, block.Hash())
 	p.AddKnownInventory(iv)
 
+	sp.processBlock(p, block)
+	log.Trace("OnBlock done, sp.syncPeer.BlockProcessed")
+}
+
+// processBlock hands the block received from the peer, in full or as a
+// reconstructed compact block, to the block manager and waits until it is
+// processed.
+func (sp *serverPeer) processBlock(p *peer.Peer, block *types.SerializedBlock) {
 	// Queue the block up to be handled by the block manager and
 	// intentionally block further receives until the network block is fully
 	// processed and known good or bad.  This helps prevent a malicious peer
@@ -228,7 +248,6 @@ func (sp *serverPeer) OnBlock(p *peer.Peer, msg *message.MsgBlock, buf []byte) {
 	if score > connmgr.NoneScore {
 		sp.addBanScore(0, uint32(score), "onblock")
 	}
-	log.Trace("OnBlock done, sp.syncPeer.BlockProcessed")
 }
 
 // OnGetBlocks is invoked when a peer receives a getblocks wire message.
@@ -282,6 +301,19 @@ func (sp *serverPeer) OnGetHeaders(p *peer.Peer, msg *message.MsgGetHeaders) {
 	}
 
 	sp.UpdateLastGS(p, msg.GS)
+
+	// Light nodes don't know the DAG, so their locator is made of the
+	// last blocks they have and they are sent the headers of the blocks
+	// which follow it by order.
+	if protocol.HasServices(p.Services(), protocol.Light) {
+		var total uint
+		if msg.GS != nil {
+			total = msg.GS.GetTotal()
+		}
+		sp.pushLightHeadersMsg(msg.BlockLocatorHashes, total)
+		return
+	}
+
 	chain := sp.server.BlockManager.GetChain()
 	hashSlice := []*hash.Hash{}
 	if len(msg.BlockLocatorHashes) > 0 {
@@ -389,6 +421,10 @@ func (sp *serverPeer) OnGetData(p *peer.Peer, msg *message.MsgGetData) {
 			err = sp.server.pushTxMsg(sp, &iv.Hash, c, waitChan)
 		case message.InvTypeBlock:
 			err = sp.server.pushBlockMsg(sp, &iv.Hash, c, waitChan)
+		case message.InvTypeFilteredBlock:
+			err = sp.server.pushMerkleBlockMsg(sp, &iv.Hash, c, waitChan)
+		case message.InvTypeCmpctBlock:
+			err = sp.server.pushCmpctBlockMsg(sp, &iv.Hash, c, waitChan)
 		default:
 			log.Warn("Unknown type in inventory request", "type", iv.Type)
 			continue
@@ -512,6 +548,12 @@ func (sp *serverPeer) OnMemPool(_ *peer.Peer, msg *message.MsgMemPool) {
 	invMsg := message.NewMsgInvSizeHint(uint(len(txDescs)))
 
 	for _, txDesc := range txDescs {
+		// Either add all transactions when there is no bloom filter,
+		// or only the transactions that match the filter when there is
+		// one.
+		if sp.filter.IsLoaded() && !sp.filter.MatchTxAndUpdate(txDesc.Tx) {
+			continue
+		}
 		iv := message.NewInvVect(message.InvTypeTx, txDesc.Tx.Hash())
 		invMsg.AddInvVect(iv)
 		if len(invMsg.InvList)+1 > message.MaxInvPerMsg {
@@ -523,3 +565,118 @@ func (sp *serverPeer) OnMemPool(_ *peer.Peer, msg *message.MsgMemPool) {
 		sp.QueueMessage(invMsg, nil)
 	}
 }
+
+// OnGetCFilter is invoked when a peer receives a getcfilter message.
+func (sp *serverPeer) OnGetCFilter(_ *peer.Peer, msg *message.MsgGetCFilter) {
+	// Ignore getcfilter requests if not in sync or the committed filter
+	// index is disabled.
+	if sp.server.CfIndex == nil || !sp.server.BlockManager.IsCurrent() {
+		return
+	}
+
+	// Only the regular filter is supported.
+	if msg.FilterType != message.GCSFilterRegular {
+		log.Debug(fmt.Sprintf("Unsupported filter type %v from %v",
+			msg.FilterType, sp))
+		return
+	}
+
+	filterBytes, err := sp.server.CfIndex.FilterByBlockHash(&msg.BlockHash)
+	if err != nil {
+		log.Error(fmt.Sprintf("Error retrieving cfilter: %v", err))
+		return
+	}
+	if filterBytes == nil {
+		log.Debug(fmt.Sprintf("Could not obtain cfilter for %v", msg.BlockHash))
+		return
+	}
+
+	filterMsg := message.NewMsgCFilter(msg.FilterType, &msg.BlockHash, filterBytes)
+	sp.QueueMessage(filterMsg, nil)
+}
+
+// OnGetCFHeaders is invoked when a peer receives a getcfheaders message.
+func (sp *serverPeer) OnGetCFHeaders(_ *peer.Peer, msg *message.MsgGetCFHeaders) {
+	// Ignore getcfheaders requests if not in sync or the committed filter
+	// index is disabled.
+	if sp.server.CfIndex == nil || !sp.server.BlockManager.IsCurrent() {
+		return
+	}
+
+	// Only the regular filter is supported.
+	if msg.FilterType != message.GCSFilterRegular {
+		log.Debug(fmt.Sprintf("Unsupported filter type %v from %v",
+			msg.FilterType, sp))
+		return
+	}
+
+	// The range goes from the start order up to the order of the stop
+	// block in the DAG.
+	bd := sp.server.BlockManager.GetChain().BlockDAG()
+	stopBlock := bd.GetBlock(&msg.StopHash)
+	if stopBlock == nil || !stopBlock.IsOrdered() {
+		log.Debug(fmt.Sprintf("Unknown stop hash %v in getcfheaders from %v",
+			msg.StopHash, sp))
+		return
+	}
+	startOrder := uint(msg.StartOrder)
+	stopOrder := stopBlock.GetOrder()
+	if startOrder > stopOrder ||
+		stopOrder-startOrder >= message.MaxCFHeadersPerMsg {
+		log.Debug(fmt.Sprintf("Invalid getcfheaders range %d-%d from %v",
+			startOrder, stopOrder, sp))
+		return
+	}
+
+	// Fetch the filter header of the block before the range, it is the
+	// zero hash at the start of the DAG.
+	headersMsg := message.NewMsgCFHeaders()
+	if startOrder > 0 {
+		prevHash := bd.GetBlockByOrder(startOrder - 1)
+		if prevHash == nil {
+			return
+		}
+		prevHeader, err := sp.server.CfIndex.FilterHeaderByBlockHash(prevHash)
+		if err != nil {
+			log.Error(fmt.Sprintf("Error retrieving cfilter header: %v", err))
+			return
+		}
+		if prevHeader == nil {
+			log.Debug(fmt.Sprintf("Could not obtain cfilter header for %v",
+				prevHash))
+			return
+		}
+		copy(headersMsg.PrevFilterHeader[:], prevHeader)
+	}
+
+	blockHashes := make([]*hash.Hash, 0, stopOrder-startOrder+1)
+	for order := startOrder; order <= stopOrder; order++ {
+		blockHash := bd.GetBlockByOrder(order)
+		if blockHash == nil {
+			return
+		}
+		blockHashes = append(blockHashes, blockHash)
+	}
+	filterHashes, err := sp.server.CfIndex.FilterHashesByBlockHashes(blockHashes)
+	if err != nil {
+		log.Error(fmt.Sprintf("Error retrieving cfilter hashes: %v", err))
+		return
+	}
+	for i, filterHash := range filterHashes {
+		if filterHash == nil {
+			log.Debug(fmt.Sprintf("Could not obtain cfilter hash for %v",
+				blockHashes[i]))
+			return
+		}
+		h, err := hash.NewHash(filterHash)
+		if err != nil {
+			log.Error(fmt.Sprintf("Invalid cfilter hash: %v", err))
+			return
+		}
+		headersMsg.AddCFHash(h)
+	}
+
+	headersMsg.FilterType = msg.FilterType
+	headersMsg.StopHash = msg.StopHash
+	sp.QueueMessage(headersMsg, nil)
+}
@@ -5,7 +5,6 @@ import (
 	"github.com/Qitmeer/qitmeer/core/message"
 	"github.com/Qitmeer/qitmeer/core/types"
 	"github.com/Qitmeer/qitmeer/log"
-	"github.com/Qitmeer/qitmeer/services/mempool"
 	"sync/atomic"
 )
 
@@ -44,12 +43,19 @@ func (s *PeerServer) handleRelayInvMsg(state *peerState, msg relayMsg) {
 				return
 			}
 
-			txD, ok := msg.data.(*mempool.TxDesc)
+			txD, ok := msg.data.(*types.TxDesc)
 			if ok {
 				feeFilter := atomic.LoadInt64(&sp.feeFilter)
 				if feeFilter > 0 && txD.FeePerKB < feeFilter {
 					return
 				}
+
+				// Don't relay the transaction if there is a bloom
+				// filter loaded and the transaction doesn't match
+				// it.
+				if sp.filter.IsLoaded() && !sp.filter.MatchTxAndUpdate(txD.Tx) {
+					return
+				}
 			}
 		} else if msg.invVect.Type == message.InvTypeBlock {
 			gs = s.BlockManager.GetChain().BestSnapshot().GraphState
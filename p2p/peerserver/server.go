@@ -14,12 +14,16 @@ import (
 	"github.com/Qitmeer/qitmeer/core/message"
 	"github.com/Qitmeer/qitmeer/core/protocol"
 	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/crypto/ecc/secp256k1"
+	"github.com/Qitmeer/qitmeer/database"
 	"github.com/Qitmeer/qitmeer/log"
 	"github.com/Qitmeer/qitmeer/p2p/addmgr"
 	"github.com/Qitmeer/qitmeer/p2p/connmgr"
 	"github.com/Qitmeer/qitmeer/p2p/peer"
 	"github.com/Qitmeer/qitmeer/params"
 	"github.com/Qitmeer/qitmeer/services/blkmgr"
+	"github.com/Qitmeer/qitmeer/services/index"
+	"github.com/Qitmeer/qitmeer/services/light"
 	"github.com/Qitmeer/qitmeer/services/mempool"
 	"github.com/Qitmeer/qitmeer/version"
 	"github.com/satori/go.uuid"
@@ -31,8 +35,10 @@ import (
 )
 
 const (
-	// the default services supported by the node
-	defaultServices = protocol.Full | protocol.CF
+	// the default services supported by the node, protocol.CF is added
+	// when the committed filter index is enabled and protocol.Bloom when
+	// bloom filters aren't disabled
+	defaultServices = protocol.Full
 
 	// the default services that are required to be supported
 	defaultRequiredServices = protocol.Full
@@ -96,9 +102,36 @@ type PeerServer struct {
 	chainParams *params.Params
 	cfg         *config.Config
 
+	// db stores the ban list.
+	db database.DB
+
+	// dial and onionDial connect to the peers and the tor hidden services,
+	// lookup resolves the host names.  They go through the proxies when
+	// they are configured.  onion is whether the tor hidden services can
+	// be dialed.
+	dial      dialFunc
+	onionDial dialFunc
+	lookup    connmgr.LookupFunc
+	onion     bool
+
+	// persistentReqs are the connection requests of the peers given by
+	// --addpeer or --connect, keyed by their address.
+	persistentReqs map[string]*connmgr.ConnReq
+
+	// identityKey is the long-term key of the node which signs the
+	// encrypted connections.  peerIdentities are the identity keys the
+	// peers given by --peeridentity must prove, keyed by their address.
+	identityKey    *secp256k1.PrivateKey
+	peerIdentities map[string][]byte
+
 	TimeSource   blockchain.MedianTimeSource
 	BlockManager *blkmgr.BlockManager
 	TxMemPool    *mempool.TxPool
+	CfIndex      *index.CfIndex
+
+	// LightSync is the sync manager of the light node, it replaces the
+	// block manager when running as a light node.
+	LightSync *light.SyncManager
 
 	services protocol.ServiceFlag
 
@@ -134,7 +167,9 @@ func (s *PeerServer) inboundPeerConnected(c *connmgr.ConnReq) {
 // manager of the attempt.
 func (s *PeerServer) outboundPeerConnected(c *connmgr.ConnReq) {
 	sp := newServerPeer(s, c.Permanent)
-	p, err := peer.NewOutboundPeer(newPeerConfig(sp), c.Addr.String())
+	peerCfg := newPeerConfig(sp)
+	peerCfg.PeerIdentity = s.peerIdentities[c.Addr.String()]
+	p, err := peer.NewOutboundPeer(peerCfg, c.Addr.String())
 	if err != nil {
 		log.Debug(fmt.Sprintf("Cannot create outbound peer %s: %v", c.Addr, err))
 		s.connManager.Disconnect(c.ID())
@@ -151,7 +186,7 @@ func (s *PeerServer) outboundPeerConnected(c *connmgr.ConnReq) {
 // newPeerConfig returns the configuration for the given serverPeer.
 func newPeerConfig(sp *serverPeer) *peer.Config {
 
-	return &peer.Config{
+	cfg := &peer.Config{
 		Listeners: peer.MessageListeners{
 			OnVersion:        sp.OnVersion,
 			OnGetAddr:        sp.OnGetAddr,
@@ -172,9 +207,15 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 			OnSyncDAG:        sp.OnSyncDAG,
 			OnSyncPoint:      sp.OnSyncPoint,
 			OnFeeFilter:      sp.OnFeeFilter,
+			OnGetCFilter:     sp.OnGetCFilter,
+			OnGetCFHeaders:   sp.OnGetCFHeaders,
+			OnFilterAdd:      sp.OnFilterAdd,
+			OnFilterClear:    sp.OnFilterClear,
+			OnFilterLoad:     sp.OnFilterLoad,
+			OnCmpctBlock:     sp.OnCmpctBlock,
+			OnGetBlockTxn:    sp.OnGetBlockTxn,
+			OnBlockTxn:       sp.OnBlockTxn,
 			//OnHeaders:        sp.OnHeaders,
-			//OnGetCFilter:     sp.OnGetCFilter,
-			//OnGetCFHeaders:   sp.OnGetCFHeaders,
 			//OnGetCFTypes:     sp.OnGetCFTypes,
 		},
 		NewestGS:         sp.newestGS,
@@ -183,10 +224,18 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 		UserAgentVersion: userAgentVersion,
 		ChainParams:      sp.server.chainParams,
 		Services:         sp.server.services,
-		DisableRelayTx:   sp.server.cfg.BlocksOnly,
+		DisableRelayTx:   sp.server.cfg.BlocksOnly || sp.server.cfg.LightNode,
 		ProtocolVersion:  maxProtocolVersion,
 		TrickleInterval:  sp.server.cfg.TrickleInterval,
+		Proxy:            sp.server.cfg.Proxy,
+
+		IdentityKey:       sp.server.identityKey,
+		RequireEncryption: sp.server.cfg.RequireEncryption,
 	}
+	if sp.server.cfg.LightNode {
+		cfg.Listeners = sp.lightListeners()
+	}
+	return cfg
 }
 
 // isWhitelisted returns whether the IP address is included in the whitelisted
@@ -218,7 +267,7 @@ func isWhitelisted(cfg *config.Config, addr net.Addr) bool {
 // addrStringToNetAddr takes an address in the form of 'host:port' and returns
 // a net.Addr which maps to the original address with any host names resolved
 // to IP addresses.
-func addrStringToNetAddr(addr string) (net.Addr, error) {
+func (s *PeerServer) addrStringToNetAddr(addr string) (net.Addr, error) {
 	host, strPort, err := net.SplitHostPort(addr)
 	if err != nil {
 		return nil, err
@@ -237,8 +286,17 @@ func addrStringToNetAddr(addr string) (net.Addr, error) {
 		}, nil
 	}
 
+	// Tor addresses cannot be resolved to an IP, so just return an onion
+	// address instead.
+	if isOnionHost(host) {
+		if !s.onion {
+			return nil, errors.New("tor has been disabled")
+		}
+		return &onionAddr{addr: addr}, nil
+	}
+
 	// Attempt to look up an IP address associated with the parsed host.
-	ips, err := net.LookupIP(host)
+	ips, err := s.lookup(host)
 	if err != nil {
 		return nil, err
 	}
@@ -252,6 +310,16 @@ func addrStringToNetAddr(addr string) (net.Addr, error) {
 	}, nil
 }
 
+// normalizeAddress returns addr with the default port appended when it has no
+// port.
+func normalizeAddress(addr, defaultPort string) string {
+	_, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return net.JoinHostPort(addr, defaultPort)
+	}
+	return addr
+}
+
 func (p *PeerServer) Start() error {
 
 	// Already started?
@@ -270,6 +338,13 @@ func (p *PeerServer) Start() error {
 		p.wg.Add(1)
 		go p.upnpUpdateThread()
 	}
+
+	// Announce the changes of the mempool minimum fee rate when relaying
+	// transactions.
+	if p.TxMemPool != nil && p.LightSync == nil && !p.cfg.BlocksOnly {
+		p.wg.Add(1)
+		go p.feeFilterHandler()
+	}
 	return nil
 }
 func (p *PeerServer) Stop() error {
@@ -291,6 +366,9 @@ func (p *PeerServer) Stop() error {
 // newestBlock returns the current best block hash and height using the format
 // required by the configuration for the peer package.
 func (sp *serverPeer) newestGS() (*blockdag.GraphState, error) {
+	if sp.server.LightSync != nil {
+		return sp.server.LightSync.GraphState(), nil
+	}
 	best := sp.server.BlockManager.GetChain().BestSnapshot()
 	return best.GraphState, nil
 }
@@ -321,8 +399,12 @@ func (s *PeerServer) peerDoneHandler(sp *serverPeer) {
 
 	// Only tell block manager we are gone if we ever told it we existed.
 	if sp.VersionKnown() && !sp.connReq.Ban {
-		log.Trace("peerDoneHandler send blkmgr donePeerMsg ")
-		s.BlockManager.DonePeer(sp.syncPeer)
+		if s.LightSync != nil {
+			s.LightSync.DonePeer(sp.syncPeer)
+		} else {
+			log.Trace("peerDoneHandler send blkmgr donePeerMsg ")
+			s.BlockManager.DonePeer(sp.syncPeer)
+		}
 	}
 	close(sp.quit)
 	log.Trace("stop peerDoneHandler")
@@ -341,14 +423,16 @@ func (s *PeerServer) peerHandler() {
 		inboundPeers:    make(map[int32]*serverPeer),
 		persistentPeers: make(map[int32]*serverPeer),
 		outboundPeers:   make(map[int32]*serverPeer),
-		banned:          make(map[string]time.Time),
 		outboundGroups:  make(map[string]int),
+		banned:          make(map[string]*BanEntry),
+		addedNodes:      make(map[string]*connmgr.ConnReq),
 	}
+	s.loadBanList(state)
 	s.state = state
 
 	if !s.cfg.DisableDNSSeed {
 		// Add peers discovered through DNS to the address manager.
-		connmgr.SeedFromDNS(s.chainParams, defaultRequiredServices, net.LookupIP, func(addrs []*types.NetAddress) {
+		connmgr.SeedFromDNS(s.chainParams, defaultRequiredServices, s.lookup, func(addrs []*types.NetAddress) {
 			// Bitcoind uses a lookup of the dns seeder here. This
 			// is rather strange since the values looked up by the
 			// DNS seed lookups will vary quite a lot.
@@ -359,6 +443,13 @@ func (s *PeerServer) peerHandler() {
 	}
 	go s.connManager.Start()
 
+	// Start up persistent peers.
+	for addr, c := range s.persistentReqs {
+		state.addedNodes[addr] = c
+		s.connManager.Register(c)
+		go s.connManager.Connect(c)
+	}
+
 out:
 	for {
 		select {
@@ -429,9 +520,13 @@ func (s *PeerServer) BroadcastMessage(msg message.Message, exclPeers ...*serverP
 	s.broadcast <- bmsg
 }
 
-// Dial connects to the address on the named network.
-func (s *PeerServer) Dial(network, addr string) (net.Conn, error) {
-	return net.DialTimeout(network, addr, defaultConnectTimeout)
+// isCurrent returns whether or not the node believes it is synced with the
+// connected peers.
+func (s *PeerServer) isCurrent() bool {
+	if s.LightSync != nil {
+		return s.LightSync.IsCurrent()
+	}
+	return s.BlockManager.IsCurrent()
 }
 
 // ConnectedCount returns the number of currently connected peers.
@@ -450,26 +545,73 @@ func (s *PeerServer) ConnectedPeers() []*serverPeer {
 	return <-replyChan
 }
 
-// Whether it has peer.
-func (s *PeerServer) HasPeer(uuid uuid.UUID) bool {
-	replyChan := make(chan bool)
-	s.query <- getPeerMsg{uuid: uuid, reply: replyChan}
+// AddedNode describes a node added at startup or with the addnode RPC.
+type AddedNode struct {
+	// Addr is the address the node was added with.
+	Addr string
+
+	// State is the state of the connection request to the node.
+	State connmgr.ConnState
+
+	// Peer is the connected peer of the node, it is nil when the node
+	// isn't connected.
+	Peer *serverPeer
+}
+
+// AddNode connects to the address of the node, it is reconnected on
+// disconnection when permanent.
+func (s *PeerServer) AddNode(addr string, permanent bool) error {
+	replyChan := make(chan error)
+	s.query <- connectNodeMsg{
+		addr:      normalizeAddress(addr, s.chainParams.DefaultPort),
+		permanent: permanent,
+		reply:     replyChan,
+	}
 	return <-replyChan
 }
 
-func (s *PeerServer) GetBanlist() map[string]time.Time {
-	return s.state.banned
+// RemoveNode removes a node added with AddNode as permanent and disconnects
+// from it.
+func (s *PeerServer) RemoveNode(addr string) error {
+	replyChan := make(chan error)
+	s.query <- removeNodeMsg{
+		addr:  normalizeAddress(addr, s.chainParams.DefaultPort),
+		reply: replyChan,
+	}
+	return <-replyChan
 }
 
-func (s *PeerServer) RemoveBan(host string) {
-	if len(host) == 0 {
-		s.state.banned = map[string]time.Time{}
-		log.Trace("Remove all ban")
-		return
+// DisconnectNodeByAddr disconnects the peers connected to the address.
+func (s *PeerServer) DisconnectNodeByAddr(addr string) error {
+	addr = normalizeAddress(addr, s.chainParams.DefaultPort)
+	replyChan := make(chan error)
+	s.query <- disconnectNodeMsg{
+		cmp:   func(sp *serverPeer) bool { return sp.Addr() == addr },
+		reply: replyChan,
 	}
-	_, ok := s.state.banned[host]
-	if ok {
-		delete(s.state.banned, host)
-		log.Trace(fmt.Sprintf("RemoveBan:%s", host))
+	return <-replyChan
+}
+
+// DisconnectNodeByID disconnects the peer with the id.
+func (s *PeerServer) DisconnectNodeByID(id int32) error {
+	replyChan := make(chan error)
+	s.query <- disconnectNodeMsg{
+		cmp:   func(sp *serverPeer) bool { return sp.ID() == id },
+		reply: replyChan,
 	}
+	return <-replyChan
+}
+
+// AddedNodes returns the nodes added at startup or with AddNode as permanent.
+func (s *PeerServer) AddedNodes() []*AddedNode {
+	replyChan := make(chan []*AddedNode)
+	s.query <- getAddedNodesMsg{reply: replyChan}
+	return <-replyChan
+}
+
+// Whether it has peer.
+func (s *PeerServer) HasPeer(uuid uuid.UUID) bool {
+	replyChan := make(chan bool)
+	s.query <- getPeerMsg{uuid: uuid, reply: replyChan}
+	return <-replyChan
 }
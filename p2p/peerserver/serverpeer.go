@@ -9,11 +9,13 @@ import (
 	"fmt"
 	"github.com/Qitmeer/qitmeer/common/hash"
 	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/core/protocol"
 	"github.com/Qitmeer/qitmeer/core/types"
 	"github.com/Qitmeer/qitmeer/log"
 	"github.com/Qitmeer/qitmeer/p2p/addmgr"
 	"github.com/Qitmeer/qitmeer/p2p/connmgr"
 	"github.com/Qitmeer/qitmeer/p2p/peer"
+	"github.com/Qitmeer/qitmeer/services/bloom"
 	"sync"
 	"sync/atomic"
 )
@@ -44,6 +46,15 @@ type serverPeer struct {
 
 	// Use to fee filter
 	feeFilter int64
+
+	// filter is the bloom filter loaded by the peer, transactions and
+	// merkle blocks relayed to it are filtered when it is loaded.
+	filter *bloom.Filter
+
+	// cmpctBlocks holds the compact blocks received from the peer which
+	// wait for their missing transactions.  It is only accessed by the
+	// input handler of the peer.
+	cmpctBlocks map[hash.Hash]*partialBlock
 }
 
 // newServerPeer returns a new serverPeer instance. The peer needs to be set by
@@ -53,6 +64,8 @@ func newServerPeer(s *PeerServer, isPersistent bool) *serverPeer {
 		server:         s,
 		persistent:     isPersistent,
 		knownAddresses: make(map[string]struct{}),
+		filter:         bloom.LoadFilter(nil),
+		cmpctBlocks:    make(map[hash.Hash]*partialBlock),
 		quit:           make(chan struct{}),
 		syncPeer: &peer.ServerPeer{
 			TxProcessed:     make(chan struct{}, 1),
@@ -135,3 +148,78 @@ func (sp *serverPeer) OnFeeFilter(_ *peer.Peer, msg *message.MsgFeeFilter) {
 	}
 	atomic.StoreInt64(&sp.feeFilter, msg.MinFee)
 }
+
+// enforceNodeBloomFlag disconnects the peer if the server is not configured to
+// allow bloom filters.  Additionally, if the peer has negotiated to a protocol
+// version  that is high enough to observe the bloom filter service support bit,
+// it will be banned since it is intentionally violating the protocol.
+func (sp *serverPeer) enforceNodeBloomFlag(cmd string) bool {
+	if sp.server.services&protocol.Bloom != protocol.Bloom {
+		// Disconnect the peer regardless of whether it was banned.
+		sp.addBanScore(100, 0, cmd)
+		log.Debug(fmt.Sprintf("%s sent an unsupported %s request -- "+
+			"disconnecting", sp, cmd))
+		sp.Disconnect()
+		return false
+	}
+
+	return true
+}
+
+// OnFilterAdd is invoked when a peer receives a filteradd message and is used
+// by remote peers to add data to an already loaded bloom filter.  The peer
+// will be disconnected if a filter is not loaded when this message is received
+// or the server is not configured to allow bloom filters.
+func (sp *serverPeer) OnFilterAdd(_ *peer.Peer, msg *message.MsgFilterAdd) {
+	// Disconnect and/or ban depending on the node bloom services flag and
+	// negotiated protocol version.
+	if !sp.enforceNodeBloomFlag(msg.Command()) {
+		return
+	}
+
+	if !sp.filter.IsLoaded() {
+		log.Debug(fmt.Sprintf("%s sent a filteradd request with no filter "+
+			"loaded -- disconnecting", sp))
+		sp.Disconnect()
+		return
+	}
+
+	sp.filter.Add(msg.Data)
+}
+
+// OnFilterClear is invoked when a peer receives a filterclear message and is
+// used by remote peers to clear an already loaded bloom filter.  The peer will
+// be disconnected if a filter is not loaded when this message is received  or
+// the server is not configured to allow bloom filters.
+func (sp *serverPeer) OnFilterClear(_ *peer.Peer, msg *message.MsgFilterClear) {
+	// Disconnect and/or ban depending on the node bloom services flag and
+	// negotiated protocol version.
+	if !sp.enforceNodeBloomFlag(msg.Command()) {
+		return
+	}
+
+	if !sp.filter.IsLoaded() {
+		log.Debug(fmt.Sprintf("%s sent a filterclear request with no "+
+			"filter loaded -- disconnecting", sp))
+		sp.Disconnect()
+		return
+	}
+
+	sp.filter.Unload()
+}
+
+// OnFilterLoad is invoked when a peer receives a filterload message and it
+// used to load a bloom filter that should be used for delivering merkle
+// blocks and associated transactions that match the filter.  The peer will be
+// disconnected if the server is not configured to allow bloom filters.
+func (sp *serverPeer) OnFilterLoad(_ *peer.Peer, msg *message.MsgFilterLoad) {
+	// Disconnect and/or ban depending on the node bloom services flag and
+	// negotiated protocol version.
+	if !sp.enforceNodeBloomFlag(msg.Command()) {
+		return
+	}
+
+	sp.setDisableRelayTx(false)
+
+	sp.filter.Reload(msg)
+}
@@ -63,7 +63,8 @@ type DNSSeed struct {
 // change that is voted in.  This is part of BIP0009.
 type ConsensusDeployment struct {
 	// BitNumber defines the specific bit number within the block version
-	// this particular soft-fork deployment refers to.
+	// this particular soft-fork deployment refers to.  The lower 16 bits
+	// hold the block version itself, so it must be in the range [16, 29).
 	BitNumber uint8
 
 	// StartTime is the median block time after which voting on the
@@ -210,7 +211,8 @@ type Params struct {
 	// state retarget window.
 	//
 	// Deployments define the specific consensus rule changes to be voted
-	// on.
+	// on, keyed by the block version they are voted on with.  The index of
+	// a deployment in its list is its deployment ID.
 	RuleChangeActivationThreshold uint32
 	MinerConfirmationWindow       uint32
 	Deployments                   map[uint32][]ConsensusDeployment
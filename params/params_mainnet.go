@@ -87,7 +87,13 @@ var MainNetParams = Params{
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints: []Checkpoint{},
 
-	Deployments: map[uint32][]ConsensusDeployment{},
+	// Consensus rule change deployments.
+	//
+	// The miner confirmation window is defined as:
+	//   main chain blocks in a retarget window
+	RuleChangeActivationThreshold: 1916, // 95% of MinerConfirmationWindow
+	MinerConfirmationWindow:       2016, //
+	Deployments:                   map[uint32][]ConsensusDeployment{},
 
 	// Address encoding magics
 	NetworkAddressPrefix: "N",
@@ -12,6 +12,13 @@ func RpcNoTxInfoError(txHash *hash.Hash) error {
 	return fmt.Errorf("No information available about transaction %v", txHash)
 }
 
+// RpcBlockPrunedError is a convenience function for returning a nicely
+// formatted RPC error which indicates the provided transaction is in a block
+// deleted by pruning.
+func RpcBlockPrunedError(txHash *hash.Hash, blockHash *hash.Hash) error {
+	return fmt.Errorf("Transaction %v is in the block %v which has been pruned", txHash, blockHash)
+}
+
 // RpcInvalidError is a convenience function to convert an invalid parameter
 // error to an RPC error with the appropriate code set.
 func RpcInvalidError(fmtStr string, args ...interface{}) error {
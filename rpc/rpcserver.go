@@ -44,8 +44,12 @@ type RpcServer struct {
 	codecsMu sync.Mutex
 	codecs   mapset.Set
 
+	// websocket subscriptions
+	ntfnMgr *wsNotificationManager
+
 	authsha                [sha256.Size]byte
 	numClients             int32
+	numWsClients           int32
 	statusLines            map[int]string
 	requestProcessShutdown chan struct{}
 
@@ -109,6 +113,7 @@ func NewRPCServer(cfg *config.Config) (*RpcServer, error) {
 
 		rpcSvcRegistry: make(serviceRegistry),
 		codecs:         mapset.NewSet(),
+		ntfnMgr:        newWsNotificationManager(),
 
 		statusLines:            make(map[int]string),
 		requestProcessShutdown: make(chan struct{}),
@@ -130,6 +135,7 @@ func (s *RpcServer) Start() error {
 	if err := s.startHTTP(s.config.RPCListeners); err != nil {
 		return err
 	}
+	s.ntfnMgr.start()
 	s.run = 1
 	return nil
 }
@@ -145,6 +151,7 @@ func (s *RpcServer) Stop() {
 			c.(ServerCodec).Close()
 			return true
 		})
+		s.ntfnMgr.stop()
 	}
 }
 
@@ -186,6 +193,8 @@ func (s *RpcServer) startHTTP(listenAddrs []string) error {
 		// Read and respond to the request.
 		s.jsonRPCRead(w, r)
 	})
+	// Websocket endpoint for long lived connections and subscriptions.
+	rpcServeMux.Handle(wsEndpoint, s.websocketHandler())
 	listeners, err := parseListeners(s.config, listenAddrs)
 	if err != nil {
 		return err
@@ -0,0 +1,109 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// The parts code inspired by
+// https://github.com/ethereum/go-ethereum/rpc
+
+package rpc
+
+import (
+	"context"
+	"github.com/Qitmeer/qitmeer/log"
+	"golang.org/x/net/websocket"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// wsEndpoint is the path of the websocket endpoint which is served on
+	// the same listeners as the standard HTTP POST endpoint.
+	wsEndpoint = "/ws"
+)
+
+// websocketHandler returns a handler that upgrades authenticated requests to
+// a websocket connection and serves JSON-RPC requests and subscriptions over
+// it until the connection is closed.
+func (s *RpcServer) websocketHandler() http.Handler {
+	wsServer := websocket.Server{
+		// The connection is already authenticated, so any origin is
+		// acceptable here.
+		Handshake: func(cfg *websocket.Config, r *http.Request) error {
+			return nil
+		},
+		Handler: func(conn *websocket.Conn) {
+			// The http server read timeout is still set on the hijacked
+			// connection, so clear it for the long lived websocket.
+			conn.SetReadDeadline(time.Time{})
+			conn.MaxPayloadBytes = maxRequestContentLength
+
+			s.incrementWsClients()
+			defer s.decrementWsClients()
+
+			r := conn.Request()
+			ctx := context.WithValue(context.Background(), "remote", r.RemoteAddr)
+			ctx = context.WithValue(ctx, "scheme", "ws")
+			ctx = context.WithValue(ctx, "local", r.Host)
+
+			codec := NewCodec(conn, func(v interface{}) error {
+				return websocket.JSON.Send(conn, v)
+			}, func(v interface{}) error {
+				return websocket.JSON.Receive(conn, v)
+			})
+			defer codec.Close()
+
+			log.Debug("New websocket client", "remote", r.RemoteAddr)
+			s.serveRequest(ctx, codec, false, OptionMethodInvocation|OptionSubscriptions)
+			log.Debug("Websocket client disconnected", "remote", r.RemoteAddr)
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&s.run) != 1 {
+			http.Error(w, "503 Server is stopping.", http.StatusServiceUnavailable)
+			return
+		}
+		// Limit the number of websocket clients to max allowed.
+		if s.limitWebsockets(w, r.RemoteAddr) {
+			return
+		}
+		_, err := s.checkAuth(r, true)
+		if err != nil {
+			jsonAuthFail(w)
+			return
+		}
+		wsServer.ServeHTTP(w, r)
+	})
+}
+
+// limitWebsockets responds with a 503 service unavailable and returns true if
+// adding another websocket client would exceed the maximum allowed websocket
+// clients.
+//
+// This function is safe for concurrent access.
+func (s *RpcServer) limitWebsockets(w http.ResponseWriter, remoteAddr string) bool {
+	if int(atomic.LoadInt32(&s.numWsClients)+1) > s.config.RPCMaxWebsockets {
+		log.Info("RPC websocket clients exceeded", "max", s.config.RPCMaxWebsockets,
+			"client", remoteAddr)
+		http.Error(w, "503 Too busy.  Try again later.",
+			http.StatusServiceUnavailable)
+		return true
+	}
+	return false
+}
+
+// incrementWsClients adds one to the number of connected websocket clients.
+//
+// This function is safe for concurrent access.
+func (s *RpcServer) incrementWsClients() {
+	atomic.AddInt32(&s.numWsClients, 1)
+}
+
+// decrementWsClients subtracts one from the number of connected websocket
+// clients.
+//
+// This function is safe for concurrent access.
+func (s *RpcServer) decrementWsClients() {
+	atomic.AddInt32(&s.numWsClients, -1)
+}
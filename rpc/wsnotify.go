@@ -0,0 +1,187 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+//
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"context"
+	"github.com/Qitmeer/qitmeer/log"
+	"sync"
+)
+
+// These are all events that can be subscribed through the websocket endpoint
+// via "qitmeer_subscribe".  The name is the formatted name of the matching
+// method of PublicSubscribeAPI.
+const (
+	newBlocksEvent       = "newBlocks"
+	newTransactionsEvent = "newTransactions"
+	replacedTxsEvent     = "replacedTransactions"
+	orderChangesEvent    = "orderChanges"
+)
+
+// notificationQueueSize is the number of pending notifications which can be
+// queued for a subscriber.  A client which falls further behind is
+// disconnected, so a slow client never blocks the callers.
+const notificationQueueSize = 1000
+
+// wsSubscriber is a subscription made by a websocket client for one event.
+// The notifications are written to the client by its own goroutine.
+type wsSubscriber struct {
+	notifier *Notifier
+	sub      *Subscription
+	queue    chan interface{}
+}
+
+// wsNotificationManager keeps track of the event subscriptions of websocket
+// clients and queues the events to them in the order they are notified.
+type wsNotificationManager struct {
+	mtx         sync.RWMutex
+	subscribers map[string]map[ID]*wsSubscriber
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newWsNotificationManager() *wsNotificationManager {
+	return &wsNotificationManager{
+		subscribers: make(map[string]map[ID]*wsSubscriber),
+		quit:        make(chan struct{}),
+	}
+}
+
+// start is a no-op, the subscribers start their own goroutines.
+func (m *wsNotificationManager) start() {
+}
+
+// stop stops the goroutines of the subscribers and waits for them to finish.
+func (m *wsNotificationManager) stop() {
+	close(m.quit)
+	m.wg.Wait()
+}
+
+// notificationQueueHandler writes the queued notifications to the client
+// until it unsubscribes or disconnects.
+func (m *wsNotificationManager) notificationQueueHandler(name string, s *wsSubscriber) {
+	defer m.wg.Done()
+	defer func() {
+		m.mtx.Lock()
+		delete(m.subscribers[name], s.sub.ID)
+		m.mtx.Unlock()
+	}()
+	for {
+		select {
+		case data := <-s.queue:
+			if err := s.notifier.Notify(s.sub.ID, data); err != nil {
+				log.Debug("Websocket notification failed", "event", name, "error", err)
+				return
+			}
+		case <-s.sub.Err():
+			return
+		case <-s.notifier.Closed():
+			return
+		case <-m.quit:
+			return
+		}
+	}
+}
+
+// notify queues an event for the subscribers without blocking.  Events are
+// dropped when nobody subscribes to them, and a client whose queue is full
+// is disconnected.
+func (m *wsNotificationManager) notify(name string, data interface{}) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	for _, s := range m.subscribers[name] {
+		select {
+		case s.queue <- data:
+		default:
+			log.Warn("Disconnecting slow websocket client", "event", name,
+				"subscription", s.sub.ID)
+			s.notifier.codec.Close()
+		}
+	}
+}
+
+// subscribe creates a subscription for the event on the connection of ctx.
+// The subscription is removed when the client unsubscribes or disconnects.
+func (m *wsNotificationManager) subscribe(ctx context.Context, name string) (*Subscription, error) {
+	notifier, supported := NotifierFromContext(ctx)
+	if !supported {
+		return nil, ErrNotificationsUnsupported
+	}
+	s := &wsSubscriber{
+		notifier: notifier,
+		sub:      notifier.CreateSubscription(),
+		queue:    make(chan interface{}, notificationQueueSize),
+	}
+
+	m.mtx.Lock()
+	if m.subscribers[name] == nil {
+		m.subscribers[name] = make(map[ID]*wsSubscriber)
+	}
+	m.subscribers[name][s.sub.ID] = s
+	m.mtx.Unlock()
+
+	m.wg.Add(1)
+	go m.notificationQueueHandler(name, s)
+	return s.sub, nil
+}
+
+// PublicSubscribeAPI provides the event subscriptions of the websocket
+// endpoint.
+type PublicSubscribeAPI struct {
+	s *RpcServer
+}
+
+func NewPublicSubscribeAPI(s *RpcServer) *PublicSubscribeAPI {
+	return &PublicSubscribeAPI{s}
+}
+
+// NewBlocks sends a notification each time a block is connected to the DAG,
+// including its order and blue/red status.
+func (api *PublicSubscribeAPI) NewBlocks(ctx context.Context) (*Subscription, error) {
+	return api.s.ntfnMgr.subscribe(ctx, newBlocksEvent)
+}
+
+// NewTransactions sends a notification each time a transaction is accepted
+// into the memory pool.
+func (api *PublicSubscribeAPI) NewTransactions(ctx context.Context) (*Subscription, error) {
+	return api.s.ntfnMgr.subscribe(ctx, newTransactionsEvent)
+}
+
+// ReplacedTransactions sends a notification each time a transaction accepted
+// into the memory pool replaces some of its transactions by fee.
+func (api *PublicSubscribeAPI) ReplacedTransactions(ctx context.Context) (*Subscription, error) {
+	return api.s.ntfnMgr.subscribe(ctx, replacedTxsEvent)
+}
+
+// OrderChanges sends a notification each time a new block changes the order
+// of blocks which were already ordered in the DAG.
+func (api *PublicSubscribeAPI) OrderChanges(ctx context.Context) (*Subscription, error) {
+	return api.s.ntfnMgr.subscribe(ctx, orderChangesEvent)
+}
+
+// NotifyNewBlock notifies the websocket clients subscribed to newBlocks.
+func (s *RpcServer) NotifyNewBlock(data interface{}) {
+	s.ntfnMgr.notify(newBlocksEvent, data)
+}
+
+// NotifyNewTransaction notifies the websocket clients subscribed to
+// newTransactions.
+func (s *RpcServer) NotifyNewTransaction(data interface{}) {
+	s.ntfnMgr.notify(newTransactionsEvent, data)
+}
+
+// NotifyTxReplaced notifies the websocket clients subscribed to
+// replacedTransactions.
+func (s *RpcServer) NotifyTxReplaced(data interface{}) {
+	s.ntfnMgr.notify(replacedTxsEvent, data)
+}
+
+// NotifyOrderChange notifies the websocket clients subscribed to
+// orderChanges.
+func (s *RpcServer) NotifyOrderChange(data interface{}) {
+	s.ntfnMgr.notify(orderChangesEvent, data)
+}
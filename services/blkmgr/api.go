@@ -154,8 +154,8 @@ func (api *PublicBlockAPI) GetBlock(h hash.Hash, verbose *bool, inclTx *bool, fu
 	cs := ib.GetChildren()
 	children := []*hash.Hash{}
 	if cs != nil && !cs.IsEmpty() {
-		for _, v := range cs.GetMap() {
-			children = append(children, v.(blockdag.IBlock).GetHash())
+		for k := range cs.GetMap() {
+			children = append(children, api.bm.chain.BlockDAG().GetBlockHash(k))
 		}
 	}
 	api.bm.chain.CalculateDAGDuplicateTxs(blk)
@@ -215,8 +215,8 @@ func (api *PublicBlockAPI) GetBlockV2(h hash.Hash, verbose *bool, inclTx *bool,
 	cs := ib.GetChildren()
 	children := []*hash.Hash{}
 	if cs != nil && !cs.IsEmpty() {
-		for _, v := range cs.GetMap() {
-			children = append(children, v.(blockdag.IBlock).GetHash())
+		for k := range cs.GetMap() {
+			children = append(children, api.bm.chain.BlockDAG().GetBlockHash(k))
 		}
 	}
 	api.bm.chain.CalculateDAGDuplicateTxs(blk)
@@ -415,3 +415,113 @@ func (api *PublicBlockAPI) GetCoinbase(h hash.Hash, verbose *bool) (interface{},
 func (api *PublicBlockAPI) GetFees(h hash.Hash) (interface{}, error) {
 	return api.bm.chain.GetFees(&h), nil
 }
+
+// GetUtxoSetInfo returns the statistics of the utxo set at the main chain tip,
+// with a hash of the set which can be compared between nodes at the same
+// order.
+func (api *PublicBlockAPI) GetUtxoSetInfo() (interface{}, error) {
+	stats, err := api.bm.chain.FetchUtxoSetStats(api.bm.quit)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Fetch utxo set")
+	}
+	return json.GetUtxoSetInfoResult{
+		BestBlock:      stats.Hash.String(),
+		Order:          stats.Order,
+		Count:          stats.Count,
+		TotalAmount:    stats.TotalAmount,
+		SerializedSize: stats.SerializedSize,
+		UtxoSetHash:    stats.UtxoSetHash.String(),
+	}, nil
+}
+
+// deploymentStatusStrings maps the threshold states to the BIP0009 status
+// names reported by getDeploymentInfo.
+var deploymentStatusStrings = map[blockchain.ThresholdState]string{
+	blockchain.ThresholdDefined:  "defined",
+	blockchain.ThresholdStarted:  "started",
+	blockchain.ThresholdLockedIn: "locked_in",
+	blockchain.ThresholdActive:   "active",
+	blockchain.ThresholdFailed:   "failed",
+}
+
+// GetDeploymentInfo returns the state of the consensus rule change deployments
+// for the block after the main chain tip.
+func (api *PublicBlockAPI) GetDeploymentInfo() (interface{}, error) {
+	info, err := api.bm.chain.FetchDeploymentInfo()
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Fetch deployment info")
+	}
+	result := json.GetDeploymentInfoResult{
+		BestBlock:   info.Hash.String(),
+		Height:      info.Height,
+		Window:      info.Window,
+		Threshold:   info.Threshold,
+		Elapsed:     info.Elapsed,
+		Deployments: make([]json.DeploymentInfoResult, 0, len(info.Deployments)),
+	}
+	for _, d := range info.Deployments {
+		result.Deployments = append(result.Deployments, json.DeploymentInfoResult{
+			ID:         d.ID,
+			Bit:        d.Deployment.BitNumber,
+			StartTime:  d.Deployment.StartTime,
+			ExpireTime: d.Deployment.ExpireTime,
+			Status:     deploymentStatusStrings[d.State],
+			Count:      d.Count,
+		})
+	}
+	return result, nil
+}
+
+// GetBlockRisk returns the probability that the block is reversed according to
+// the SPECTRE risk model, alpha is the relative computational power assumed
+// for the attacker.
+func (api *PublicBlockAPI) GetBlockRisk(h hash.Hash, alpha *float64) (interface{}, error) {
+	a := blockchain.DefaultRiskAlpha
+	if alpha != nil {
+		a = *alpha
+	}
+	risk, err := api.bm.chain.BlockConfirmationRisk(&h, a)
+	if err != nil {
+		return nil, rpc.RpcInvalidError("%s", err.Error())
+	}
+	return marshal.MarshalJsonConfirmationRisk(risk, ""), nil
+}
+
+// maxExportDAGBlocks is the maximum number of blocks returned by ExportDAG.
+const maxExportDAGBlocks = 2000
+
+// ExportDAG returns the sub-DAG of the blocks with the orders from 'start' to
+// 'end'(exclude self), 'end' is after the main chain tip if it is equal to
+// zero.  If 'last' is set, the sub-DAG is made of the last blocks before 'end'
+// instead, like the dag command of fastibd.  The format is either json
+// (default) or dot, which returns a Graphviz digraph.
+func (api *PublicBlockAPI) ExportDAG(start uint, end uint, last *uint, format *string) (interface{}, error) {
+	bd := api.bm.chain.BlockDAG()
+	var lastBlocks uint
+	if last != nil {
+		lastBlocks = *last
+	}
+	start, end = bd.ExportRange(start, end, lastBlocks)
+	if start >= end {
+		return nil, rpc.RpcInvalidError("start order %d is not below the end order %d", start, end)
+	}
+	if end-start > maxExportDAGBlocks {
+		return nil, rpc.RpcInvalidError("at most %d blocks can be exported", maxExportDAGBlocks)
+	}
+	blocks, err := bd.ExportDAG(start, end)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Failed to export the DAG")
+	}
+
+	if format == nil || *format == "json" {
+		return marshal.MarshalJsonDAG(blocks), nil
+	}
+	if *format != "dot" {
+		return nil, rpc.RpcInvalidError("unknown format %s", *format)
+	}
+	var buf bytes.Buffer
+	if err := blockdag.WriteDot(&buf, blocks); err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Failed to write the DAG")
+	}
+	return buf.String(), nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/Qitmeer/qitmeer/config"
 	"github.com/Qitmeer/qitmeer/core/blockchain"
 	"github.com/Qitmeer/qitmeer/core/blockdag"
+	"github.com/Qitmeer/qitmeer/core/json"
 	"github.com/Qitmeer/qitmeer/core/message"
 	"github.com/Qitmeer/qitmeer/core/types"
 	"github.com/Qitmeer/qitmeer/database"
@@ -122,6 +123,8 @@ func NewBlockManager(ntmgr notify.Notify, indexManager blockchain.IndexManager,
 		DAGType:        cfg.DAGType,
 		BlockVersion:   blockVersion,
 		CacheInvalidTx: cfg.CacheInvalidTx,
+		PruneTarget:    cfg.Prune * 1024 * 1024,
+		DAGCacheWindow: cfg.DAGCacheWindow,
 	})
 	if err != nil {
 		return nil, err
@@ -245,12 +248,16 @@ func (b *BlockManager) handleNotifyMsg(notification *blockchain.Notification) {
 			b.notify.AnnounceNewTransactions(acceptedTxs)
 		}
 
-		/*
-			if r := b.server.rpcServer; r != nil {
-				// Notify registered websocket clients of incoming block.
-				r.ntfnMgr.NotifyBlockConnected(block)
+		// Register block with the fee estimator, if it exists.
+		if fe := b.GetTxManager().FeeEstimator(); fe != nil {
+			err := fe.RegisterBlock(block)
+			if err != nil {
+				log.Error("Failed to register block with the fee estimator", "error", err)
 			}
-		*/
+		}
+
+		// Notify registered websocket clients of incoming block.
+		b.notify.NotifyBlockConnected(b.newBlockNtfn(block))
 
 		b.zmqNotify.BlockConnected(block)
 
@@ -262,27 +269,74 @@ func (b *BlockManager) handleNotifyMsg(notification *blockchain.Notification) {
 			log.Warn("Chain disconnected notification is not a block slice.")
 			break
 		}
+
+		// Rollback previous block recorded by the fee estimator.
+		if fe := b.GetTxManager().FeeEstimator(); fe != nil {
+			fe.Rollback(block.Hash())
+		}
 		b.zmqNotify.BlockDisconnected(block)
 	// The blockchain is reorganizing.
 	case blockchain.Reorganization:
 		log.Trace("Chain reorganization notification")
-		/*
-			rd, ok := notification.Data.(*blockchain.ReorganizationNotifyData)
-			if !ok {
-				log.Warn("Chain reorganization notification is malformed")
-				break
-			}
+		rd, ok := notification.Data.(*blockchain.ReorganizationNotifyData)
+		if !ok {
+			log.Warn("Chain reorganization notification is malformed")
+			break
+		}
 
-			// Notify registered websocket clients.
-			if r := b.server.rpcServer; r != nil {
-				r.ntfnMgr.NotifyReorganization(rd)
-			}
+		// Notify registered websocket clients.
+		b.notify.NotifyReorganization(newOrderChangeNtfn(rd))
+	}
+}
 
-			// Drop the associated mining template from the old chain, since it
-			// will be no longer valid.
-			b.cachedCurrentTemplate = nil
-		*/
+// newBlockNtfn returns the websocket notification of the connected block,
+// which carries its DAG order and blue/red status.
+func (b *BlockManager) newBlockNtfn(block *types.SerializedBlock) *json.NewBlockNtfn {
+	ntfn := &json.NewBlockNtfn{
+		Hash:     block.Hash().String(),
+		Order:    block.Order(),
+		Height:   uint64(block.Height()),
+		Txsvalid: true,
+		Time:     block.Block().Header.Timestamp.Unix(),
+		TxCount:  len(block.Transactions()),
+	}
+	for _, pb := range block.Block().Parents {
+		ntfn.Parents = append(ntfn.Parents, pb.String())
+	}
+	ib := b.chain.BlockDAG().GetBlock(block.Hash())
+	if ib != nil {
+		ntfn.Layer = uint32(ib.GetLayer())
+		ntfn.IsBlue = b.chain.BlockDAG().IsBlue(ib.GetID())
+	}
+	node := b.chain.BlockIndex().LookupNode(block.Hash())
+	if node != nil {
+		ntfn.Txsvalid = !b.chain.BlockIndex().NodeStatus(node).KnownInvalid()
+	}
+	return ntfn
+}
+
+// newOrderChangeNtfn returns the websocket notification of a reorganization.
+func newOrderChangeNtfn(rd *blockchain.ReorganizationNotifyData) *json.OrderChangeNtfn {
+	changes := map[hash.Hash]*json.BlockOrderNtfn{}
+	ntfn := &json.OrderChangeNtfn{Hash: rd.NewHash.String()}
+	change := func(h hash.Hash) *json.BlockOrderNtfn {
+		c, ok := changes[h]
+		if !ok {
+			c = &json.BlockOrderNtfn{Hash: h.String()}
+			changes[h] = c
+			ntfn.Blocks = append(ntfn.Blocks, c)
+		}
+		return c
+	}
+	for _, bo := range rd.OldOrders {
+		order := bo.Order
+		change(bo.Hash).OldOrder = &order
+	}
+	for _, bo := range rd.NewOrders {
+		order := bo.Order
+		change(bo.Hash).NewOrder = &order
 	}
+	return ntfn
 }
 
 // current returns true if we believe we are synced with our peers, false if we
@@ -554,7 +608,7 @@ out:
 
 			case processBlockMsg:
 				log.Trace("blkmgr msgChan processBlockMsg", "msg", msg)
-				isOrphan, err := b.chain.ProcessBlock(
+				isOrphan, err := b.processBlock(
 					msg.block, msg.flags)
 				if err != nil {
 					msg.reply <- processBlockResponse{
@@ -1,6 +1,7 @@
 package blkmgr
 
 import (
+	"github.com/Qitmeer/qitmeer/common/hash"
 	"github.com/Qitmeer/qitmeer/core/types"
 )
 
@@ -108,8 +109,12 @@ func deepCopyBlockTemplate(blockTemplate *types.BlockTemplate) *types.BlockTempl
 		}
 	}
 
+	parentsCopy := make([]*hash.Hash, len(blockTemplate.Block.Parents))
+	copy(parentsCopy, blockTemplate.Block.Parents)
+
 	msgBlockCopy := &types.Block{
 		Header:       headerCopy,
+		Parents:      parentsCopy,
 		Transactions: transactionsCopy,
 	}
 
@@ -126,5 +131,6 @@ func deepCopyBlockTemplate(blockTemplate *types.BlockTemplate) *types.BlockTempl
 		Height:          blockTemplate.Height,
 		Blues:           blockTemplate.Blues,
 		ValidPayAddress: blockTemplate.ValidPayAddress,
+		PowDiffData:     blockTemplate.PowDiffData,
 	}
 }
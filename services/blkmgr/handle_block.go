@@ -70,7 +70,7 @@ func (b *BlockManager) handleBlockMsg(bmsg *blockMsg) connmgr.BanScore {
 	delete(b.requestedBlocks, *blockHash)
 	// Process the block to include validation, best chain selection, orphan
 	// handling, etc.
-	isOrphan, err := b.chain.ProcessBlock(bmsg.block,
+	isOrphan, err := b.processBlock(bmsg.block,
 		behaviorFlags)
 
 	if err != nil {
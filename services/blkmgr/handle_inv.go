@@ -123,6 +123,11 @@ func (b *BlockManager) handleInvMsg(imsg *invMsg) {
 	numRequested := 0
 	gdmsg := message.NewMsgGetData()
 	requestQueue := imsg.peer.RequestQueue
+
+	// Request compact blocks when the peer supports them and the
+	// transactions of the new blocks are likely in the memory pool.
+	cmpctBlocks := imsg.peer.SupportsCmpctBlocks() && b.IsCurrent() &&
+		!b.config.BlocksOnly
 	for len(requestQueue) != 0 {
 		iv := requestQueue[0]
 		requestQueue[0] = nil
@@ -136,6 +141,10 @@ func (b *BlockManager) handleInvMsg(imsg *invMsg) {
 				b.requestedBlocks[iv.Hash] = struct{}{}
 				b.limitMap(b.requestedBlocks, maxRequestedBlocks)
 				imsg.peer.RequestedBlocks[iv.Hash] = struct{}{}
+				if cmpctBlocks {
+					iv = message.NewInvVect(message.InvTypeCmpctBlock,
+						&iv.Hash)
+				}
 				gdmsg.AddInvVect(iv)
 				numRequested++
 			}
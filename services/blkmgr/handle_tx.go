@@ -2,7 +2,9 @@ package blkmgr
 
 import (
 	"fmt"
+	"github.com/Qitmeer/qitmeer/core/json"
 	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/core/types"
 	"github.com/Qitmeer/qitmeer/services/mempool"
 )
 
@@ -80,3 +82,21 @@ func (b *BlockManager) handleTxMsg(tmsg *txMsg) {
 
 	b.notify.AnnounceNewTransactions(acceptedTxs)
 }
+
+// TxReplaced announces the transactions replaced by fee in the mempool to the
+// websocket clients and the ZMQ subscribers.  It is called by the mempool with
+// its lock held, so it must not call back into it.
+func (b *BlockManager) TxReplaced(replacement *types.TxDesc, replaced []*types.TxDesc) {
+	ntfn := &json.TxReplacedNtfn{
+		Txid:     replacement.Tx.Hash().String(),
+		Fee:      replacement.Fee,
+		FeePerKB: replacement.FeePerKB,
+	}
+	replacedTxs := make([]*types.Tx, 0, len(replaced))
+	for _, td := range replaced {
+		ntfn.Replaced = append(ntfn.Replaced, td.Tx.Hash().String())
+		replacedTxs = append(replacedTxs, td.Tx)
+	}
+	b.notify.NotifyTxReplaced(ntfn)
+	b.zmqNotify.TxReplaced(replacement.Tx, replacedTxs)
+}
@@ -8,10 +8,13 @@ import (
 	"github.com/Qitmeer/qitmeer/common/hash"
 	"github.com/Qitmeer/qitmeer/core/blockchain"
 	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/services/mempool"
 )
 
 type TxManager interface {
 	MemPool() TxPool
+
+	FeeEstimator() *mempool.FeeEstimator
 }
 
 type TxPool interface {
@@ -0,0 +1,39 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blkmgr
+
+import (
+	"time"
+
+	"github.com/Qitmeer/qitmeer/core/blockchain"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/metrics"
+)
+
+var (
+	// blockProcessTimer measures the latency of the processing of the
+	// blocks by the chain.
+	blockProcessTimer = metrics.NewTimer("blkmgr/block/process")
+
+	// rejectedBlocksCounter counts the blocks rejected by the chain.
+	rejectedBlocksCounter = metrics.NewCounter("blkmgr/block/rejected")
+
+	// orphanBlocksGauge is the number of orphan blocks waiting for their
+	// parents.
+	orphanBlocksGauge = metrics.NewGauge("blkmgr/orphans")
+)
+
+// processBlock processes the block by the chain and records the metrics of
+// the processing.
+func (b *BlockManager) processBlock(block *types.SerializedBlock, flags blockchain.BehaviorFlags) (bool, error) {
+	start := time.Now()
+	isOrphan, err := b.chain.ProcessBlock(block, flags)
+	blockProcessTimer.UpdateSince(start)
+	if err != nil {
+		rejectedBlocksCounter.Inc(1)
+	}
+	orphanBlocksGauge.Update(int64(b.chain.GetOrphansTotal()))
+	return isOrphan, err
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package bloom
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/core/types"
+)
+
+func TestMurmurHash3(t *testing.T) {
+	var tests = []struct {
+		seed uint32
+		data []byte
+		out  uint32
+	}{
+		{0x00000000, []byte{}, 0x00000000},
+		{0xfba4c795, []byte{}, 0x6a396f08},
+		{0xffffffff, []byte{}, 0x81f16f39},
+		{0x00000000, []byte{0x00}, 0x514e28b7},
+		{0xfba4c795, []byte{0x00}, 0xea3f0b17},
+		{0x00000000, []byte{0xff}, 0xfd6cf10d},
+		{0x00000000, []byte{0x00, 0x11}, 0x16c6b7ab},
+		{0x00000000, []byte{0x00, 0x11, 0x22}, 0x8eb51c3d},
+		{0x00000000, []byte{0x00, 0x11, 0x22, 0x33}, 0xb4471bf8},
+		{0x00000000, []byte{0x00, 0x11, 0x22, 0x33, 0x44}, 0xe2301fa8},
+		{0x00000000, []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}, 0xfc2e4a15},
+		{0x00000000, []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66}, 0xb074502c},
+		{0x00000000, []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77}, 0x8034d2a0},
+		{0x00000000, []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88}, 0xb4698def},
+	}
+
+	for i, test := range tests {
+		result := MurmurHash3(test.seed, test.data)
+		if result != test.out {
+			t.Errorf("MurmurHash3 test #%d failed: got %v want %v",
+				i, result, test.out)
+		}
+	}
+}
+
+func TestFilterInsert(t *testing.T) {
+	var tests = []struct {
+		hex    string
+		insert bool
+	}{
+		{"99108ad8ed9bb6274d3980bab5a85c048f0950c8", true},
+		{"19108ad8ed9bb6274d3980bab5a85c048f0950c8", false},
+		{"b5a2c786d9ef4658287ced5914b37a1b4aa32eee", true},
+		{"b9300670b4c5366e95b2699e8b18bc75e5f729c5", true},
+	}
+
+	f := NewFilter(3, 0, 0.01, message.BloomUpdateAll)
+
+	for i, test := range tests {
+		data, err := hex.DecodeString(test.hex)
+		if err != nil {
+			t.Fatalf("DecodeString #%d: %v", i, err)
+		}
+		if test.insert {
+			f.Add(data)
+		}
+
+		result := f.Matches(data)
+		if test.insert != result {
+			t.Errorf("Matches #%d: got %v want %v", i, result,
+				test.insert)
+		}
+	}
+
+	want, _ := hex.DecodeString("03614e9b050000000000000001")
+	got := bytes.NewBuffer(nil)
+	err := f.MsgFilterLoad().Encode(got, 0)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("serialized filter mismatch: got %x want %x",
+			got.Bytes(), want)
+	}
+
+	f.Unload()
+	if f.IsLoaded() || f.Matches([]byte{0x99}) {
+		t.Errorf("unloaded filter still matches")
+	}
+}
+
+func TestFilterMatchTxAndUpdate(t *testing.T) {
+	pkScriptData := bytes.Repeat([]byte{0x42}, 20)
+	// OP_DUP OP_HASH160 <20 bytes> OP_EQUALVERIFY OP_CHECKSIG
+	pkScript := append([]byte{0x76, 0xa9, 0x14}, pkScriptData...)
+	pkScript = append(pkScript, 0x88, 0xac)
+
+	fundTx := types.NewTransaction()
+	fundTx.AddTxIn(types.NewTxInput(types.NewOutPoint(&hash.Hash{1}, 0), nil))
+	fundTx.AddTxOut(types.NewTxOutput(100, pkScript))
+	fund := types.NewTx(fundTx)
+
+	spendTx := types.NewTransaction()
+	spendTx.AddTxIn(types.NewTxInput(types.NewOutPoint(fund.Hash(), 0), nil))
+	spendTx.AddTxOut(types.NewTxOutput(90, []byte{0x51}))
+	spend := types.NewTx(spendTx)
+
+	f := NewFilter(10, 0, 0.0001, message.BloomUpdateAll)
+	if f.MatchTxAndUpdate(spend) {
+		t.Fatalf("empty filter matched the spending tx")
+	}
+	f.Add(pkScriptData)
+	if !f.MatchTxAndUpdate(fund) {
+		t.Fatalf("filter did not match the output script data")
+	}
+
+	// The outpoint of the matched output was added by the update, so the
+	// transaction spending it matches too.
+	if !f.MatchesOutPoint(types.NewOutPoint(fund.Hash(), 0)) {
+		t.Fatalf("matched outpoint was not added to the filter")
+	}
+	if !f.MatchTxAndUpdate(spend) {
+		t.Fatalf("filter did not match the spending tx")
+	}
+}
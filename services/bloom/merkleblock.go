@@ -0,0 +1,223 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package bloom
+
+import (
+	"errors"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/merkle"
+	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/core/types"
+)
+
+// merkleBlock is used to house intermediate information needed to generate a
+// message.MsgMerkleBlock according to a filter.
+type merkleBlock struct {
+	numTx       uint32
+	matchedBits []byte
+	finalHashes []*hash.Hash
+	bits        []byte
+
+	// store is the merkle tree of all of the transactions of the block as
+	// built by merkle.BuildMerkleTreeStore, with the levels of the tree
+	// stored one after the other starting at the leaves.
+	store []*hash.Hash
+	// leaves is the number of leaves of the tree, the number of
+	// transactions rounded up to the next power of two.
+	leaves uint32
+}
+
+// calcTreeWidth calculates and returns the number of nodes (width) of a
+// merkle tree at the given depth-first height.
+func (m *merkleBlock) calcTreeWidth(height uint32) uint32 {
+	return (m.numTx + (1 << height) - 1) >> height
+}
+
+// calcHash returns the hash of the node at the given depth-first height and
+// position in the merkle tree.  The hashes are looked up in the merkle tree
+// store, which hashes a node without a right child with itself as the partial
+// merkle tree requires.
+func (m *merkleBlock) calcHash(height, pos uint32) *hash.Hash {
+	offset := uint32(0)
+	for i := uint32(0); i < height; i++ {
+		offset += m.leaves >> i
+	}
+	return m.store[offset+pos]
+}
+
+// traverseAndBuild builds a partial merkle tree using a recursive depth-first
+// approach.  As it calculates the hashes, it also sets the flag bits and
+// records the final hashes used to build the merkle tree.
+func (m *merkleBlock) traverseAndBuild(height, pos uint32) {
+	// Determine whether this node is a parent of a matched node.
+	var isParent byte
+	for i := pos << height; i < (pos+1)<<height && i < m.numTx; i++ {
+		isParent |= m.matchedBits[i]
+	}
+	m.bits = append(m.bits, isParent)
+
+	// When the node is a leaf node or not a parent of a matched node,
+	// append the hash to the list that will be part of the final merkle
+	// block.
+	if height == 0 || isParent == 0x00 {
+		m.finalHashes = append(m.finalHashes, m.calcHash(height, pos))
+		return
+	}
+
+	// At this point, the node is an internal node and it is the parent
+	// of an included leaf node.
+
+	// Descend into the left child and process its sub-tree.
+	m.traverseAndBuild(height-1, pos*2)
+
+	// Descend into the right child and process its sub-tree if
+	// there is one.
+	if pos*2+1 < m.calcTreeWidth(height-1) {
+		m.traverseAndBuild(height-1, pos*2+1)
+	}
+}
+
+// NewMerkleBlock returns a new *message.MsgMerkleBlock and an array of the
+// matched transaction index numbers based on the passed block and filter.
+func NewMerkleBlock(block *types.SerializedBlock, filter *Filter) (*message.MsgMerkleBlock, []uint32) {
+	transactions := block.Transactions()
+	numTx := uint32(len(transactions))
+	store := merkle.BuildMerkleTreeStore(transactions, false)
+	mBlock := merkleBlock{
+		numTx:       numTx,
+		matchedBits: make([]byte, 0, numTx),
+		store:       store,
+		leaves:      uint32(len(store)+1) / 2,
+	}
+
+	// Find and keep track of any transactions that match the filter.
+	var matchedIndices []uint32
+	for txIndex, tx := range transactions {
+		if filter.MatchTxAndUpdate(tx) {
+			mBlock.matchedBits = append(mBlock.matchedBits, 0x01)
+			matchedIndices = append(matchedIndices, uint32(txIndex))
+		} else {
+			mBlock.matchedBits = append(mBlock.matchedBits, 0x00)
+		}
+	}
+
+	// Calculate the number of merkle branches (height) in the tree.
+	height := uint32(0)
+	for mBlock.calcTreeWidth(height) > 1 {
+		height++
+	}
+
+	// Build the depth-first partial merkle tree.
+	mBlock.traverseAndBuild(height, 0)
+
+	// Create and return the merkle block.
+	msgMerkleBlock := message.MsgMerkleBlock{
+		Header:       block.Block().Header,
+		Transactions: mBlock.numTx,
+		Hashes:       make([]*hash.Hash, 0, len(mBlock.finalHashes)),
+		Flags:        make([]byte, (len(mBlock.bits)+7)/8),
+	}
+	for _, h := range mBlock.finalHashes {
+		msgMerkleBlock.AddTxHash(h)
+	}
+	for i := uint32(0); i < uint32(len(mBlock.bits)); i++ {
+		msgMerkleBlock.Flags[i/8] |= mBlock.bits[i] << (i % 8)
+	}
+	return &msgMerkleBlock, matchedIndices
+}
+
+// ErrBadMerkleBlock is returned by ExtractMatches when the partial merkle tree
+// of a merkle block is malformed.
+var ErrBadMerkleBlock = errors.New("malformed partial merkle tree")
+
+// partialMerkleTree is used to walk the partial merkle tree of a
+// message.MsgMerkleBlock the same way it was built by traverseAndBuild.
+type partialMerkleTree struct {
+	msg      *message.MsgMerkleBlock
+	bitsUsed uint32
+	hashUsed int
+	matched  []*hash.Hash
+}
+
+// calcTreeWidth calculates and returns the number of nodes (width) of the
+// partial merkle tree at the given depth-first height.
+func (p *partialMerkleTree) calcTreeWidth(height uint32) uint32 {
+	return (p.msg.Transactions + (1 << height) - 1) >> height
+}
+
+// traverseAndExtract computes the hash of the node at the given height and
+// position from the flags and hashes of the merkle block, and records the
+// hashes of the matched transactions it comes across.
+func (p *partialMerkleTree) traverseAndExtract(height, pos uint32) (*hash.Hash, error) {
+	if p.bitsUsed >= uint32(len(p.msg.Flags))*8 {
+		return nil, ErrBadMerkleBlock
+	}
+	isParent := p.msg.Flags[p.bitsUsed/8]&(1<<(p.bitsUsed%8)) != 0
+	p.bitsUsed++
+
+	if height == 0 || !isParent {
+		if p.hashUsed >= len(p.msg.Hashes) {
+			return nil, ErrBadMerkleBlock
+		}
+		h := p.msg.Hashes[p.hashUsed]
+		p.hashUsed++
+		if height == 0 && isParent {
+			p.matched = append(p.matched, h)
+		}
+		return h, nil
+	}
+
+	left, err := p.traverseAndExtract(height-1, pos*2)
+	if err != nil {
+		return nil, err
+	}
+	right := left
+	if pos*2+1 < p.calcTreeWidth(height-1) {
+		right, err = p.traverseAndExtract(height-1, pos*2+1)
+		if err != nil {
+			return nil, err
+		}
+		// The right child can't be the same as the left one, otherwise
+		// the same transactions could be matched twice.
+		if right.IsEqual(left) {
+			return nil, ErrBadMerkleBlock
+		}
+	}
+	var buf [hash.HashSize * 2]byte
+	copy(buf[:hash.HashSize], left[:])
+	copy(buf[hash.HashSize:], right[:])
+	root := hash.DoubleHashH(buf[:])
+	return &root, nil
+}
+
+// ExtractMatches walks the partial merkle tree of the passed merkle block and
+// returns the merkle root it commits to, along with the hashes of the matched
+// transactions in block order.  The caller is expected to compare the root
+// with the transaction root of the block header.
+func ExtractMatches(msg *message.MsgMerkleBlock) (*hash.Hash, []*hash.Hash, error) {
+	if msg.Transactions == 0 || len(msg.Hashes) > int(msg.Transactions) ||
+		len(msg.Flags)*8 < len(msg.Hashes) {
+		return nil, nil, ErrBadMerkleBlock
+	}
+
+	p := &partialMerkleTree{msg: msg}
+	height := uint32(0)
+	for p.calcTreeWidth(height) > 1 {
+		height++
+	}
+	root, err := p.traverseAndExtract(height, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// All of the hashes and all but the padding bits of the last flag
+	// byte must have been consumed.
+	if p.hashUsed != len(msg.Hashes) ||
+		(p.bitsUsed+7)/8 != uint32(len(msg.Flags)) {
+		return nil, nil, ErrBadMerkleBlock
+	}
+	return root, p.matched, nil
+}
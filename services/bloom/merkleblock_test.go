@@ -0,0 +1,86 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package bloom
+
+import (
+	"testing"
+
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/merkle"
+	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/core/types/pow"
+)
+
+func testBlock(numTx int) *types.SerializedBlock {
+	block := &types.Block{}
+	block.Header.Pow = pow.GetInstance(pow.BLAKE2BD, 0, []byte{})
+	for i := 0; i < numTx; i++ {
+		tx := types.NewTransaction()
+		tx.AddTxIn(types.NewTxInput(types.NewOutPoint(&hash.Hash{byte(i)}, 0), nil))
+		tx.AddTxOut(types.NewTxOutput(uint64(i+1), []byte{0x51}))
+		block.AddTransaction(tx)
+	}
+	txs := make([]*types.Tx, 0, numTx)
+	for _, tx := range block.Transactions {
+		txs = append(txs, types.NewTx(tx))
+	}
+	store := merkle.BuildMerkleTreeStore(txs, false)
+	block.Header.TxRoot = *store[len(store)-1]
+	return types.NewBlock(block)
+}
+
+func TestNewMerkleBlock(t *testing.T) {
+	for _, numTx := range []int{1, 2, 3, 7, 8, 13} {
+		block := testBlock(numTx)
+		txs := block.Transactions()
+		for _, target := range []int{0, numTx / 2, numTx - 1} {
+			f := NewFilter(1, 0, 0.000001, message.BloomUpdateNone)
+			f.AddHash(txs[target].Hash())
+
+			msg, matched := NewMerkleBlock(block, f)
+			if len(matched) != 1 || matched[0] != uint32(target) {
+				t.Fatalf("numTx %d: unexpected matched indices %v",
+					numTx, matched)
+			}
+			if msg.Transactions != uint32(numTx) {
+				t.Fatalf("numTx %d: got %d transactions", numTx,
+					msg.Transactions)
+			}
+
+			root, matchedHashes, err := ExtractMatches(msg)
+			if err != nil {
+				t.Fatalf("numTx %d target %d: %v", numTx, target, err)
+			}
+			if !root.IsEqual(&block.Block().Header.TxRoot) {
+				t.Fatalf("numTx %d target %d: root %v, want %v",
+					numTx, target, root, block.Block().Header.TxRoot)
+			}
+			if len(matchedHashes) != 1 || !matchedHashes[0].IsEqual(txs[target].Hash()) {
+				t.Fatalf("numTx %d target %d: unexpected matched "+
+					"hashes %v", numTx, target, matchedHashes)
+			}
+		}
+	}
+}
+
+func TestExtractMatchesMalformed(t *testing.T) {
+	block := testBlock(7)
+	f := NewFilter(1, 0, 0.000001, message.BloomUpdateNone)
+	f.AddHash(block.Transactions()[3].Hash())
+	msg, _ := NewMerkleBlock(block, f)
+
+	truncated := *msg
+	truncated.Hashes = msg.Hashes[:len(msg.Hashes)-1]
+	if _, _, err := ExtractMatches(&truncated); err != ErrBadMerkleBlock {
+		t.Fatalf("truncated hashes: got %v, want %v", err, ErrBadMerkleBlock)
+	}
+
+	extra := *msg
+	extra.Flags = append(append([]byte{}, msg.Flags...), 0x00)
+	if _, _, err := ExtractMatches(&extra); err != ErrBadMerkleBlock {
+		t.Fatalf("extra flags: got %v, want %v", err, ErrBadMerkleBlock)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package cf
+
+import "io"
+
+// bitWriter appends bits to a byte slice, most significant bit first.
+type bitWriter struct {
+	data []byte
+	// used is the number of bits used in the last byte of data.
+	used uint8
+}
+
+// writeBit appends a single bit.
+func (w *bitWriter) writeBit(bit bool) {
+	if w.used == 0 || w.used == 8 {
+		w.data = append(w.data, 0)
+		w.used = 0
+	}
+	if bit {
+		w.data[len(w.data)-1] |= 1 << (7 - w.used)
+	}
+	w.used++
+}
+
+// writeBits appends the nbits low bits of v, most significant first.
+func (w *bitWriter) writeBits(v uint64, nbits uint8) {
+	for i := int(nbits) - 1; i >= 0; i-- {
+		w.writeBit(v&(1<<uint(i)) != 0)
+	}
+}
+
+// bytes returns the written bits, the unused bits of the last byte are zero.
+func (w *bitWriter) bytes() []byte {
+	return w.data
+}
+
+// bitReader reads bits from a byte slice, most significant bit first.
+type bitReader struct {
+	data []byte
+	// pos is the index of the next bit to read.
+	pos uint64
+}
+
+func newBitReader(data []byte) *bitReader {
+	return &bitReader{data: data}
+}
+
+// readBit returns the next bit, or io.EOF when all bits were read.
+func (r *bitReader) readBit() (bool, error) {
+	if r.pos >= uint64(len(r.data))*8 {
+		return false, io.EOF
+	}
+	b := r.data[r.pos/8]&(1<<(7-r.pos%8)) != 0
+	r.pos++
+	return b, nil
+}
+
+// readBits returns the next nbits bits as the low bits of an integer.
+func (r *bitReader) readBits(nbits uint8) (uint64, error) {
+	var v uint64
+	for i := uint8(0); i < nbits; i++ {
+		b, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		v <<= 1
+		if b {
+			v |= 1
+		}
+	}
+	return v, nil
+}
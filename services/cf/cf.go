@@ -1 +1,97 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package cf builds the compact block filters served to light clients.
+//
+// A basic filter of a block is a Golomb-coded set of every script created by
+// the outputs of the block and every script spent by its inputs.  The filters
+// are committed to by filter headers which are chained in the DAG order of the
+// blocks:
+//
+//	header(order) = DoubleHashH(filterHash(order) || header(order-1))
+//
+// where the header before the genesis block is the zero hash.
 package cf
+
+import (
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/engine/txscript"
+)
+
+const (
+	// DefaultP is the default collision probability (2^-19).
+	DefaultP = 19
+
+	// DefaultM is the default value used for the hash range.
+	DefaultM uint64 = 784931
+)
+
+// DeriveKey derives the SipHash key of the filter of a block from the first
+// KeySize bytes of its hash.
+func DeriveKey(blockHash *hash.Hash) [KeySize]byte {
+	var key [KeySize]byte
+	copy(key[:], blockHash[:KeySize])
+	return key
+}
+
+// BuildBasicFilter builds a basic filter from a block and the scripts of the
+// outputs spent by it.  Scripts that are empty or start with OP_RETURN are not
+// included, since they can't be spent, and duplicate scripts are only
+// included once.
+func BuildBasicFilter(block *types.SerializedBlock, prevOutScripts [][]byte) (*Filter, error) {
+	blockHash := block.Hash()
+	key := DeriveKey(blockHash)
+
+	items := make(map[string]struct{})
+	addScript := func(script []byte) {
+		if len(script) == 0 || script[0] == txscript.OP_RETURN {
+			return
+		}
+		items[string(script)] = struct{}{}
+	}
+	for _, tx := range block.Transactions() {
+		if tx.IsDuplicate {
+			continue
+		}
+		for _, txOut := range tx.Transaction().TxOut {
+			addScript(txOut.PkScript)
+		}
+	}
+	for _, script := range prevOutScripts {
+		addScript(script)
+	}
+
+	data := make([][]byte, 0, len(items))
+	for item := range items {
+		data = append(data, []byte(item))
+	}
+	return BuildGCSFilter(DefaultP, DefaultM, key, data)
+}
+
+// FromBasicFilterBytes deserializes a basic filter as returned by NBytes().
+func FromBasicFilterBytes(d []byte) (*Filter, error) {
+	return FromNBytes(DefaultP, DefaultM, d)
+}
+
+// FilterHash returns the hash of a serialized filter.
+func FilterHash(filterBytes []byte) hash.Hash {
+	return hash.DoubleHashH(filterBytes)
+}
+
+// MakeHeaderForFilter makes the filter header of a serialized filter from the
+// filter header of the block ordered before it.
+func MakeHeaderForFilter(filterBytes []byte, prevHeader *hash.Hash) hash.Hash {
+	filterHash := FilterHash(filterBytes)
+	return MakeHeaderForHash(&filterHash, prevHeader)
+}
+
+// MakeHeaderForHash makes the filter header of a filter hash from the filter
+// header of the block ordered before it.
+func MakeHeaderForHash(filterHash *hash.Hash, prevHeader *hash.Hash) hash.Hash {
+	var data [2 * hash.HashSize]byte
+	copy(data[:hash.HashSize], filterHash[:])
+	copy(data[hash.HashSize:], prevHeader[:])
+	return hash.DoubleHashH(data[:])
+}
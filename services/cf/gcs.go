@@ -0,0 +1,288 @@
+// Copyright (c) 2016-2017 The btcsuite developers
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package cf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/serialization"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+const (
+	// KeySize is the size of the byte array required for key material for
+	// the SipHash keyed hash function.
+	KeySize = 16
+
+	// varIntProtoVer is the protocol version used for the var int of the
+	// number of items in the serialized filter.
+	varIntProtoVer uint32 = 0
+)
+
+var (
+	// ErrNTooBig signifies that the filter can't handle N items.
+	ErrNTooBig = fmt.Errorf("N is too big to fit in uint32")
+
+	// ErrPTooBig signifies that the filter can't handle `1/2**P`
+	// collision probability.
+	ErrPTooBig = fmt.Errorf("P is too big to fit in uint32")
+)
+
+// Filter describes an immutable filter that can be built from a set of data
+// elements, serialized, deserialized, and queried in a thread-safe manner.
+// The elements are hashed into the range [0, N*M) and the sorted differences
+// between them are stored with Golomb-Rice coding using P bits for the
+// remainder.
+type Filter struct {
+	n          uint32
+	p          uint8
+	modulusNM  uint64
+	filterData []byte
+}
+
+// BuildGCSFilter builds a new GCS filter with the collision probability of
+// `1/(2**P)`, the false positive rate of `1/M`, key `key`, and including every
+// `[]byte` in `data` as a member of the set.
+func BuildGCSFilter(P uint8, M uint64, key [KeySize]byte, data [][]byte) (*Filter, error) {
+	// Some initial parameter checks: make sure we have data from which to
+	// build the filter, and make sure our parameters will fit the hash
+	// function we're using.
+	if uint64(len(data)) >= (1 << 32) {
+		return nil, ErrNTooBig
+	}
+	if P > 32 {
+		return nil, ErrPTooBig
+	}
+
+	f := Filter{
+		n: uint32(len(data)),
+		p: P,
+	}
+
+	// The hashed items are mapped into the range [0, N*M).
+	f.modulusNM = uint64(f.n) * M
+
+	// Shortcut if the filter is empty.
+	if f.n == 0 {
+		return &f, nil
+	}
+
+	// Build the filter.
+	values := make([]uint64, 0, len(data))
+	k0 := binary.LittleEndian.Uint64(key[0:8])
+	k1 := binary.LittleEndian.Uint64(key[8:16])
+	for _, d := range data {
+		// For each datum, we assign the initial hash to a uint64.
+		v := hash.SipHash(k0, k1, d)
+		values = append(values, fastReduction(v, f.modulusNM))
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	// Write the sorted list of values into the filter bitstream,
+	// compressing it using Golomb coding.
+	var w bitWriter
+	var lastValue uint64
+	for _, v := range values {
+		// Calculate the difference between this value and the last,
+		// modulo P.
+		remainder := (v - lastValue) & ((uint64(1) << f.p) - 1)
+
+		// Calculate the difference between this value and the last,
+		// divided by P.
+		quotient := (v - lastValue) >> f.p
+		lastValue = v
+
+		// Write the P multiple into the bitstream in unary; the
+		// average should be around 1 (2 bits - 0b10).
+		for quotient > 0 {
+			w.writeBit(true)
+			quotient--
+		}
+		w.writeBit(false)
+
+		// Write the remainder as a big-endian integer with enough bits
+		// to represent the appropriate collision probability.
+		w.writeBits(remainder, f.p)
+	}
+
+	// Copy the bitstream into the filter object and return the object.
+	f.filterData = w.bytes()
+
+	return &f, nil
+}
+
+// FromBytes deserializes a GCS filter from a known N, P, and serialized filter
+// as returned by Bytes().
+func FromBytes(N uint32, P uint8, M uint64, d []byte) (*Filter, error) {
+	// Basic sanity check.
+	if P > 32 {
+		return nil, ErrPTooBig
+	}
+
+	// Create the filter object and insert metadata.
+	f := &Filter{
+		n:         N,
+		p:         P,
+		modulusNM: uint64(N) * M,
+	}
+
+	// Copy the filter.
+	f.filterData = make([]byte, len(d))
+	copy(f.filterData, d)
+
+	return f, nil
+}
+
+// FromNBytes deserializes a GCS filter from a known P, and serialized N and
+// filter as returned by NBytes().
+func FromNBytes(P uint8, M uint64, d []byte) (*Filter, error) {
+	buffer := bytes.NewBuffer(d)
+	N, err := serialization.ReadVarInt(buffer, varIntProtoVer)
+	if err != nil {
+		return nil, err
+	}
+	if N >= (1 << 32) {
+		return nil, ErrNTooBig
+	}
+	return FromBytes(uint32(N), P, M, buffer.Bytes())
+}
+
+// Bytes returns the serialized format of the GCS filter, which does not
+// include N or P (returned by separate methods) or the key used by SipHash.
+func (f *Filter) Bytes() []byte {
+	filterData := make([]byte, len(f.filterData))
+	copy(filterData, f.filterData)
+	return filterData
+}
+
+// NBytes returns the serialized format of the GCS filter with N, which does
+// not include P (returned by a separate method) or the key used by SipHash.
+func (f *Filter) NBytes() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.Grow(serialization.VarIntSerializeSize(uint64(f.n)) + len(f.filterData))
+
+	err := serialization.WriteVarInt(&buffer, varIntProtoVer, uint64(f.n))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = buffer.Write(f.filterData)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// P returns the filter's collision probability as a negative power of 2 (that
+// is, a collision probability of `1/2**20` is represented as 20).
+func (f *Filter) P() uint8 {
+	return f.p
+}
+
+// N returns the size of the data set used to build the filter.
+func (f *Filter) N() uint32 {
+	return f.n
+}
+
+// Match checks whether a []byte value is likely (within collision probability)
+// to be a member of the set represented by the filter.
+func (f *Filter) Match(key [KeySize]byte, data []byte) (bool, error) {
+	return f.MatchAny(key, [][]byte{data})
+}
+
+// MatchAny checks whether any []byte value is likely (within collision
+// probability) to be a member of the set represented by the filter faster than
+// calling Match() for each value individually.
+func (f *Filter) MatchAny(key [KeySize]byte, data [][]byte) (bool, error) {
+	// Basic sanity check.
+	if len(data) == 0 || f.n == 0 {
+		return false, nil
+	}
+
+	// Create an uncompressed filter of the search values.
+	values := make([]uint64, 0, len(data))
+	k0 := binary.LittleEndian.Uint64(key[0:8])
+	k1 := binary.LittleEndian.Uint64(key[8:16])
+	for _, d := range data {
+		v := hash.SipHash(k0, k1, d)
+		values = append(values, fastReduction(v, f.modulusNM))
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	// Zip down the filters, comparing values until we either run out of
+	// values to compare in one of the filters or we reach a matching
+	// value.
+	r := newBitReader(f.filterData)
+	var lastValue uint64
+	for i := uint32(0); i < f.n; i++ {
+		delta, err := f.readFullUint64(r)
+		if err != nil {
+			if err == io.EOF {
+				return false, nil
+			}
+			return false, err
+		}
+		lastValue += delta
+
+		for len(values) > 0 && values[0] < lastValue {
+			values = values[1:]
+		}
+		if len(values) == 0 {
+			return false, nil
+		}
+		if values[0] == lastValue {
+			return true, nil
+		}
+	}
+
+	// If we've made it this far, no element matched.
+	return false, nil
+}
+
+// readFullUint64 reads a value represented by the sum of a unary multiple of
+// the filter's P modulus (`2**P`) and a big-endian P-bit remainder.
+func (f *Filter) readFullUint64(r *bitReader) (uint64, error) {
+	var quotient uint64
+
+	// Count the 1s until we reach a 0.
+	for {
+		b, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if !b {
+			break
+		}
+		quotient++
+		if quotient > math.MaxUint32 {
+			return 0, fmt.Errorf("malformed filter")
+		}
+	}
+
+	// Read P bits.
+	remainder, err := r.readBits(f.p)
+	if err != nil {
+		return 0, err
+	}
+
+	// Add the multiple and the remainder.
+	v := (quotient << f.p) + remainder
+	return v, nil
+}
+
+// fastReduction calculates a mapping that's more or less equivalent to: x mod
+// N. However, instead of using a mod operation, which can be expensive, this
+// function uses the high bits of the 128 bit product of x and N.
+func fastReduction(v, nTimesM uint64) uint64 {
+	hi, _ := bits.Mul64(v, nTimesM)
+	return hi
+}
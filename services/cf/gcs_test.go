@@ -0,0 +1,133 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package cf
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/Qitmeer/qitmeer/common/hash"
+)
+
+func randomItems(r *rand.Rand, n int) [][]byte {
+	items := make([][]byte, n)
+	for i := range items {
+		items[i] = make([]byte, 20+r.Intn(20))
+		r.Read(items[i])
+	}
+	return items
+}
+
+func TestFilterMatch(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var key [KeySize]byte
+	r.Read(key[:])
+	items := randomItems(r, 500)
+
+	filter, err := BuildGCSFilter(DefaultP, DefaultM, key, items)
+	if err != nil {
+		t.Fatalf("BuildGCSFilter: %v", err)
+	}
+	if filter.N() != uint32(len(items)) || filter.P() != DefaultP {
+		t.Fatalf("unexpected filter params N=%d P=%d", filter.N(), filter.P())
+	}
+
+	for i, item := range items {
+		match, err := filter.Match(key, item)
+		if err != nil {
+			t.Fatalf("Match: %v", err)
+		}
+		if !match {
+			t.Fatalf("item %d not matched", i)
+		}
+	}
+
+	// With a false positive rate of 1/M, none of the unrelated items
+	// should be matched.
+	others := randomItems(r, 100)
+	for _, item := range others {
+		match, err := filter.Match(key, item)
+		if err != nil {
+			t.Fatalf("Match: %v", err)
+		}
+		if match {
+			t.Fatalf("unexpected match of %x", item)
+		}
+	}
+	match, err := filter.MatchAny(key, others)
+	if err != nil || match {
+		t.Fatalf("MatchAny of unrelated items: %v %v", match, err)
+	}
+	match, err = filter.MatchAny(key, append(others, items[123]))
+	if err != nil || !match {
+		t.Fatalf("MatchAny with a member: %v %v", match, err)
+	}
+
+	// A different key must not match the members.
+	var otherKey [KeySize]byte
+	r.Read(otherKey[:])
+	match, err = filter.MatchAny(otherKey, items[:10])
+	if err != nil || match {
+		t.Fatalf("MatchAny with another key: %v %v", match, err)
+	}
+}
+
+func TestFilterSerialization(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	var key [KeySize]byte
+	r.Read(key[:])
+	items := randomItems(r, 100)
+
+	filter, err := BuildGCSFilter(DefaultP, DefaultM, key, items)
+	if err != nil {
+		t.Fatalf("BuildGCSFilter: %v", err)
+	}
+	nBytes, err := filter.NBytes()
+	if err != nil {
+		t.Fatalf("NBytes: %v", err)
+	}
+	filter2, err := FromBasicFilterBytes(nBytes)
+	if err != nil {
+		t.Fatalf("FromBasicFilterBytes: %v", err)
+	}
+	if filter2.N() != filter.N() || !bytes.Equal(filter2.Bytes(), filter.Bytes()) {
+		t.Fatalf("filter changed by the serialization")
+	}
+	match, err := filter2.MatchAny(key, items[50:51])
+	if err != nil || !match {
+		t.Fatalf("deserialized filter does not match: %v %v", match, err)
+	}
+
+	// An empty filter matches nothing.
+	empty, err := BuildGCSFilter(DefaultP, DefaultM, key, nil)
+	if err != nil {
+		t.Fatalf("BuildGCSFilter: %v", err)
+	}
+	nBytes, err = empty.NBytes()
+	if err != nil {
+		t.Fatalf("NBytes: %v", err)
+	}
+	if !bytes.Equal(nBytes, []byte{0}) {
+		t.Fatalf("unexpected empty filter bytes %x", nBytes)
+	}
+	match, err = empty.MatchAny(key, items)
+	if err != nil || match {
+		t.Fatalf("empty filter matches: %v %v", match, err)
+	}
+}
+
+func TestFilterHeaderChain(t *testing.T) {
+	var zero hash.Hash
+	h1 := MakeHeaderForFilter([]byte{0}, &zero)
+	h2 := MakeHeaderForFilter([]byte{0}, &h1)
+	if h1.IsEqual(&h2) {
+		t.Fatalf("header does not commit to the previous header")
+	}
+	filterHash := FilterHash([]byte{0})
+	if h := MakeHeaderForHash(&filterHash, &h1); !h.IsEqual(&h2) {
+		t.Fatalf("MakeHeaderForHash mismatch: %v != %v", h, h2)
+	}
+}
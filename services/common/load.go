@@ -10,6 +10,7 @@ import (
 	"github.com/Qitmeer/qitmeer/config"
 	"github.com/Qitmeer/qitmeer/core/address"
 	"github.com/Qitmeer/qitmeer/log"
+	"github.com/Qitmeer/qitmeer/metrics"
 	"github.com/Qitmeer/qitmeer/p2p/peer"
 	"github.com/Qitmeer/qitmeer/params"
 	"github.com/Qitmeer/qitmeer/services/mempool"
@@ -33,11 +34,15 @@ const (
 	defaultBlockMinSize           = 0
 	defaultBlockMaxSize           = 375000
 	defaultMaxRPCClients          = 10
+	defaultMaxRPCWebsockets       = 25
 	defaultMaxPeers               = 125
 	defaultMiningStateSync        = false
 	defaultMaxInboundPeersPerHost = 10 // The default max total of inbound peer for host
 	defaultTrickleInterval        = peer.TrickleTimeout
 	defaultCacheInvalidTx         = false
+	minPruneTargetMiB             = 550
+	minDAGCacheWindow             = 1000
+	defaultStratumDiff            = 1
 )
 const (
 	defaultSigCacheMaxSize = 100000
@@ -73,9 +78,11 @@ func LoadConfig() (*config.Config, []string, error) {
 		RPCKey:            defaultRPCKeyFile,
 		RPCCert:           defaultRPCCertFile,
 		RPCMaxClients:     defaultMaxRPCClients,
+		RPCMaxWebsockets:  defaultMaxRPCWebsockets,
 		Generate:          defaultGenerate,
 		MaxPeers:          defaultMaxPeers,
 		MinTxFee:          mempool.DefaultMinRelayTxFee,
+		MaxMempool:        mempool.DefaultMaxPoolSize,
 		BlockMinSize:      defaultBlockMinSize,
 		BlockMaxSize:      defaultBlockMaxSize,
 		SigCacheMaxSize:   defaultSigCacheMaxSize,
@@ -85,6 +92,7 @@ func LoadConfig() (*config.Config, []string, error) {
 		MaxInbound:        defaultMaxInboundPeersPerHost,
 		TrickleInterval:   defaultTrickleInterval,
 		CacheInvalidTx:    defaultCacheInvalidTx,
+		StratumDiff:       defaultStratumDiff,
 	}
 
 	// Pre-parse the command line options to see if an alternative config
@@ -243,6 +251,12 @@ func LoadConfig() (*config.Config, []string, error) {
 		params.ActiveNetParams.Params.DefaultPort = cfg.DefaultPort
 	}
 
+	// Don't listen by default when connecting through a proxy, so that the
+	// node can't be reached outside of it.
+	if cfg.Proxy != "" && len(cfg.Listeners) == 0 {
+		cfg.DisableListen = true
+	}
+
 	// Add the default listener if none were specified. The default
 	// listener is all addresses on the listen port for the network
 	// we are to connect to.
@@ -321,6 +335,132 @@ func LoadConfig() (*config.Config, []string, error) {
 		return nil, nil, err
 	}
 
+	// --prune may not keep too few blocks.
+	if cfg.Prune > 0 && cfg.Prune < minPruneTargetMiB {
+		err := fmt.Errorf("%s: the --prune option must be at least "+
+			"%d MiB", funcName, minPruneTargetMiB)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --dagcachewindow has to be deeper than any reorganization.
+	if cfg.DAGCacheWindow > 0 && cfg.DAGCacheWindow < minDAGCacheWindow {
+		err := fmt.Errorf("%s: the --dagcachewindow option must be at "+
+			"least %d layers", funcName, minDAGCacheWindow)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --dagcachewindow is only supported by the phantom DAG.  The other
+	// ones, phantom_v2 included, keep their own state of every block in
+	// memory and can't load the evicted blocks back.
+	if cfg.DAGCacheWindow > 0 && cfg.DAGType != defaultDAGType {
+		err := fmt.Errorf("%s: the --dagcachewindow option is only "+
+			"supported by the %s DAG, not by the %s one", funcName,
+			defaultDAGType, cfg.DAGType)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --prune and --addrindex do not mix.
+	if cfg.Prune > 0 && cfg.AddrIndex {
+		err := fmt.Errorf("%s: the --prune and --addrindex options may "+
+			"not be activated at the same time because the address "+
+			"index reads the transactions of the old blocks",
+			funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --prune and --light do not mix.
+	if cfg.Prune > 0 && cfg.LightNode {
+		err := fmt.Errorf("%s: the --prune and --light options may not "+
+			"be activated at the same time", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --cfindex and --dropcfindex do not mix.
+	if cfg.CfIndex && cfg.DropCfIndex {
+		err := fmt.Errorf("%s: the --cfindex and --dropcfindex "+
+			"options may not be activated at the same time",
+			funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The metrics collection is enabled from the command line before the
+	// configuration is loaded, so it can't be enabled by the config file.
+	if cfg.MetricsListen != "" && !metrics.Enabled {
+		err := fmt.Errorf("%s: the --metricslisten option must be "+
+			"passed on the command line", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --spendindex and --dropspendindex do not mix.
+	if cfg.SpendIndex && cfg.DropSpendIndex {
+		err := fmt.Errorf("%s: the --spendindex and --dropspendindex "+
+			"options may not be activated at the same time",
+			funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The proxies must be addresses in the host:port form.
+	for _, proxy := range []struct{ name, addr string }{
+		{"proxy", cfg.Proxy}, {"onion", cfg.OnionProxy}} {
+
+		if proxy.addr == "" {
+			continue
+		}
+		_, _, err := net.SplitHostPort(proxy.addr)
+		if err != nil {
+			str := "%s: the --%s option '%s' is not a valid " +
+				"address: %v"
+			err := fmt.Errorf(str, funcName, proxy.name, proxy.addr, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
+	// --onion and --noonion do not mix.
+	if cfg.OnionProxy != "" && cfg.NoOnion {
+		err := fmt.Errorf("%s: the --onion and --noonion options may "+
+			"not be activated at the same time", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Stream isolation needs a proxy to isolate the streams in.
+	if cfg.TorIsolation && cfg.Proxy == "" && cfg.OnionProxy == "" {
+		err := fmt.Errorf("%s: the --torisolation option requires "+
+			"the --proxy or --onion option", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// The mempool must be able to hold some transactions.
+	if cfg.MaxMempool < 1 {
+		err := fmt.Errorf("%s: the --maxmempool option must be at "+
+			"least 1 megabyte -- parsed [%d]", funcName,
+			cfg.MaxMempool)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Check mining addresses are valid and saved parsed versions.
 	for _, strAddr := range cfg.MiningAddrs {
 		addr, err := address.DecodeAddress(strAddr)
@@ -384,6 +524,33 @@ func LoadConfig() (*config.Config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Ensure there is at least one mining address when the stratum server
+	// is enabled, solved blocks pay to those addresses.
+	if cfg.Stratum != "" {
+		if len(cfg.MiningAddrs) == 0 {
+			str := "%s: the stratum option is set, but there are no mining " +
+				"addresses specified "
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if _, _, err := net.SplitHostPort(cfg.Stratum); err != nil {
+			str := "%s: the stratum listen address '%s' is invalid: %v"
+			err := fmt.Errorf(str, funcName, cfg.Stratum, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if cfg.StratumDiff == 0 {
+			str := "%s: the stratumdiff option may not be 0"
+			err := fmt.Errorf(str, funcName)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
 	// Warn about missing config file only after all other configuration is
 	// done.  This prevents the warning on help messages and invalid
 	// options.  Note this should go directly before the return.
@@ -0,0 +1,281 @@
+// Copyright (c) 2017 The btcsuite developers
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package index
+
+import (
+	"errors"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/blockchain"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/database"
+	"github.com/Qitmeer/qitmeer/services/cf"
+	"math"
+)
+
+const (
+	// cfIndexName is the human-readable name for the index.
+	cfIndexName = "committed filter index"
+)
+
+var (
+	// cfIndexParentBucketKey is the name of the parent bucket used to
+	// house the index.  The rest of the buckets live below this bucket.
+	cfIndexParentBucketKey = []byte("cfindexparentbucket")
+
+	// cfFilterBucketName is the name of the db bucket used to house the
+	// block hash -> serialized basic filter index.
+	cfFilterBucketName = []byte("cf0byhashidx")
+
+	// cfFilterHashBucketName is the name of the db bucket used to house
+	// the block hash -> basic filter hash index.
+	cfFilterHashBucketName = []byte("cf0hashbyhashidx")
+
+	// cfHeaderBucketName is the name of the db bucket used to house the
+	// block hash -> basic filter header index.
+	cfHeaderBucketName = []byte("cf0headerbyhashidx")
+
+	// errNoCfEntry is an error that indicates a requested entry does not
+	// exist in the committed filter index.
+	errNoCfEntry = errors.New("no entry in the committed filter index")
+)
+
+// -----------------------------------------------------------------------------
+// The committed filter index consists of three buckets below the parent
+// bucket, all of them keyed by the hash of the block:
+//
+//   cf0byhashidx:       <block hash> -> <serialized basic filter>
+//   cf0hashbyhashidx:   <block hash> -> <filter hash>
+//   cf0headerbyhashidx: <block hash> -> <filter header>
+//
+// The serialized filter is the number of items as a varint followed by the
+// Golomb-coded set (see cf.Filter.NBytes).  The filter header of a block
+// commits to its filter hash and to the filter header of the block ordered
+// just before it in the DAG, so the headers of all of the blocks form a chain
+// following the DAG order.  The block with order 0 uses the zero hash as the
+// previous header.
+// -----------------------------------------------------------------------------
+
+// dbFetchCfEntry retrieves an entry of the committed filter index from one of
+// the buckets.  errNoCfEntry is returned when there is no entry.
+func dbFetchCfEntry(dbTx database.Tx, bucketName []byte, h *hash.Hash) ([]byte, error) {
+	bucket := dbTx.Metadata().Bucket(cfIndexParentBucketKey).Bucket(bucketName)
+	entry := bucket.Get(h[:])
+	if entry == nil {
+		return nil, errNoCfEntry
+	}
+	// The returned slice is only valid during the transaction.
+	return append([]byte(nil), entry...), nil
+}
+
+// dbPutCfEntry stores an entry of the committed filter index in one of the
+// buckets.
+func dbPutCfEntry(dbTx database.Tx, bucketName []byte, h *hash.Hash, entry []byte) error {
+	bucket := dbTx.Metadata().Bucket(cfIndexParentBucketKey).Bucket(bucketName)
+	return bucket.Put(h[:], entry)
+}
+
+// dbDeleteCfEntry removes an entry of the committed filter index from one of
+// the buckets.
+func dbDeleteCfEntry(dbTx database.Tx, bucketName []byte, h *hash.Hash) error {
+	bucket := dbTx.Metadata().Bucket(cfIndexParentBucketKey).Bucket(bucketName)
+	return bucket.Delete(h[:])
+}
+
+// CfIndex implements a committed filter (cf) by hash index.
+type CfIndex struct {
+	db database.DB
+}
+
+// Ensure the CfIndex type implements the Indexer interface.
+var _ Indexer = (*CfIndex)(nil)
+
+// Ensure the CfIndex type implements the NeedsInputser interface.
+var _ NeedsInputser = (*CfIndex)(nil)
+
+// NeedsInputs signals that the index requires the referenced inputs in order
+// to properly create the index.
+//
+// This implements the NeedsInputser interface.
+func (idx *CfIndex) NeedsInputs() bool {
+	return true
+}
+
+// Init initializes the hash-based cf index. This is part of the Indexer
+// interface.
+func (idx *CfIndex) Init() error {
+	// Nothing to do.
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice. This is
+// part of the Indexer interface.
+func (idx *CfIndex) Key() []byte {
+	return cfIndexParentBucketKey
+}
+
+// Name returns the human-readable name of the index. This is part of the
+// Indexer interface.
+func (idx *CfIndex) Name() string {
+	return cfIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs to
+// be created for the first time. It creates the buckets for the filters,
+// filter hashes and filter headers.
+//
+// This is part of the Indexer interface.
+func (idx *CfIndex) Create(dbTx database.Tx) error {
+	meta := dbTx.Metadata()
+	cfIndexParentBucket, err := meta.CreateBucket(cfIndexParentBucketKey)
+	if err != nil {
+		return err
+	}
+	for _, bucketName := range [][]byte{cfFilterBucketName,
+		cfFilterHashBucketName, cfHeaderBucketName} {
+		if _, err := cfIndexParentBucket.CreateBucket(bucketName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain. This indexer adds the basic filter of the
+// block and chains its filter header to the one of the current index tip,
+// which is the block ordered just before it.
+//
+// This is part of the Indexer interface.
+func (idx *CfIndex) ConnectBlock(dbTx database.Tx, block *types.SerializedBlock, stxos []blockchain.SpentTxOut) error {
+	prevScripts := make([][]byte, 0, len(stxos))
+	for _, stxo := range stxos {
+		prevScripts = append(prevScripts, stxo.PkScript)
+	}
+	filter, err := cf.BuildBasicFilter(block, prevScripts)
+	if err != nil {
+		return err
+	}
+	filterBytes, err := filter.NBytes()
+	if err != nil {
+		return err
+	}
+
+	// The index tip isn't updated until this block is connected, so it
+	// still refers to the previous block in the DAG order.
+	prevHeader := hash.ZeroHash
+	tipHash, tipOrder, err := dbFetchIndexerTip(dbTx, idx.Key())
+	if err != nil {
+		return err
+	}
+	if tipOrder != math.MaxUint32 {
+		header, err := dbFetchCfEntry(dbTx, cfHeaderBucketName, tipHash)
+		if err != nil {
+			return err
+		}
+		copy(prevHeader[:], header)
+	}
+
+	blockHash := block.Hash()
+	filterHash := cf.FilterHash(filterBytes)
+	filterHeader := cf.MakeHeaderForHash(&filterHash, &prevHeader)
+	if err := dbPutCfEntry(dbTx, cfFilterBucketName, blockHash, filterBytes); err != nil {
+		return err
+	}
+	if err := dbPutCfEntry(dbTx, cfFilterHashBucketName, blockHash, filterHash[:]); err != nil {
+		return err
+	}
+	return dbPutCfEntry(dbTx, cfHeaderBucketName, blockHash, filterHeader[:])
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer removes the filter, the
+// filter hash and the filter header of the block.
+//
+// This is part of the Indexer interface.
+func (idx *CfIndex) DisconnectBlock(dbTx database.Tx, block *types.SerializedBlock, stxos []blockchain.SpentTxOut) error {
+	blockHash := block.Hash()
+	for _, bucketName := range [][]byte{cfFilterBucketName,
+		cfFilterHashBucketName, cfHeaderBucketName} {
+		if err := dbDeleteCfEntry(dbTx, bucketName, blockHash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entryByBlockHash returns an entry of the committed filter index of the
+// block.  nil is returned for both the entry and the error when the block is
+// not indexed.
+func (idx *CfIndex) entryByBlockHash(bucketName []byte, h *hash.Hash) ([]byte, error) {
+	var entry []byte
+	err := idx.db.View(func(dbTx database.Tx) error {
+		var err error
+		entry, err = dbFetchCfEntry(dbTx, bucketName, h)
+		return err
+	})
+	if err == errNoCfEntry {
+		return nil, nil
+	}
+	return entry, err
+}
+
+// FilterByBlockHash returns the serialized basic filter of the block.
+//
+// This function is safe for concurrent access.
+func (idx *CfIndex) FilterByBlockHash(h *hash.Hash) ([]byte, error) {
+	return idx.entryByBlockHash(cfFilterBucketName, h)
+}
+
+// FilterHashByBlockHash returns the hash of the basic filter of the block.
+//
+// This function is safe for concurrent access.
+func (idx *CfIndex) FilterHashByBlockHash(h *hash.Hash) ([]byte, error) {
+	return idx.entryByBlockHash(cfFilterHashBucketName, h)
+}
+
+// FilterHeaderByBlockHash returns the basic filter header of the block.
+//
+// This function is safe for concurrent access.
+func (idx *CfIndex) FilterHeaderByBlockHash(h *hash.Hash) ([]byte, error) {
+	return idx.entryByBlockHash(cfHeaderBucketName, h)
+}
+
+// FilterHashesByBlockHashes returns the hashes of the basic filters of the
+// blocks.  The entry of a block which isn't indexed is nil.
+//
+// This function is safe for concurrent access.
+func (idx *CfIndex) FilterHashesByBlockHashes(hashes []*hash.Hash) ([][]byte, error) {
+	entries := make([][]byte, len(hashes))
+	err := idx.db.View(func(dbTx database.Tx) error {
+		for i, h := range hashes {
+			entry, err := dbFetchCfEntry(dbTx, cfFilterHashBucketName, h)
+			if err == errNoCfEntry {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			entries[i] = entry
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// NewCfIndex returns a new instance of an indexer that is used to create a
+// mapping of the hashes of all blocks in the DAG to their compact filters,
+// filter hashes and filter headers.
+//
+// It implements the Indexer interface which plugs into the IndexManager that
+// in turn is used by the blockchain package. This allows the index to be
+// seamlessly maintained along with the chain.
+func NewCfIndex(db database.DB) *CfIndex {
+	return &CfIndex{db: db}
+}
+
+// DropCfIndex drops the CF index from the provided database if it exists.
+func DropCfIndex(db database.DB, interrupt <-chan struct{}) error {
+	return dropIndex(db, cfIndexParentBucketKey, cfIndexName, interrupt)
+}
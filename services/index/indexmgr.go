@@ -216,6 +216,10 @@ func (m *Manager) Init(chain *blockchain.BlockChain, interrupt <-chan struct{})
 			// Load the block for the height since it is required to index
 			// it.
 			block, err = blockchain.DBFetchBlockByOrder(dbTx, uint64(order))
+			if database.IsError(err, database.ErrBlockPruned) {
+				return fmt.Errorf("the indexes can't be caught up "+
+					"because the block of order %d has been pruned", order)
+			}
 			if err != nil {
 				return err
 			}
@@ -416,6 +420,9 @@ func DBFetchTx(dbTx database.Tx, hash *hash.Hash) (*types.Transaction, error) {
 
 	// Load the raw transaction bytes from the database.
 	txBytes, err := dbTx.FetchBlockRegion(blockRegion)
+	if database.IsError(err, database.ErrBlockPruned) {
+		return nil, fmt.Errorf("transaction %v is in the pruned block %v", hash, blockRegion.Hash)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -442,6 +449,9 @@ func DBFetchTxAndBlock(dbTx database.Tx, hash *hash.Hash) (*types.Transaction, *
 
 	// Load the raw transaction bytes from the database.
 	txBytes, err := dbTx.FetchBlockRegion(blockRegion)
+	if database.IsError(err, database.ErrBlockPruned) {
+		return nil, nil, fmt.Errorf("transaction %v is in the pruned block %v", hash, blockRegion.Hash)
+	}
 	if err != nil {
 		return nil, nil, err
 	}
@@ -0,0 +1,266 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package index
+
+import (
+	"errors"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/blockchain"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/database"
+)
+
+const (
+	// spendIndexName is the human-readable name for the index.
+	spendIndexName = "spend index"
+
+	// outpointKeySize is the size of the key of a spend index entry.
+	outpointKeySize = hash.HashSize + 4
+
+	// spendEntrySize is the size of the value of a spend index entry.
+	spendEntrySize = hash.HashSize + 4 + hash.HashSize
+)
+
+var (
+	// spendIndexKey is the key of the spend index and the db bucket used
+	// to house it.
+	spendIndexKey = []byte("spendbyoutpointidx")
+
+	// errNoSpendEntry is an error that indicates a requested entry does
+	// not exist in the spend index.
+	errNoSpendEntry = errors.New("no entry in the spend index")
+)
+
+// -----------------------------------------------------------------------------
+// The spend index maps every outpoint spent by a block connected in the DAG
+// order to the transaction input spending it.  Only the spends recorded in the
+// spend journal of the block are indexed, so the transactions of the block
+// which are ignored by the DAG don't show up in the index.
+//
+// The serialized format for keys and values in the bucket is:
+//
+//   <txid><index> = <spending txid><input index><block hash>
+//
+//   Field           Type              Size
+//   txid            hash.Hash         32 bytes
+//   index           uint32            4 bytes
+//   spending txid   hash.Hash         32 bytes
+//   input index     uint32            4 bytes
+//   block hash      hash.Hash         32 bytes
+//   -----
+//   Total: 104 bytes
+// -----------------------------------------------------------------------------
+
+// SpendEntry describes the transaction input which spent an outpoint.
+type SpendEntry struct {
+	// TxId is the id of the spending transaction.
+	TxId hash.Hash
+
+	// InIndex is the index of the input spending the outpoint.
+	InIndex uint32
+
+	// BlockHash is the hash of the block containing the spending
+	// transaction.
+	BlockHash hash.Hash
+}
+
+// outpointKey returns the key of the spend index entry of the outpoint.
+func outpointKey(outpoint *types.TxOutPoint) []byte {
+	key := make([]byte, outpointKeySize)
+	copy(key, outpoint.Hash[:])
+	byteOrder.PutUint32(key[hash.HashSize:], outpoint.OutIndex)
+	return key
+}
+
+// serializeSpendEntry returns the serialized value of a spend index entry.
+func serializeSpendEntry(entry *SpendEntry) []byte {
+	serialized := make([]byte, spendEntrySize)
+	copy(serialized, entry.TxId[:])
+	byteOrder.PutUint32(serialized[hash.HashSize:], entry.InIndex)
+	copy(serialized[hash.HashSize+4:], entry.BlockHash[:])
+	return serialized
+}
+
+// deserializeSpendEntry decodes the value of a spend index entry.
+func deserializeSpendEntry(serialized []byte) (*SpendEntry, error) {
+	if len(serialized) != spendEntrySize {
+		return nil, errDeserialize("unexpected end of data")
+	}
+	var entry SpendEntry
+	copy(entry.TxId[:], serialized)
+	entry.InIndex = byteOrder.Uint32(serialized[hash.HashSize:])
+	copy(entry.BlockHash[:], serialized[hash.HashSize+4:])
+	return &entry, nil
+}
+
+// dbFetchSpendEntry uses an existing database transaction to fetch the spend
+// index entry of the outpoint.  errNoSpendEntry is returned when there is no
+// entry.
+func dbFetchSpendEntry(dbTx database.Tx, outpoint *types.TxOutPoint) (*SpendEntry, error) {
+	serialized := dbTx.Metadata().Bucket(spendIndexKey).Get(outpointKey(outpoint))
+	if serialized == nil {
+		return nil, errNoSpendEntry
+	}
+	return deserializeSpendEntry(serialized)
+}
+
+// spentOutpoints returns the outpoints spent by the block according to its
+// spend journal along with the spend index entries of their inputs.
+func spentOutpoints(block *types.SerializedBlock, stxos []blockchain.SpentTxOut) ([]*types.TxOutPoint, []*SpendEntry) {
+	txs := block.Transactions()
+	outpoints := make([]*types.TxOutPoint, 0, len(stxos))
+	entries := make([]*SpendEntry, 0, len(stxos))
+	for _, stxo := range stxos {
+		if int(stxo.TxIndex) >= len(txs) {
+			continue
+		}
+		tx := txs[stxo.TxIndex]
+		if int(stxo.TxInIndex) >= len(tx.Tx.TxIn) {
+			continue
+		}
+		outpoints = append(outpoints, &tx.Tx.TxIn[stxo.TxInIndex].PreviousOut)
+		entries = append(entries, &SpendEntry{
+			TxId:      *tx.Hash(),
+			InIndex:   stxo.TxInIndex,
+			BlockHash: *block.Hash(),
+		})
+	}
+	return outpoints, entries
+}
+
+// SpendIndex implements an index of the spent outpoints to the transactions
+// spending them.
+type SpendIndex struct {
+	db database.DB
+}
+
+// Ensure the SpendIndex type implements the Indexer interface.
+var _ Indexer = (*SpendIndex)(nil)
+
+// Ensure the SpendIndex type implements the NeedsInputser interface.
+var _ NeedsInputser = (*SpendIndex)(nil)
+
+// NeedsInputs signals that the index requires the referenced inputs in order
+// to properly create the index.
+//
+// This implements the NeedsInputser interface.
+func (idx *SpendIndex) NeedsInputs() bool {
+	return true
+}
+
+// Init is only provided to satisfy the Indexer interface as there is nothing to
+// initialize for this index.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) Init() error {
+	// Nothing to do.
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) Key() []byte {
+	return spendIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) Name() string {
+	return spendIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs
+// to be created for the first time.  It creates the bucket for the spend
+// index.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) Create(dbTx database.Tx) error {
+	_, err := dbTx.Metadata().CreateBucket(spendIndexKey)
+	return err
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer adds a mapping from each outpoint
+// spent by the block to the input spending it.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) ConnectBlock(dbTx database.Tx, block *types.SerializedBlock, stxos []blockchain.SpentTxOut) error {
+	bucket := dbTx.Metadata().Bucket(spendIndexKey)
+	outpoints, entries := spentOutpoints(block, stxos)
+	for i, outpoint := range outpoints {
+		err := bucket.Put(outpointKey(outpoint), serializeSpendEntry(entries[i]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer removes the mappings of the
+// outpoints spent by the block, which become unspent again unless another
+// block spends them once it is connected in the new DAG order.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) DisconnectBlock(dbTx database.Tx, block *types.SerializedBlock, stxos []blockchain.SpentTxOut) error {
+	bucket := dbTx.Metadata().Bucket(spendIndexKey)
+	outpoints, _ := spentOutpoints(block, stxos)
+	for _, outpoint := range outpoints {
+		key := outpointKey(outpoint)
+
+		// Leave the entry alone when it was written by another block.
+		serialized := bucket.Get(key)
+		if serialized == nil {
+			continue
+		}
+		entry, err := deserializeSpendEntry(serialized)
+		if err != nil {
+			return err
+		}
+		if !entry.BlockHash.IsEqual(block.Hash()) {
+			continue
+		}
+		if err := bucket.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SpendingTx returns the spend index entry of the input which spent the
+// outpoint.  When the outpoint isn't spent by a block, nil is returned for
+// both the entry and the error.
+//
+// This function is safe for concurrent access.
+func (idx *SpendIndex) SpendingTx(outpoint *types.TxOutPoint) (*SpendEntry, error) {
+	var entry *SpendEntry
+	err := idx.db.View(func(dbTx database.Tx) error {
+		var err error
+		entry, err = dbFetchSpendEntry(dbTx, outpoint)
+		if err == errNoSpendEntry {
+			return nil
+		}
+		return err
+	})
+	return entry, err
+}
+
+// NewSpendIndex returns a new instance of an indexer that is used to create a
+// mapping of the spent outpoints to the transactions spending them.
+//
+// It implements the Indexer interface which plugs into the IndexManager that in
+// turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewSpendIndex(db database.DB) *SpendIndex {
+	return &SpendIndex{db: db}
+}
+
+// DropSpendIndex drops the spend index from the provided database if it
+// exists.
+func DropSpendIndex(db database.DB, interrupt <-chan struct{}) error {
+	return dropIndex(db, spendIndexKey, spendIndexName, interrupt)
+}
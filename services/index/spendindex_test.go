@@ -0,0 +1,141 @@
+// Copyright (c) 2017-2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/blockchain"
+	"github.com/Qitmeer/qitmeer/core/protocol"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/core/types/pow"
+	"github.com/Qitmeer/qitmeer/database"
+	_ "github.com/Qitmeer/qitmeer/database/ffldb"
+)
+
+// spendTestBlock returns a block holding a coinbase and a transaction spending
+// the outpoints.
+func spendTestBlock(timestamp int64, outpoints ...*types.TxOutPoint) *types.SerializedBlock {
+	coinbase := types.NewTransaction()
+	coinbase.AddTxIn(&types.TxInput{
+		PreviousOut: *types.NewOutPoint(&hash.Hash{}, types.MaxPrevOutIndex),
+		Sequence:    types.MaxTxInSequenceNum,
+	})
+	coinbase.AddTxOut(&types.TxOutput{Amount: 1})
+	tx := types.NewTransaction()
+	for _, outpoint := range outpoints {
+		tx.AddTxIn(&types.TxInput{PreviousOut: *outpoint, Sequence: types.MaxTxInSequenceNum})
+	}
+	tx.AddTxOut(&types.TxOutput{Amount: 1})
+	block := &types.Block{
+		Header: types.BlockHeader{
+			Timestamp: time.Unix(timestamp, 0),
+			Pow:       pow.GetInstance(pow.BLAKE2BD, 0, []byte{}),
+		},
+		Transactions: []*types.Transaction{coinbase, tx},
+	}
+	return types.NewBlock(block)
+}
+
+func TestSpendIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spendindex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := database.Create("ffldb", filepath.Join(dir, "db"), protocol.PrivNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	idx := NewSpendIndex(db)
+	if err := db.Update(idx.Create); err != nil {
+		t.Fatal(err)
+	}
+
+	x := types.NewOutPoint(&hash.Hash{1}, 0)
+	y := types.NewOutPoint(&hash.Hash{2}, 1)
+	z := types.NewOutPoint(&hash.Hash{3}, 2)
+
+	// Both blocks spend x, so the one ordered last has it out of its spend
+	// journal.
+	a := spendTestBlock(1, x, y)
+	b := spendTestBlock(2, x, z)
+	stxos := func(inputs ...uint32) []blockchain.SpentTxOut {
+		result := make([]blockchain.SpentTxOut, 0, len(inputs)+2)
+		for _, in := range inputs {
+			result = append(result, blockchain.SpentTxOut{TxIndex: 1, TxInIndex: in})
+		}
+		// Out of range entries are skipped.
+		result = append(result, blockchain.SpentTxOut{TxIndex: 2},
+			blockchain.SpentTxOut{TxIndex: 1, TxInIndex: 2})
+		return result
+	}
+	connect := func(block *types.SerializedBlock, stxos []blockchain.SpentTxOut) {
+		err := db.Update(func(dbTx database.Tx) error {
+			return idx.ConnectBlock(dbTx, block, stxos)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	disconnect := func(block *types.SerializedBlock, stxos []blockchain.SpentTxOut) {
+		err := db.Update(func(dbTx database.Tx) error {
+			return idx.DisconnectBlock(dbTx, block, stxos)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(desc string, outpoint *types.TxOutPoint, block *types.SerializedBlock, inIndex uint32) {
+		entry, err := idx.SpendingTx(outpoint)
+		if err != nil {
+			t.Fatalf("%s: %v", desc, err)
+		}
+		if block == nil {
+			if entry != nil {
+				t.Fatalf("%s: %v spent by the block %s", desc, outpoint, entry.BlockHash)
+			}
+			return
+		}
+		want := SpendEntry{TxId: *block.Transactions()[1].Hash(), InIndex: inIndex, BlockHash: *block.Hash()}
+		if entry == nil || *entry != want {
+			t.Fatalf("%s: %v spent by %v, want %v", desc, outpoint, entry, want)
+		}
+	}
+
+	// a then b.
+	connect(a, stxos(0, 1))
+	connect(b, stxos(1))
+	check("connect", x, a, 0)
+	check("connect", y, a, 1)
+	check("connect", z, b, 1)
+
+	// Both are disconnected for a reorder.
+	disconnect(b, stxos(1))
+	disconnect(a, stxos(0, 1))
+	check("disconnect", x, nil, 0)
+	check("disconnect", y, nil, 0)
+	check("disconnect", z, nil, 0)
+
+	// b then a.
+	connect(b, stxos(0, 1))
+	connect(a, stxos(1))
+	check("reconnect", x, b, 0)
+	check("reconnect", y, a, 1)
+	check("reconnect", z, b, 1)
+
+	// Disconnecting a with x in its journal leaves the spend of b alone.
+	disconnect(a, stxos(0, 1))
+	check("other block", x, b, 0)
+	check("other block", y, nil, 0)
+	check("other block", z, b, 1)
+}
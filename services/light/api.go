@@ -0,0 +1,146 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package light
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/json"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/rpc"
+)
+
+func (sm *SyncManager) API() rpc.API {
+	return rpc.API{
+		NameSpace: rpc.DefaultServiceNameSpace,
+		Service:   NewPublicLightAPI(sm),
+		Public:    true,
+	}
+}
+
+// PublicLightAPI is the reduced set of the block commands served by a light
+// node, which only knows the block headers and the watched outputs.
+type PublicLightAPI struct {
+	sm *SyncManager
+}
+
+func NewPublicLightAPI(sm *SyncManager) *PublicLightAPI {
+	return &PublicLightAPI{sm}
+}
+
+// The total synced Block count
+func (api *PublicLightAPI) GetBlockCount() (interface{}, error) {
+	return api.sm.chain.Total(), nil
+}
+
+// Return IsCurrent
+func (api *PublicLightAPI) IsCurrent() (interface{}, error) {
+	return api.sm.IsCurrent(), nil
+}
+
+// Return a list hash of the tip blocks of the DAG announced by the peers.
+func (api *PublicLightAPI) Tips() (interface{}, error) {
+	tips := []string{}
+	for _, v := range api.sm.BestGraphState().GetTips().SortList(false) {
+		tips = append(tips, v.String())
+	}
+	return tips, nil
+}
+
+func (api *PublicLightAPI) GetBlockhash(order uint) (string, error) {
+	_, blockHash, err := api.sm.chain.HeaderByOrder(order)
+	if err != nil {
+		return "", err
+	}
+	return blockHash.String(), nil
+}
+
+// GetBlockHeader implements the getblockheader command of the light node.
+func (api *PublicLightAPI) GetBlockHeader(hash hash.Hash, verbose bool) (interface{}, error) {
+	blockHeader, order, err := api.sm.chain.HeaderByHash(&hash)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), fmt.Sprintf("Block not found: %v", hash))
+	}
+	return headerResult(blockHeader, &hash, order, verbose)
+}
+
+// GetBlockByOrder returns the header of the block with the order, since the
+// light node doesn't have the block itself.
+func (api *PublicLightAPI) GetBlockByOrder(order uint64, verbose *bool) (interface{}, error) {
+	blockHeader, blockHash, err := api.sm.chain.HeaderByOrder(uint(order))
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), fmt.Sprintf("Block not found: %d", order))
+	}
+	vb := false
+	if verbose != nil {
+		vb = *verbose
+	}
+	return headerResult(blockHeader, blockHash, uint(order), vb)
+}
+
+// headerResult returns the serialized header as a hex-encoded string, or its
+// fields when the verbose flag is set.
+func headerResult(blockHeader *types.BlockHeader, h *hash.Hash, order uint, verbose bool) (interface{}, error) {
+	if !verbose {
+		var headerBuf bytes.Buffer
+		err := blockHeader.Serialize(&headerBuf)
+		if err != nil {
+			context := "Failed to serialize block header"
+			return nil, rpc.RpcInternalError(err.Error(), context)
+		}
+		return hex.EncodeToString(headerBuf.Bytes()), nil
+	}
+	return json.LightBlockHeaderResult{
+		Hash:       h.String(),
+		Order:      uint64(order),
+		Version:    int32(blockHeader.Version),
+		ParentRoot: blockHeader.ParentRoot.String(),
+		TxRoot:     blockHeader.TxRoot.String(),
+		StateRoot:  blockHeader.StateRoot.String(),
+		Difficulty: blockHeader.Difficulty,
+		Time:       blockHeader.Timestamp.Unix(),
+		PowResult:  blockHeader.Pow.GetPowResult(),
+	}, nil
+}
+
+// Return the watched addresses
+func (api *PublicLightAPI) GetWatchedAddresses() (interface{}, error) {
+	return api.sm.watch.Addresses(), nil
+}
+
+// AddWatchedAddress starts tracking the outputs of the address, the synced
+// blocks are rescanned from the birthday order, which is the order of the
+// first block which may pay to it, or from the genesis block.
+func (api *PublicLightAPI) AddWatchedAddress(address string, birthday *uint64) (interface{}, error) {
+	from := uint(0)
+	if birthday != nil {
+		from = uint(*birthday)
+	}
+	err := api.sm.AddWatchedAddress(address, from)
+	if err != nil {
+		return nil, rpc.RpcInvalidError("%s", err.Error())
+	}
+	return nil, nil
+}
+
+// Return the unspent outputs of the watched addresses
+func (api *PublicLightAPI) GetWatchedUtxos() (interface{}, error) {
+	utxos := api.sm.watch.Utxos()
+	result := make([]json.WatchedUtxoResult, 0, len(utxos))
+	for _, u := range utxos {
+		result = append(result, json.WatchedUtxoResult{
+			Txid:         u.OutPoint.Hash.String(),
+			Vout:         u.OutPoint.OutIndex,
+			Address:      api.sm.watch.AddressOf(u.PkScript),
+			Amount:       types.Amount(u.Amount).ToCoin(),
+			ScriptPubKey: hex.EncodeToString(u.PkScript),
+			BlockHash:    u.BlockHash.String(),
+			BlockOrder:   uint64(u.BlockOrder),
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,426 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package light
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/blockchain"
+	"github.com/Qitmeer/qitmeer/core/blockdag"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/core/types/pow"
+	"github.com/Qitmeer/qitmeer/database"
+	"github.com/Qitmeer/qitmeer/params"
+	"sync"
+	"time"
+)
+
+var (
+	// headersBucketName is the name of the db bucket used to house the
+	// block headers synced by the light node, keyed by their order.
+	headersBucketName = []byte("lightheaders")
+)
+
+// headerNode is a block header known by the light node along with its order.
+type headerNode struct {
+	hash   hash.Hash
+	header types.BlockHeader
+	order  uint
+}
+
+// HeaderChain keeps the block headers synced by a light node.
+//
+// Block headers don't commit to their parents directly, so a light node can't
+// rebuild the DAG and calculate the order of the blocks by itself.  Instead,
+// the headers are requested in the order the full node peers return their
+// main chain, and every header is kept with that order once its proof of
+// work has been validated.  When the DAG of the peers reorders the blocks,
+// the headers following the last block whose order they agree on are
+// connected again with their new order.
+type HeaderChain struct {
+	mtx sync.RWMutex
+
+	db         database.DB
+	params     *params.Params
+	timeSource blockchain.MedianTimeSource
+
+	index  map[hash.Hash]*headerNode
+	orders []*headerNode
+}
+
+// NewHeaderChain loads the headers stored in the database, or stores the
+// genesis header when there are none yet.
+func NewHeaderChain(db database.DB, par *params.Params, timeSource blockchain.MedianTimeSource) (*HeaderChain, error) {
+	hc := &HeaderChain{
+		db:         db,
+		params:     par,
+		timeSource: timeSource,
+		index:      make(map[hash.Hash]*headerNode),
+	}
+
+	err := db.Update(func(dbTx database.Tx) error {
+		bucket, err := dbTx.Metadata().CreateBucketIfNotExists(headersBucketName)
+		if err != nil {
+			return err
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var header types.BlockHeader
+			err := header.Deserialize(bytes.NewReader(v))
+			if err != nil {
+				return err
+			}
+			hc.addNode(&header)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(hc.orders) == 0 {
+		err := hc.storeHeader(&par.GenesisBlock.Header)
+		if err != nil {
+			return nil, err
+		}
+	} else if !hc.orders[0].hash.IsEqual(par.GenesisHash) {
+		return nil, fmt.Errorf("the stored headers don't start with the "+
+			"genesis block %v", par.GenesisHash)
+	}
+	return hc, nil
+}
+
+// addNode appends the header to the in-memory index.  It must be called with
+// the lock held.
+func (hc *HeaderChain) addNode(header *types.BlockHeader) *headerNode {
+	node := &headerNode{
+		hash:   header.BlockHash(),
+		header: *header,
+		order:  uint(len(hc.orders)),
+	}
+	hc.index[node.hash] = node
+	hc.orders = append(hc.orders, node)
+	return node
+}
+
+// storeHeader writes the header to the database with the next order and
+// appends it to the in-memory index.  It must be called with the lock held.
+func (hc *HeaderChain) storeHeader(header *types.BlockHeader) error {
+	var buf bytes.Buffer
+	err := header.Serialize(&buf)
+	if err != nil {
+		return err
+	}
+	// The key is big endian so that iterating the bucket returns the
+	// headers in order.
+	var key [4]byte
+	binary.BigEndian.PutUint32(key[:], uint32(len(hc.orders)))
+	err = hc.db.Update(func(dbTx database.Tx) error {
+		return dbTx.Metadata().Bucket(headersBucketName).Put(key[:], buf.Bytes())
+	})
+	if err != nil {
+		return err
+	}
+	hc.addNode(header)
+	return nil
+}
+
+// LocatorOrders returns the orders of the blocks a light node with the total
+// number of headers sends in its locator, starting from the last one.  The
+// last blocks are all sent, then the step doubles back to the genesis block.
+// Full nodes use them to find the last block whose order they agree on.
+func LocatorOrders(total uint) []uint {
+	if total == 0 {
+		return nil
+	}
+	orders := make([]uint, 0, maxLocatorHashes+32)
+	step := uint(1)
+	for order := total - 1; ; order -= step {
+		orders = append(orders, order)
+		if len(orders) >= maxLocatorHashes {
+			step *= 2
+		}
+		if order < step {
+			break
+		}
+	}
+	if orders[len(orders)-1] != 0 {
+		orders = append(orders, 0)
+	}
+	return orders
+}
+
+// Locator returns the hashes of the blocks with the orders of LocatorOrders.
+//
+// This function is safe for concurrent access.
+func (hc *HeaderChain) Locator() []*hash.Hash {
+	hc.mtx.RLock()
+	defer hc.mtx.RUnlock()
+
+	orders := LocatorOrders(uint(len(hc.orders)))
+	locator := make([]*hash.Hash, 0, len(orders))
+	for _, order := range orders {
+		h := hc.orders[order].hash
+		locator = append(locator, &h)
+	}
+	return locator
+}
+
+// checkHeaderSanity performs the context free checks of the header: the proof
+// of work and the timestamp.
+func (hc *HeaderChain) checkHeaderSanity(header *types.BlockHeader, mainHeight uint) error {
+	instance := pow.GetInstance(header.Pow.GetPowType(), 0, []byte{})
+	instance.SetMainHeight(int64(mainHeight))
+	instance.SetParams(hc.params.PowConfig)
+	if !instance.CheckAvailable() {
+		return fmt.Errorf("pow type : %d is not available", header.Pow.GetPowType())
+	}
+
+	// The block hash must be less than the claimed target.
+	header.Pow.SetParams(hc.params.PowConfig)
+	header.Pow.SetMainHeight(int64(mainHeight))
+	err := header.Pow.Verify(header.BlockData(), header.BlockHash(), header.Difficulty)
+	if err != nil {
+		return err
+	}
+
+	if !header.Timestamp.Equal(time.Unix(header.Timestamp.Unix(), 0)) {
+		return fmt.Errorf("block timestamp of %v has a higher precision "+
+			"than one second", header.Timestamp)
+	}
+	maxTimestamp := hc.timeSource.AdjustedTime().Add(time.Second *
+		blockchain.MaxTimeOffsetSeconds)
+	if header.Timestamp.After(maxTimestamp) {
+		return fmt.Errorf("block timestamp of %v is too far in the future",
+			header.Timestamp)
+	}
+	return nil
+}
+
+// checkHeaderDifficulty checks that the difficulty claimed by the header is
+// not easier than the one its parents require, since the proof of work is
+// only verified against the claimed one.  The light node doesn't know the
+// parents, so the previous header of the same pow type by order stands for
+// them: the difficulty can't be easier than the one the retarget rules allow
+// after it.  It must be called with the lock held.
+func (hc *HeaderChain) checkHeaderDifficulty(header *types.BlockHeader) error {
+	powType := header.Pow.GetPowType()
+	required := pow.BigToCompact(header.Pow.GetSafeDiff(0))
+	for i := len(hc.orders) - 1; i >= 0; i-- {
+		prev := &hc.orders[i].header
+		if prev.Pow.GetPowType() != powType {
+			continue
+		}
+		// The blocks ordered after it may be its siblings with an
+		// earlier timestamp, which could still have been retargeted.
+		duration := header.Timestamp.Sub(prev.Timestamp)
+		if duration < hc.params.TargetTimespan {
+			duration = hc.params.TargetTimespan
+		}
+		required = blockchain.CalcEasiestDifficulty(hc.params, prev.Difficulty,
+			duration, header.Pow)
+		break
+	}
+
+	target := pow.CompactToBig(header.Difficulty)
+	requiredTarget := pow.CompactToBig(required)
+	if !header.Pow.CompareDiff(target, requiredTarget) {
+		return fmt.Errorf("block target difficulty of %064x is too low "+
+			"when compared to the previous headers, the easiest is %064x",
+			target, requiredTarget)
+	}
+	return nil
+}
+
+// connectHeader validates the header and appends it with the next order.  It
+// must be called with the lock held.
+func (hc *HeaderChain) connectHeader(header *types.BlockHeader, mainHeight uint) error {
+	h := header.BlockHash()
+	err := hc.checkHeaderSanity(header, mainHeight)
+	if err == nil {
+		err = hc.checkHeaderDifficulty(header)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid header %v: %v", h, err)
+	}
+	return hc.storeHeader(header)
+}
+
+// ConnectHeader validates the header and appends it with the next order.
+// The main height is the main height of the DAG the header was synced from,
+// which the proof of work of some algorithms depends on.  Headers which are
+// already known are ignored.
+//
+// This function is safe for concurrent access.
+func (hc *HeaderChain) ConnectHeader(header *types.BlockHeader, mainHeight uint) error {
+	hc.mtx.Lock()
+	defer hc.mtx.Unlock()
+
+	h := header.BlockHash()
+	if _, ok := hc.index[h]; ok {
+		return nil
+	}
+	return hc.connectHeader(header, mainHeight)
+}
+
+// ConnectHeaders connects the headers a peer returned for the locator.  The
+// first one is the last block of the locator whose order the peer agrees on
+// and the others follow it by order.  The known headers which have a
+// different order on the peer were reordered by its DAG, so they are
+// disconnected along with the ones after them, and connected again with
+// their new order.  It returns the order of the first disconnected header,
+// which is the previous total when nothing was reordered, along with the
+// hashes of the connected headers.
+//
+// This function is safe for concurrent access.
+func (hc *HeaderChain) ConnectHeaders(headers []*types.BlockHeader, mainHeight uint) (uint, []*hash.Hash, error) {
+	hc.mtx.Lock()
+	defer hc.mtx.Unlock()
+
+	total := uint(len(hc.orders))
+	if len(headers) == 0 {
+		return total, nil, nil
+	}
+	first := headers[0].BlockHash()
+	start, ok := hc.index[first]
+	if !ok {
+		return total, nil, fmt.Errorf("the headers don't start with a "+
+			"block of the locator: %v", first)
+	}
+
+	// Skip the headers which keep their order.
+	i, order := 1, start.order+1
+	for ; i < len(headers) && order < total; i, order = i+1, order+1 {
+		if headers[i].BlockHash() != hc.orders[order].hash {
+			break
+		}
+	}
+	fork := total
+	if i < len(headers) && order < total {
+		err := hc.disconnectHeaders(order)
+		if err != nil {
+			return total, nil, err
+		}
+		fork = order
+	}
+
+	connected := make([]*hash.Hash, 0, len(headers)-i)
+	for ; i < len(headers); i++ {
+		h := headers[i].BlockHash()
+		if _, ok := hc.index[h]; ok {
+			return fork, connected, fmt.Errorf("header %v is "+
+				"returned twice", h)
+		}
+		err := hc.connectHeader(headers[i], mainHeight)
+		if err != nil {
+			return fork, connected, err
+		}
+		connected = append(connected, &h)
+	}
+	return fork, connected, nil
+}
+
+// disconnectHeaders removes the headers from the order on, from the database
+// and the in-memory index.  It must be called with the lock held.
+func (hc *HeaderChain) disconnectHeaders(order uint) error {
+	err := hc.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(headersBucketName)
+		for i := order; i < uint(len(hc.orders)); i++ {
+			var key [4]byte
+			binary.BigEndian.PutUint32(key[:], uint32(i))
+			err := bucket.Delete(key[:])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, node := range hc.orders[order:] {
+		delete(hc.index, node.hash)
+	}
+	hc.orders = hc.orders[:order]
+	return nil
+}
+
+// HaveHeader returns whether or not the header of the block is known.
+//
+// This function is safe for concurrent access.
+func (hc *HeaderChain) HaveHeader(h *hash.Hash) bool {
+	hc.mtx.RLock()
+	_, ok := hc.index[*h]
+	hc.mtx.RUnlock()
+	return ok
+}
+
+// HeaderByHash returns the header of the block along with its order.
+//
+// This function is safe for concurrent access.
+func (hc *HeaderChain) HeaderByHash(h *hash.Hash) (*types.BlockHeader, uint, error) {
+	hc.mtx.RLock()
+	defer hc.mtx.RUnlock()
+
+	node, ok := hc.index[*h]
+	if !ok {
+		return nil, 0, fmt.Errorf("no header for block %v", h)
+	}
+	header := node.header
+	return &header, node.order, nil
+}
+
+// HeaderByOrder returns the header of the block with the order along with its
+// hash.
+//
+// This function is safe for concurrent access.
+func (hc *HeaderChain) HeaderByOrder(order uint) (*types.BlockHeader, *hash.Hash, error) {
+	hc.mtx.RLock()
+	defer hc.mtx.RUnlock()
+
+	if order >= uint(len(hc.orders)) {
+		return nil, nil, fmt.Errorf("no header for order %d", order)
+	}
+	node := hc.orders[order]
+	header := node.header
+	h := node.hash
+	return &header, &h, nil
+}
+
+// Total returns the number of headers, which is one more than the last order.
+//
+// This function is safe for concurrent access.
+func (hc *HeaderChain) Total() uint {
+	hc.mtx.RLock()
+	defer hc.mtx.RUnlock()
+	return uint(len(hc.orders))
+}
+
+// LastHash returns the hash of the block with the last order.
+//
+// This function is safe for concurrent access.
+func (hc *HeaderChain) LastHash() *hash.Hash {
+	hc.mtx.RLock()
+	defer hc.mtx.RUnlock()
+	h := hc.orders[len(hc.orders)-1].hash
+	return &h
+}
+
+// GraphState returns the graph state the light node announces to its peers.
+// The light node doesn't know the DAG, so its only tip is the block with the
+// last order.
+//
+// This function is safe for concurrent access.
+func (hc *HeaderChain) GraphState() *blockdag.GraphState {
+	hc.mtx.RLock()
+	defer hc.mtx.RUnlock()
+
+	gs := blockdag.NewGraphState()
+	gs.SetTotal(uint(len(hc.orders)))
+	gs.SetMainOrder(uint(len(hc.orders) - 1))
+	gs.GetTips().AddPair(&hc.orders[len(hc.orders)-1].hash, true)
+	return gs
+}
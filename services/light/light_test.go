@@ -0,0 +1,250 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package light
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/address"
+	"github.com/Qitmeer/qitmeer/core/blockchain"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/core/types/pow"
+	"github.com/Qitmeer/qitmeer/crypto/ecc"
+	"github.com/Qitmeer/qitmeer/database"
+	_ "github.com/Qitmeer/qitmeer/database/ffldb"
+	"github.com/Qitmeer/qitmeer/engine/txscript"
+	"github.com/Qitmeer/qitmeer/params"
+)
+
+func testDB(t *testing.T) (database.DB, func()) {
+	dir, err := ioutil.TempDir("", "lighttest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := database.Create("ffldb", filepath.Join(dir, "db"), params.PrivNetParams.Net)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestHeaderChain(t *testing.T) {
+	db, teardown := testDB(t)
+	defer teardown()
+
+	par := &params.PrivNetParams
+	hc, err := NewHeaderChain(db, par, blockchain.NewMedianTime())
+	if err != nil {
+		t.Fatalf("NewHeaderChain: %v", err)
+	}
+	if hc.Total() != 1 || !hc.LastHash().IsEqual(par.GenesisHash) {
+		t.Fatalf("expected only the genesis header, got %d headers", hc.Total())
+	}
+	gs := hc.GraphState()
+	if !gs.IsGenesis() || !gs.GetTips().HasOnly(par.GenesisHash) {
+		t.Fatalf("unexpected graph state %v", gs)
+	}
+
+	// Mine a header with the lowest difficulty of the network, and find
+	// a nonce which doesn't satisfy it.  Nonce 0 gives the genesis header.
+	var valid, invalid *types.BlockHeader
+	for nonce := uint32(1); valid == nil || invalid == nil; nonce++ {
+		header := par.GenesisBlock.Header
+		header.Difficulty = par.PowConfig.Blake2bdPowLimitBits
+		header.Pow = pow.GetInstance(pow.BLAKE2BD, nonce, []byte{})
+		if hc.checkHeaderSanity(&header, 1) == nil {
+			valid = &header
+		} else {
+			invalid = &header
+		}
+	}
+	if err := hc.ConnectHeader(invalid, 1); err == nil {
+		t.Fatal("ConnectHeader accepted a header with an invalid proof of work")
+	}
+	if err := hc.ConnectHeader(valid, 1); err != nil {
+		t.Fatalf("ConnectHeader: %v", err)
+	}
+	if hc.Total() != 2 {
+		t.Fatalf("expected 2 headers, got %d", hc.Total())
+	}
+
+	// The headers are loaded back from the database.
+	hc, err = NewHeaderChain(db, par, blockchain.NewMedianTime())
+	if err != nil {
+		t.Fatalf("NewHeaderChain: %v", err)
+	}
+	validHash := valid.BlockHash()
+	_, order, err := hc.HeaderByHash(&validHash)
+	if err != nil || order != 1 {
+		t.Fatalf("HeaderByHash: order %d, %v", order, err)
+	}
+
+	// The claimed difficulty can't be easier than the retarget rules
+	// allow after the previous header of the same pow type.
+	nonce := uint32(1000)
+	mine := func(bits uint32) *types.BlockHeader {
+		for ; ; nonce++ {
+			header := par.GenesisBlock.Header
+			header.Difficulty = bits
+			header.Pow = pow.GetInstance(pow.BLAKE2BD, nonce, []byte{})
+			if hc.checkHeaderSanity(&header, 1) == nil {
+				nonce++
+				return &header
+			}
+		}
+	}
+	hard := mine(0x2000ffff)
+	if err := hc.ConnectHeader(hard, 1); err != nil {
+		t.Fatalf("ConnectHeader: %v", err)
+	}
+	err = hc.ConnectHeader(mine(par.PowConfig.Blake2bdPowLimitBits), 1)
+	if err == nil || !strings.Contains(err.Error(), "too low") {
+		t.Fatalf("ConnectHeader accepted a header easier than the "+
+			"previous one: %v", err)
+	}
+
+	// The headers which follow the last block of the locator whose
+	// order the peer agrees on replace the reordered ones.
+	a, b := mine(0x2000ffff), mine(0x2000ffff)
+	genesis := par.GenesisBlock.Header
+	if _, _, err := hc.ConnectHeaders([]*types.BlockHeader{a}, 1); err == nil {
+		t.Fatal("ConnectHeaders accepted headers after an unknown block")
+	}
+	fork, connected, err := hc.ConnectHeaders([]*types.BlockHeader{&genesis, valid, a, b}, 1)
+	if err != nil {
+		t.Fatalf("ConnectHeaders: %v", err)
+	}
+	if fork != 2 || len(connected) != 2 || hc.Total() != 4 {
+		t.Fatalf("ConnectHeaders: fork %d, %d connected, %d headers",
+			fork, len(connected), hc.Total())
+	}
+	hardHash := hard.BlockHash()
+	if hc.HaveHeader(&hardHash) {
+		t.Fatal("the reordered header is still known")
+	}
+	fork, connected, err = hc.ConnectHeaders([]*types.BlockHeader{valid, a, b}, 1)
+	if err != nil || fork != 4 || len(connected) != 0 {
+		t.Fatalf("ConnectHeaders: fork %d, %d connected, %v", fork,
+			len(connected), err)
+	}
+	hc, err = NewHeaderChain(db, par, blockchain.NewMedianTime())
+	if err != nil {
+		t.Fatalf("NewHeaderChain: %v", err)
+	}
+	bHash := b.BlockHash()
+	_, order, err = hc.HeaderByHash(&bHash)
+	if err != nil || order != 3 || hc.Total() != 4 {
+		t.Fatalf("HeaderByHash: order %d of %d, %v", order, hc.Total(), err)
+	}
+	if locator := hc.Locator(); len(locator) != 4 || !locator[0].IsEqual(&bHash) {
+		t.Fatalf("unexpected locator %v", locator)
+	}
+}
+
+func TestLocatorOrders(t *testing.T) {
+	tests := []struct {
+		total  uint
+		orders []uint
+	}{
+		{0, nil},
+		{1, []uint{0}},
+		{3, []uint{2, 1, 0}},
+		{25, []uint{24, 23, 22, 21, 20, 19, 18, 17, 16, 15, 13, 9, 1, 0}},
+	}
+	for _, test := range tests {
+		orders := LocatorOrders(test.total)
+		if !reflect.DeepEqual(orders, test.orders) {
+			t.Errorf("LocatorOrders(%d): got %v, want %v", test.total,
+				orders, test.orders)
+		}
+	}
+}
+
+func TestWatchList(t *testing.T) {
+	db, teardown := testDB(t)
+	defer teardown()
+
+	par := &params.PrivNetParams
+	addr, err := address.NewPubKeyHashAddress(make([]byte, 20), par, ecc.ECDSA_Secp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wl, err := NewWatchList(db, par, []string{addr.Encode()})
+	if err != nil {
+		t.Fatalf("NewWatchList: %v", err)
+	}
+	if wl.IsEmpty() || wl.AddressOf(pkScript) != addr.Encode() {
+		t.Fatal("the address isn't watched")
+	}
+	if added, err := wl.AddAddress(addr.Encode()); added || err != nil {
+		t.Fatalf("AddAddress: %v, %v", added, err)
+	}
+
+	// An output paying to the watched address is tracked.
+	fund := types.NewTransaction()
+	fund.AddTxIn(types.NewTxInput(types.NewOutPoint(&hash.Hash{1}, 0), nil))
+	fund.AddTxOut(types.NewTxOutput(100, pkScript))
+	fund.AddTxOut(types.NewTxOutput(200, []byte{0x51}))
+	fundTx := types.NewTx(fund)
+	if err := wl.ConnectTransaction(fundTx, &hash.Hash{2}, 5); err != nil {
+		t.Fatalf("ConnectTransaction: %v", err)
+	}
+	utxos := wl.Utxos()
+	if len(utxos) != 1 || utxos[0].Amount != 100 || utxos[0].BlockOrder != 5 {
+		t.Fatalf("unexpected watched outputs %v", utxos)
+	}
+
+	// The tracked outputs are loaded back from the database.
+	wl, err = NewWatchList(db, par, nil)
+	if err != nil {
+		t.Fatalf("NewWatchList: %v", err)
+	}
+	if len(wl.Utxos()) != 1 || len(wl.Addresses()) != 1 {
+		t.Fatal("the watch list wasn't persisted")
+	}
+
+	// Spending the output removes it.
+	spend := types.NewTransaction()
+	spend.AddTxIn(types.NewTxInput(types.NewOutPoint(fundTx.Hash(), 0), nil))
+	spend.AddTxOut(types.NewTxOutput(90, []byte{0x51}))
+	if err := wl.ConnectTransaction(types.NewTx(spend), &hash.Hash{3}, 6); err != nil {
+		t.Fatalf("ConnectTransaction: %v", err)
+	}
+	if len(wl.Utxos()) != 0 {
+		t.Fatalf("the spent output is still watched")
+	}
+
+	// The outputs of the reordered blocks are removed.
+	if err := wl.ConnectTransaction(fundTx, &hash.Hash{4}, 7); err != nil {
+		t.Fatalf("ConnectTransaction: %v", err)
+	}
+	if err := wl.DisconnectBlocks(8); err != nil || len(wl.Utxos()) != 1 {
+		t.Fatalf("DisconnectBlocks removed an older output: %v", err)
+	}
+	if err := wl.DisconnectBlocks(7); err != nil || len(wl.Utxos()) != 0 {
+		t.Fatalf("DisconnectBlocks kept a reordered output: %v", err)
+	}
+	wl, err = NewWatchList(db, par, nil)
+	if err != nil {
+		t.Fatalf("NewWatchList: %v", err)
+	}
+	if len(wl.Utxos()) != 0 {
+		t.Fatal("the removed output was persisted")
+	}
+}
@@ -0,0 +1,700 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package light implements the services of a light node: it syncs the block
+// headers from the full node peers, validates their proof of work, and tracks
+// the unspent outputs of a set of watched addresses through the bloom
+// filtered merkle blocks of the peers.
+package light
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/blockchain"
+	"github.com/Qitmeer/qitmeer/core/blockdag"
+	"github.com/Qitmeer/qitmeer/core/message"
+	"github.com/Qitmeer/qitmeer/core/protocol"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/database"
+	"github.com/Qitmeer/qitmeer/p2p/peer"
+	"github.com/Qitmeer/qitmeer/params"
+	"github.com/Qitmeer/qitmeer/services/bloom"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxLocatorHashes is the number of the last synced blocks sent in
+	// the locator of the getheaders requests before its step doubles.
+	maxLocatorHashes = 10
+
+	// maxRequestAge is the time after which the requested merkle blocks
+	// and the matched transactions which weren't received are forgotten.
+	maxRequestAge = 10 * time.Minute
+
+	// expireInterval is the interval at which the requests older than
+	// maxRequestAge are expired.
+	expireInterval = time.Minute
+)
+
+// newPeerMsg signifies a newly connected peer to the sync handler.
+type newPeerMsg struct {
+	sp *peer.ServerPeer
+}
+
+// donePeerMsg signifies a disconnected peer to the sync handler.
+type donePeerMsg struct {
+	sp *peer.ServerPeer
+}
+
+// invMsg packages an inv message and the peer it came from together so the
+// sync handler has access to that information.
+type invMsg struct {
+	inv *message.MsgInv
+	sp  *peer.ServerPeer
+}
+
+// graphStateMsg signifies that the graph state of a peer was updated.
+type graphStateMsg struct {
+	sp *peer.ServerPeer
+}
+
+// headersMsg packages a headers message and the peer it came from together so
+// the sync handler has access to that information.
+type headersMsg struct {
+	headers *message.MsgHeaders
+	sp      *peer.ServerPeer
+}
+
+// merkleBlockMsg packages a merkleblock message and the peer it came from
+// together so the sync handler has access to that information.
+type merkleBlockMsg struct {
+	merkleBlock *message.MsgMerkleBlock
+	sp          *peer.ServerPeer
+}
+
+// txMsg packages a transaction and the peer it came from together so the sync
+// handler has access to that information.
+type txMsg struct {
+	tx *types.Tx
+	sp *peer.ServerPeer
+}
+
+// reloadFilterMsg signifies that the watched addresses changed and the bloom
+// filter of the peers has to be reloaded, then the blocks from the birthday
+// order on rescanned.
+type reloadFilterMsg struct {
+	birthday uint
+}
+
+// blockRef is the block a matched transaction of a merkle block belongs to,
+// along with the time the merkle block was received.
+type blockRef struct {
+	hash     hash.Hash
+	order    uint
+	received time.Time
+}
+
+// SyncManager syncs the block headers of the light node from its full node
+// peers and tracks the transactions of the watched addresses.
+type SyncManager struct {
+	started  int32
+	shutdown int32
+
+	params *params.Params
+	chain  *HeaderChain
+	watch  *WatchList
+
+	peers    map[*peer.Peer]*peer.ServerPeer
+	syncPeer *peer.ServerPeer
+	msgChan  chan interface{}
+
+	// headersRequested is set while a getheaders request to the sync peer
+	// is waiting for its response.
+	headersRequested bool
+
+	// requestedBlocks are the blocks whose merkle blocks were requested,
+	// with the time of the request, and matchedTxs are the matched
+	// transactions of the received merkle blocks, which the peers send
+	// right after them.  Both expire after maxRequestAge.
+	requestedBlocks map[hash.Hash]time.Time
+	matchedTxs      map[hash.Hash]blockRef
+
+	// rescanPending is set while the blocks from the rescanFrom order on
+	// have to be rescanned for newly watched addresses, until a peer
+	// serving merkle blocks is connected.
+	rescanPending bool
+	rescanFrom    uint
+
+	// bestGS is the best graph state announced by the peers.
+	gsMtx  sync.RWMutex
+	bestGS *blockdag.GraphState
+
+	wg   sync.WaitGroup
+	quit chan struct{}
+}
+
+// NewSyncManager returns a new sync manager for the light node, which watches
+// the passed addresses along with the ones watched before.  The synced blocks
+// from the birthday order on are rescanned for the addresses which weren't
+// watched yet.  Use Start to begin syncing from the peers.
+func NewSyncManager(db database.DB, par *params.Params, timeSource blockchain.MedianTimeSource,
+	watchAddrs []string, birthday uint, maxPeers int) (*SyncManager, error) {
+	chain, err := NewHeaderChain(db, par, timeSource)
+	if err != nil {
+		return nil, err
+	}
+	watch, err := NewWatchList(db, par, nil)
+	if err != nil {
+		return nil, err
+	}
+	sm := &SyncManager{
+		params:          par,
+		chain:           chain,
+		watch:           watch,
+		peers:           make(map[*peer.Peer]*peer.ServerPeer),
+		msgChan:         make(chan interface{}, maxPeers*3),
+		requestedBlocks: make(map[hash.Hash]time.Time),
+		matchedTxs:      make(map[hash.Hash]blockRef),
+		bestGS:          chain.GraphState(),
+		quit:            make(chan struct{}),
+	}
+	for _, addr := range watchAddrs {
+		added, err := watch.AddAddress(addr)
+		if err != nil {
+			return nil, err
+		}
+		if added {
+			sm.addRescan(birthday)
+		}
+	}
+	log.Info(fmt.Sprintf("Loaded %d block headers, watching %d addresses",
+		chain.Total(), len(watch.Addresses())))
+	return sm, nil
+}
+
+// Start begins the core sync handler which processes the messages of the
+// peers.
+func (sm *SyncManager) Start() {
+	// Already started?
+	if atomic.AddInt32(&sm.started, 1) != 1 {
+		return
+	}
+
+	log.Trace("Starting light sync manager")
+	sm.wg.Add(1)
+	go sm.syncHandler()
+}
+
+// Stop gracefully shuts down the sync manager by stopping all asynchronous
+// handlers and waiting for them to finish.
+func (sm *SyncManager) Stop() error {
+	if atomic.AddInt32(&sm.shutdown, 1) != 1 {
+		log.Warn("Light sync manager is already in the process of " +
+			"shutting down")
+		return nil
+	}
+
+	log.Info("Light sync manager shutting down")
+	close(sm.quit)
+	sm.wg.Wait()
+	return nil
+}
+
+// HeaderChain returns the headers synced by the light node.
+func (sm *SyncManager) HeaderChain() *HeaderChain {
+	return sm.chain
+}
+
+// WatchList returns the watched addresses and their unspent outputs.
+func (sm *SyncManager) WatchList() *WatchList {
+	return sm.watch
+}
+
+// GraphState returns the graph state announced to the peers.
+func (sm *SyncManager) GraphState() *blockdag.GraphState {
+	return sm.chain.GraphState()
+}
+
+// BestGraphState returns the best graph state announced by the peers, or the
+// one of the light node when it is better.
+func (sm *SyncManager) BestGraphState() *blockdag.GraphState {
+	sm.gsMtx.RLock()
+	defer sm.gsMtx.RUnlock()
+	return sm.bestGS.Clone()
+}
+
+// IsCurrent returns whether or not the light node has synced the headers of
+// all of the ordered blocks announced by its peers.
+func (sm *SyncManager) IsCurrent() bool {
+	sm.gsMtx.RLock()
+	defer sm.gsMtx.RUnlock()
+	return sm.bestGS.GetMainOrder() < sm.chain.Total()
+}
+
+// AddWatchedAddress starts watching the address, reloads the bloom filter of
+// the peers and rescans the synced blocks from the birthday order on, which is
+// the order of the first block which may pay to the address.
+func (sm *SyncManager) AddWatchedAddress(addr string, birthday uint) error {
+	added, err := sm.watch.AddAddress(addr)
+	if err != nil || !added {
+		return err
+	}
+	select {
+	case sm.msgChan <- reloadFilterMsg{birthday: birthday}:
+	case <-sm.quit:
+	}
+	return nil
+}
+
+// NewPeer informs the sync manager of a newly active peer.
+func (sm *SyncManager) NewPeer(sp *peer.ServerPeer) {
+	// Ignore if we are shutting down.
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return
+	}
+	sm.msgChan <- &newPeerMsg{sp: sp}
+}
+
+// DonePeer informs the sync manager that a peer has disconnected.
+func (sm *SyncManager) DonePeer(sp *peer.ServerPeer) {
+	// Ignore if we are shutting down.
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return
+	}
+	sm.msgChan <- &donePeerMsg{sp: sp}
+}
+
+// QueueInv adds the passed inv message and peer to the sync handler queue.
+func (sm *SyncManager) QueueInv(inv *message.MsgInv, sp *peer.ServerPeer) {
+	// No channel handling here because peers do not need to block on inv
+	// messages.
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return
+	}
+	sm.msgChan <- &invMsg{inv: inv, sp: sp}
+}
+
+// QueueGraphState informs the sync manager that the graph state of the peer
+// was updated.
+func (sm *SyncManager) QueueGraphState(sp *peer.ServerPeer) {
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return
+	}
+	sm.msgChan <- &graphStateMsg{sp: sp}
+}
+
+// QueueHeaders adds the passed headers message and peer to the sync handler
+// queue.
+func (sm *SyncManager) QueueHeaders(headers *message.MsgHeaders, sp *peer.ServerPeer) {
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return
+	}
+	sm.msgChan <- &headersMsg{headers: headers, sp: sp}
+}
+
+// QueueMerkleBlock adds the passed merkleblock message and peer to the sync
+// handler queue.
+func (sm *SyncManager) QueueMerkleBlock(merkleBlock *message.MsgMerkleBlock, sp *peer.ServerPeer) {
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return
+	}
+	sm.msgChan <- &merkleBlockMsg{merkleBlock: merkleBlock, sp: sp}
+}
+
+// QueueTx adds the passed transaction and peer to the sync handler queue.
+func (sm *SyncManager) QueueTx(tx *types.Tx, sp *peer.ServerPeer) {
+	if atomic.LoadInt32(&sm.shutdown) != 0 {
+		return
+	}
+	sm.msgChan <- &txMsg{tx: tx, sp: sp}
+}
+
+// syncHandler is the main handler for the sync manager.  It must be run as a
+// goroutine.  It processes the messages of the peers in a separate goroutine
+// from the peer handlers so the headers are connected in order.
+func (sm *SyncManager) syncHandler() {
+	expireTicker := time.NewTicker(expireInterval)
+	defer expireTicker.Stop()
+
+out:
+	for {
+		select {
+		case m := <-sm.msgChan:
+			switch msg := m.(type) {
+			case *newPeerMsg:
+				sm.handleNewPeerMsg(msg.sp)
+
+			case *donePeerMsg:
+				sm.handleDonePeerMsg(msg.sp)
+
+			case *invMsg:
+				sm.handleInvMsg(msg)
+
+			case *graphStateMsg:
+				sm.handleGraphStateMsg(msg.sp)
+
+			case *headersMsg:
+				sm.handleHeadersMsg(msg)
+
+			case *merkleBlockMsg:
+				sm.handleMerkleBlockMsg(msg)
+
+			case *txMsg:
+				sm.handleTxMsg(msg)
+
+			case reloadFilterMsg:
+				for _, sp := range sm.peers {
+					sm.pushFilterLoad(sp)
+				}
+				sm.addRescan(msg.birthday)
+				sm.startRescan()
+
+			default:
+				log.Warn(fmt.Sprintf("Invalid message type in light sync "+
+					"handler: %T", msg))
+			}
+
+		case <-expireTicker.C:
+			sm.expireRequests(time.Now().Add(-maxRequestAge))
+
+		case <-sm.quit:
+			break out
+		}
+	}
+
+	sm.wg.Done()
+	log.Trace("Light sync handler done")
+}
+
+// isSyncCandidate returns whether or not the peer is a candidate to consider
+// syncing from.
+func (sm *SyncManager) isSyncCandidate(sp *peer.ServerPeer) bool {
+	return sp.Services()&protocol.Full == protocol.Full
+}
+
+// updateBestGS keeps the best graph state announced by the peers.
+func (sm *SyncManager) updateBestGS(gs *blockdag.GraphState) {
+	if gs == nil {
+		return
+	}
+	sm.gsMtx.Lock()
+	if gs.IsExcellent(sm.bestGS) {
+		sm.bestGS = gs.Clone()
+	}
+	sm.gsMtx.Unlock()
+}
+
+// isAhead returns whether or not the peer has ordered blocks which aren't
+// synced yet.
+func (sm *SyncManager) isAhead(sp *peer.ServerPeer) bool {
+	gs := sp.LastGS()
+	return gs != nil && gs.GetMainOrder() >= sm.chain.Total()
+}
+
+// handleNewPeerMsg deals with new peers that have signalled they may be
+// considered as a sync peer.  It loads the bloom filter of the watched
+// addresses into the peer and starts syncing if needed.
+func (sm *SyncManager) handleNewPeerMsg(sp *peer.ServerPeer) {
+	log.Info(fmt.Sprintf("New valid peer: %s,user-agent:%s", sp, sp.UserAgent()))
+
+	sp.SyncCandidate = sm.isSyncCandidate(sp)
+	sm.peers[sp.Peer] = sp
+	if !sp.SyncCandidate {
+		return
+	}
+
+	sm.pushFilterLoad(sp)
+	sm.updateBestGS(sp.LastGS())
+	if sm.syncPeer == nil {
+		sm.startSync()
+	}
+	sm.startRescan()
+}
+
+// handleDonePeerMsg deals with peers that have signalled they are done.  It
+// chooses a new sync peer when it was the sync peer.
+func (sm *SyncManager) handleDonePeerMsg(sp *peer.ServerPeer) {
+	if _, exists := sm.peers[sp.Peer]; !exists {
+		log.Warn(fmt.Sprintf("Received done peer message for unknown peer %s", sp))
+		return
+	}
+	delete(sm.peers, sp.Peer)
+	log.Info("Lost peer", "peer", sp)
+
+	if sm.syncPeer == sp {
+		sm.syncPeer = nil
+		sm.headersRequested = false
+		sm.startSync()
+	}
+	sm.startRescan()
+}
+
+// startSync chooses the candidate peer with the best graph state as the sync
+// peer, and requests the headers from it when it is ahead.
+func (sm *SyncManager) startSync() {
+	var best *peer.ServerPeer
+	for _, sp := range sm.peers {
+		if !sp.SyncCandidate || sp.LastGS() == nil {
+			continue
+		}
+		if best == nil || sp.LastGS().IsExcellent(best.LastGS()) {
+			best = sp
+		}
+	}
+	if best == nil {
+		log.Trace("No sync peer candidates available")
+		return
+	}
+	sm.syncPeer = best
+	if sm.isAhead(best) {
+		log.Info(fmt.Sprintf("Syncing headers to order %d from peer %s",
+			best.LastGS().GetMainOrder(), best.Addr()))
+		sm.requestHeaders()
+	}
+}
+
+// requestHeaders sends a getheaders request to the sync peer.
+func (sm *SyncManager) requestHeaders() {
+	msg := message.NewMsgGetHeaders(sm.chain.GraphState())
+	for _, h := range sm.chain.Locator() {
+		err := msg.AddBlockLocatorHash(h)
+		if err != nil {
+			break
+		}
+	}
+	sm.syncPeer.QueueMessage(msg, nil)
+	sm.headersRequested = true
+}
+
+// pushFilterLoad loads the bloom filter of the watched addresses into the
+// peer.  Nothing is loaded when no address is watched, so the peer doesn't
+// relay transactions.
+func (sm *SyncManager) pushFilterLoad(sp *peer.ServerPeer) {
+	if sm.watch.IsEmpty() || sp.Services()&protocol.Bloom != protocol.Bloom {
+		return
+	}
+	sp.QueueMessage(sm.watch.FilterLoadMsg(rand.Uint32()), nil)
+}
+
+// requestMerkleBlocks requests the merkle blocks of the blocks from the peer
+// when addresses are watched.
+func (sm *SyncManager) requestMerkleBlocks(sp *peer.ServerPeer, hashes []*hash.Hash) {
+	if sm.watch.IsEmpty() || sp.Services()&protocol.Bloom != protocol.Bloom {
+		return
+	}
+	now := time.Now()
+	gdmsg := message.NewMsgGetData()
+	for _, h := range hashes {
+		sm.requestedBlocks[*h] = now
+		gdmsg.AddInvVect(message.NewInvVect(message.InvTypeFilteredBlock, h))
+		if len(gdmsg.InvList) == message.MaxInvPerMsg {
+			sp.QueueMessage(gdmsg, nil)
+			gdmsg = message.NewMsgGetData()
+		}
+	}
+	if len(gdmsg.InvList) > 0 {
+		sp.QueueMessage(gdmsg, nil)
+	}
+}
+
+// addRescan records that the synced blocks from the birthday order on have to
+// be rescanned for newly watched addresses.
+func (sm *SyncManager) addRescan(birthday uint) {
+	if !sm.rescanPending || birthday < sm.rescanFrom {
+		sm.rescanFrom = birthday
+	}
+	sm.rescanPending = true
+}
+
+// startRescan requests the merkle blocks of the synced blocks to rescan from
+// the sync peer, or another peer serving them, once their bloom filter holds
+// the newly watched addresses.  The blocks synced later are requested with
+// their headers.
+func (sm *SyncManager) startRescan() {
+	if !sm.rescanPending {
+		return
+	}
+	sp := sm.syncPeer
+	if sp == nil || sp.Services()&protocol.Bloom != protocol.Bloom {
+		sp = nil
+		for _, p := range sm.peers {
+			if p.SyncCandidate && p.Services()&protocol.Bloom == protocol.Bloom {
+				sp = p
+				break
+			}
+		}
+	}
+	if sp == nil {
+		return
+	}
+	sm.rescanPending = false
+
+	total := sm.chain.Total()
+	if sm.rescanFrom >= total {
+		return
+	}
+	log.Info(fmt.Sprintf("Rescanning the blocks from order %d to %d for "+
+		"the watched addresses", sm.rescanFrom, total-1))
+	hashes := make([]*hash.Hash, 0, total-sm.rescanFrom)
+	for order := sm.rescanFrom; order < total; order++ {
+		_, h, err := sm.chain.HeaderByOrder(order)
+		if err != nil {
+			break
+		}
+		hashes = append(hashes, h)
+	}
+	sm.requestMerkleBlocks(sp, hashes)
+}
+
+// expireRequests forgets the merkle blocks requested and the transactions
+// matched before the time, whose peer never sent them.
+func (sm *SyncManager) expireRequests(before time.Time) {
+	for h, requested := range sm.requestedBlocks {
+		if requested.Before(before) {
+			delete(sm.requestedBlocks, h)
+		}
+	}
+	for h, ref := range sm.matchedTxs {
+		if ref.received.Before(before) {
+			delete(sm.matchedTxs, h)
+		}
+	}
+}
+
+// handleGraphStateMsg starts syncing from the peer when its updated graph
+// state shows ordered blocks which aren't synced yet.
+func (sm *SyncManager) handleGraphStateMsg(sp *peer.ServerPeer) {
+	if _, exists := sm.peers[sp.Peer]; !exists || !sp.SyncCandidate {
+		return
+	}
+	sm.updateBestGS(sp.LastGS())
+	if sm.headersRequested || !sm.isAhead(sp) {
+		return
+	}
+	if sm.syncPeer == nil || sm.syncPeer == sp || !sm.isAhead(sm.syncPeer) {
+		sm.syncPeer = sp
+		sm.requestHeaders()
+	}
+}
+
+// handleInvMsg handles the block announcements of the peers, the new blocks
+// are synced by requesting the headers which follow the last synced one.
+func (sm *SyncManager) handleInvMsg(imsg *invMsg) {
+	for _, iv := range imsg.inv.InvList {
+		if iv.Type == message.InvTypeBlock && !sm.chain.HaveHeader(&iv.Hash) {
+			sm.handleGraphStateMsg(imsg.sp)
+			return
+		}
+	}
+}
+
+// handleHeadersMsg connects the headers returned by the sync peer in order
+// and requests the next ones until the light node is synced.
+func (sm *SyncManager) handleHeadersMsg(hmsg *headersMsg) {
+	sp := hmsg.sp
+	if sp != sm.syncPeer || !sm.headersRequested {
+		log.Trace(fmt.Sprintf("Ignoring unrequested headers from %s", sp))
+		return
+	}
+	sm.headersRequested = false
+	sm.updateBestGS(hmsg.headers.GS)
+
+	total := sm.chain.Total()
+	mainHeight := hmsg.headers.GS.GetMainHeight()
+	fork, connected, err := sm.chain.ConnectHeaders(hmsg.headers.Headers, mainHeight)
+	if fork < total {
+		// The outputs of the reordered blocks are tracked again with
+		// their new order once their merkle blocks are received.
+		log.Info(fmt.Sprintf("Reordered the headers from order %d on",
+			fork))
+		sm.disconnectBlocks(fork)
+	}
+	if err != nil {
+		log.Warn(fmt.Sprintf("Rejected header from %s: %v -- "+
+			"disconnecting", sp, err))
+		if len(connected) > 0 {
+			_, order, err := sm.chain.HeaderByHash(connected[0])
+			if err == nil {
+				sm.addRescan(order)
+			}
+		}
+		sp.Disconnect()
+		return
+	}
+	if len(connected) > 0 {
+		log.Info(fmt.Sprintf("Synced %d headers from %s, last order %d",
+			len(connected), sp.Addr(), sm.chain.Total()-1))
+	}
+	sm.requestMerkleBlocks(sp, connected)
+
+	// Keep requesting headers while the peer returns new ones.
+	if len(connected) > 0 && sm.isAhead(sp) {
+		sm.requestHeaders()
+	}
+}
+
+// disconnectBlocks forgets the outputs and the matched transactions of the
+// blocks from the order on.
+func (sm *SyncManager) disconnectBlocks(order uint) {
+	for h, ref := range sm.matchedTxs {
+		if ref.order >= order {
+			delete(sm.matchedTxs, h)
+		}
+	}
+	err := sm.watch.DisconnectBlocks(order)
+	if err != nil {
+		log.Error(fmt.Sprintf("Failed to remove the watched outputs from "+
+			"order %d: %v", order, err))
+	}
+}
+
+// handleMerkleBlockMsg validates the merkle block of a requested block
+// against its header and records the matched transactions which follow it.
+func (sm *SyncManager) handleMerkleBlockMsg(bmsg *merkleBlockMsg) {
+	h := bmsg.merkleBlock.Header.BlockHash()
+	if _, ok := sm.requestedBlocks[h]; !ok {
+		log.Trace(fmt.Sprintf("Ignoring unrequested merkle block %v from %s",
+			h, bmsg.sp))
+		return
+	}
+	delete(sm.requestedBlocks, h)
+
+	header, order, err := sm.chain.HeaderByHash(&h)
+	if err != nil {
+		return
+	}
+	root, matches, err := bloom.ExtractMatches(bmsg.merkleBlock)
+	if err == nil && !root.IsEqual(&header.TxRoot) {
+		err = fmt.Errorf("merkle root %v doesn't match the block %v", root, h)
+	}
+	if err != nil {
+		log.Warn(fmt.Sprintf("Bad merkle block from %s: %v -- "+
+			"disconnecting", bmsg.sp, err))
+		bmsg.sp.Disconnect()
+		return
+	}
+	now := time.Now()
+	for _, txHash := range matches {
+		sm.matchedTxs[*txHash] = blockRef{hash: h, order: order, received: now}
+	}
+}
+
+// handleTxMsg updates the watched outputs with a matched transaction of a
+// merkle block.  Other transactions are unconfirmed and ignored.
+func (sm *SyncManager) handleTxMsg(tmsg *txMsg) {
+	ref, ok := sm.matchedTxs[*tmsg.tx.Hash()]
+	if !ok {
+		return
+	}
+	delete(sm.matchedTxs, *tmsg.tx.Hash())
+
+	err := sm.watch.ConnectTransaction(tmsg.tx, &ref.hash, ref.order)
+	if err != nil {
+		log.Error(fmt.Sprintf("Failed to update the watched outputs with "+
+			"%v: %v", tmsg.tx.Hash(), err))
+	}
+}
@@ -0,0 +1,353 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package light
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/address"
+	"github.com/Qitmeer/qitmeer/core/dbnamespace"
+	"github.com/Qitmeer/qitmeer/core/message"
+	s "github.com/Qitmeer/qitmeer/core/serialization"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/database"
+	"github.com/Qitmeer/qitmeer/engine/txscript"
+	"github.com/Qitmeer/qitmeer/params"
+	"github.com/Qitmeer/qitmeer/services/bloom"
+	"sort"
+	"sync"
+)
+
+var (
+	// watchedAddrsBucketName is the name of the db bucket used to house
+	// the addresses watched by the light node.
+	watchedAddrsBucketName = []byte("lightwatchedaddrs")
+
+	// watchedUtxosBucketName is the name of the db bucket used to house
+	// the unspent outputs of the watched addresses, keyed by outpoint.
+	watchedUtxosBucketName = []byte("lightwatchedutxos")
+)
+
+// filterFPRate is the false positive rate of the bloom filter loaded into the
+// peers.
+const filterFPRate = 0.0001
+
+// WatchedUtxo is an unspent output paying to a watched address.
+type WatchedUtxo struct {
+	OutPoint   types.TxOutPoint
+	Amount     uint64
+	PkScript   []byte
+	BlockHash  hash.Hash
+	BlockOrder uint
+}
+
+// WatchList keeps the set of addresses watched by the light node along with
+// their unspent outputs found in the synced blocks.
+type WatchList struct {
+	mtx sync.RWMutex
+
+	db     database.DB
+	params *params.Params
+
+	addrs map[string]types.Address
+	utxos map[types.TxOutPoint]*WatchedUtxo
+}
+
+// outPointKey returns the key of the outpoint in the utxos bucket.
+func outPointKey(op *types.TxOutPoint) []byte {
+	key := make([]byte, hash.HashSize+4)
+	copy(key, op.Hash[:])
+	dbnamespace.ByteOrder.PutUint32(key[hash.HashSize:], op.OutIndex)
+	return key
+}
+
+// serializeUtxo returns the value of the unspent output in the utxos bucket.
+func serializeUtxo(u *WatchedUtxo) ([]byte, error) {
+	var buf bytes.Buffer
+	err := s.WriteElements(&buf, u.Amount, &u.BlockHash, uint32(u.BlockOrder))
+	if err != nil {
+		return nil, err
+	}
+	err = s.WriteVarBytes(&buf, 0, u.PkScript)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// deserializeUtxo decodes an unspent output of the utxos bucket.
+func deserializeUtxo(key, value []byte) (*WatchedUtxo, error) {
+	u := &WatchedUtxo{}
+	copy(u.OutPoint.Hash[:], key[:hash.HashSize])
+	u.OutPoint.OutIndex = dbnamespace.ByteOrder.Uint32(key[hash.HashSize:])
+
+	r := bytes.NewReader(value)
+	var order uint32
+	err := s.ReadElements(r, &u.Amount, &u.BlockHash, &order)
+	if err != nil {
+		return nil, err
+	}
+	u.BlockOrder = uint(order)
+	u.PkScript, err = s.ReadVarBytes(r, 0, types.MaxMessagePayload, "PkScript")
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// NewWatchList loads the watched addresses and their unspent outputs from
+// the database, and adds the passed addresses to them.
+func NewWatchList(db database.DB, par *params.Params, addrs []string) (*WatchList, error) {
+	wl := &WatchList{
+		db:     db,
+		params: par,
+		addrs:  make(map[string]types.Address),
+		utxos:  make(map[types.TxOutPoint]*WatchedUtxo),
+	}
+
+	err := db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		addrBucket, err := meta.CreateBucketIfNotExists(watchedAddrsBucketName)
+		if err != nil {
+			return err
+		}
+		utxoBucket, err := meta.CreateBucketIfNotExists(watchedUtxosBucketName)
+		if err != nil {
+			return err
+		}
+		err = addrBucket.ForEach(func(k, v []byte) error {
+			addr, err := address.DecodeAddress(string(k))
+			if err != nil {
+				return err
+			}
+			wl.addrs[string(k)] = addr
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return utxoBucket.ForEach(func(k, v []byte) error {
+			u, err := deserializeUtxo(k, v)
+			if err != nil {
+				return err
+			}
+			wl.utxos[u.OutPoint] = u
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, addr := range addrs {
+		_, err := wl.AddAddress(addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return wl, nil
+}
+
+// AddAddress starts watching the address, and returns whether or not it
+// wasn't watched yet.  Only the outputs of the blocks synced from now on are
+// tracked for it, the synced blocks have to be rescanned for the older ones.
+//
+// This function is safe for concurrent access.
+func (wl *WatchList) AddAddress(addr string) (bool, error) {
+	a, err := address.DecodeAddress(addr)
+	if err != nil {
+		return false, err
+	}
+	if !address.IsForNetwork(a, wl.params) {
+		return false, fmt.Errorf("address %s is not for the %s network",
+			addr, wl.params.Name)
+	}
+
+	wl.mtx.Lock()
+	defer wl.mtx.Unlock()
+
+	key := a.Encode()
+	if _, ok := wl.addrs[key]; ok {
+		return false, nil
+	}
+	err = wl.db.Update(func(dbTx database.Tx) error {
+		return dbTx.Metadata().Bucket(watchedAddrsBucketName).Put([]byte(key), nil)
+	})
+	if err != nil {
+		return false, err
+	}
+	wl.addrs[key] = a
+	return true, nil
+}
+
+// Addresses returns the encoded watched addresses.
+//
+// This function is safe for concurrent access.
+func (wl *WatchList) Addresses() []string {
+	wl.mtx.RLock()
+	defer wl.mtx.RUnlock()
+
+	addrs := make([]string, 0, len(wl.addrs))
+	for k := range wl.addrs {
+		addrs = append(addrs, k)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// IsEmpty returns whether or not no address is watched.
+//
+// This function is safe for concurrent access.
+func (wl *WatchList) IsEmpty() bool {
+	wl.mtx.RLock()
+	defer wl.mtx.RUnlock()
+	return len(wl.addrs) == 0
+}
+
+// Utxos returns the unspent outputs of the watched addresses sorted by the
+// order of their blocks.
+//
+// This function is safe for concurrent access.
+func (wl *WatchList) Utxos() []*WatchedUtxo {
+	wl.mtx.RLock()
+	defer wl.mtx.RUnlock()
+
+	utxos := make([]*WatchedUtxo, 0, len(wl.utxos))
+	for _, u := range wl.utxos {
+		utxos = append(utxos, u)
+	}
+	sort.Slice(utxos, func(i, j int) bool {
+		if utxos[i].BlockOrder != utxos[j].BlockOrder {
+			return utxos[i].BlockOrder < utxos[j].BlockOrder
+		}
+		return bytes.Compare(outPointKey(&utxos[i].OutPoint),
+			outPointKey(&utxos[j].OutPoint)) < 0
+	})
+	return utxos
+}
+
+// AddressOf returns the encoded watched address the script pays to, or an
+// empty string when it doesn't pay to one of them.
+//
+// This function is safe for concurrent access.
+func (wl *WatchList) AddressOf(pkScript []byte) string {
+	wl.mtx.RLock()
+	defer wl.mtx.RUnlock()
+	return wl.addressOf(pkScript)
+}
+
+func (wl *WatchList) addressOf(pkScript []byte) string {
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript, wl.params)
+	if err != nil {
+		return ""
+	}
+	for _, a := range addrs {
+		if _, ok := wl.addrs[a.Encode()]; ok {
+			return a.Encode()
+		}
+	}
+	return ""
+}
+
+// FilterLoadMsg returns the filterload message to send to the peers so that
+// they relay the transactions paying to or spending from the watched
+// addresses.
+//
+// This function is safe for concurrent access.
+func (wl *WatchList) FilterLoadMsg(tweak uint32) *message.MsgFilterLoad {
+	wl.mtx.RLock()
+	defer wl.mtx.RUnlock()
+
+	elements := uint32(len(wl.addrs) + len(wl.utxos))
+	if elements == 0 {
+		elements = 1
+	}
+	// The outpoints of the matched outputs are added to the filter of
+	// the peers, so that the transactions spending them match too.
+	filter := bloom.NewFilter(elements, tweak, filterFPRate, message.BloomUpdateAll)
+	for _, a := range wl.addrs {
+		filter.Add(a.ScriptAddress())
+	}
+	for op := range wl.utxos {
+		outPoint := op
+		filter.AddOutPoint(&outPoint)
+	}
+	return filter.MsgFilterLoad()
+}
+
+// ConnectTransaction removes the watched outputs spent by the transaction of
+// the block and adds its outputs paying to the watched addresses.
+//
+// This function is safe for concurrent access.
+func (wl *WatchList) ConnectTransaction(tx *types.Tx, blockHash *hash.Hash, order uint) error {
+	wl.mtx.Lock()
+	defer wl.mtx.Unlock()
+
+	return wl.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(watchedUtxosBucketName)
+		msgTx := tx.Transaction()
+		if !msgTx.IsCoinBase() {
+			for _, txIn := range msgTx.TxIn {
+				if _, ok := wl.utxos[txIn.PreviousOut]; !ok {
+					continue
+				}
+				err := bucket.Delete(outPointKey(&txIn.PreviousOut))
+				if err != nil {
+					return err
+				}
+				delete(wl.utxos, txIn.PreviousOut)
+			}
+		}
+
+		for i, txOut := range msgTx.TxOut {
+			if wl.addressOf(txOut.PkScript) == "" {
+				continue
+			}
+			u := &WatchedUtxo{
+				OutPoint:   *types.NewOutPoint(tx.Hash(), uint32(i)),
+				Amount:     txOut.Amount,
+				PkScript:   txOut.PkScript,
+				BlockHash:  *blockHash,
+				BlockOrder: order,
+			}
+			value, err := serializeUtxo(u)
+			if err != nil {
+				return err
+			}
+			err = bucket.Put(outPointKey(&u.OutPoint), value)
+			if err != nil {
+				return err
+			}
+			wl.utxos[u.OutPoint] = u
+		}
+		return nil
+	})
+}
+
+// DisconnectBlocks removes the watched outputs of the blocks from the order
+// on, which were reordered.  They are tracked again with their new order when
+// the transactions of the blocks are connected again.
+//
+// This function is safe for concurrent access.
+func (wl *WatchList) DisconnectBlocks(order uint) error {
+	wl.mtx.Lock()
+	defer wl.mtx.Unlock()
+
+	return wl.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(watchedUtxosBucketName)
+		for op, u := range wl.utxos {
+			if u.BlockOrder < order {
+				continue
+			}
+			err := bucket.Delete(outPointKey(&op))
+			if err != nil {
+				return err
+			}
+			delete(wl.utxos, op)
+		}
+		return nil
+	})
+}
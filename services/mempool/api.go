@@ -1,6 +1,7 @@
 package mempool
 
 import (
+	"github.com/Qitmeer/qitmeer/core/json"
 	"github.com/Qitmeer/qitmeer/log"
 	"github.com/Qitmeer/qitmeer/rpc"
 	"sort"
@@ -35,3 +36,70 @@ func (api *PublicMempoolAPI) GetMempool(txType *string, verbose bool) (interface
 	sort.Strings(hashStrings)
 	return hashStrings, nil
 }
+
+// GetMempoolInfo returns the size of the mempool and the minimum fee rate a
+// transaction has to pay to be accepted into it.
+func (api *PublicMempoolAPI) GetMempoolInfo() (interface{}, error) {
+	mp := api.txPool
+	mp.mtx.Lock()
+	result := &json.GetMempoolInfoResult{
+		Size:          len(mp.pool),
+		Bytes:         mp.poolSize,
+		MaxMempool:    mp.cfg.Policy.MaxPoolSize,
+		MempoolMinFee: mp.minRelayFee().ToCoin(),
+		MinRelayTxFee: mp.cfg.Policy.MinRelayTxFee.ToCoin(),
+	}
+	mp.mtx.Unlock()
+	return result, nil
+}
+
+// minFeeRate returns the fee rate, or the minimum relay fee rate when it is
+// lower, since a transaction paying less is not relayed.
+func (api *PublicMempoolAPI) minFeeRate(feeRate AtomPerByte) AtomPerByte {
+	minRate := AtomPerByte(float64(api.txPool.MinRelayFee()) / bytePerKb)
+	if feeRate < minRate {
+		return minRate
+	}
+	return feeRate
+}
+
+// EstimateFee returns the estimated fee rate in MEER/kB for a transaction to
+// be confirmed within the number of blocks.
+func (api *PublicMempoolAPI) EstimateFee(numBlocks int64) (interface{}, error) {
+	fe := api.txPool.cfg.FeeEstimator
+	if fe == nil {
+		return nil, rpc.RpcInternalError("Fee estimation disabled", "")
+	}
+	if numBlocks <= 0 {
+		return -1.0, rpc.RpcInvalidError("Parameter NumBlocks must be positive")
+	}
+
+	feeRate, err := fe.EstimateFee(uint32(numBlocks))
+	if err != nil {
+		return -1.0, rpc.RpcInvalidError("%s", err.Error())
+	}
+	return float64(api.minFeeRate(feeRate).ToCoinPerKb()), nil
+}
+
+// EstimateSmartFee returns the estimated fee rate in MEER/kB for a transaction
+// to be confirmed within the number of blocks, or within the lowest number of
+// blocks the estimator has data for when there isn't enough for the target.
+func (api *PublicMempoolAPI) EstimateSmartFee(confTarget int64) (interface{}, error) {
+	fe := api.txPool.cfg.FeeEstimator
+	if fe == nil {
+		return nil, rpc.RpcInternalError("Fee estimation disabled", "")
+	}
+	if confTarget <= 0 {
+		return nil, rpc.RpcInvalidError("Parameter ConfTarget must be positive")
+	}
+
+	feeRate, blocks, err := fe.EstimateSmartFee(uint32(confTarget))
+	result := json.EstimateSmartFeeResult{Blocks: int64(blocks)}
+	if err != nil {
+		result.Errors = []string{err.Error()}
+		return result, nil
+	}
+	coinPerKb := float64(api.minFeeRate(feeRate).ToCoinPerKb())
+	result.FeeRate = &coinPerKb
+	return result, nil
+}
@@ -79,4 +79,14 @@ type Config struct {
 
 	// block chain
 	BC *blockchain.BlockChain
+
+	// FeeEstimator provides a feeEstimator. If it is not nil, the mempool
+	// records all new transactions it observes into the feeEstimator.
+	FeeEstimator *FeeEstimator
+
+	// TxReplaced defines the function to call when a transaction accepted
+	// into the pool replaces some of its transactions, which are passed
+	// along with their descendants.  It is called with the mempool lock
+	// held.  This can be nil.
+	TxReplaced func(replacement *types.TxDesc, replaced []*types.TxDesc)
 }
@@ -0,0 +1,157 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Copyright (c) 2016 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/core/types/pow"
+)
+
+// estimateFeeTester creates transactions and blocks of increasing order for
+// the fee estimator.
+type estimateFeeTester struct {
+	ef      *FeeEstimator
+	version uint32
+	order   uint64
+}
+
+func (eft *estimateFeeTester) testTx(fee types.Amount) *TxDesc {
+	eft.version++
+	tx := types.NewTransaction()
+	tx.Version = eft.version
+	tx.AddTxIn(types.NewTxInput(types.NewOutPoint(&hash.Hash{1}, 0), nil))
+	tx.AddTxOut(types.NewTxOutput(1, []byte{0x51}))
+
+	return &TxDesc{
+		TxDesc: types.TxDesc{
+			Tx:  types.NewTx(tx),
+			Fee: int64(fee),
+		},
+	}
+}
+
+func (eft *estimateFeeTester) newBlock(txs []*TxDesc) *types.SerializedBlock {
+	eft.order++
+	block := &types.Block{}
+	block.Header.Pow = pow.GetInstance(pow.BLAKE2BD, uint32(eft.order), []byte{})
+	block.AddTransaction(types.NewTransaction())
+	for _, tx := range txs {
+		block.AddTransaction(tx.Tx.Tx)
+	}
+	sb := types.NewBlock(block)
+	sb.SetOrder(eft.order)
+	return sb
+}
+
+func expectedFeePerKilobyte(t *TxDesc) CoinPerKilobyte {
+	size := float64(t.Tx.Tx.SerializeSize())
+	fee := float64(t.Fee)
+	return AtomPerByte(fee / size).ToCoinPerKb()
+}
+
+func TestEstimateFee(t *testing.T) {
+	ef := NewFeeEstimator(DefaultEstimateFeeMaxRollback, 1)
+	eft := &estimateFeeTester{ef: ef}
+
+	// No estimate before a block is registered.
+	if _, err := ef.EstimateFee(1); err == nil {
+		t.Fatal("EstimateFee returned an estimate without any block")
+	}
+
+	// Transactions observed before the first block are ignored.
+	ef.ObserveTransaction(eft.testTx(1000000))
+	ef.RegisterBlock(eft.newBlock(nil))
+	if len(ef.observed) != 0 {
+		t.Fatalf("expected no observed tx, got %d", len(ef.observed))
+	}
+
+	// A high fee tx confirmed in the next block and a low fee tx
+	// confirmed two blocks later.
+	high := eft.testTx(1000000)
+	low := eft.testTx(10000)
+	ef.ObserveTransaction(high)
+	ef.ObserveTransaction(low)
+	ef.RegisterBlock(eft.newBlock([]*TxDesc{high}))
+	ef.RegisterBlock(eft.newBlock(nil))
+	last := eft.newBlock([]*TxDesc{low})
+	ef.RegisterBlock(last)
+
+	rate, err := ef.EstimateFee(1)
+	if err != nil {
+		t.Fatalf("EstimateFee: %v", err)
+	}
+	if rate.ToCoinPerKb() != expectedFeePerKilobyte(high) {
+		t.Errorf("estimate for 1 block: got %v, want %v",
+			rate.ToCoinPerKb(), expectedFeePerKilobyte(high))
+	}
+	rate, err = ef.EstimateFee(3)
+	if err != nil {
+		t.Fatalf("EstimateFee: %v", err)
+	}
+	if rate.ToCoinPerKb() != expectedFeePerKilobyte(low) {
+		t.Errorf("estimate for 3 blocks: got %v, want %v",
+			rate.ToCoinPerKb(), expectedFeePerKilobyte(low))
+	}
+
+	// No tx was confirmed in exactly 2 blocks, the estimate is the next
+	// fee rate after the ones confirmed in a single block.
+	rate, blocks, err := ef.EstimateSmartFee(2)
+	if err != nil || blocks != 2 || rate.ToCoinPerKb() != expectedFeePerKilobyte(low) {
+		t.Errorf("EstimateSmartFee(2): got %v for %d blocks, %v", rate, blocks, err)
+	}
+
+	// Rolling back the last block forgets the low fee tx.
+	if err := ef.Rollback(&hash.Hash{}); err == nil {
+		t.Error("Rollback of an unknown block succeeded")
+	}
+	if err := ef.Rollback(last.Hash()); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if len(ef.bin[2]) != 0 || ef.observed[*low.Tx.Hash()].mined != unminedOrder {
+		t.Error("the rolled back tx is still mined")
+	}
+}
+
+func TestSaveRestoreFeeEstimator(t *testing.T) {
+	ef := NewFeeEstimator(DefaultEstimateFeeMaxRollback, DefaultEstimateFeeMinRegisteredBlocks)
+	eft := &estimateFeeTester{ef: ef}
+	ef.RegisterBlock(eft.newBlock(nil))
+	for i := 0; i < 10; i++ {
+		var txs []*TxDesc
+		for j := 0; j < 5; j++ {
+			tx := eft.testTx(types.Amount(10000 * (i + j + 1)))
+			ef.ObserveTransaction(tx)
+			if j%2 == 0 {
+				txs = append(txs, tx)
+			}
+		}
+		ef.RegisterBlock(eft.newBlock(txs))
+	}
+
+	saved := ef.Save()
+	restored, err := RestoreFeeEstimator(saved)
+	if err != nil {
+		t.Fatalf("RestoreFeeEstimator: %v", err)
+	}
+	if !bytes.Equal(saved, restored.Save()) {
+		t.Fatal("the restored fee estimator differs from the saved one")
+	}
+	if restored.LastKnownOrder() != ef.LastKnownOrder() {
+		t.Fatalf("last known order: got %d, want %d",
+			restored.LastKnownOrder(), ef.LastKnownOrder())
+	}
+	for i := uint32(1); i <= estimateFeeDepth; i++ {
+		want, _ := ef.EstimateFee(i)
+		got, _ := restored.EstimateFee(i)
+		if got != want {
+			t.Errorf("estimate for %d blocks: got %v, want %v", i, got, want)
+		}
+	}
+}
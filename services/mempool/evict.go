@@ -0,0 +1,379 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bytes"
+	"container/heap"
+	"math"
+	"time"
+
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/log"
+)
+
+const (
+	// rollingFeeHalfLife is the time it takes for the minimum fee rate
+	// raised by the evictions from the full pool to decay by half.  It
+	// decays faster when the pool is far from full.
+	rollingFeeHalfLife = 12 * time.Hour
+
+	// rollingFeeUpdateInterval is the minimum time between two decays of
+	// the rolling minimum fee rate.
+	rollingFeeUpdateInterval = 10 * time.Second
+)
+
+// evictionFeeRate returns the fee rate used to choose the entry to evict from
+// the full pool along with its descendants.  It is the higher of its own fee
+// rate and the one of its descendant package, so that a transaction whose
+// descendants pay for it isn't evicted first.
+func evictionFeeRate(txD *TxDesc) int64 {
+	return packageEvictionRate(txD.FeePerKB, txD.DescendantFee, txD.DescendantSize)
+}
+
+// packageEvictionRate returns the eviction fee rate of an entry of the fee
+// rate with the descendant package of the fee and size.
+func packageEvictionRate(feePerKB int64, descendantFee int64, descendantSize int64) int64 {
+	rate := feePerKB
+	if descendantSize > 0 {
+		descRate := descendantFee * 1000 / descendantSize
+		if descRate > rate {
+			rate = descRate
+		}
+	}
+	return rate
+}
+
+// evictsBefore returns whether the entry a of the eviction fee rate rateA is
+// evicted before the entry b of the rate rateB.  The entries of the same rate
+// are evicted by hash, so that the evictions are predictable.
+func evictsBefore(rateA int64, a *TxDesc, rateB int64, b *TxDesc) bool {
+	if rateA != rateB {
+		return rateA < rateB
+	}
+	return bytes.Compare(a.Tx.Hash()[:], b.Tx.Hash()[:]) < 0
+}
+
+// evictionQueue implements a priority queue of the pool entries with the next
+// entry to evict on top.  The entries have to be fixed in the queue whenever
+// their descendant package changes.
+type evictionQueue []*TxDesc
+
+// Len returns the number of entries in the queue.  It is part of the
+// heap.Interface implementation.
+func (eq evictionQueue) Len() int {
+	return len(eq)
+}
+
+// Less returns whether the entry with index i is evicted before the one with
+// index j.  It is part of the heap.Interface implementation.
+func (eq evictionQueue) Less(i, j int) bool {
+	return evictsBefore(evictionFeeRate(eq[i]), eq[i], evictionFeeRate(eq[j]), eq[j])
+}
+
+// Swap swaps the entries at the passed indices.  It is part of the
+// heap.Interface implementation.
+func (eq evictionQueue) Swap(i, j int) {
+	eq[i], eq[j] = eq[j], eq[i]
+	eq[i].evictIndex = i
+	eq[j].evictIndex = j
+}
+
+// Push pushes the passed entry onto the queue.  It is part of the
+// heap.Interface implementation.
+func (eq *evictionQueue) Push(x interface{}) {
+	txD := x.(*TxDesc)
+	txD.evictIndex = len(*eq)
+	*eq = append(*eq, txD)
+}
+
+// Pop removes the last entry of the queue.  It is part of the heap.Interface
+// implementation.
+func (eq *evictionQueue) Pop() interface{} {
+	n := len(*eq)
+	txD := (*eq)[n-1]
+	(*eq)[n-1] = nil
+	*eq = (*eq)[:n-1]
+	txD.evictIndex = -1
+	return txD
+}
+
+// inEvictionQueue returns whether the entry is in the eviction queue of the
+// pool.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) inEvictionQueue(txD *TxDesc) bool {
+	i := txD.evictIndex
+	return i >= 0 && i < len(mp.evictQueue) && mp.evictQueue[i] == txD
+}
+
+// fixEviction restores the place of the entry in the eviction queue after its
+// descendant package changed.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) fixEviction(txD *TxDesc) {
+	if mp.inEvictionQueue(txD) {
+		heap.Fix(&mp.evictQueue, txD.evictIndex)
+	}
+}
+
+// trimToSize evicts the entries with the lowest fee rate along with their
+// descendants until the size of the pool doesn't exceed the limit of the
+// policy.  The rolling minimum fee rate is raised above the fee rate of the
+// evicted packages, so that they aren't accepted again right away.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) trimToSize() {
+	for mp.poolSize > mp.cfg.Policy.MaxPoolSize && len(mp.evictQueue) > 0 {
+		worst := mp.evictQueue[0]
+		worstRate := evictionFeeRate(worst)
+
+		// The next transaction has to pay the fee rate of the evicted
+		// package plus the minimum relay fee rate for its own relay.
+		minFee := float64(worstRate + int64(mp.cfg.Policy.MinRelayTxFee))
+		if minFee > mp.rollingMinFee {
+			mp.rollingMinFee = minFee
+		}
+		mp.lastRollingFeeUpdate = time.Now()
+
+		log.Debug("Evicting transaction from the full mempool",
+			"tx", worst.Tx.Hash(), "feePerKB", worstRate,
+			"descendants", worst.DescendantCount-1)
+		mp.removeTransaction(worst.Tx, true)
+	}
+}
+
+// evictionCandidate is an entry of the pool, or the transaction to admit, at
+// the eviction fee rate it had when it was queued during the replay of
+// wouldEvict.
+type evictionCandidate struct {
+	txD  *TxDesc
+	rate int64
+
+	// index is the index of the entry in the eviction queue of the pool,
+	// or -1 if it was queued because its package changed.
+	index int
+}
+
+// evictionCandidates implements a priority queue of the eviction candidates
+// with the next candidate to evict on top.
+type evictionCandidates []*evictionCandidate
+
+// Len returns the number of candidates in the queue.  It is part of the
+// heap.Interface implementation.
+func (ec evictionCandidates) Len() int {
+	return len(ec)
+}
+
+// Less returns whether the candidate with index i is evicted before the one
+// with index j.  It is part of the heap.Interface implementation.
+func (ec evictionCandidates) Less(i, j int) bool {
+	return evictsBefore(ec[i].rate, ec[i].txD, ec[j].rate, ec[j].txD)
+}
+
+// Swap swaps the candidates at the passed indices.  It is part of the
+// heap.Interface implementation.
+func (ec evictionCandidates) Swap(i, j int) {
+	ec[i], ec[j] = ec[j], ec[i]
+}
+
+// Push pushes the passed candidate onto the queue.  It is part of the
+// heap.Interface implementation.
+func (ec *evictionCandidates) Push(x interface{}) {
+	*ec = append(*ec, x.(*evictionCandidate))
+}
+
+// Pop removes the last candidate of the queue.  It is part of the
+// heap.Interface implementation.
+func (ec *evictionCandidates) Pop() interface{} {
+	n := len(*ec)
+	c := (*ec)[n-1]
+	(*ec)[n-1] = nil
+	*ec = (*ec)[:n-1]
+	return c
+}
+
+// wouldEvict returns whether trimToSize would evict the transaction with the
+// fee right after adding it to the pool in place of its conflicts, which
+// include their descendants.  The evictions are replayed without changing
+// the pool.  The entries are visited from the top of the eviction queue, and
+// the entries whose descendant package changes during the replay are queued
+// again with their new fee rate, so only the evicted entries and their
+// ancestors are visited.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) wouldEvict(tx *types.Tx, fee int64, conflicts map[hash.Hash]*types.Tx) bool {
+	size := int64(tx.Transaction().SerializeSize())
+	excess := mp.poolSize + size - mp.cfg.Policy.MaxPoolSize
+	for h := range conflicts {
+		excess -= int64(mp.pool[h].Tx.Transaction().SerializeSize())
+	}
+	if excess <= 0 {
+		return false
+	}
+
+	txD := &TxDesc{
+		TxDesc: types.TxDesc{
+			Tx:       tx,
+			Fee:      fee,
+			FeePerKB: fee * 1000 / size,
+		},
+		DescendantFee:   fee,
+		DescendantSize:  size,
+		DescendantCount: 1,
+	}
+	var candidates evictionCandidates
+	heap.Push(&candidates, &evictionCandidate{txD: txD, rate: evictionFeeRate(txD), index: -1})
+	if len(mp.evictQueue) > 0 {
+		top := mp.evictQueue[0]
+		heap.Push(&candidates, &evictionCandidate{txD: top, rate: evictionFeeRate(top), index: 0})
+	}
+
+	// The changes of the descendant packages of the entries during the
+	// replay are kept aside.
+	type packageChange struct {
+		fee  int64
+		size int64
+	}
+	changes := make(map[hash.Hash]*packageChange)
+	rate := func(entry *TxDesc) int64 {
+		c, ok := changes[*entry.Tx.Hash()]
+		if !ok {
+			return evictionFeeRate(entry)
+		}
+		return packageEvictionRate(entry.FeePerKB, entry.DescendantFee+c.fee,
+			entry.DescendantSize+c.size)
+	}
+	change := func(entry *TxDesc, fee int64, size int64) {
+		c, ok := changes[*entry.Tx.Hash()]
+		if !ok {
+			c = &packageChange{}
+			changes[*entry.Tx.Hash()] = c
+		}
+		c.fee += fee
+		c.size += size
+		heap.Push(&candidates, &evictionCandidate{txD: entry, rate: rate(entry), index: -1})
+	}
+
+	// remove takes the entries out of the replayed pool and out of the
+	// packages of their remaining ancestors.
+	removed := make(map[hash.Hash]bool)
+	cache := make(map[hash.Hash]map[hash.Hash]*types.Tx)
+	remove := func(entries map[hash.Hash]*types.Tx) {
+		for h := range entries {
+			removed[h] = true
+		}
+		for h, entryTx := range entries {
+			entry := mp.pool[h]
+			entrySize := int64(entryTx.Transaction().SerializeSize())
+			for a := range mp.txAncestors(entryTx, cache) {
+				if !removed[a] {
+					change(mp.pool[a], -entry.Fee, -entrySize)
+				}
+			}
+		}
+	}
+	remove(conflicts)
+	ancestors := mp.txAncestors(tx, cache)
+	for h := range ancestors {
+		if !removed[h] {
+			change(mp.pool[h], fee, size)
+		}
+	}
+
+	for excess > 0 {
+		c := heap.Pop(&candidates).(*evictionCandidate)
+		if c.index >= 0 {
+			for _, i := range []int{2*c.index + 1, 2*c.index + 2} {
+				if i < len(mp.evictQueue) {
+					entry := mp.evictQueue[i]
+					heap.Push(&candidates, &evictionCandidate{txD: entry,
+						rate: evictionFeeRate(entry), index: i})
+				}
+			}
+		}
+		if c.txD == txD {
+			return true
+		}
+		h := *c.txD.Tx.Hash()
+		if removed[h] {
+			continue
+		}
+
+		// The candidate is queued again if its package changed since,
+		// the lower fee rates are already queued.
+		if r := rate(c.txD); r != c.rate {
+			if r > c.rate {
+				heap.Push(&candidates, &evictionCandidate{txD: c.txD, rate: r, index: -1})
+			}
+			continue
+		}
+
+		evicted := mp.txDescendants(c.txD.Tx, nil)
+		evicted[h] = c.txD.Tx
+		for eh, evictedTx := range evicted {
+			if removed[eh] {
+				delete(evicted, eh)
+				continue
+			}
+			if _, ok := ancestors[eh]; ok {
+				return true
+			}
+			excess -= int64(evictedTx.Transaction().SerializeSize())
+		}
+		remove(evicted)
+	}
+	return false
+}
+
+// minRelayFee returns the minimum fee rate in atoms/kB of the transactions to
+// accept into the pool, which is the minimum relay fee rate of the policy
+// unless the rolling minimum fee rate raised by evictions is higher.  The
+// rolling fee rate decays with a half-life, which is shorter when the pool is
+// less than half full, and is reset once it is lower than half the minimum
+// relay fee rate.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) minRelayFee() types.Amount {
+	policyFee := mp.cfg.Policy.MinRelayTxFee
+	if mp.rollingMinFee == 0 {
+		return policyFee
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(mp.lastRollingFeeUpdate)
+	if elapsed > rollingFeeUpdateInterval {
+		halfLife := rollingFeeHalfLife
+		if mp.poolSize < mp.cfg.Policy.MaxPoolSize/4 {
+			halfLife /= 4
+		} else if mp.poolSize < mp.cfg.Policy.MaxPoolSize/2 {
+			halfLife /= 2
+		}
+		mp.rollingMinFee /= math.Pow(2, float64(elapsed)/float64(halfLife))
+		mp.lastRollingFeeUpdate = now
+
+		if mp.rollingMinFee < float64(policyFee)/2 {
+			mp.rollingMinFee = 0
+			return policyFee
+		}
+	}
+
+	if rollingFee := types.Amount(mp.rollingMinFee); rollingFee > policyFee {
+		return rollingFee
+	}
+	return policyFee
+}
+
+// MinRelayFee returns the minimum fee rate in atoms/kB a transaction has to
+// pay to be accepted into the pool, which rises above the minimum relay fee
+// rate of the policy when transactions are evicted from the full pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MinRelayFee() types.Amount {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+	return mp.minRelayFee()
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"testing"
+
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/types"
+)
+
+func TestTrimToSize(t *testing.T) {
+	minRelayFee := types.Amount(DefaultMinRelayTxFee)
+	mp := New(&Config{Policy: Policy{MinRelayTxFee: minRelayFee}})
+
+	// A pays a low fee but its child B pays for it, C pays a medium fee.
+	txA := newTestTx(types.MaxTxInSequenceNum, types.NewOutPoint(&hash.Hash{1}, 0))
+	txB := newTestTx(types.MaxTxInSequenceNum, types.NewOutPoint(txA.Hash(), 0))
+	txC := newTestTx(types.MaxTxInSequenceNum, types.NewOutPoint(&hash.Hash{2}, 0))
+	addTestTx(mp, txA, 1000)
+	addTestTx(mp, txB, 100000)
+	addTestTx(mp, txC, 20000)
+
+	mp.cfg.Policy.MaxPoolSize = mp.poolSize
+	mp.trimToSize()
+	if len(mp.pool) != 3 || mp.minRelayFee() != minRelayFee {
+		t.Fatal("transactions evicted from a pool which isn't full")
+	}
+
+	// C is evicted rather than A whose package pays more.
+	mp.cfg.Policy.MaxPoolSize = mp.poolSize - 1
+	mp.trimToSize()
+	if len(mp.pool) != 2 || mp.pool[*txC.Hash()] != nil {
+		t.Fatalf("unexpected pool after eviction %v", mp.pool)
+	}
+	if mp.poolSize != int64(txA.Tx.SerializeSize()+txB.Tx.SerializeSize()) {
+		t.Fatalf("unexpected pool size %d", mp.poolSize)
+	}
+
+	// The minimum fee rate is raised above the one of the evicted entry.
+	feePerKB := 20000 * 1000 / int64(txC.Tx.SerializeSize())
+	want := types.Amount(feePerKB) + minRelayFee
+	if got := mp.minRelayFee(); got != want {
+		t.Fatalf("minRelayFee: got %v, want %v", got, want)
+	}
+
+	// Evicting A also evicts its descendant B.
+	mp.cfg.Policy.MaxPoolSize = 1
+	mp.trimToSize()
+	if len(mp.pool) != 0 || mp.poolSize != 0 {
+		t.Fatalf("pool not emptied, %d entries of %d bytes", len(mp.pool),
+			mp.poolSize)
+	}
+}
+
+func TestWouldEvict(t *testing.T) {
+	minRelayFee := types.Amount(DefaultMinRelayTxFee)
+	coinC := types.NewOutPoint(&hash.Hash{2}, 0)
+	coinD := types.NewOutPoint(&hash.Hash{3}, 0)
+
+	// A pays a low fee with its child B, C pays a medium fee and is
+	// replaced by R which is larger.
+	newPool := func() (*TxPool, *types.Tx) {
+		mp := New(&Config{Policy: Policy{MinRelayTxFee: minRelayFee}})
+		txA := newTestTx(types.MaxTxInSequenceNum, types.NewOutPoint(&hash.Hash{1}, 0))
+		txB := newTestTx(types.MaxTxInSequenceNum, types.NewOutPoint(txA.Hash(), 0))
+		txC := newTestTx(MaxRBFSequence, coinC)
+		addTestTx(mp, txA, 1000)
+		addTestTx(mp, txB, 2000)
+		addTestTx(mp, txC, 20000)
+		mp.cfg.Policy.MaxPoolSize = mp.poolSize
+		return mp, txC
+	}
+	tests := []struct {
+		fee     int64
+		evicted bool
+	}{
+		{fee: 500, evicted: true},
+		{fee: 30000, evicted: false},
+	}
+	for _, test := range tests {
+		mp, txC := newPool()
+		txR := newTestTx(MaxRBFSequence, coinC, coinD)
+		conflicts := mp.txConflicts(txR)
+		if evicted := mp.wouldEvict(txR, test.fee, conflicts); evicted != test.evicted {
+			t.Fatalf("fee %d: wouldEvict %v, expected %v", test.fee, evicted, test.evicted)
+		}
+
+		// The replay matches the evictions of the pool.
+		mp.removeTransaction(txC, true)
+		addTestTx(mp, txR, test.fee)
+		mp.trimToSize()
+		if evicted := mp.pool[*txR.Hash()] == nil; evicted != test.evicted {
+			t.Fatalf("fee %d: evicted %v, expected %v", test.fee, evicted, test.evicted)
+		}
+		if len(mp.evictQueue) != len(mp.pool) {
+			t.Fatalf("fee %d: %d entries in the eviction queue of %d", test.fee,
+				len(mp.evictQueue), len(mp.pool))
+		}
+	}
+
+	// A transaction which isn't replacing any fits in the pool only if its
+	// fee rate is higher than the package of A.
+	mp, _ := newPool()
+	if !mp.wouldEvict(newTestTx(types.MaxTxInSequenceNum, coinD), 100, nil) {
+		t.Fatal("transaction of the lowest fee rate kept in the full pool")
+	}
+	if mp.wouldEvict(newTestTx(types.MaxTxInSequenceNum, coinD), 100000, nil) {
+		t.Fatal("transaction of the highest fee rate evicted from the full pool")
+	}
+}
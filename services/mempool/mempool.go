@@ -6,6 +6,7 @@
 package mempool
 
 import (
+	"container/heap"
 	"container/list"
 	"fmt"
 	"github.com/Qitmeer/qitmeer/common/hash"
@@ -35,6 +36,17 @@ type TxPool struct {
 
 	pennyTotal    float64 // exponentially decaying total for penny spends.
 	lastPennyUnix int64   // unix time of last ``penny spend''
+
+	// poolSize is the total size in bytes of the transactions in the pool.
+	poolSize int64
+
+	// rollingMinFee is the minimum fee rate in atoms/kB raised by the
+	// evictions from the full pool, which decays from lastRollingFeeUpdate.
+	rollingMinFee        float64
+	lastRollingFeeUpdate time.Time
+
+	// evictQueue orders the entries by eviction fee rate for trimToSize.
+	evictQueue evictionQueue
 }
 
 // New returns a new memory pool for validating and storing standalone
@@ -57,6 +69,17 @@ type TxDesc struct {
 	// StartingPriority is the priority of the transaction when it was added
 	// to the pool.
 	StartingPriority float64
+
+	// DescendantFee, DescendantSize and DescendantCount are the total fee,
+	// size and number of the transactions in the package made of the entry
+	// and its descendants in the pool.
+	DescendantFee   int64
+	DescendantSize  int64
+	DescendantCount int
+
+	// evictIndex is the index of the entry in the eviction queue of the
+	// pool.
+	evictIndex int
 }
 
 // TxDescs returns a slice of descriptors for all the transactions in the pool.
@@ -101,12 +124,19 @@ func (mp *TxPool) removeTransaction(theTx *types.Tx, removeRedeemers bool) {
 		if mp.cfg.AddrIndex != nil {
 			mp.cfg.AddrIndex.RemoveUnconfirmedTx(txHash)
 		}
+		mp.removeFromPackages(txDesc)
+		if mp.inEvictionQueue(txDesc) {
+			heap.Remove(&mp.evictQueue, txDesc.evictIndex)
+		}
+
 		// Mark the referenced outpoints as unspent by the pool.
 
 		for _, txIn := range txDesc.Tx.Transaction().TxIn {
 			delete(mp.outpoints, txIn.PreviousOut)
 		}
 		delete(mp.pool, *txHash)
+		mp.poolSize -= int64(txDesc.Tx.Transaction().SerializeSize())
+		mp.updatePoolMetrics()
 		atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
 	}
 }
@@ -168,6 +198,10 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint,
 	for _, txIn := range msgTx.TxIn {
 		mp.outpoints[txIn.PreviousOut] = tx
 	}
+	mp.addToPackages(txD)
+	heap.Push(&mp.evictQueue, txD)
+	mp.poolSize += int64(msgTx.SerializeSize())
+	mp.updatePoolMetrics()
 	atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
 
 	// Add unconfirmed address index entries associated with the transaction
@@ -178,6 +212,11 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint,
 	if mp.cfg.ExistsAddrIndex != nil {
 		mp.cfg.ExistsAddrIndex.AddUnconfirmedTx(msgTx)
 	}
+
+	// Record this tx for fee estimation if enabled.
+	if mp.cfg.FeeEstimator != nil {
+		mp.cfg.FeeEstimator.ObserveTransaction(txD)
+	}
 	return txD
 }
 
@@ -272,7 +311,9 @@ func (mp *TxPool) maybeAcceptTransaction(tx *types.Tx, isNew, rateLimit, allowHi
 	// at this point.  There is a more in-depth check that happens later
 	// after fetching the referenced transaction inputs from the main chain
 	// which examines the actual spend data and prevents double spends.
-	err = mp.checkPoolDoubleSpend(tx)
+	// A transaction spending the coins of pool transactions which signal
+	// replacement is a replacement, checked further once its fee is known.
+	isReplacement, err := mp.checkPoolDoubleSpend(tx)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -395,8 +436,7 @@ func (mp *TxPool) maybeAcceptTransaction(tx *types.Tx, isNew, rateLimit, allowHi
 
 	// Don't allow transactions with fees too low to get into a mined block.
 	serializedSize := int64(msgTx.SerializeSize())
-	minFee := calcMinRequiredTxRelayFee(serializedSize,
-		mp.cfg.Policy.MinRelayTxFee)
+	minFee := calcMinRequiredTxRelayFee(serializedSize, mp.minRelayFee())
 	if txFee < minFee {
 		str := fmt.Sprintf("transaction %v has %v fees which "+
 			"is under the required amount of %v", txHash,
@@ -461,6 +501,34 @@ func (mp *TxPool) maybeAcceptTransaction(tx *types.Tx, isNew, rateLimit, allowHi
 		}
 	}
 
+	// If the transaction has any conflicts and we've made it this far,
+	// then we're processing a potential replacement.
+	var conflicts map[hash.Hash]*types.Tx
+	if isReplacement {
+		conflicts, err = mp.validateReplacement(tx, txFee)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Don't allow the transaction to depend on too many unconfirmed
+	// transactions, since they have to be mined along with it.
+	ancestorCount, ancestorSize := mp.ancestorPackage(tx)
+	err = checkAncestorLimits(tx, ancestorCount, ancestorSize,
+		&mp.cfg.Policy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Reject the transaction before replacing its conflicts if the pool
+	// is full and it would be evicted right away, since the replaced
+	// transactions would be lost along with it.
+	if mp.wouldEvict(tx, txFee, conflicts) {
+		str := fmt.Sprintf("transaction %v would be evicted from the "+
+			"full mempool", txHash)
+		return nil, nil, txRuleError(message.RejectInsufficientFee, str)
+	}
+
 	// Verify crypto signatures for each input and reject the transaction if
 	// any don't verify.
 	flags, err := mp.cfg.Policy.StandardVerifyFlags()
@@ -476,9 +544,32 @@ func (mp *TxPool) maybeAcceptTransaction(tx *types.Tx, isNew, rateLimit, allowHi
 		return nil, nil, err
 	}
 
-	// Add to transaction pool.
+	// Now that we've deemed the transaction as valid, we can add it to the
+	// mempool.  If it ended up replacing any transactions, we'll remove
+	// them first.
+	replaced := make([]*types.TxDesc, 0, len(conflicts))
+	for h := range conflicts {
+		replaced = append(replaced, &mp.pool[h].TxDesc)
+	}
+	for _, conflict := range conflicts {
+		log.Debug("Replacing transaction", "tx", conflict.Hash(),
+			"replacement", txHash)
+		mp.removeTransaction(conflict, true)
+	}
 	txD := mp.addTransaction(utxoView, tx, nextBlockHeight, txFee)
 
+	// Evict the packages with the lowest fee rate when the pool is full,
+	// which doesn't include the transaction itself as checked above.
+	mp.trimToSize()
+	if _, exists := mp.pool[*txHash]; !exists {
+		str := fmt.Sprintf("transaction %v has been evicted from the "+
+			"full mempool", txHash)
+		return nil, nil, txRuleError(message.RejectInsufficientFee, str)
+	}
+	if len(replaced) > 0 && mp.cfg.TxReplaced != nil {
+		mp.cfg.TxReplaced(&txD.TxDesc, replaced)
+	}
+
 	log.Debug("Accepted transaction", "txHash", txHash, "pool size", len(mp.pool))
 
 	return nil, txD, nil
@@ -532,6 +623,7 @@ func (mp *TxPool) ProcessTransaction(tx *types.Tx, allowOrphan, rateLimit, allow
 	var err error
 	defer func() {
 		if err != nil {
+			rejectedTxsCounter.Inc(1)
 			log.Trace("Failed to process transaction", "tx", tx.Hash(), "err", err.Error())
 		}
 	}()
@@ -559,6 +651,7 @@ func (mp *TxPool) ProcessTransaction(tx *types.Tx, allowOrphan, rateLimit, allow
 		for _, td := range newTxs {
 			acceptedTxs = append(acceptedTxs, &td.TxDesc)
 		}
+		acceptedTxsCounter.Inc(int64(len(acceptedTxs)))
 
 		return acceptedTxs, nil
 	}
@@ -578,7 +671,8 @@ func (mp *TxPool) ProcessTransaction(tx *types.Tx, allowOrphan, rateLimit, allow
 		str := fmt.Sprintf("orphan transaction %v references "+
 			"outputs of unknown or fully-spent "+
 			"transaction %v", tx.Hash(), missingParents[0])
-		return nil, txRuleError(message.RejectDuplicate, str)
+		err = txRuleError(message.RejectDuplicate, str)
+		return nil, err
 	}
 
 	// Potentially add the orphan transaction to the orphan pool.
@@ -816,6 +910,27 @@ func (mp *TxPool) FetchTransaction(txHash *hash.Hash) (*types.Tx, error) {
 	return nil, fmt.Errorf("transaction is not in the pool")
 }
 
+// FetchSpendingTx returns the transaction of the pool spending the outpoint
+// along with the index of its input spending it, or nil when the outpoint
+// isn't spent by the pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) FetchSpendingTx(outpoint *types.TxOutPoint) (*types.Tx, uint32) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	tx, exists := mp.outpoints[*outpoint]
+	if !exists {
+		return nil, 0
+	}
+	for i, txIn := range tx.Tx.TxIn {
+		if txIn.PreviousOut == *outpoint {
+			return tx, uint32(i)
+		}
+	}
+	return nil, 0
+}
+
 // HaveAllTransactions returns whether or not all of the passed transaction
 // hashes exist in the mempool.
 //
@@ -922,7 +1037,10 @@ func (mp *TxPool) MiningDescs() []*types.TxDesc {
 	descs := make([]*types.TxDesc, len(mp.pool))
 	i := 0
 	for _, desc := range mp.pool {
-		descs[i] = &desc.TxDesc
+		// The package stats of the entries change as the pool does, so
+		// a copy is returned.
+		miningDesc := desc.TxDesc
+		descs[i] = &miningDesc
 		i++
 	}
 	mp.mtx.RUnlock()
@@ -0,0 +1,32 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"github.com/Qitmeer/qitmeer/metrics"
+)
+
+var (
+	// poolTxsGauge is the number of transactions in the pool.
+	poolTxsGauge = metrics.NewGauge("mempool/txs")
+
+	// poolBytesGauge is the total size of the transactions in the pool.
+	poolBytesGauge = metrics.NewGauge("mempool/bytes")
+
+	// acceptedTxsCounter counts the transactions accepted into the pool,
+	// including the orphans accepted along with their parents.
+	acceptedTxsCounter = metrics.NewCounter("mempool/accepted")
+
+	// rejectedTxsCounter counts the transactions rejected by the pool.
+	rejectedTxsCounter = metrics.NewCounter("mempool/rejected")
+)
+
+// updatePoolMetrics updates the size metrics of the pool.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) updatePoolMetrics() {
+	poolTxsGauge.Update(int64(len(mp.pool)))
+	poolBytesGauge.Update(mp.poolSize)
+}
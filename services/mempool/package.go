@@ -0,0 +1,113 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"github.com/Qitmeer/qitmeer/core/types"
+)
+
+// ancestorPackage returns the number of transactions and the total size in
+// bytes of the package made of the passed transaction and its unconfirmed
+// ancestors in the pool.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) ancestorPackage(tx *types.Tx) (int, int64) {
+	count := 1
+	size := int64(tx.Transaction().SerializeSize())
+	for h := range mp.txAncestors(tx, nil) {
+		count++
+		size += int64(mp.pool[h].Tx.Transaction().SerializeSize())
+	}
+	return count, size
+}
+
+// calcAncestorStats recalculates the ancestor package of the entry from the
+// transactions in the pool.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) calcAncestorStats(txD *TxDesc) {
+	txD.AncestorFee = txD.Fee
+	txD.AncestorSize = int64(txD.Tx.Transaction().SerializeSize())
+	txD.AncestorCount = 1
+	for h := range mp.txAncestors(txD.Tx, nil) {
+		ancestor := mp.pool[h]
+		txD.AncestorFee += ancestor.Fee
+		txD.AncestorSize += int64(ancestor.Tx.Transaction().SerializeSize())
+		txD.AncestorCount++
+	}
+}
+
+// calcDescendantStats recalculates the descendant package of the entry from
+// the transactions in the pool.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) calcDescendantStats(txD *TxDesc) {
+	txD.DescendantFee = txD.Fee
+	txD.DescendantSize = int64(txD.Tx.Transaction().SerializeSize())
+	txD.DescendantCount = 1
+	for h := range mp.txDescendants(txD.Tx, nil) {
+		descendant := mp.pool[h]
+		txD.DescendantFee += descendant.Fee
+		txD.DescendantSize += int64(descendant.Tx.Transaction().SerializeSize())
+		txD.DescendantCount++
+	}
+}
+
+// addToPackages sets the package stats of the entry which has just been added
+// to the pool and accounts it in the packages of its ancestors and descendants.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) addToPackages(txD *TxDesc) {
+	ancestors := mp.txAncestors(txD.Tx, nil)
+	descendants := mp.txDescendants(txD.Tx, nil)
+	mp.calcAncestorStats(txD)
+	mp.calcDescendantStats(txD)
+
+	// A new transaction has no descendants, so it only joins the
+	// descendant packages of its ancestors.
+	size := int64(txD.Tx.Transaction().SerializeSize())
+	if len(descendants) == 0 {
+		for h := range ancestors {
+			ancestor := mp.pool[h]
+			ancestor.DescendantFee += txD.Fee
+			ancestor.DescendantSize += size
+			ancestor.DescendantCount++
+			mp.fixEviction(ancestor)
+		}
+		return
+	}
+
+	// The transactions of a disconnected block are added back while their
+	// descendants are still in the pool, which links packages together, so
+	// they are recalculated.
+	for h := range descendants {
+		mp.calcAncestorStats(mp.pool[h])
+	}
+	for h := range ancestors {
+		mp.calcDescendantStats(mp.pool[h])
+		mp.fixEviction(mp.pool[h])
+	}
+}
+
+// removeFromPackages removes the entry which is about to be removed from the
+// pool from the packages of its ancestors and descendants.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) removeFromPackages(txD *TxDesc) {
+	size := int64(txD.Tx.Transaction().SerializeSize())
+	for h := range mp.txAncestors(txD.Tx, nil) {
+		ancestor := mp.pool[h]
+		ancestor.DescendantFee -= txD.Fee
+		ancestor.DescendantSize -= size
+		ancestor.DescendantCount--
+		mp.fixEviction(ancestor)
+	}
+	for h := range mp.txDescendants(txD.Tx, nil) {
+		descendant := mp.pool[h]
+		descendant.AncestorFee -= txD.Fee
+		descendant.AncestorSize -= size
+		descendant.AncestorCount--
+	}
+}
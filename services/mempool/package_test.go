@@ -0,0 +1,67 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"testing"
+
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/types"
+)
+
+func TestPackages(t *testing.T) {
+	mp := New(&Config{Policy: Policy{
+		MaxAncestorCount: 2,
+		MaxAncestorSize:  DefaultMaxAncestorSize,
+	}})
+
+	// A chain of transactions A <- B <- C.
+	txA := newTestTx(types.MaxTxInSequenceNum, types.NewOutPoint(&hash.Hash{1}, 0))
+	txB := newTestTx(types.MaxTxInSequenceNum, types.NewOutPoint(txA.Hash(), 0))
+	txC := newTestTx(types.MaxTxInSequenceNum, types.NewOutPoint(txB.Hash(), 0))
+	addTestTx(mp, txA, 1000)
+	addTestTx(mp, txB, 2000)
+
+	count, size := mp.ancestorPackage(txC)
+	if count != 3 {
+		t.Fatalf("ancestor count: got %d, want 3", count)
+	}
+	if err := checkAncestorLimits(txC, count, size, &mp.cfg.Policy); err == nil {
+		t.Fatal("transaction exceeding the ancestor limit accepted")
+	}
+	addTestTx(mp, txC, 4000)
+
+	descA, descB, descC := mp.pool[*txA.Hash()], mp.pool[*txB.Hash()], mp.pool[*txC.Hash()]
+	if descC.AncestorFee != 7000 || descC.AncestorCount != 3 ||
+		descC.AncestorSize != descA.AncestorSize*3 {
+		t.Fatalf("unexpected ancestor package of C: %d fee, %d bytes, %d txs",
+			descC.AncestorFee, descC.AncestorSize, descC.AncestorCount)
+	}
+	if descA.DescendantFee != 7000 || descA.DescendantCount != 3 {
+		t.Fatalf("unexpected descendant package of A: %d fee, %d txs",
+			descA.DescendantFee, descA.DescendantCount)
+	}
+
+	// Mining A removes it from the packages of its descendants.
+	mp.removeTransaction(txA, false)
+	if descC.AncestorFee != 6000 || descC.AncestorCount != 2 {
+		t.Fatalf("unexpected ancestor package of C: %d fee, %d txs",
+			descC.AncestorFee, descC.AncestorCount)
+	}
+
+	// Adding A back from a disconnected block links the packages again.
+	addTestTx(mp, txA, 1000)
+	descA = mp.pool[*txA.Hash()]
+	if descC.AncestorFee != 7000 || descA.DescendantCount != 3 {
+		t.Fatal("the packages weren't recalculated")
+	}
+
+	// Removing C removes it from the packages of its ancestors.
+	mp.removeTransaction(txC, true)
+	if descA.DescendantFee != 3000 || descB.DescendantCount != 1 {
+		t.Fatalf("unexpected descendant packages: A %d fee, B %d txs",
+			descA.DescendantFee, descB.DescendantCount)
+	}
+}
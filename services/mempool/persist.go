@@ -0,0 +1,192 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/log"
+)
+
+const (
+	// MempoolFileName is the name of the file the mempool is saved to in
+	// the data directory.
+	MempoolFileName = "mempool.dat"
+
+	// mempoolFileVersion is the version of the format of the mempool file.
+	mempoolFileVersion = 1
+
+	// maxSavedTxs is the maximum number of transactions read from a
+	// mempool file, which prevents a corrupted count from allocating a
+	// huge amount of memory.
+	maxSavedTxs = 10000000
+)
+
+// savedTx is a transaction read from a mempool file along with the time it
+// was first seen.
+type savedTx struct {
+	tx    *types.Tx
+	added time.Time
+}
+
+// savedTxsByAncestors returns the transactions and added times of the entries
+// sorted by number of ancestors, so that the parents are written before their
+// children and can be accepted again in the same order.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func savedTxsByAncestors(descs []*TxDesc) []*savedTx {
+	sort.SliceStable(descs, func(i, j int) bool {
+		return descs[i].AncestorCount < descs[j].AncestorCount
+	})
+	txs := make([]*savedTx, 0, len(descs))
+	for _, txD := range descs {
+		txs = append(txs, &savedTx{tx: txD.Tx, added: txD.Added})
+	}
+	return txs
+}
+
+// writeMempoolFile serializes the transactions to w in the given order.
+func writeMempoolFile(w io.Writer, txs []*savedTx) error {
+	err := binary.Write(w, binary.BigEndian, uint32(mempoolFileVersion))
+	if err != nil {
+		return err
+	}
+	err = binary.Write(w, binary.BigEndian, uint32(len(txs)))
+	if err != nil {
+		return err
+	}
+	for _, stx := range txs {
+		err = binary.Write(w, binary.BigEndian, stx.added.Unix())
+		if err != nil {
+			return err
+		}
+		err = stx.tx.Tx.Encode(w, 0, types.TxSerializeFull)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readMempoolFile deserializes the transactions written by writeMempoolFile
+// from r.
+func readMempoolFile(r io.Reader) ([]*savedTx, error) {
+	var version, count uint32
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return nil, err
+	}
+	if version != mempoolFileVersion {
+		return nil, fmt.Errorf("unsupported mempool file version %d", version)
+	}
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, err
+	}
+	if count > maxSavedTxs {
+		return nil, fmt.Errorf("mempool file has too many transactions %d",
+			count)
+	}
+
+	txs := make([]*savedTx, 0, count)
+	for i := uint32(0); i < count; i++ {
+		var added int64
+		if err := binary.Read(r, binary.BigEndian, &added); err != nil {
+			return nil, err
+		}
+		msgTx := types.NewTransaction()
+		if err := msgTx.Decode(r, 0); err != nil {
+			return nil, err
+		}
+		txs = append(txs, &savedTx{
+			tx:    types.NewTx(msgTx),
+			added: time.Unix(added, 0),
+		})
+	}
+	return txs, nil
+}
+
+// Save writes the transactions of the pool along with the time they were first
+// seen to the file, so that they can be loaded back after a restart.  The file
+// is replaced atomically.  It returns the number of saved transactions.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Save(path string) (int, error) {
+	mp.mtx.RLock()
+	descs := make([]*TxDesc, 0, len(mp.pool))
+	for _, txD := range mp.pool {
+		descs = append(descs, txD)
+	}
+	txs := savedTxsByAncestors(descs)
+	mp.mtx.RUnlock()
+
+	tmpPath := path + ".new"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return 0, err
+	}
+	w := bufio.NewWriter(file)
+	err = writeMempoolFile(w, txs)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return 0, err
+	}
+	return len(txs), nil
+}
+
+// Load reads the transactions saved to the file and processes them again as
+// new transactions, so that only the ones still valid are accepted into the
+// pool.  The accepted transactions keep the time they were first seen.  It
+// returns the number of accepted and rejected transactions.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Load(path string) (int, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	txs, err := readMempoolFile(bufio.NewReader(file))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var accepted, failed int
+	for _, saved := range txs {
+		_, err := mp.ProcessTransaction(saved.tx, false, false, true)
+		if err != nil {
+			log.Debug("Failed to load transaction into the mempool",
+				"tx", saved.tx.Hash(), "error", err)
+			failed++
+			continue
+		}
+		accepted++
+
+		mp.mtx.Lock()
+		if txD, ok := mp.pool[*saved.tx.Hash()]; ok {
+			txD.Added = saved.added
+		}
+		mp.mtx.Unlock()
+	}
+	return accepted, failed, nil
+}
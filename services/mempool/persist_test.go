@@ -0,0 +1,54 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/types"
+)
+
+func TestMempoolFile(t *testing.T) {
+	mp := New(&Config{Policy: Policy{MinRelayTxFee: types.Amount(DefaultMinRelayTxFee)}})
+
+	// B spends A and is added first, it has to be written after A.
+	txA := newTestTx(types.MaxTxInSequenceNum, types.NewOutPoint(&hash.Hash{1}, 0))
+	txB := newTestTx(types.MaxTxInSequenceNum, types.NewOutPoint(txA.Hash(), 0))
+	addTestTx(mp, txA, 10000)
+	addTestTx(mp, txB, 10000)
+	added := time.Unix(1600000000, 0)
+	mp.pool[*txA.Hash()].Added = added
+	mp.pool[*txB.Hash()].Added = added.Add(time.Minute)
+
+	var buf bytes.Buffer
+	descs := []*TxDesc{mp.pool[*txB.Hash()], mp.pool[*txA.Hash()]}
+	if err := writeMempoolFile(&buf, savedTxsByAncestors(descs)); err != nil {
+		t.Fatalf("writeMempoolFile: %v", err)
+	}
+	saved, err := readMempoolFile(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("readMempoolFile: %v", err)
+	}
+	if len(saved) != 2 {
+		t.Fatalf("unexpected number of transactions %d", len(saved))
+	}
+	if !saved[0].tx.Hash().IsEqual(txA.Hash()) || !saved[0].added.Equal(added) {
+		t.Fatalf("unexpected first transaction %v added %v", saved[0].tx.Hash(),
+			saved[0].added)
+	}
+	if !saved[1].tx.Hash().IsEqual(txB.Hash()) ||
+		!saved[1].added.Equal(added.Add(time.Minute)) {
+		t.Fatalf("unexpected second transaction %v added %v",
+			saved[1].tx.Hash(), saved[1].added)
+	}
+
+	// A truncated file is rejected.
+	if _, err := readMempoolFile(bytes.NewReader(buf.Bytes()[:buf.Len()-1])); err == nil {
+		t.Fatal("truncated mempool file accepted")
+	}
+}
@@ -7,6 +7,8 @@
 package mempool
 
 import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/core/message"
 	"github.com/Qitmeer/qitmeer/core/types"
 	"github.com/Qitmeer/qitmeer/engine/txscript"
 )
@@ -93,6 +95,31 @@ const (
 	// MinHighPriority is the minimum priority value that allows a
 	// transaction to be considered high priority.
 	MinHighPriority = types.AtomsPerCoin * 144.0 / 250
+
+	// MaxRBFSequence is the maximum sequence number an input can use to
+	// signal that the transaction spending it can be replaced using the
+	// Replace-By-Fee (RBF) policy.
+	MaxRBFSequence = 0xfffffffd
+
+	// MaxReplacementEvictions is the maximum number of transactions that
+	// can be evicted from the mempool when accepting a transaction
+	// replacement.
+	MaxReplacementEvictions = 100
+
+	// DefaultMaxAncestorCount is the default maximum number of unconfirmed
+	// transactions, itself included, a transaction can depend on to be
+	// accepted into the mempool.
+	DefaultMaxAncestorCount = 25
+
+	// DefaultMaxAncestorSize is the default maximum size in bytes of a
+	// transaction along with all of its unconfirmed ancestors.  This bounds
+	// the size of the package a block template has to include to mine the
+	// transaction.
+	DefaultMaxAncestorSize = 101000
+
+	// DefaultMaxPoolSize is the default maximum size in megabytes of the
+	// transactions in the mempool.
+	DefaultMaxPoolSize = 300
 )
 
 // Policy houses the policy (configuration parameters) which is used to
@@ -134,6 +161,24 @@ type Policy struct {
 	// MinRelayTxFee defines the minimum transaction fee in AtomQitmeer/kB
 	MinRelayTxFee types.Amount
 
+	// RejectReplacement, if true, rejects accepting replacement
+	// transactions using the Replace-By-Fee (RBF) signaling policy into
+	// the mempool.
+	RejectReplacement bool
+
+	// MaxAncestorCount is the maximum number of transactions in the
+	// package made of a transaction and its unconfirmed ancestors.
+	MaxAncestorCount int
+
+	// MaxAncestorSize is the maximum size in bytes of the package made of
+	// a transaction and its unconfirmed ancestors.
+	MaxAncestorSize int64
+
+	// MaxPoolSize is the maximum size in bytes of the transactions in the
+	// mempool.  The packages with the lowest fee rate are evicted when it
+	// is exceeded.
+	MaxPoolSize int64
+
 	// StandardVerifyFlags defines the function to retrieve the flags to
 	// use for verifying scripts for the block after the current best block.
 	// It must set the verification flags properly depending on the result
@@ -142,3 +187,24 @@ type Policy struct {
 	// This function must be safe for concurrent access.
 	StandardVerifyFlags func() (txscript.ScriptFlags, error)
 }
+
+// checkAncestorLimits returns an error when the package made of the passed
+// transaction and its unconfirmed ancestors in the pool exceeds the ancestor
+// count or size limits of the policy.
+func checkAncestorLimits(tx *types.Tx, ancestorCount int, ancestorSize int64,
+	policy *Policy) error {
+
+	if ancestorCount > policy.MaxAncestorCount {
+		str := fmt.Sprintf("transaction %v has too many unconfirmed "+
+			"ancestors: %d > %d", tx.Hash(), ancestorCount-1,
+			policy.MaxAncestorCount-1)
+		return txRuleError(message.RejectNonstandard, str)
+	}
+	if ancestorSize > policy.MaxAncestorSize {
+		str := fmt.Sprintf("transaction %v exceeds the ancestor size "+
+			"limit: %d > %d bytes", tx.Hash(), ancestorSize,
+			policy.MaxAncestorSize)
+		return txRuleError(message.RejectNonstandard, str)
+	}
+	return nil
+}
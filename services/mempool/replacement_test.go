@@ -0,0 +1,100 @@
+// Copyright (c) 2017-2019 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"container/heap"
+	"testing"
+
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/types"
+)
+
+// newTestTx returns a transaction spending the outpoints with the sequence.
+func newTestTx(sequence uint32, prevOuts ...*types.TxOutPoint) *types.Tx {
+	tx := types.NewTransaction()
+	for _, prevOut := range prevOuts {
+		txIn := types.NewTxInput(prevOut, nil)
+		txIn.Sequence = sequence
+		tx.AddTxIn(txIn)
+	}
+	tx.AddTxOut(types.NewTxOutput(1000, []byte{0x51}))
+	return types.NewTx(tx)
+}
+
+// addTestTx adds the transaction with the fee to the pool without any check.
+func addTestTx(mp *TxPool, tx *types.Tx, fee int64) {
+	mp.pool[*tx.Hash()] = &TxDesc{
+		TxDesc: types.TxDesc{
+			Tx:       tx,
+			Fee:      fee,
+			FeePerKB: fee * 1000 / int64(tx.Tx.SerializeSize()),
+		},
+	}
+	for _, txIn := range tx.Tx.TxIn {
+		mp.outpoints[txIn.PreviousOut] = tx
+	}
+	mp.addToPackages(mp.pool[*tx.Hash()])
+	heap.Push(&mp.evictQueue, mp.pool[*tx.Hash()])
+	mp.poolSize += int64(tx.Tx.SerializeSize())
+}
+
+func TestReplacement(t *testing.T) {
+	mp := New(&Config{Policy: Policy{MinRelayTxFee: types.Amount(DefaultMinRelayTxFee)}})
+
+	// A signals replacement, B spends A without signaling it and C
+	// doesn't signal it at all.
+	coinA := types.NewOutPoint(&hash.Hash{1}, 0)
+	coinC := types.NewOutPoint(&hash.Hash{2}, 0)
+	txA := newTestTx(MaxRBFSequence, coinA)
+	txB := newTestTx(types.MaxTxInSequenceNum, types.NewOutPoint(txA.Hash(), 0))
+	txC := newTestTx(types.MaxTxInSequenceNum, coinC)
+	addTestTx(mp, txA, 10000)
+	addTestTx(mp, txB, 10000)
+	addTestTx(mp, txC, 10000)
+
+	if !mp.signalsReplacement(txA, nil) || !mp.signalsReplacement(txB, nil) {
+		t.Fatal("explicit or inherited replacement signaling not detected")
+	}
+	if mp.signalsReplacement(txC, nil) {
+		t.Fatal("transaction without signaling is replaceable")
+	}
+
+	// Double spending C is rejected, double spending A replaces it and B.
+	if _, err := mp.checkPoolDoubleSpend(newTestTx(MaxRBFSequence, coinC)); err == nil {
+		t.Fatal("double spend of a transaction without signaling accepted")
+	}
+	replacement := newTestTx(MaxRBFSequence, coinA)
+	isReplacement, err := mp.checkPoolDoubleSpend(replacement)
+	if err != nil || !isReplacement {
+		t.Fatalf("checkPoolDoubleSpend: %v, %v", isReplacement, err)
+	}
+	conflicts := mp.txConflicts(replacement)
+	if len(conflicts) != 2 || conflicts[*txA.Hash()] == nil ||
+		conflicts[*txB.Hash()] == nil {
+		t.Fatalf("unexpected conflicts %v", conflicts)
+	}
+
+	// The replacement has to pay for the evicted transactions and its own
+	// relay fee.
+	if _, err := mp.validateReplacement(replacement, 20000); err == nil {
+		t.Fatal("replacement without the relay fee accepted")
+	}
+	if _, err := mp.validateReplacement(replacement, 30000); err != nil {
+		t.Fatalf("validateReplacement: %v", err)
+	}
+
+	// No new unconfirmed input can be spent by the replacement.
+	spendsC := newTestTx(MaxRBFSequence, coinA, types.NewOutPoint(txC.Hash(), 0))
+	if _, err := mp.validateReplacement(spendsC, 100000); err == nil {
+		t.Fatal("replacement spending a new unconfirmed input accepted")
+	}
+
+	// The replacement is rejected when the policy forbids it.
+	mp.cfg.Policy.RejectReplacement = true
+	if _, err := mp.checkPoolDoubleSpend(replacement); err == nil {
+		t.Fatal("replacement accepted with RejectReplacement")
+	}
+}
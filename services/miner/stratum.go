@@ -0,0 +1,847 @@
+// Copyright (c) 2017-2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package miner
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/blockchain"
+	"github.com/Qitmeer/qitmeer/core/blockdag"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/core/types/pow"
+	"github.com/Qitmeer/qitmeer/services/mining"
+	"math"
+	"math/big"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The stratum server speaks line delimited JSON-RPC in the style of
+// Stratum v1 with the following Qitmeer extensions:
+//
+//  mining.subscribe  [useragent, powtype]
+//    powtype is one of the pow.PowMapString names and defaults to
+//    qitmeer_keccak256.  The result is the usual subscription list, the
+//    hex extranonce1 which the server places into the coinbase and an
+//    extranonce2 size of 0.
+//  mining.authorize  [worker, password]
+//  mining.notify     [jobid, header, powtype, height, nbits, cleanjobs]
+//    header is the hex serialized block header with a zero nonce and empty
+//    proof data, height is the main height the cuckoo graph weight uses and
+//    nbits is the compact block target.
+//  mining.submit     [worker, jobid, nonce, proofdata]
+//    nonce is the big endian hex header nonce and proofdata the hex cuckoo
+//    proof data (edge bits followed by the cycle nonces), empty for the hash
+//    based algorithms.
+//  mining.set_difficulty [difficulty]
+
+const (
+	// stratumRefreshSecs is the number of seconds between checks for new
+	// mining tips, stale templates and worker difficulty retargets.
+	stratumRefreshSecs = 2
+
+	// stratumMinTemplateAge is the minimum age of a template before new
+	// mempool transactions cause it to be replaced.
+	stratumMinTemplateAge = time.Second * 3
+
+	// stratumMaxTemplateAge is the age after which a template is replaced
+	// even without any new transactions.
+	stratumMaxTemplateAge = time.Second * 60
+
+	// stratumShareInterval is the share interval the per-worker difficulty
+	// is adjusted towards.
+	stratumShareInterval = time.Second * 10
+
+	// stratumRetargetInterval is how often the difficulty of a worker is
+	// adjusted.
+	stratumRetargetInterval = time.Second * 60
+
+	// stratumRetargetShares is the number of shares which triggers an
+	// early difficulty adjustment of a fast worker.
+	stratumRetargetShares = 30
+
+	// stratumMaxRetargetFactor limits how far a single adjustment may move
+	// the share difficulty.
+	stratumMaxRetargetFactor = 4
+
+	// stratumMaxShareDiff bounds the share difficulty.
+	stratumMaxShareDiff = uint64(1) << 62
+
+	// stratumMaxJobs is the number of jobs remembered per connection.
+	stratumMaxJobs = 16
+
+	// stratumMaxLineLen is the longest request line accepted from a miner.
+	stratumMaxLineLen = 16 * 1024
+
+	// stratumIdleTimeout disconnects miners which send nothing for this
+	// long.
+	stratumIdleTimeout = time.Minute * 10
+
+	// stratumWriteTimeout is the deadline for sending a message to a miner.
+	stratumWriteTimeout = time.Second * 10
+)
+
+// Stratum error codes as used by the common pool implementations.
+const (
+	stratumErrOther        = 20
+	stratumErrJobNotFound  = 21
+	stratumErrDuplicate    = 22
+	stratumErrLowDiff      = 23
+	stratumErrUnauthorized = 24
+	stratumErrNotSubscribe = 25
+)
+
+// stratumRequest is a request or notification received from a miner.
+type stratumRequest struct {
+	ID     interface{}       `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// stratumResponse is the reply to a stratumRequest.
+type stratumResponse struct {
+	ID     interface{} `json:"id"`
+	Result interface{} `json:"result"`
+	Error  interface{} `json:"error"`
+}
+
+// stratumNotification is a server initiated message.
+type stratumNotification struct {
+	ID     interface{}   `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+// stratumError is an error which is reported back to the miner.
+type stratumError struct {
+	code    int
+	message string
+}
+
+func (e *stratumError) Error() string {
+	return e.message
+}
+
+// toJSON returns the [code, message, traceback] triple of Stratum v1.
+func (e *stratumError) toJSON() []interface{} {
+	return []interface{}{e.code, e.message, nil}
+}
+
+func newStratumError(code int, format string, a ...interface{}) *stratumError {
+	return &stratumError{code: code, message: fmt.Sprintf(format, a...)}
+}
+
+// stratumJob is a unit of work handed out to a single connection.
+type stratumJob struct {
+	id        string
+	block     *types.Block
+	height    uint64
+	powType   pow.PowType
+	shareDiff uint64
+	submitted map[string]struct{}
+}
+
+// StratumServer hands out jobs built from the block manager template cache to
+// Stratum miners, tracks the share difficulty of every worker and submits the
+// solved blocks through the block manager.
+type StratumServer struct {
+	miner      *CPUMiner
+	listenAddr string
+	startDiff  uint64
+	listener   net.Listener
+
+	// extraNonceBase is the random offset of the per-connection coinbase
+	// extra nonces and nextExtraNonce the counter added to it.
+	extraNonceBase uint64
+	nextExtraNonce uint64
+	nextJobID      uint64
+
+	// templateMtx serializes template refreshes, lastTxUpdate and
+	// templateTime describe the template last generated here.
+	templateMtx  sync.Mutex
+	lastTxUpdate time.Time
+	templateTime time.Time
+	jobParents   []*hash.Hash
+
+	clientsMtx sync.Mutex
+	clients    map[*stratumClient]struct{}
+
+	newWork chan struct{}
+	started int32
+	wg      sync.WaitGroup
+	quit    chan struct{}
+}
+
+// NewStratumServer returns a Stratum server listening on listenAddr which
+// mines with the policy and payment addresses of the passed miner.
+func NewStratumServer(m *CPUMiner, listenAddr string, startDiff uint64) *StratumServer {
+	if startDiff == 0 {
+		startDiff = 1
+	}
+	return &StratumServer{
+		miner:          m,
+		listenAddr:     listenAddr,
+		startDiff:      startDiff,
+		extraNonceBase: rand.New(rand.NewSource(time.Now().UnixNano())).Uint64(),
+		clients:        make(map[*stratumClient]struct{}),
+		newWork:        make(chan struct{}, 1),
+		quit:           make(chan struct{}),
+	}
+}
+
+// Start begins accepting Stratum connections.
+func (s *StratumServer) Start() error {
+	if !atomic.CompareAndSwapInt32(&s.started, 0, 1) {
+		return nil
+	}
+	listener, err := net.Listen("tcp", s.listenAddr)
+	if err != nil {
+		atomic.StoreInt32(&s.started, 0)
+		return err
+	}
+	s.listener = listener
+	s.wg.Add(2)
+	go s.acceptHandler()
+	go s.workHandler()
+	log.Info("Stratum server listening", "addr", listener.Addr())
+	return nil
+}
+
+// Stop disconnects all miners and stops the server.
+func (s *StratumServer) Stop() {
+	if !atomic.CompareAndSwapInt32(&s.started, 1, 0) {
+		return
+	}
+	close(s.quit)
+	s.listener.Close()
+	s.clientsMtx.Lock()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.clientsMtx.Unlock()
+	s.wg.Wait()
+	log.Info("Stratum server stopped")
+}
+
+// acceptHandler accepts new miner connections.  It must be run as a goroutine.
+func (s *StratumServer) acceptHandler() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.quit:
+				return
+			default:
+			}
+			log.Warn("Stratum accept failed", "err", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		c := &stratumClient{
+			server:     s,
+			conn:       conn,
+			extraNonce: s.extraNonceBase + atomic.AddUint64(&s.nextExtraNonce, 1),
+			powType:    pow.QITMEERKECCAK256,
+			diff:       s.startDiff,
+			jobs:       make(map[string]*stratumJob),
+		}
+		s.clientsMtx.Lock()
+		s.clients[c] = struct{}{}
+		s.clientsMtx.Unlock()
+
+		s.wg.Add(1)
+		go c.inHandler()
+	}
+}
+
+// workHandler watches for new mining tips, stale templates and workers whose
+// share difficulty needs adjusting.  It must be run as a goroutine.
+func (s *StratumServer) workHandler() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(time.Second * stratumRefreshSecs)
+	defer ticker.Stop()
+	for {
+		force := false
+		select {
+		case <-s.quit:
+			return
+		case <-s.newWork:
+			force = true
+		case <-ticker.C:
+		}
+
+		changed, clean, err := s.refreshTemplate(force)
+		if err != nil {
+			log.Error("Stratum failed to refresh the block template", "err", err)
+			continue
+		}
+		for _, c := range s.authorizedClients() {
+			retargeted := c.retarget()
+			if changed || retargeted {
+				c.sendJob(clean)
+			}
+		}
+	}
+}
+
+// authorizedClients returns the connections which may receive jobs.
+func (s *StratumServer) authorizedClients() []*stratumClient {
+	s.clientsMtx.Lock()
+	defer s.clientsMtx.Unlock()
+	clients := make([]*stratumClient, 0, len(s.clients))
+	for c := range s.clients {
+		if c.isAuthorized() {
+			clients = append(clients, c)
+		}
+	}
+	return clients
+}
+
+// removeClient forgets a disconnected miner.
+func (s *StratumServer) removeClient(c *stratumClient) {
+	s.clientsMtx.Lock()
+	delete(s.clients, c)
+	s.clientsMtx.Unlock()
+}
+
+// refreshTemplate replaces the cached block template when it no longer builds
+// on the mining tips, when it is too old or when new transactions arrived.
+// It reports whether new work is available and whether the previous jobs
+// became worthless because the tips changed.
+func (s *StratumServer) refreshTemplate(force bool) (bool, bool, error) {
+	s.templateMtx.Lock()
+	defer s.templateMtx.Unlock()
+
+	m := s.miner
+	tips := m.blockManager.GetChain().GetMiningTips()
+	template := m.blockManager.GetCurrentTemplate()
+	stale := force || template == nil || !sameHashSet(template.Block.Parents, tips) ||
+		(s.lastTxUpdate != m.txSource.LastUpdated() && time.Since(s.templateTime) >= stratumMinTemplateAge) ||
+		time.Since(s.templateTime) >= stratumMaxTemplateAge
+	if !stale {
+		return false, false, nil
+	}
+
+	// Grab the lock used for block submission, since the current block will
+	// be changing and this would otherwise end up building a new block
+	// template on a block that is in the process of becoming stale.
+	m.submitBlockLock.Lock()
+	addrs := m.config.GetMinningAddrs()
+	payToAddr := addrs[rand.Intn(len(addrs))]
+	lastTxUpdate := m.txSource.LastUpdated()
+	template, err := mining.NewBlockTemplate(m.policy, m.params, m.sigCache, m.txSource,
+		m.timeSource, m.blockManager, payToAddr, nil, pow.QITMEERKECCAK256)
+	m.submitBlockLock.Unlock()
+	if err != nil {
+		return false, false, err
+	}
+	m.blockManager.SetCurrentTemplate(template)
+	s.lastTxUpdate = lastTxUpdate
+	s.templateTime = time.Now()
+
+	clean := !sameHashSet(s.jobParents, template.Block.Parents)
+	s.jobParents = template.Block.Parents
+	return true, clean, nil
+}
+
+// newJob builds a job for the connection from the cached template, with the
+// coinbase carrying the connection extra nonce.
+func (s *StratumServer) newJob(extraNonce uint64, powType pow.PowType, shareDiff uint64) (*stratumJob, error) {
+	template := s.miner.blockManager.GetCurrentTemplate()
+	if template == nil {
+		if _, _, err := s.refreshTemplate(false); err != nil {
+			return nil, err
+		}
+		template = s.miner.blockManager.GetCurrentTemplate()
+		if template == nil {
+			return nil, errors.New("no block template available")
+		}
+	}
+	return s.jobFromTemplate(template, extraNonce, powType, shareDiff)
+}
+
+// jobFromTemplate builds a job from a copy of the template block, so that the
+// extra nonce and pow of the job neither change the cached template nor the
+// jobs of the other connections.
+func (s *StratumServer) jobFromTemplate(template *types.BlockTemplate, extraNonce uint64,
+	powType pow.PowType, shareDiff uint64) (*stratumJob, error) {
+	block := copyTemplateBlock(template.Block)
+	err := mining.UpdateExtraNonce(block, template.Height, extraNonce)
+	if err != nil {
+		return nil, err
+	}
+	bits, err := templateTarget(template, powType)
+	if err != nil {
+		return nil, err
+	}
+	instance := pow.GetInstance(powType, 0, []byte{})
+	instance.SetParams(s.miner.params.PowConfig)
+	instance.SetMainHeight(int64(template.Height))
+	if !instance.CheckAvailable() {
+		return nil, fmt.Errorf("pow %s is not available at height %d",
+			pow.PowMapString[powType], template.Height)
+	}
+	block.Header.Pow = instance
+	block.Header.Difficulty = bits
+
+	return &stratumJob{
+		id:        strconv.FormatUint(atomic.AddUint64(&s.nextJobID, 1), 16),
+		block:     block,
+		height:    template.Height,
+		powType:   powType,
+		shareDiff: shareDiff,
+		submitted: make(map[string]struct{}),
+	}, nil
+}
+
+// copyTemplateBlock returns a copy of the template block with its own header,
+// parents and transaction slice.  The coinbase, which carries the extra nonce,
+// is deep copied while the other transactions are shared with the template.
+func copyTemplateBlock(block *types.Block) *types.Block {
+	parents := make([]*hash.Hash, len(block.Parents))
+	copy(parents, block.Parents)
+	txs := make([]*types.Transaction, len(block.Transactions))
+	copy(txs, block.Transactions)
+	if len(txs) > 0 {
+		txs[0] = types.NewTxDeep(txs[0]).Tx
+	}
+	return &types.Block{
+		Header:       block.Header,
+		Parents:      parents,
+		Transactions: txs,
+	}
+}
+
+// submitBlock processes a solved block like a block received from the network.
+func (s *StratumServer) submitBlock(block *types.Block, worker string) error {
+	m := s.miner
+	m.submitBlockLock.Lock()
+	defer m.submitBlockLock.Unlock()
+
+	// Because it's asynchronous, so you must ensure that all tips are referenced
+	chain := m.blockManager.GetChain()
+	parents := blockdag.NewIdSet()
+	for _, v := range block.Parents {
+		parents.Add(chain.BlockIndex().GetDAGBlockID(v))
+	}
+	height, ok := chain.BlockDAG().CheckSubMainChainTip(parents.List())
+	if !ok {
+		return errors.New("the tips of block is expired")
+	}
+	sb := types.NewBlock(block)
+	sb.SetHeight(height)
+	isOrphan, err := m.blockManager.ProcessBlock(sb, blockchain.BFNone)
+	if err != nil {
+		return err
+	}
+	if isOrphan {
+		return fmt.Errorf("block %s is an orphan", sb.Hash())
+	}
+	log.Info("Block submitted via stratum accepted", "hash", sb.Hash(),
+		"order", blockdag.GetOrderLogStr(uint(sb.Order())), "height", sb.Height(), "worker", worker)
+
+	// Hand out work on top of the new block right away.
+	select {
+	case s.newWork <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// stratumClient is a single miner connection.
+type stratumClient struct {
+	server     *StratumServer
+	conn       net.Conn
+	extraNonce uint64
+	writeMtx   sync.Mutex
+
+	mtx          sync.Mutex
+	subscribed   bool
+	authorized   bool
+	worker       string
+	powType      pow.PowType
+	diff         uint64
+	jobs         map[string]*stratumJob
+	jobOrder     []string
+	retargetTime time.Time
+	shares       uint64
+	accepted     uint64
+	rejected     uint64
+	blocks       uint64
+}
+
+func (c *stratumClient) isAuthorized() bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.authorized
+}
+
+// inHandler reads and answers the requests of the miner.  It must be run as a
+// goroutine.
+func (c *stratumClient) inHandler() {
+	defer c.server.wg.Done()
+	defer c.server.removeClient(c)
+	defer c.conn.Close()
+
+	log.Debug("Stratum miner connected", "addr", c.conn.RemoteAddr())
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 0, 1024), stratumMaxLineLen)
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(stratumIdleTimeout))
+		if !scanner.Scan() {
+			break
+		}
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var req stratumRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			log.Debug("Stratum malformed request", "addr", c.conn.RemoteAddr(), "err", err)
+			break
+		}
+		result, err := c.handleRequest(&req)
+		resp := stratumResponse{ID: req.ID, Result: result}
+		if err != nil {
+			resp.Result = nil
+			if serr, ok := err.(*stratumError); ok {
+				resp.Error = serr.toJSON()
+			} else {
+				resp.Error = newStratumError(stratumErrOther, "%v", err).toJSON()
+			}
+		}
+		if err := c.send(&resp); err != nil {
+			break
+		}
+		if req.Method == "mining.authorize" && err == nil {
+			c.sendJob(true)
+		}
+	}
+
+	c.mtx.Lock()
+	log.Debug("Stratum miner disconnected", "addr", c.conn.RemoteAddr(), "worker", c.worker,
+		"accepted", c.accepted, "rejected", c.rejected, "blocks", c.blocks)
+	c.mtx.Unlock()
+}
+
+// handleRequest dispatches a request to its handler.
+func (c *stratumClient) handleRequest(req *stratumRequest) (interface{}, error) {
+	switch req.Method {
+	case "mining.subscribe":
+		return c.handleSubscribe(req.Params)
+	case "mining.authorize":
+		return c.handleAuthorize(req.Params)
+	case "mining.submit":
+		return c.handleSubmit(req.Params)
+	case "mining.extranonce.subscribe":
+		return false, nil
+	default:
+		return nil, newStratumError(stratumErrOther, "unknown method %s", req.Method)
+	}
+}
+
+func (c *stratumClient) handleSubscribe(params []json.RawMessage) (interface{}, error) {
+	powType := pow.QITMEERKECCAK256
+	if len(params) > 1 {
+		var name string
+		if err := json.Unmarshal(params[1], &name); err != nil {
+			return nil, newStratumError(stratumErrOther, "invalid pow type")
+		}
+		var ok bool
+		powType, ok = parsePowType(name)
+		if !ok {
+			return nil, newStratumError(stratumErrOther, "unknown pow type %s", name)
+		}
+	}
+	c.mtx.Lock()
+	c.subscribed = true
+	c.powType = powType
+	c.mtx.Unlock()
+
+	var en [8]byte
+	binary.BigEndian.PutUint64(en[:], c.extraNonce)
+	subID := strconv.FormatUint(c.extraNonce, 16)
+	return []interface{}{
+		[][]string{{"mining.set_difficulty", subID}, {"mining.notify", subID}},
+		hex.EncodeToString(en[:]),
+		0,
+	}, nil
+}
+
+func (c *stratumClient) handleAuthorize(params []json.RawMessage) (interface{}, error) {
+	var worker string
+	if len(params) < 1 || json.Unmarshal(params[0], &worker) != nil || worker == "" {
+		return nil, newStratumError(stratumErrOther, "invalid worker name")
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if !c.subscribed {
+		return nil, newStratumError(stratumErrNotSubscribe, "not subscribed")
+	}
+	c.worker = worker
+	c.authorized = true
+	c.retargetTime = time.Now()
+	log.Info("Stratum worker authorized", "worker", worker, "addr", c.conn.RemoteAddr(),
+		"pow", pow.PowMapString[c.powType])
+	return true, nil
+}
+
+func (c *stratumClient) handleSubmit(params []json.RawMessage) (interface{}, error) {
+	var args [4]string
+	if len(params) < 3 {
+		return nil, newStratumError(stratumErrOther, "invalid submit parameters")
+	}
+	for i := 0; i < len(params) && i < len(args); i++ {
+		if err := json.Unmarshal(params[i], &args[i]); err != nil {
+			return nil, newStratumError(stratumErrOther, "invalid submit parameters")
+		}
+	}
+	nonce, err := strconv.ParseUint(args[2], 16, 32)
+	if err != nil {
+		return nil, newStratumError(stratumErrOther, "invalid nonce")
+	}
+	proofData, err := hex.DecodeString(args[3])
+	if err != nil || len(proofData) > pow.PROOFDATA_LENGTH {
+		return nil, newStratumError(stratumErrOther, "invalid proof data")
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if !c.authorized || args[0] != c.worker {
+		return nil, newStratumError(stratumErrUnauthorized, "unauthorized worker")
+	}
+	job, ok := c.jobs[args[1]]
+	if !ok {
+		c.rejected++
+		return nil, newStratumError(stratumErrJobNotFound, "job not found")
+	}
+	key := args[2] + args[3]
+	if _, ok := job.submitted[key]; ok {
+		c.rejected++
+		return nil, newStratumError(stratumErrDuplicate, "duplicate share")
+	}
+
+	header := job.block.Header
+	header.Pow = pow.GetInstance(job.powType, uint32(nonce), proofData)
+	header.Pow.SetParams(c.server.miner.params.PowConfig)
+	header.Pow.SetMainHeight(int64(job.height))
+	headerData := header.BlockData()
+	blockHash := header.BlockHash()
+	target := shareTarget(job.powType, job.shareDiff, header.Difficulty, c.server.miner.params.PowConfig)
+	if err := header.Pow.Verify(headerData, blockHash, target); err != nil {
+		c.rejected++
+		return nil, newStratumError(stratumErrLowDiff, "low difficulty share")
+	}
+	job.submitted[key] = struct{}{}
+	c.accepted++
+	c.shares++
+
+	if header.Pow.Verify(headerData, blockHash, header.Difficulty) == nil {
+		job.block.Header.Pow = header.Pow
+		if err := c.server.submitBlock(job.block, c.worker); err != nil {
+			log.Warn("Block submitted via stratum rejected", "hash", blockHash,
+				"worker", c.worker, "err", err)
+		} else {
+			c.blocks++
+		}
+	}
+	return true, nil
+}
+
+// retarget adjusts the share difficulty of the worker and reports whether it
+// changed.
+func (c *stratumClient) retarget() bool {
+	c.mtx.Lock()
+	elapsed := time.Since(c.retargetTime)
+	if elapsed < stratumRetargetInterval && c.shares < stratumRetargetShares {
+		c.mtx.Unlock()
+		return false
+	}
+	diff := retargetShareDiff(c.diff, c.shares, elapsed)
+	c.shares = 0
+	c.retargetTime = time.Now()
+	changed := diff != c.diff
+	c.diff = diff
+	c.mtx.Unlock()
+	if changed {
+		log.Debug("Stratum worker difficulty adjusted", "worker", c.worker, "diff", diff)
+	}
+	return changed
+}
+
+// sendJob sends the share difficulty and a new job to the miner.
+func (c *stratumClient) sendJob(clean bool) {
+	c.mtx.Lock()
+	extraNonce, powType, diff := c.extraNonce, c.powType, c.diff
+	c.mtx.Unlock()
+
+	job, err := c.server.newJob(extraNonce, powType, diff)
+	if err != nil {
+		log.Warn("Stratum failed to create a job", "worker", c.worker, "err", err)
+		return
+	}
+
+	c.mtx.Lock()
+	if clean {
+		c.jobs = make(map[string]*stratumJob)
+		c.jobOrder = c.jobOrder[:0]
+	}
+	if len(c.jobOrder) >= stratumMaxJobs {
+		delete(c.jobs, c.jobOrder[0])
+		c.jobOrder = c.jobOrder[1:]
+	}
+	c.jobs[job.id] = job
+	c.jobOrder = append(c.jobOrder, job.id)
+	c.mtx.Unlock()
+
+	err = c.send(&stratumNotification{Method: "mining.set_difficulty",
+		Params: []interface{}{diff}})
+	if err != nil {
+		return
+	}
+	c.send(&stratumNotification{Method: "mining.notify", Params: []interface{}{
+		job.id,
+		hex.EncodeToString(job.block.Header.BlockData()),
+		pow.PowMapString[job.powType],
+		job.height,
+		fmt.Sprintf("%08x", job.block.Header.Difficulty),
+		clean,
+	}})
+}
+
+// send writes a single message to the miner.
+func (c *stratumClient) send(msg interface{}) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(stratumWriteTimeout))
+	_, err = c.conn.Write(append(b, '\n'))
+	return err
+}
+
+// parsePowType returns the pow type with the given pow.PowMapString name.
+func parsePowType(name string) (pow.PowType, bool) {
+	for powType, n := range pow.PowMapString {
+		if n == name {
+			return powType, true
+		}
+	}
+	return 0, false
+}
+
+// templateTarget returns the compact block target of the template for the
+// given pow type.
+func templateTarget(template *types.BlockTemplate, powType pow.PowType) (uint32, error) {
+	diff := template.PowDiffData
+	switch powType {
+	case pow.BLAKE2BD:
+		return diff.Blake2bDTarget, nil
+	case pow.X16RV3:
+		return diff.X16rv3DTarget, nil
+	case pow.X8R16:
+		return diff.X8r16DTarget, nil
+	case pow.QITMEERKECCAK256:
+		return diff.QitmeerKeccak256Target, nil
+	case pow.CUCKAROO:
+		return pow.BigToCompact(new(big.Int).SetUint64(diff.CuckarooBaseDiff)), nil
+	case pow.CUCKATOO:
+		return pow.BigToCompact(new(big.Int).SetUint64(diff.CuckatooBaseDiff)), nil
+	case pow.CUCKAROOM:
+		return pow.BigToCompact(new(big.Int).SetUint64(diff.CuckaroomBaseDiff)), nil
+	}
+	return 0, fmt.Errorf("unknown pow type %d", powType)
+}
+
+// shareTarget returns the compact target a share of the given pow type must
+// meet at the share difficulty.  The hash based algorithms divide their pow
+// limit by the difficulty while the cuckoo family uses it as the minimum
+// cycle difficulty.  A share target is never harder than the block target, so
+// that every block solution also counts as a share.
+func shareTarget(powType pow.PowType, diff uint64, blockBits uint32, conf *pow.PowConfig) uint32 {
+	blockTarget := pow.CompactToBig(blockBits)
+	d := new(big.Int).SetUint64(diff)
+
+	var limit *big.Int
+	switch powType {
+	case pow.BLAKE2BD:
+		limit = conf.Blake2bdPowLimit
+	case pow.X16RV3:
+		limit = conf.X16rv3PowLimit
+	case pow.X8R16:
+		limit = conf.X8r16PowLimit
+	case pow.QITMEERKECCAK256:
+		limit = conf.QitmeerKeccak256PowLimit
+	case pow.CUCKAROO, pow.CUCKATOO, pow.CUCKAROOM:
+		minBits := conf.CuckarooMinDifficulty
+		if powType == pow.CUCKATOO {
+			minBits = conf.CuckatooMinDifficulty
+		} else if powType == pow.CUCKAROOM {
+			minBits = conf.CuckaroomMinDifficulty
+		}
+		if min := pow.CompactToBig(minBits); d.Cmp(min) < 0 {
+			d = min
+		}
+		if d.Cmp(blockTarget) > 0 {
+			return blockBits
+		}
+		return pow.BigToCompact(d)
+	}
+	if limit == nil {
+		return blockBits
+	}
+	target := new(big.Int).Div(limit, d)
+	if target.Cmp(blockTarget) < 0 {
+		return blockBits
+	}
+	return pow.BigToCompact(target)
+}
+
+// retargetShareDiff returns the share difficulty which moves the share rate
+// of a worker towards stratumShareInterval, given the shares it found at the
+// current difficulty during elapsed.
+func retargetShareDiff(diff uint64, shares uint64, elapsed time.Duration) uint64 {
+	newDiff := float64(diff) / stratumMaxRetargetFactor
+	if shares > 0 {
+		newDiff = float64(diff) * float64(stratumShareInterval) *
+			float64(shares) / float64(elapsed)
+		newDiff = math.Max(newDiff, float64(diff)/stratumMaxRetargetFactor)
+		newDiff = math.Min(newDiff, float64(diff)*stratumMaxRetargetFactor)
+	}
+	if newDiff < 1 {
+		return 1
+	}
+	if newDiff >= float64(stratumMaxShareDiff) {
+		return stratumMaxShareDiff
+	}
+	return uint64(newDiff)
+}
+
+// sameHashSet returns whether both lists hold the same hashes.
+func sameHashSet(a, b []*hash.Hash) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := blockdag.NewHashSet()
+	set.AddList(a)
+	for _, h := range b {
+		if !set.Has(h) {
+			return false
+		}
+	}
+	return true
+}
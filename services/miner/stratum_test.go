@@ -0,0 +1,246 @@
+// Copyright (c) 2017-2020 The qitmeer developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package miner
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/types"
+	"github.com/Qitmeer/qitmeer/core/types/pow"
+	"github.com/Qitmeer/qitmeer/engine/txscript"
+	"github.com/Qitmeer/qitmeer/params"
+	"github.com/Qitmeer/qitmeer/services/mining"
+)
+
+func TestRetargetShareDiff(t *testing.T) {
+	tests := []struct {
+		diff    uint64
+		shares  uint64
+		elapsed time.Duration
+		want    uint64
+	}{
+		// On target.
+		{diff: 100, shares: 6, elapsed: time.Minute, want: 100},
+		// Twice as fast as wanted.
+		{diff: 100, shares: 12, elapsed: time.Minute, want: 200},
+		// Much too fast is limited to the max factor.
+		{diff: 100, shares: 30, elapsed: time.Second, want: 400},
+		// No shares at all lowers the difficulty.
+		{diff: 100, shares: 0, elapsed: time.Minute, want: 25},
+		// Never below 1.
+		{diff: 1, shares: 0, elapsed: time.Minute, want: 1},
+		// Never above the max.
+		{diff: stratumMaxShareDiff, shares: 30, elapsed: time.Second, want: stratumMaxShareDiff},
+	}
+	for i, test := range tests {
+		got := retargetShareDiff(test.diff, test.shares, test.elapsed)
+		if got != test.want {
+			t.Errorf("test %d: got diff %d, want %d", i, got, test.want)
+		}
+	}
+}
+
+func TestShareTarget(t *testing.T) {
+	conf := params.PrivNetParams.PowConfig
+	limitBits := pow.BigToCompact(conf.QitmeerKeccak256PowLimit)
+
+	// Difficulty 1 is the pow limit.
+	got := shareTarget(pow.QITMEERKECCAK256, 1, 0x1d00ffff, conf)
+	if got != limitBits {
+		t.Fatalf("got share target %08x, want %08x", got, limitBits)
+	}
+
+	// Higher difficulties lower the target.
+	got = shareTarget(pow.QITMEERKECCAK256, 1024, 0x1d00ffff, conf)
+	if pow.CompactToBig(got).Cmp(pow.CompactToBig(limitBits)) >= 0 {
+		t.Fatalf("share target %08x not below the limit", got)
+	}
+
+	// A share is never harder than the block.
+	got = shareTarget(pow.QITMEERKECCAK256, stratumMaxShareDiff, 0x207fffff, conf)
+	if got != 0x207fffff {
+		t.Fatalf("got share target %08x, want the block target", got)
+	}
+
+	// Cuckoo shares are at least the minimum difficulty and at most the
+	// block difficulty.
+	got = shareTarget(pow.CUCKAROO, 1, 0x02010000, conf)
+	if got != conf.CuckarooMinDifficulty {
+		t.Fatalf("got share target %08x, want %08x", got, conf.CuckarooMinDifficulty)
+	}
+	got = shareTarget(pow.CUCKAROO, 100, 0x02010000, conf)
+	if pow.CompactToBig(got).Uint64() != 100 {
+		t.Fatalf("got share target %08x, want 100", got)
+	}
+	got = shareTarget(pow.CUCKAROO, stratumMaxShareDiff, 0x02010000, conf)
+	if got != 0x02010000 {
+		t.Fatalf("got share target %08x, want the block target", got)
+	}
+}
+
+func TestStratumHandshake(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+	c := &stratumClient{
+		conn:       conn,
+		extraNonce: 0x0102,
+		powType:    pow.QITMEERKECCAK256,
+		diff:       1,
+		jobs:       make(map[string]*stratumJob),
+	}
+	params := func(args ...interface{}) []json.RawMessage {
+		raw := make([]json.RawMessage, len(args))
+		for i, arg := range args {
+			raw[i], _ = json.Marshal(arg)
+		}
+		return raw
+	}
+
+	// Authorizing requires a subscription.
+	_, err := c.handleAuthorize(params("worker", "x"))
+	if serr, ok := err.(*stratumError); !ok || serr.code != stratumErrNotSubscribe {
+		t.Fatalf("unexpected authorize error %v", err)
+	}
+
+	_, err = c.handleSubscribe(params("miner/1.0", "unknown"))
+	if err == nil {
+		t.Fatal("subscribed with an unknown pow type")
+	}
+	result, err := c.handleSubscribe(params("miner/1.0", "cuckaroo"))
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	if c.powType != pow.CUCKAROO {
+		t.Fatalf("got pow type %d, want %d", c.powType, pow.CUCKAROO)
+	}
+	if en := result.([]interface{})[1]; en != "0000000000000102" {
+		t.Fatalf("got extranonce1 %v", en)
+	}
+
+	if _, err := c.handleAuthorize(params("worker", "x")); err != nil {
+		t.Fatalf("authorize failed: %v", err)
+	}
+
+	// Shares for unknown jobs or other workers are rejected.
+	_, err = c.handleSubmit(params("other", "1", "00000000", ""))
+	if serr, ok := err.(*stratumError); !ok || serr.code != stratumErrUnauthorized {
+		t.Fatalf("unexpected submit error %v", err)
+	}
+	_, err = c.handleSubmit(params("worker", "1", "00000000", ""))
+	if serr, ok := err.(*stratumError); !ok || serr.code != stratumErrJobNotFound {
+		t.Fatalf("unexpected submit error %v", err)
+	}
+}
+
+func TestStratumJobsFromTemplate(t *testing.T) {
+	s := &StratumServer{miner: &CPUMiner{params: &params.PrivNetParams}}
+	coinbase := &types.Transaction{
+		Version: 1,
+		TxIn: []*types.TxInput{{
+			PreviousOut: types.TxOutPoint{OutIndex: ^uint32(0)},
+			Sequence:    ^uint32(0),
+		}},
+		TxOut: []*types.TxOutput{{Amount: 1, PkScript: []byte{txscript.OP_TRUE}}},
+	}
+	templatePow := pow.GetInstance(pow.BLAKE2BD, 0, []byte{})
+	templatePow.SetParams(params.PrivNetParams.PowConfig)
+	template := &types.BlockTemplate{
+		Block: &types.Block{
+			Header:       types.BlockHeader{Version: 1, Pow: templatePow},
+			Parents:      []*hash.Hash{&hash.ZeroHash},
+			Transactions: []*types.Transaction{coinbase},
+		},
+		Height: 1,
+	}
+	// A block target far below the share target, so that no share solves
+	// the block.
+	template.PowDiffData.QitmeerKeccak256Target = 0x1d00ffff
+	templateRoot := template.Block.Header.TxRoot
+
+	newClient := func(extraNonce uint64) *stratumClient {
+		return &stratumClient{
+			server:     s,
+			extraNonce: extraNonce,
+			authorized: true,
+			worker:     "worker",
+			powType:    pow.QITMEERKECCAK256,
+			diff:       1,
+			jobs:       make(map[string]*stratumJob),
+		}
+	}
+	clients := []*stratumClient{newClient(1), newClient(2)}
+	for _, c := range clients {
+		job, err := s.jobFromTemplate(template, c.extraNonce, c.powType, c.diff)
+		if err != nil {
+			t.Fatalf("job for extra nonce %d: %v", c.extraNonce, err)
+		}
+		c.jobs[job.id] = job
+	}
+	jobA, jobB := clients[0].jobs["1"], clients[1].jobs["2"]
+	if jobA == nil || jobB == nil {
+		t.Fatal("jobs not found")
+	}
+
+	// The template is left untouched and each job commits to the coinbase
+	// of its own extra nonce.
+	if template.Block.Header.TxRoot != templateRoot || len(coinbase.TxIn[0].SignScript) != 0 {
+		t.Fatal("building the jobs modified the template")
+	}
+	if template.Block.Header.Pow != templatePow || template.Block.Header.Difficulty != 0 {
+		t.Fatal("building the jobs set the pow of the template")
+	}
+	for i, c := range clients {
+		job := c.jobs[strconv.Itoa(i+1)]
+		want := copyTemplateBlock(template.Block)
+		if err := mining.UpdateExtraNonce(want, template.Height, c.extraNonce); err != nil {
+			t.Fatal(err)
+		}
+		if job.block.Header.TxRoot != want.Header.TxRoot {
+			t.Fatalf("job %s does not commit to extra nonce %d", job.id, c.extraNonce)
+		}
+	}
+	if jobA.block.Header.TxRoot == jobB.block.Header.TxRoot {
+		t.Fatal("the jobs share the same coinbase")
+	}
+
+	params := func(args ...interface{}) []json.RawMessage {
+		raw := make([]json.RawMessage, len(args))
+		for i, arg := range args {
+			raw[i], _ = json.Marshal(arg)
+		}
+		return raw
+	}
+	submit := func(c *stratumClient, jobID string, nonce uint32) error {
+		_, err := c.handleSubmit(params("worker", jobID, fmt.Sprintf("%08x", nonce), ""))
+		return err
+	}
+
+	// Find a nonce which is a share of the first job only and check that
+	// each client validates it against its own job.
+	for nonce := uint32(0); nonce < 1000; nonce++ {
+		if submit(clients[0], "1", nonce) != nil {
+			continue
+		}
+		err := submit(clients[1], "2", nonce)
+		if err == nil {
+			continue
+		}
+		if serr, ok := err.(*stratumError); !ok || serr.code != stratumErrLowDiff {
+			t.Fatalf("unexpected submit error %v", err)
+		}
+		if clients[0].blocks != 0 || clients[1].blocks != 0 {
+			t.Fatal("a share was submitted as a block")
+		}
+		return
+	}
+	t.Fatal("no nonce is a share of only one of the jobs")
+}
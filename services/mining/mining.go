@@ -7,6 +7,8 @@
 package mining
 
 import (
+	"encoding/binary"
+	"fmt"
 	"github.com/Qitmeer/qitmeer/common/hash"
 	"github.com/Qitmeer/qitmeer/core/blockchain"
 	"github.com/Qitmeer/qitmeer/core/merkle"
@@ -99,6 +101,52 @@ func standardCoinbaseScript(nextBlockHeight uint64, extraNonce uint64) ([]byte,
 		Script()
 }
 
+// UpdateExtraNonce replaces the extra nonce in the coinbase script of the
+// passed block with the provided value, pushes it in the nulldata output of the
+// coinbase and recalculates the merkle root so the header commits to the
+// updated coinbase transaction.  This allows a
+// single template to be handed out to many miners without overlapping work.
+func UpdateExtraNonce(msgBlock *types.Block, blockHeight uint64, extraNonce uint64) error {
+	coinbaseScript, err := standardCoinbaseScript(blockHeight, extraNonce)
+	if err != nil {
+		return err
+	}
+	if len(coinbaseScript) > blockchain.MaxCoinbaseScriptLen {
+		return fmt.Errorf("coinbase transaction script length "+
+			"of %d is out of range (min: %d, max: %d)",
+			len(coinbaseScript), blockchain.MinCoinbaseScriptLen,
+			blockchain.MaxCoinbaseScriptLen)
+	}
+	coinbase := msgBlock.Transactions[0]
+	coinbase.TxIn[0].SignScript = coinbaseScript
+
+	// The signature scripts are not part of the transaction prefix hash the
+	// merkle root commits to, so the extra nonce is also pushed in the
+	// nulldata output of the coinbase.
+	var enData [8]byte
+	binary.LittleEndian.PutUint64(enData[:], extraNonce)
+	opReturnPkScript, err := standardCoinbaseOpReturn(enData[:])
+	if err != nil {
+		return err
+	}
+	// Without tax the empty tax output keeps the nulldata at its index.
+	for len(coinbase.TxOut) < blockchain.CoinbaseOutput_data {
+		coinbase.AddTxOut(&types.TxOutput{})
+	}
+	if len(coinbase.TxOut) > blockchain.CoinbaseOutput_data {
+		coinbase.TxOut[blockchain.CoinbaseOutput_data].PkScript = opReturnPkScript
+	} else {
+		coinbase.AddTxOut(&types.TxOutput{PkScript: opReturnPkScript})
+	}
+	coinbase.CachedHash = nil
+
+	// Recalculate the merkle root with the updated extra nonce.
+	block := types.NewBlock(msgBlock)
+	merkles := merkle.BuildMerkleTreeStore(block.Transactions(), false)
+	msgBlock.Header.TxRoot = *merkles[len(merkles)-1]
+	return nil
+}
+
 // standardCoinbaseOpReturn creates a standard OP_RETURN output to insert into
 // coinbase to use as extranonces. The OP_RETURN pushes 32 bytes.
 func standardCoinbaseOpReturn(enData []byte) ([]byte, error) {
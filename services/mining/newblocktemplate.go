@@ -1,6 +1,7 @@
 package mining
 
 import (
+	"container/heap"
 	"fmt"
 	"github.com/Qitmeer/qitmeer/common/hash"
 	"github.com/Qitmeer/qitmeer/core/blockchain"
@@ -14,6 +15,8 @@ import (
 	"github.com/Qitmeer/qitmeer/params"
 	"github.com/Qitmeer/qitmeer/services/blkmgr"
 	"github.com/Qitmeer/qitmeer/services/mempool"
+	"math/rand"
+	"time"
 )
 
 // NewBlockTemplate returns a new block template that is ready to be solved
@@ -33,19 +36,23 @@ import (
 // higher fee per kilobyte are preferred.  Finally, the block generation related
 // policy settings are all taken into account.
 //
-// Transactions which only spend outputs from other transactions already in the
-// block chain are immediately added to a priority queue which either
-// prioritizes based on the priority (then fee per kilobyte) or the fee per
-// kilobyte (then priority) depending on whether or not the BlockPrioritySize
-// policy setting allots space for high-priority transactions.  Transactions
-// which spend outputs from other transactions in the source pool are added to a
-// dependency map so they can be added to the priority queue once the
-// transactions they depend on have been included.
+// Each transaction is added to a priority queue along with the package made of
+// it and its unconfirmed ancestors, which the source pool tracks.  The queue
+// either prioritizes based on the priority (then fee per kilobyte) or the fee
+// per kilobyte of the package depending on whether or not the
+// BlockPrioritySize policy setting allots space for high-priority
+// transactions.  The package at the top of the queue is included at each step,
+// ancestors first, so a transaction paying a high fee helps its low-fee
+// ancestors to be mined (child-pays-for-parent).  The packages of the
+// descendants of the included transactions are then updated, since those are
+// no longer needed along with them.
 //
 // Once the high-priority area (if configured) has been filled with
 // transactions, or the priority falls below what is considered high-priority,
-// the priority queue is updated to prioritize by fees per kilobyte (then
-// priority).
+// the priority queue is updated to prioritize by the fees per kilobyte of the
+// packages.  The packages whose fees per kilobyte are within feeBandRatio of
+// each other are picked in a random order, so that the miners of parallel
+// blocks don't all pick the same transactions.
 //
 // When the fees per kilobyte drop below the TxMinFreeFee policy setting, the
 // transaction will be skipped unless the BlockMinSize policy setting is
@@ -148,7 +155,12 @@ func NewBlockTemplate(policy *Policy, params *params.Params,
 	// or not there is an area allocated for high-priority transactions.
 	sourceTxns := txSource.MiningDescs()
 	sortedByFee := policy.BlockPrioritySize == 0
-	weightedRandQueue := newWeightedRandQueue(len(sourceTxns))
+	lessFunc := txPQByPackageFee
+	if !sortedByFee {
+		lessFunc = txPQByPriority
+	}
+	priorityQueue := newTxPriorityQueue(len(sourceTxns), lessFunc)
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
 	// Create a slice to hold the transactions to be included in the
 	// generated block with reserved space.  Also create a utxo view to
 	// house all of the input transactions so multiple lookups can be
@@ -160,9 +172,10 @@ func NewBlockTemplate(policy *Policy, params *params.Params,
 	// dependers is used to track transactions which depend on another
 	// transaction in the source pool.  This, in conjunction with the
 	// dependsOn map kept with each dependent transaction helps quickly
-	// determine which dependent transactions are now eligible for inclusion
-	// in the block once each transaction has been included.
-	dependers := make(map[hash.Hash]map[hash.Hash]*WeightedRandTx)
+	// determine the packages of transactions which have to be included
+	// together, and the packages to update once a transaction has been
+	// included.
+	dependers := make(map[hash.Hash]map[hash.Hash]*txPrioItem)
 	// Create slices to hold the fees and number of signature operations
 	// for each of the selected transactions and add an entry for the
 	// coinbase.  This allows the code below to simply append details about
@@ -175,6 +188,7 @@ func NewBlockTemplate(policy *Policy, params *params.Params,
 	txSigOpCosts = append(txSigOpCosts, coinbaseSigOpCost)
 
 	log.Debug("Inclusion to new block", "transactions", len(sourceTxns))
+	candidates := make(map[hash.Hash]*txPrioItem, len(sourceTxns))
 mempoolLoop:
 	for _, txDesc := range sourceTxns {
 		// A block can't have more than one coinbase or contain
@@ -206,7 +220,7 @@ mempoolLoop:
 		// Setup dependencies for any transactions which reference
 		// other transactions in the mempool so they can be properly
 		// ordered below.
-		weirandItem := &WeightedRandTx{tx: tx}
+		prioItem := &txPrioItem{tx: tx}
 		for _, txIn := range tx.Tx.TxIn {
 			originHash := &txIn.PreviousOut.Hash
 			entry := utxos.LookupEntry(txIn.PreviousOut)
@@ -224,15 +238,15 @@ mempoolLoop:
 				// ordering dependency.
 				deps, exists := dependers[*originHash]
 				if !exists {
-					deps = make(map[hash.Hash]*WeightedRandTx)
+					deps = make(map[hash.Hash]*txPrioItem)
 					dependers[*originHash] = deps
 				}
-				deps[*weirandItem.tx.Hash()] = weirandItem
-				if weirandItem.dependsOn == nil {
-					weirandItem.dependsOn = make(
+				deps[*prioItem.tx.Hash()] = prioItem
+				if prioItem.dependsOn == nil {
+					prioItem.dependsOn = make(
 						map[hash.Hash]struct{})
 				}
-				weirandItem.dependsOn[*originHash] = struct{}{}
+				prioItem.dependsOn[*originHash] = struct{}{}
 
 				// Skip the check below. We already know the
 				// referenced transaction is available.
@@ -243,18 +257,27 @@ mempoolLoop:
 		// Calculate the final transaction priority using the input
 		// value age sum as well as the adjusted transaction size.  The
 		// formula is: sum(inputValue * inputAge) / adjustedTxSize
-		weirandItem.priority = mempool.CalcPriority(tx.Tx, utxos,
+		prioItem.priority = mempool.CalcPriority(tx.Tx, utxos,
 			nextBlockHeight, blockManager.GetChain().BlockDAG())
 
 		// Calculate the fee in Satoshi/kB.
-		weirandItem.feePerKB = txDesc.FeePerKB
-		weirandItem.fee = txDesc.Fee
+		prioItem.feePerKB = txDesc.FeePerKB
+		prioItem.fee = txDesc.Fee
+		prioItem.rank = rnd.Int63()
+
+		// The source pool tracks the package of the transaction and its
+		// ancestors, none of which are in the block yet.
+		prioItem.ancestorFee = txDesc.AncestorFee
+		prioItem.ancestorSize = txDesc.AncestorSize
+		if prioItem.ancestorSize <= 0 {
+			prioItem.ancestorFee = txDesc.Fee
+			prioItem.ancestorSize = int64(tx.Transaction().SerializeSize())
+		}
 
 		// Add the transaction to the priority queue to mark it ready
-		// for inclusion in the block unless it has dependencies.
-		if weirandItem.dependsOn == nil {
-			weightedRandQueue.Push(weirandItem)
-		}
+		// for inclusion in the block along with its ancestors.
+		candidates[*tx.Hash()] = prioItem
+		heap.Push(priorityQueue, prioItem)
 
 		// Merge the referenced outputs from the input transactions to
 		// this transaction into the block utxo view.  This allows the
@@ -262,31 +285,51 @@ mempoolLoop:
 		mergeUtxoView(blockUtxos, utxos)
 	}
 
-	log.Trace(fmt.Sprintf("Weighted random queue len %d, dependers len %d",
-		weightedRandQueue.Len(), len(dependers)))
+	log.Trace(fmt.Sprintf("Priority queue len %d, dependers len %d",
+		priorityQueue.Len(), len(dependers)))
 
 	blockSize := uint32(blockHeaderOverhead) + uint32(coinbaseTx.Transaction().SerializeSize())
 
 	blockSigOpCost := coinbaseSigOpCost
 	totalFees := int64(0)
 
-	// Choose which transactions make it into the block.
-	for weightedRandQueue.Len() > 0 {
+	// Choose which transactions make it into the block.  The package of the
+	// transaction at the top of the priority queue is included at each
+	// step, ancestors first.
+	included := make(map[hash.Hash]struct{})
+	failed := make(map[hash.Hash]struct{})
+	for priorityQueue.Len() > 0 {
 		// Grab the highest priority (or highest fee per kilobyte
-		// depending on the sort order) transaction.
-		weirandItem := weightedRandQueue.Pop()
-		tx := weirandItem.tx
+		// package depending on the sort order) transaction.
+		prioItem := heap.Pop(priorityQueue).(*txPrioItem)
+		tx := prioItem.tx
 
 		// Grab any transactions which depend on this one.
 		deps := dependers[*tx.Hash()]
 
+		// The package can't be included when one of its ancestors
+		// wasn't a candidate or has failed to be included.
+		pkg, ok := packageTxs(prioItem, candidates, included, failed)
+		if !ok {
+			log.Trace(fmt.Sprintf("Skipping tx %s because one of its "+
+				"ancestors can't be included", tx.Hash()))
+			failed[*tx.Hash()] = struct{}{}
+			logSkippedDeps(tx, deps)
+			continue
+		}
+
 		// Enforce maximum block size.  Also check for overflow.
-		txSize := uint32(tx.Transaction().SerializeSize())
-		blockPlusTxSize := blockSize + txSize
-		if blockPlusTxSize < blockSize || blockPlusTxSize >= policy.BlockMaxSize {
-			log.Trace(fmt.Sprintf("Skipping tx %s (size %v) because it "+
-				"would exceed the max block size; cur block "+
-				"size %v, cur num tx %v", tx.Hash(), txSize,
+		pkgSize := uint32(0)
+		pkgSigOpCost := int64(0)
+		for _, item := range pkg {
+			pkgSize += uint32(item.tx.Transaction().SerializeSize())
+			pkgSigOpCost += int64(blockchain.CountSigOps(item.tx))
+		}
+		blockPlusPkgSize := blockSize + pkgSize
+		if blockPlusPkgSize < blockSize || blockPlusPkgSize >= policy.BlockMaxSize {
+			log.Trace(fmt.Sprintf("Skipping tx %s (package size %v) "+
+				"because it would exceed the max block size; cur "+
+				"block size %v, cur num tx %v", tx.Hash(), pkgSize,
 				blockSize, len(blockTxns)))
 			logSkippedDeps(tx, deps)
 			continue
@@ -294,9 +337,8 @@ mempoolLoop:
 
 		// Enforce maximum signature operation cost per block.  Also
 		// check for overflow.
-		sigOpCost := blockchain.CountSigOps(tx)
-		if blockSigOpCost+int64(sigOpCost) < blockSigOpCost ||
-			blockSigOpCost+int64(sigOpCost) > blockchain.MaxSigOpsPerBlock {
+		if blockSigOpCost+pkgSigOpCost < blockSigOpCost ||
+			blockSigOpCost+pkgSigOpCost > blockchain.MaxSigOpsPerBlock {
 			log.Trace(fmt.Sprintf("Skipping tx %s because it would "+
 				"exceed the maximum sigops per block", tx.Hash()))
 			logSkippedDeps(tx, deps)
@@ -305,68 +347,108 @@ mempoolLoop:
 
 		// Skip free transactions once the block is larger than the
 		// minimum block size.
+		pkgFeePerKB := prioItem.packageFeePerKB()
 		if sortedByFee &&
-			weirandItem.feePerKB < int64(policy.TxMinFreeFee) &&
-			(blockPlusTxSize >= policy.BlockMinSize) {
-			log.Trace(fmt.Sprintf("Skipping tx %s with feePerKB %.2d "+
-				"< TxMinFreeFee %d and block size %d >= "+
-				"minBlockSize %d", tx.Hash(), weirandItem.feePerKB,
-				policy.TxMinFreeFee, blockPlusTxSize,
+			pkgFeePerKB < int64(policy.TxMinFreeFee) &&
+			(blockPlusPkgSize >= policy.BlockMinSize) {
+			log.Trace(fmt.Sprintf("Skipping tx %s with package feePerKB "+
+				"%.2d < TxMinFreeFee %d and block size %d >= "+
+				"minBlockSize %d", tx.Hash(), pkgFeePerKB,
+				policy.TxMinFreeFee, blockPlusPkgSize,
 				policy.BlockMinSize))
 			logSkippedDeps(tx, deps)
 			continue
 		}
 
-		// Ensure the transaction inputs pass all of the necessary
-		// preconditions before allowing it to be added to the block.
-		_, err = blockManager.GetChain().CheckTransactionInputs(tx, blockUtxos)
-		if err != nil {
-			log.Trace(fmt.Sprintf("Skipping tx %s due to error in "+
-				"CheckTransactionInputs: %v", tx.Hash(), err))
-			logSkippedDeps(tx, deps)
-			continue
-		}
-		err = blockchain.ValidateTransactionScripts(tx, blockUtxos,
-			scriptFlags, sigCache)
-		if err != nil {
-			log.Trace(fmt.Sprintf("Skipping tx %s due to error in "+
-				"ValidateTransactionScripts: %v", tx.Hash(), err))
-			logSkippedDeps(tx, deps)
-			continue
+		// Prioritize by package fee per kilobyte once the block is
+		// larger than the priority size or there are no more
+		// high-priority transactions.
+		if !sortedByFee && (blockPlusPkgSize >= policy.BlockPrioritySize ||
+			prioItem.priority <= mempool.MinHighPriority) {
+
+			log.Trace(fmt.Sprintf("Switching to sort by fees per "+
+				"kilobyte blockSize %d >= BlockPrioritySize %d || "+
+				"priority %.2f <= minHighPriority %.2f",
+				blockPlusPkgSize, policy.BlockPrioritySize,
+				prioItem.priority, mempool.MinHighPriority))
+
+			sortedByFee = true
+			priorityQueue.SetLessFunc(txPQByPackageFee)
+
+			// Put the transaction back into the priority queue and
+			// skip it so it is re-prioritized by fees if it won't
+			// fit into the high-priority section or the priority
+			// is too low.  Otherwise this transaction will be the
+			// final one in the high-priority section, so just fall
+			// through to the code below so it is added now.
+			if blockPlusPkgSize > policy.BlockPrioritySize ||
+				prioItem.priority < mempool.MinHighPriority {
+
+				heap.Push(priorityQueue, prioItem)
+				continue
+			}
 		}
 
-		// Spend the transaction inputs in the block utxo view and add
-		// an entry for it to ensure any transactions which reference
-		// this one have it available as an input and can ensure they
-		// aren't double spending.
-		err = spendTransaction(blockUtxos, tx, &hash.ZeroHash)
-		if err != nil {
-			log.Warn(fmt.Sprintf("Unable to spend transaction %v in the preliminary "+
-				"UTXO view for the block template: %v",
-				tx.Hash(), err))
-		}
-		// Add the transaction to the block, increment counters, and
-		// save the fees and signature operation counts to the block
-		// template.
-		blockTxns = append(blockTxns, tx)
-		blockSize += txSize
-		blockSigOpCost += int64(sigOpCost)
-		totalFees += weirandItem.fee
-		txFees = append(txFees, weirandItem.fee)
-		txSigOpCosts = append(txSigOpCosts, int64(sigOpCost))
-
-		log.Trace(fmt.Sprintf("Adding tx %s (priority %.2f, feePerKB %.2d)",
-			weirandItem.tx.Hash(), weirandItem.priority, weirandItem.feePerKB))
-
-		// Add transactions which depend on this one (and also do not
-		// have any other unsatisified dependencies) to the priority
-		// queue.
-		for _, item := range deps {
-			// Add the transaction to the priority queue if there
-			// are no more dependencies after this one.
-			delete(item.dependsOn, *tx.Hash())
-			if len(item.dependsOn) == 0 {
-				weightedRandQueue.Push(item)
+		// Include the package, ancestors first.
+		for _, item := range pkg {
+			// Ensure the transaction inputs pass all of the necessary
+			// preconditions before allowing it to be added to the block.
+			_, err = blockManager.GetChain().CheckTransactionInputs(item.tx, blockUtxos)
+			if err != nil {
+				log.Trace(fmt.Sprintf("Skipping tx %s due to error in "+
+					"CheckTransactionInputs: %v", item.tx.Hash(), err))
+				failed[*item.tx.Hash()] = struct{}{}
+				logSkippedDeps(item.tx, dependers[*item.tx.Hash()])
+				break
+			}
+			err = blockchain.ValidateTransactionScripts(item.tx, blockUtxos,
+				scriptFlags, sigCache)
+			if err != nil {
+				log.Trace(fmt.Sprintf("Skipping tx %s due to error in "+
+					"ValidateTransactionScripts: %v", item.tx.Hash(), err))
+				failed[*item.tx.Hash()] = struct{}{}
+				logSkippedDeps(item.tx, dependers[*item.tx.Hash()])
+				break
+			}
+
+			// Spend the transaction inputs in the block utxo view and add
+			// an entry for it to ensure any transactions which reference
+			// this one have it available as an input and can ensure they
+			// aren't double spending.
+			err = spendTransaction(blockUtxos, item.tx, &hash.ZeroHash)
+			if err != nil {
+				log.Warn(fmt.Sprintf("Unable to spend transaction %v in the preliminary "+
+					"UTXO view for the block template: %v",
+					item.tx.Hash(), err))
+			}
+			// Add the transaction to the block, increment counters, and
+			// save the fees and signature operation counts to the block
+			// template.
+			txSize := uint32(item.tx.Transaction().SerializeSize())
+			sigOpCost := int64(blockchain.CountSigOps(item.tx))
+			blockTxns = append(blockTxns, item.tx)
+			blockSize += txSize
+			blockSigOpCost += sigOpCost
+			totalFees += item.fee
+			txFees = append(txFees, item.fee)
+			txSigOpCosts = append(txSigOpCosts, sigOpCost)
+			included[*item.tx.Hash()] = struct{}{}
+			if item.index >= 0 {
+				heap.Remove(priorityQueue, item.index)
+			}
+
+			log.Trace(fmt.Sprintf("Adding tx %s (priority %.2f, feePerKB %.2d, "+
+				"package feePerKB %.2d)", item.tx.Hash(), item.priority,
+				item.feePerKB, pkgFeePerKB))
+
+			// The transaction is no longer part of the packages of
+			// its descendants, which move in the priority queue.
+			for _, desc := range descendantItems(item, dependers) {
+				desc.ancestorFee -= item.fee
+				desc.ancestorSize -= int64(txSize)
+				if desc.index >= 0 {
+					heap.Fix(priorityQueue, desc.index)
+				}
 			}
 		}
 	}
@@ -419,8 +501,12 @@ mempoolLoop:
 		return nil, miningRuleError(ErrGettingDifficulty, err.Error())
 	}
 
-	// Choose the block version to generate based on the network.
-	blockVersion := BlockVersion(params.Net)
+	// Choose the block version to generate based on the network and the
+	// deployments being voted on.
+	blockVersion, err := blockManager.GetChain().CalcNextBlockVersion()
+	if err != nil {
+		return nil, err
+	}
 
 	// Create a new block ready to be solved.
 	merkles := merkle.BuildMerkleTreeStore(blockTxns, false)
@@ -551,7 +637,7 @@ func mergeUtxoView(viewA *blockchain.UtxoViewpoint, viewB *blockchain.UtxoViewpo
 // TODO, move the log logic
 // logSkippedDeps logs any dependencies which are also skipped as a result of
 // skipping a transaction while generating a block template at the trace level.
-func logSkippedDeps(tx *types.Tx, deps map[hash.Hash]*WeightedRandTx) {
+func logSkippedDeps(tx *types.Tx, deps map[hash.Hash]*txPrioItem) {
 	if deps == nil {
 		return
 	}
@@ -562,6 +648,66 @@ func logSkippedDeps(tx *types.Tx, deps map[hash.Hash]*WeightedRandTx) {
 	}
 }
 
+// packageTxs returns the package made of the transaction and its ancestors
+// which are not in the block yet, sorted so that each transaction comes after
+// the ones it depends on.  It returns false when one of the ancestors isn't a
+// candidate or has failed to be included.
+func packageTxs(item *txPrioItem, candidates map[hash.Hash]*txPrioItem,
+	included, failed map[hash.Hash]struct{}) ([]*txPrioItem, bool) {
+
+	var pkg []*txPrioItem
+	visited := make(map[hash.Hash]struct{})
+	var visit func(item *txPrioItem) bool
+	visit = func(item *txPrioItem) bool {
+		visited[*item.tx.Hash()] = struct{}{}
+		for h := range item.dependsOn {
+			if _, ok := included[h]; ok {
+				continue
+			}
+			if _, ok := visited[h]; ok {
+				continue
+			}
+			ancestor, ok := candidates[h]
+			if !ok {
+				return false
+			}
+			if _, ok := failed[h]; ok {
+				return false
+			}
+			if !visit(ancestor) {
+				return false
+			}
+		}
+		pkg = append(pkg, item)
+		return true
+	}
+	if !visit(item) {
+		return nil, false
+	}
+	return pkg, true
+}
+
+// descendantItems returns the transactions which depend on the passed one,
+// directly or not.
+func descendantItems(item *txPrioItem,
+	dependers map[hash.Hash]map[hash.Hash]*txPrioItem) map[hash.Hash]*txPrioItem {
+
+	descendants := make(map[hash.Hash]*txPrioItem)
+	queue := []*txPrioItem{item}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		for h, desc := range dependers[*next.tx.Hash()] {
+			if _, ok := descendants[h]; ok {
+				continue
+			}
+			descendants[h] = desc
+			queue = append(queue, desc)
+		}
+	}
+	return descendants
+}
+
 // spendTransaction updates the passed view by marking the inputs to the passed
 // transaction as spent.  It also adds all outputs in the passed transaction
 // which are not provably unspendable as available unspent transaction outputs.
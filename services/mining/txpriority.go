@@ -4,8 +4,15 @@ import (
 	"container/heap"
 	"github.com/Qitmeer/qitmeer/common/hash"
 	"github.com/Qitmeer/qitmeer/core/types"
+	"math"
 )
 
+// feeBandRatio is the ratio between the fees per kilobyte of the packages in
+// two consecutive fee bands.  The packages of the same band are picked in a
+// random order, so that the miners of parallel blocks don't all pick the same
+// transactions.
+const feeBandRatio = 1.1
+
 // txPrioItem houses a transaction along with extra information that allows the
 // transaction to be prioritized and track dependencies on other transactions
 // which have not been mined into a block yet.
@@ -20,6 +27,37 @@ type txPrioItem struct {
 	// transactions in the source pool and hence must come after them in
 	// a block.
 	dependsOn map[hash.Hash]struct{}
+
+	// ancestorFee and ancestorSize are the total fee and size of the
+	// package made of the transaction and its ancestors which are not in
+	// the block yet.
+	ancestorFee  int64
+	ancestorSize int64
+
+	// rank orders the packages of the same fee band, it is drawn at random
+	// for each block template.
+	rank int64
+
+	// index is the index of the item in the priority queue, or -1 once it
+	// has been removed from it.
+	index int
+}
+
+// packageFeePerKB returns the fee per kilobyte of the package made of the
+// transaction and its ancestors which are not in the block yet.
+func (item *txPrioItem) packageFeePerKB() int64 {
+	return item.ancestorFee * kilobyte / item.ancestorSize
+}
+
+// feeBand returns the fee band of the package of the transaction.  The fees
+// per kilobyte of the packages of a band are within feeBandRatio of each
+// other.
+func (item *txPrioItem) feeBand() int {
+	feePerKB := item.packageFeePerKB()
+	if feePerKB <= 0 {
+		return 0
+	}
+	return 1 + int(math.Log(float64(feePerKB))/math.Log(feeBandRatio))
 }
 
 // txPriorityQueueLessFunc describes a function that can be used as a compare
@@ -50,12 +88,16 @@ func (pq *txPriorityQueue) Less(i, j int) bool {
 // part of the heap.Interface implementation.
 func (pq *txPriorityQueue) Swap(i, j int) {
 	pq.items[i], pq.items[j] = pq.items[j], pq.items[i]
+	pq.items[i].index = i
+	pq.items[j].index = j
 }
 
 // Push pushes the passed item onto the priority queue.  It is part of the
 // heap.Interface implementation.
 func (pq *txPriorityQueue) Push(x interface{}) {
-	pq.items = append(pq.items, x.(*txPrioItem))
+	item := x.(*txPrioItem)
+	item.index = len(pq.items)
+	pq.items = append(pq.items, item)
 }
 
 // Pop removes the highest priority item (according to Less) from the priority
@@ -65,6 +107,7 @@ func (pq *txPriorityQueue) Pop() interface{} {
 	item := pq.items[n-1]
 	pq.items[n-1] = nil
 	pq.items = pq.items[0 : n-1]
+	item.index = -1
 	return item
 }
 
@@ -113,3 +156,19 @@ func txPQByPriority(pq *txPriorityQueue, i, j int) bool {
 	return pq.items[i].priority > pq.items[j].priority
 
 }
+
+// txPQByPackageFee sorts a txPriorityQueue by the fee bands of the packages
+// made of the transactions and their ancestors, followed by their random rank.
+// A transaction paying a high fee thus helps its low-fee ancestors to be mined
+// (child-pays-for-parent), while the packages paying similar fees are picked
+// in a random order.
+func txPQByPackageFee(pq *txPriorityQueue, i, j int) bool {
+	// Using > here so that pop gives the highest fee package as opposed
+	// to the lowest.
+	bandI := pq.items[i].feeBand()
+	bandJ := pq.items[j].feeBand()
+	if bandI == bandJ {
+		return pq.items[i].rank > pq.items[j].rank
+	}
+	return bandI > bandJ
+}
@@ -0,0 +1,101 @@
+package mining
+
+import (
+	"container/heap"
+	"testing"
+
+	"github.com/Qitmeer/qitmeer/common/hash"
+	"github.com/Qitmeer/qitmeer/core/types"
+)
+
+func TestPackageFeeOrder(t *testing.T) {
+	newItem := func(version uint32, fee int64, parents ...*txPrioItem) *txPrioItem {
+		tx := types.NewTransaction()
+		tx.Version = version
+		tx.AddTxOut(types.NewTxOutput(1, []byte{0x51}))
+		item := &txPrioItem{tx: types.NewTx(tx), fee: fee}
+		item.ancestorFee = fee
+		item.ancestorSize = int64(tx.SerializeSize())
+		for _, p := range parents {
+			if item.dependsOn == nil {
+				item.dependsOn = make(map[hash.Hash]struct{})
+			}
+			item.dependsOn[*p.tx.Hash()] = struct{}{}
+			item.ancestorFee += p.ancestorFee
+			item.ancestorSize += p.ancestorSize
+		}
+		return item
+	}
+
+	// A low fee parent with a high fee child beats a medium fee tx.
+	parent := newItem(1, 100)
+	child := newItem(2, 10000, parent)
+	other := newItem(3, 3000)
+	candidates := map[hash.Hash]*txPrioItem{}
+	pq := newTxPriorityQueue(3, txPQByPackageFee)
+	for _, item := range []*txPrioItem{parent, child, other} {
+		candidates[*item.tx.Hash()] = item
+		heap.Push(pq, item)
+	}
+
+	best := heap.Pop(pq).(*txPrioItem)
+	if best != child {
+		t.Fatalf("expected the child package first")
+	}
+	pkg, ok := packageTxs(best, candidates, map[hash.Hash]struct{}{},
+		map[hash.Hash]struct{}{})
+	if !ok || len(pkg) != 2 || pkg[0] != parent || pkg[1] != child {
+		t.Fatalf("unexpected package %v", pkg)
+	}
+
+	// The package can't be included without its ancestor.
+	delete(candidates, *parent.tx.Hash())
+	if _, ok := packageTxs(child, candidates, map[hash.Hash]struct{}{},
+		map[hash.Hash]struct{}{}); ok {
+		t.Fatal("package without its ancestor accepted")
+	}
+}
+
+func TestPackageFeeBands(t *testing.T) {
+	newItem := func(version uint32, fee int64, rank int64) *txPrioItem {
+		tx := types.NewTransaction()
+		tx.Version = version
+		tx.AddTxOut(types.NewTxOutput(1, []byte{0x51}))
+		return &txPrioItem{tx: types.NewTx(tx), fee: fee, ancestorFee: fee,
+			ancestorSize: kilobyte, rank: rank}
+	}
+
+	// The packages paying similar fees are ordered by their rank.
+	low := newItem(1, 10000, 3)
+	high := newItem(2, 10300, 1)
+	other := newItem(3, 20000, 2)
+	if low.feeBand() != high.feeBand() || low.feeBand() == other.feeBand() {
+		t.Fatalf("unexpected fee bands %d, %d and %d", low.feeBand(),
+			high.feeBand(), other.feeBand())
+	}
+	pq := newTxPriorityQueue(3, txPQByPackageFee)
+	for _, item := range []*txPrioItem{low, high, other} {
+		heap.Push(pq, item)
+	}
+	for i, item := range pq.items {
+		if item.index != i {
+			t.Fatalf("item %d has index %d", i, item.index)
+		}
+	}
+	for i, expected := range []*txPrioItem{other, low, high} {
+		item := heap.Pop(pq).(*txPrioItem)
+		if item != expected || item.index != -1 {
+			t.Fatalf("unexpected item %d", i)
+		}
+	}
+
+	// The queue is fixed when the package of an item changes.
+	for _, item := range []*txPrioItem{low, high, other} {
+		heap.Push(pq, item)
+	}
+	high.ancestorFee *= 4
+	heap.Fix(pq, high.index)
+	if item := heap.Pop(pq).(*txPrioItem); item != high {
+		t.Fatal("the increased package fee was not taken into account")
+	}
+}
@@ -1,6 +1,7 @@
 package notifymgr
 
 import (
+	"github.com/Qitmeer/qitmeer/core/json"
 	"github.com/Qitmeer/qitmeer/core/message"
 	"github.com/Qitmeer/qitmeer/core/types"
 	"github.com/Qitmeer/qitmeer/p2p/peerserver"
@@ -29,10 +30,15 @@ func (ntmgr *NotifyMgr) AnnounceNewTransactions(newTxs []*types.TxDesc) {
 		ntmgr.RelayInventory(iv, tx)
 		// reply to rpc
 		if ntmgr.RpcServer != nil {
-			//TODO reply to rpc layer (if websockect long connection or gbt long poll)
 			// Notify websocket clients about mempool transactions.
-			//qitmeer.node.rpcServer.ntfnMgr.NotifyMempoolTx(tx, true)
-			//
+			ntmgr.RpcServer.NotifyNewTransaction(&json.NewTxNtfn{
+				Txid:     tx.Tx.Hash().String(),
+				Size:     tx.Tx.Transaction().SerializeSize(),
+				Fee:      tx.Fee,
+				FeePerKB: tx.FeePerKB,
+				Time:     tx.Added.Unix(),
+			})
+			//TODO reply to gbt long poll
 			// Potentially notify any getblocktemplate long poll clients
 			// about stale block templates due to the new transaction.
 			//qitmeer.node.rpcServer.gbtWorkState.NotifyMempoolTx(
@@ -50,3 +56,27 @@ func (ntmgr *NotifyMgr) RelayInventory(invVect *message.InvVect, data interface{
 func (ntmgr *NotifyMgr) BroadcastMessage(msg message.Message) {
 	ntmgr.Server.BroadcastMessage(msg)
 }
+
+// NotifyBlockConnected notifies websocket clients about the block which has
+// been connected to the DAG.
+func (ntmgr *NotifyMgr) NotifyBlockConnected(ntfn *json.NewBlockNtfn) {
+	if ntmgr.RpcServer != nil {
+		ntmgr.RpcServer.NotifyNewBlock(ntfn)
+	}
+}
+
+// NotifyReorganization notifies websocket clients about the blocks whose
+// order has been changed by a new block.
+func (ntmgr *NotifyMgr) NotifyReorganization(ntfn *json.OrderChangeNtfn) {
+	if ntmgr.RpcServer != nil {
+		ntmgr.RpcServer.NotifyOrderChange(ntfn)
+	}
+}
+
+// NotifyTxReplaced notifies websocket clients about the transactions which
+// have been replaced by fee in the mempool.
+func (ntmgr *NotifyMgr) NotifyTxReplaced(ntfn *json.TxReplacedNtfn) {
+	if ntmgr.RpcServer != nil {
+		ntmgr.RpcServer.NotifyTxReplaced(ntfn)
+	}
+}
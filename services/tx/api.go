@@ -273,6 +273,9 @@ func (api *PublicTxAPI) GetRawTransaction(txHash hash.Hash, verbose bool) (inter
 			txBytes, err = dbTx.FetchBlockRegion(blockRegion)
 			return err
 		})
+		if database.IsError(err, database.ErrBlockPruned) {
+			return nil, rpc.RpcBlockPrunedError(&txHash, blockRegion.Hash)
+		}
 		if err != nil {
 			return nil, rpc.RpcNoTxInfoError(&txHash)
 		}
@@ -458,6 +461,87 @@ func (api *PublicTxAPI) GetUtxo(txHash hash.Hash, vout uint32, includeMempool *b
 	return txOutReply, nil
 }
 
+// GetSpendingTx returns the transaction input which spent the output, looking
+// into the mempool first unless it is excluded.  It returns null when the
+// output isn't spent.
+func (api *PublicTxAPI) GetSpendingTx(txHash hash.Hash, vout uint32, includeMempool *bool) (interface{}, error) {
+	spendIndex := api.txManager.spendIndex
+	if spendIndex == nil {
+		return nil, fmt.Errorf("Spend index must be enabled (--spendindex)")
+	}
+	outpoint := types.NewOutPoint(&txHash, vout)
+
+	if includeMempool == nil || *includeMempool {
+		tx, inIndex := api.txManager.txMemPool.FetchSpendingTx(outpoint)
+		if tx != nil {
+			return &json.GetSpendingTxResult{
+				TxId: tx.Hash().String(),
+				Vin:  inIndex,
+			}, nil
+		}
+	}
+
+	entry, err := spendIndex.SpendingTx(outpoint)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Failed to fetch spending tx")
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var confirmations int64
+	bc := api.txManager.bm.GetChain()
+	block := bc.BlockDAG().GetBlock(&entry.BlockHash)
+	if block != nil {
+		best := bc.BestSnapshot()
+		confirmations = int64(best.GraphState.GetLayer() - block.GetLayer())
+	}
+	return &json.GetSpendingTxResult{
+		TxId:          entry.TxId.String(),
+		Vin:           entry.InIndex,
+		BlockHash:     entry.BlockHash.String(),
+		Confirmations: confirmations,
+	}, nil
+}
+
+// GetTxConfirmationRisk returns the probability that the transaction is
+// reversed according to the SPECTRE risk model of the block including it.  A
+// transaction still in the mempool is not confirmed at all.
+func (api *PublicTxAPI) GetTxConfirmationRisk(txHash hash.Hash, alpha *float64) (interface{}, error) {
+	a := blockchain.DefaultRiskAlpha
+	if alpha != nil {
+		a = *alpha
+	}
+	if a <= 0 || a >= 0.5 {
+		return nil, rpc.RpcInvalidError("attacker power %v is not in (0, 0.5)", a)
+	}
+
+	if tx, _ := api.txManager.txMemPool.FetchTransaction(&txHash); tx != nil {
+		return &json.ConfirmationRiskResult{
+			TxId:  txHash.String(),
+			Alpha: a,
+			Risk:  1,
+		}, nil
+	}
+	txIndex := api.txManager.txIndex
+	if txIndex == nil {
+		return nil, fmt.Errorf("the transaction index " +
+			"must be enabled to query the blockchain (specify --txindex in configuration)")
+	}
+	blockRegion, err := txIndex.TxBlockRegion(txHash)
+	if err != nil {
+		return nil, errors.New("Failed to retrieve transaction location")
+	}
+	if blockRegion == nil {
+		return nil, rpc.RpcNoTxInfoError(&txHash)
+	}
+	risk, err := api.txManager.bm.GetChain().BlockConfirmationRisk(blockRegion.Hash, a)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Failed to calculate confirmation risk")
+	}
+	return marshal.MarshalJsonConfirmationRisk(risk, txHash.String()), nil
+}
+
 // handleSearchRawTransactions implements the searchrawtransactions command.
 func (api *PublicTxAPI) GetRawTransactions(addre string, vinext *bool, count *uint, skip *uint, revers *bool, verbose *bool, filterAddrs *[]string) (interface{}, error) {
 	addrIndex := api.txManager.addrIndex
@@ -843,6 +927,9 @@ func (api *PublicTxAPI) fetchInputTxos(tx *message.MsgTx) (map[types.TxOutPoint]
 			txBytes, err = dbTx.FetchBlockRegion(blockRegion)
 			return err
 		})
+		if database.IsError(err, database.ErrBlockPruned) {
+			return nil, rpc.RpcBlockPrunedError(&origin.Hash, blockRegion.Hash)
+		}
 		if err != nil {
 			return nil, rpc.RpcNoTxInfoError(&origin.Hash)
 		}
@@ -899,6 +986,32 @@ func NewPrivateTxAPI(tm *TxManager) *PrivateTxAPI {
 	return &ptapi
 }
 
+// SaveMempool writes the transactions of the mempool to the mempool file in
+// the data directory.
+func (api *PrivateTxAPI) SaveMempool() (interface{}, error) {
+	fileName := api.txManager.mempoolFile
+	size, err := api.txManager.txMemPool.Save(fileName)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Unable to save mempool")
+	}
+	return &json.SaveMempoolResult{FileName: fileName, Size: size}, nil
+}
+
+// LoadMempool processes the transactions of the mempool file in the data
+// directory again and adds the valid ones to the mempool.
+func (api *PrivateTxAPI) LoadMempool() (interface{}, error) {
+	fileName := api.txManager.mempoolFile
+	accepted, failed, err := api.txManager.txMemPool.Load(fileName)
+	if err != nil {
+		return nil, rpc.RpcInternalError(err.Error(), "Unable to load mempool")
+	}
+	return &json.LoadMempoolResult{
+		FileName: fileName,
+		Accepted: accepted,
+		Failed:   failed,
+	}, nil
+}
+
 func (api *PrivateTxAPI) TxSign(privkeyStr string, rawTxStr string) (interface{}, error) {
 	privkeyByte, err := hex.DecodeString(privkeyStr)
 	if err != nil {
@@ -963,6 +1076,9 @@ func (api *PrivateTxAPI) TxSign(privkeyStr string, rawTxStr string) (interface{}
 			txBytes, err = dbTx.FetchBlockRegion(blockRegion)
 			return err
 		})
+		if database.IsError(err, database.ErrBlockPruned) {
+			return nil, rpc.RpcBlockPrunedError(&txHash, blockRegion.Hash)
+		}
 		if err != nil {
 			return nil, rpc.RpcNoTxInfoError(&txHash)
 		}
@@ -13,6 +13,8 @@ import (
 	"github.com/Qitmeer/qitmeer/services/common"
 	"github.com/Qitmeer/qitmeer/services/index"
 	"github.com/Qitmeer/qitmeer/services/mempool"
+	"os"
+	"path/filepath"
 	"time"
 )
 
@@ -23,6 +25,9 @@ type TxManager struct {
 
 	// addr index
 	addrIndex *index.AddrIndex
+
+	// spend index
+	spendIndex *index.SpendIndex
 	// mempool hold tx that need to be mined into blocks and relayed to other peers.
 	txMemPool *mempool.TxPool
 
@@ -34,25 +39,89 @@ type TxManager struct {
 
 	//invalidTx hash->block hash
 	invalidTx map[hash.Hash]*blockdag.HashSet
+
+	// fee estimator records the confirmation of the mempool transactions
+	feeEstimator *mempool.FeeEstimator
+
+	// mempoolFile is the file the mempool is saved to on shutdown and
+	// loaded from on startup.
+	mempoolFile string
 }
 
 func (tm *TxManager) Start() error {
 	log.Info("Starting tx manager")
+
+	// Load the transactions saved on the last shutdown.
+	accepted, failed, err := tm.txMemPool.Load(tm.mempoolFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Error("Failed to load mempool", "file", tm.mempoolFile, "error", err)
+		}
+		return nil
+	}
+	log.Info("Loaded mempool", "accepted", accepted, "failed", failed)
 	return nil
 }
 
 func (tm *TxManager) Stop() error {
 	log.Info("Stopping tx manager")
-	return nil
+
+	// Save the mempool so that it is loaded again on startup.
+	saved, err := tm.txMemPool.Save(tm.mempoolFile)
+	if err != nil {
+		log.Error("Failed to save mempool", "file", tm.mempoolFile, "error", err)
+	} else {
+		log.Info("Saved mempool", "transactions", saved)
+	}
+
+	// Save fee estimator state in the database.
+	return tm.db.Update(func(dbTx database.Tx) error {
+		return dbTx.Metadata().Put(mempool.EstimateFeeDatabaseKey, tm.feeEstimator.Save())
+	})
 }
 
 func (tm *TxManager) MemPool() blkmgr.TxPool {
 	return tm.txMemPool
 }
 
+func (tm *TxManager) FeeEstimator() *mempool.FeeEstimator {
+	return tm.feeEstimator
+}
+
+// loadFeeEstimator restores the fee estimator saved in the database, or
+// creates a new one when there is none or it is behind the DAG.
+func loadFeeEstimator(db database.DB, mainOrder uint) *mempool.FeeEstimator {
+	var feeEstimator *mempool.FeeEstimator
+	db.Update(func(dbTx database.Tx) error {
+		metadata := dbTx.Metadata()
+		feeEstimationData := metadata.Get(mempool.EstimateFeeDatabaseKey)
+		if feeEstimationData != nil {
+			// Delete it from the database so that we don't try to
+			// restore the same thing again somehow.
+			metadata.Delete(mempool.EstimateFeeDatabaseKey)
+
+			var err error
+			feeEstimator, err = mempool.RestoreFeeEstimator(feeEstimationData)
+			if err != nil {
+				log.Error("Failed to restore fee estimator", "error", err)
+			}
+		}
+		return nil
+	})
+
+	if feeEstimator == nil || feeEstimator.LastKnownOrder() != uint64(mainOrder) {
+		feeEstimator = mempool.NewFeeEstimator(
+			mempool.DefaultEstimateFeeMaxRollback,
+			mempool.DefaultEstimateFeeMinRegisteredBlocks)
+	}
+	return feeEstimator
+}
+
 func NewTxManager(bm *blkmgr.BlockManager, txIndex *index.TxIndex,
-	addrIndex *index.AddrIndex, cfg *config.Config, ntmgr notify.Notify,
+	addrIndex *index.AddrIndex, spendIndex *index.SpendIndex, cfg *config.Config, ntmgr notify.Notify,
 	sigCache *txscript.SigCache, db database.DB) (*TxManager, error) {
+	feeEstimator := loadFeeEstimator(db, bm.GetChain().BestSnapshot().GraphState.GetMainOrder())
+
 	// mem-pool
 	txC := mempool.Config{
 		Policy: mempool.Policy{
@@ -64,6 +133,10 @@ func NewTxManager(bm *blkmgr.BlockManager, txIndex *index.TxIndex,
 			MaxOrphanTxSize:      mempool.DefaultMaxOrphanTxSize,
 			MaxSigOpsPerTx:       blockchain.MaxSigOpsPerBlock / 5,
 			MinRelayTxFee:        types.Amount(cfg.MinTxFee),
+			RejectReplacement:    cfg.RejectReplacement,
+			MaxAncestorCount:     mempool.DefaultMaxAncestorCount,
+			MaxAncestorSize:      mempool.DefaultMaxAncestorSize,
+			MaxPoolSize:          cfg.MaxMempool * 1000 * 1000,
 			StandardVerifyFlags: func() (txscript.ScriptFlags, error) {
 				return common.StandardScriptVerifyFlags()
 			},
@@ -80,8 +153,12 @@ func NewTxManager(bm *blkmgr.BlockManager, txIndex *index.TxIndex,
 		AddrIndex:        addrIndex,
 		BD:               bm.GetChain().BlockDAG(),
 		BC:               bm.GetChain(),
+		FeeEstimator:     feeEstimator,
+		TxReplaced:       bm.TxReplaced,
 	}
 	txMemPool := mempool.New(&txC)
 	invalidTx := make(map[hash.Hash]*blockdag.HashSet)
-	return &TxManager{bm, txIndex, addrIndex, txMemPool, ntmgr, db, invalidTx}, nil
+	mempoolFile := filepath.Join(cfg.DataDir, mempool.MempoolFileName)
+	return &TxManager{bm, txIndex, addrIndex, spendIndex, txMemPool, ntmgr, db, invalidTx,
+		feeEstimator, mempoolFile}, nil
 }
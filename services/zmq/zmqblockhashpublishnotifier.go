@@ -32,6 +32,10 @@ func (zp *ZMQBlockHashPublishNotifier) NotifyTransaction(txs []*types.Tx) error
 	return nil
 }
 
+func (zp *ZMQBlockHashPublishNotifier) NotifyReplacement(replacement *types.Tx, replaced []*types.Tx) error {
+	return nil
+}
+
 func (zp *ZMQBlockHashPublishNotifier) Shutdown() {
 	zp.shutdown()
 }
@@ -35,6 +35,10 @@ func (zp *ZMQBlockRawPublishNotifier) NotifyTransaction(txs []*types.Tx) error {
 	return nil
 }
 
+func (zp *ZMQBlockRawPublishNotifier) NotifyReplacement(replacement *types.Tx, replaced []*types.Tx) error {
+	return nil
+}
+
 func (zp *ZMQBlockRawPublishNotifier) Shutdown() {
 	zp.shutdown()
 }
@@ -36,6 +36,11 @@ func (zn *ZMQNotification) BlockDisconnected(block *types.SerializedBlock) {
 
 }
 
+// transactions replaced by fee
+func (zn *ZMQNotification) TxReplaced(replacement *types.Tx, replaced []*types.Tx) {
+
+}
+
 // Shutdown
 func (zn *ZMQNotification) Shutdown() {
 
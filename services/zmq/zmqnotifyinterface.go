@@ -23,6 +23,9 @@ type IZMQNotification interface {
 	// block connected
 	BlockDisconnected(block *types.SerializedBlock)
 
+	// transactions replaced by fee in the mempool
+	TxReplaced(replacement *types.Tx, replaced []*types.Tx)
+
 	// Shutdown
 	Shutdown()
 }
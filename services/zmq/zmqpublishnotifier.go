@@ -15,16 +15,21 @@ const (
 	TxHash    = "TxHash"
 	TxRaw     = "TxRaw"
 
+	TxReplacedHash = "TxReplacedHash"
+
 	defaultBlockHashEndpoint = "tcp://*:8230"
 	defaultBlockRawEndpoint  = "tcp://*:8231"
 	defaultTxHashEndpoint    = "tcp://*:8232"
 	defaultTxRawEndpoint     = "tcp://*:8233"
+
+	defaultTxReplacedHashEndpoint = "tcp://*:8234"
 )
 
 type IZMQPublishNotifier interface {
 	Init(cfg *config.Config) error
 	NotifyBlock(block *types.SerializedBlock) error
 	NotifyTransaction(transaction []*types.Tx) error
+	NotifyReplacement(replacement *types.Tx, replaced []*types.Tx) error
 	Shutdown()
 }
 
@@ -83,6 +88,8 @@ func NewZMQPublishNotifier(cfg *config.Config, notifierType string) IZMQPublishN
 		zmq = &ZMQTxHashPublishNotifier{&ZMQPublishNotifier{name: notifierType}}
 	case TxRaw:
 		zmq = &ZMQTxRawPublishNotifier{&ZMQPublishNotifier{name: notifierType}}
+	case TxReplacedHash:
+		zmq = &ZMQTxReplacedHashPublishNotifier{&ZMQPublishNotifier{name: notifierType}}
 	}
 	if zmq == nil {
 		return nil
@@ -0,0 +1,53 @@
+// +build zmq
+
+package zmq
+
+import (
+	"fmt"
+	"github.com/Qitmeer/qitmeer/config"
+	"github.com/Qitmeer/qitmeer/core/types"
+)
+
+// ZMQTxReplacedHashPublishNotifier publishes the replacements by fee in the
+// mempool as one message: the hash of the replacement followed by the hashes
+// of the transactions it replaced.
+type ZMQTxReplacedHashPublishNotifier struct {
+	*ZMQPublishNotifier
+}
+
+func (zp *ZMQTxReplacedHashPublishNotifier) Init(cfg *config.Config) error {
+	if len(cfg.Zmqpubhashreplacedtx) <= 0 {
+		return fmt.Errorf("No config")
+	}
+	if cfg.Zmqpubhashreplacedtx == "default" || cfg.Zmqpubhashreplacedtx == "*" {
+		cfg.Zmqpubhashreplacedtx = defaultTxReplacedHashEndpoint
+	}
+	return zp.initialization(cfg.Zmqpubhashreplacedtx)
+}
+
+func (zp *ZMQTxReplacedHashPublishNotifier) NotifyBlock(block *types.SerializedBlock) error {
+	return nil
+}
+
+func (zp *ZMQTxReplacedHashPublishNotifier) NotifyTransaction(txs []*types.Tx) error {
+	return nil
+}
+
+func (zp *ZMQTxReplacedHashPublishNotifier) NotifyReplacement(replacement *types.Tx, replaced []*types.Tx) error {
+	err := zp.sendMessage(replacement.Hash().Bytes(), len(replaced) > 0)
+	if err != nil {
+		return err
+	}
+	txsLen := len(replaced) - 1
+	for k, transaction := range replaced {
+		err := zp.sendMessage(transaction.Hash().Bytes(), k < txsLen)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (zp *ZMQTxReplacedHashPublishNotifier) Shutdown() {
+	zp.shutdown()
+}